@@ -0,0 +1,96 @@
+package billingservice
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/yongkaiyu/CNAD_Assg1/internal/clients"
+)
+
+// CancellationPolicy sets how much of a bill is refunded when its booking is cancelled, by how
+// long before the start it is cancelled. Cancelling at least FullRefundBefore ahead refunds
+// everything, at least PartialRefundBefore ahead refunds PartialRefundPercentage, and any
+// later nothing.
+type CancellationPolicy struct {
+	MembershipTier          string        `json:"membership_tier"`
+	FullRefundBefore        time.Duration `json:"full_refund_before"`
+	PartialRefundBefore     time.Duration `json:"partial_refund_before"`
+	PartialRefundPercentage float64       `json:"partial_refund_percentage"`
+}
+
+// Refund is money given back on a bill. GatewayReference is the payment it was returned to,
+// empty when the bill hadn't been paid and the refund only lowers what is owed. Refunds
+// through the gateway are Pending until the gateway has made them.
+type Refund struct {
+	RefundID         int       `json:"refund_id"`
+	BillingID        int       `json:"billing_id"`
+	Kind             string    `json:"kind"`
+	Status           string    `json:"status"`
+	Amount           float64   `json:"amount"`
+	Percentage       float64   `json:"percentage"`
+	Reason           string    `json:"reason"`
+	GatewayReference string    `json:"-"`
+	CreatedAt        time.Time `json:"created_at"`
+}
+
+// What a refund was for
+const (
+	RefundKindCancellation = "Cancellation"
+	RefundKindRepricing    = "Repricing"
+	RefundKindCreditNote   = "Credit Note"
+	// Made through the gateway directly, such as from its dashboard
+	RefundKindGateway = "Gateway"
+)
+
+const (
+	RefundStatusPending   = "Pending"
+	RefundStatusCompleted = "Completed"
+)
+
+// The percentage of the bill refunded when cancelling with the given notice before the start
+func (p CancellationPolicy) refundPercentage(notice time.Duration) float64 {
+	switch {
+	case notice >= p.FullRefundBefore:
+		return 100
+	case notice >= p.PartialRefundBefore:
+		return p.PartialRefundPercentage
+	}
+	return 0
+}
+
+// The cancellation policy of a user's membership tier, or the configured one if the tier
+// has none
+func (s *Server) cancellationPolicy(ctx context.Context, userID int) (CancellationPolicy, error) {
+	membership, err := s.users.GetMembership(ctx, userID)
+	if err != nil {
+		if clients.IsNotFound(err) {
+			return CancellationPolicy{}, errMembershipNotFound
+		}
+		return CancellationPolicy{}, err
+	}
+
+	policy, err := s.store.CancellationPolicies().Get(ctx, membership.Tier)
+	if err != nil {
+		if errors.Is(err, errCancellationPolicyNotFound) {
+			return CancellationPolicy{
+				MembershipTier:          membership.Tier,
+				FullRefundBefore:        s.pricing.FullRefundBefore,
+				PartialRefundBefore:     s.pricing.PartialRefundBefore,
+				PartialRefundPercentage: s.pricing.PartialRefundPercentage,
+			}, nil
+		}
+		return CancellationPolicy{}, err
+	}
+	return *policy, nil
+}
+
+// Why a cancellation was refunded what it was, for the refund record
+func refundReason(policy CancellationPolicy, notice time.Duration, percentage float64) string {
+	if notice < 0 {
+		notice = 0
+	}
+	return fmt.Sprintf("Cancelled %s before the start, %g%% refund under the %s cancellation policy",
+		notice.Truncate(time.Minute), percentage, policy.MembershipTier)
+}
@@ -0,0 +1,105 @@
+package billingservice
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/yongkaiyu/CNAD_Assg1/internal/auth"
+)
+
+/* Billing Service Handlers */
+
+// FetchBillingHandler retrieves billing information.
+func (s *Server) fetchBillingHandler(w http.ResponseWriter, r *http.Request) {
+	userID := auth.UserID(r)
+
+	bills, err := s.store.Bills().ListByUser(r.Context(), userID)
+	if err != nil {
+		http.Error(w, "Failed to fetch billing information", http.StatusInternalServerError)
+		log.Printf("Error querying database: %v", err)
+		return
+	}
+
+	var billings []map[string]interface{}
+	for _, bill := range bills {
+		billingID := strconv.Itoa(bill.BillingID)
+		bookingID := strconv.Itoa(bill.BookingID)
+		formattedCreatedAt := bill.CreatedAt.Format(timeLayout)
+		formattedUpdatedAt := bill.UpdatedAt.Format(timeLayout)
+
+		// Log the billing details
+		log.Printf("Billing ID: %s, Booking ID: %s, Payment Status: %s, Payment Method: %s, Total Amount: %.2f, Created At: %s, Updated At: %s",
+			billingID, bookingID, bill.PaymentStatus, bill.PaymentMethod, bill.TotalAmount, formattedCreatedAt, formattedUpdatedAt)
+
+		billing := map[string]interface{}{
+			"billing_id":      billingID,
+			"booking_id":      bookingID,
+			"payment_status":  bill.PaymentStatus,
+			"payment_method":  bill.PaymentMethod,
+			"total_amount":    bill.TotalAmount,
+			"refunded_amount": bill.RefundedAmount,
+			"amount_paid":     bill.AmountPaid,
+			"amount_due":      bill.amountDue(),
+			"created_at":      formattedCreatedAt,
+			"updated_at":      formattedUpdatedAt,
+		}
+
+		billings = append(billings, billing)
+	}
+
+	if len(billings) == 0 {
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode([]map[string]interface{}{})
+		return
+	}
+
+	// Set content-type to application/json
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(billings)
+}
+
+// The invoice of a completed rental with any credit notes against it
+func (s *Server) rentalInvoiceHandler(w http.ResponseWriter, r *http.Request) {
+	// Get the booking ID from the query parameters
+	bookingID, err := strconv.Atoi(r.URL.Query().Get("booking_id"))
+	if err != nil {
+		http.Error(w, "Booking ID is required", http.StatusBadRequest)
+		return
+	}
+
+	// The bill is only found if it belongs to the caller
+	bill, err := s.store.Bills().GetByBooking(r.Context(), bookingID)
+	if err == nil && bill.UserID != auth.UserID(r) {
+		err = errBillNotFound
+	}
+	if err != nil {
+		if errors.Is(err, errBillNotFound) {
+			http.Error(w, "Booking not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Error retrieving booking data", http.StatusInternalServerError)
+		return
+	}
+
+	documents, err := s.store.Invoices().ForBilling(r.Context(), bill.BillingID)
+	if err != nil {
+		log.Printf("Error fetching invoices of bill %d: %v", bill.BillingID, err)
+		http.Error(w, "Error retrieving invoice", http.StatusInternalServerError)
+		return
+	}
+
+	// Invoices are issued once the trip has ended and been billed
+	response, found := newInvoiceResponse(documents)
+	if !found {
+		http.Error(w, "This rental hasn't been invoiced yet", http.StatusNotFound)
+		return
+	}
+	// A late fee on a bill paid up front is still to pay
+	response.AmountPaid, response.AmountDue = bill.AmountPaid, bill.amountDue()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
@@ -0,0 +1,456 @@
+package billingservice
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/yongkaiyu/CNAD_Assg1/internal/clients"
+)
+
+/* Internal endpoints called by the user and vehicle services */
+
+func billInfo(bill Billing) clients.BillInfo {
+	return clients.BillInfo{
+		BillingID:      bill.BillingID,
+		BookingID:      bill.BookingID,
+		UserID:         bill.UserID,
+		PaymentStatus:  bill.PaymentStatus,
+		PaymentMethod:  bill.PaymentMethod,
+		TotalAmount:    bill.TotalAmount,
+		RefundedAmount: bill.RefundedAmount,
+		AmountPaid:     bill.AmountPaid,
+		AmountDue:      bill.amountDue(),
+		CreatedAt:      bill.CreatedAt.Format(timeLayout),
+		UpdatedAt:      bill.UpdatedAt.Format(timeLayout),
+	}
+}
+
+// Keep how the bill was priced, item by item and its tax, for its invoice
+func (s *Server) recordPricing(ctx context.Context, bills BillStore, bill Billing, quote *PriceQuote) error {
+	if err := bills.ReplaceLineItems(ctx, bill.BillingID, pricingLineItems, s.quoteLineItems(*quote)); err != nil {
+		return err
+	}
+	return bills.SetTax(ctx, bill.BookingID, quote.TaxRate, quote.Tax)
+}
+
+func writeBillResponse(w http.ResponseWriter, status int, bill Billing, quote *PriceQuote) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"bill":  billInfo(bill),
+		"quote": quote,
+	})
+}
+
+// Price a booking window for another service without billing it
+func (s *Server) internalQuoteHandler(w http.ResponseWriter, r *http.Request) {
+	var input clients.BillRequest
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil || input.UserID == 0 {
+		http.Error(w, "Invalid input", http.StatusBadRequest)
+		return
+	}
+
+	quote, err := s.calculateQuote(r.Context(), quoteRequest{
+		UserID:    input.UserID,
+		VehicleID: input.VehicleID,
+		StartTime: input.StartTime,
+		EndTime:   input.EndTime,
+		PromoCode: input.PromoCode,
+	})
+	if err != nil {
+		writeQuoteError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(quote)
+}
+
+// Price a new booking and create its pending bill
+func (s *Server) createBillHandler(w http.ResponseWriter, r *http.Request) {
+	var input clients.BillRequest
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil || input.BookingID == 0 || input.UserID == 0 {
+		http.Error(w, "Invalid input", http.StatusBadRequest)
+		return
+	}
+
+	req := quoteRequest{
+		UserID:    input.UserID,
+		VehicleID: input.VehicleID,
+		StartTime: input.StartTime,
+		EndTime:   input.EndTime,
+		PromoCode: input.PromoCode,
+	}
+	var quote *PriceQuote
+	var bill *Billing
+	for {
+		var err error
+		quote, err = s.calculateQuote(r.Context(), req)
+		if err != nil {
+			writeQuoteError(w, err)
+			return
+		}
+
+		err = s.store.InTx(r.Context(), func(bills BillStore, promotions PromotionStore, invoices InvoiceStore) error {
+			if quote.PromotionID != 0 {
+				// Check again with the promotion locked so concurrent bookings can't go over its caps
+				promotion, err := promotions.Lock(r.Context(), quote.PromotionID)
+				if err != nil {
+					return err
+				}
+				if err := s.checkPromotion(r.Context(), promotions, *promotion, input.UserID, quote); err != nil {
+					return err
+				}
+				if err := promotions.Redeem(r.Context(), Redemption{
+					PromotionID: quote.PromotionID,
+					UserID:      input.UserID,
+					BookingID:   input.BookingID,
+					Discount:    quote.PromotionDiscount,
+				}); err != nil {
+					return err
+				}
+			}
+
+			var err error
+			bill, err = bills.Create(r.Context(), input.BookingID, input.UserID, quote.Total)
+			if err != nil {
+				return err
+			}
+			return s.recordPricing(r.Context(), bills, *bill, quote)
+		})
+		var promotionErr *promotionError
+		if errors.As(err, &promotionErr) && quote.PromotionCode == "" {
+			// The user didn't ask for an automatic promotion, so one that ran out since the
+			// quote is dropped and the booking priced without it
+			log.Printf("Billing booking %d without promotion %d: %v", input.BookingID, quote.PromotionID, err)
+			req.Without = append(req.Without, quote.PromotionID)
+			continue
+		}
+		if errors.As(err, &promotionErr) {
+			http.Error(w, promotionErr.Error()+", please try again", http.StatusConflict)
+			return
+		}
+		if err != nil {
+			log.Printf("Error inserting billing entry: %v", err)
+			http.Error(w, "Error creating billing entry", http.StatusInternalServerError)
+			return
+		}
+		break
+	}
+
+	writeBillResponse(w, http.StatusCreated, *bill, quote)
+}
+
+// Reprice a booking after its window changed. The final repricing, for the trip as taken,
+// also issues the bill's invoice.
+func (s *Server) updateBillHandler(w http.ResponseWriter, r *http.Request) {
+	bookingID, err := strconv.Atoi(mux.Vars(r)["bookingId"])
+	if err != nil {
+		http.Error(w, "Invalid booking ID", http.StatusBadRequest)
+		return
+	}
+
+	var input clients.BillRequest
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil || input.UserID == 0 {
+		http.Error(w, "Invalid input", http.StatusBadRequest)
+		return
+	}
+
+	// The booking keeps the promotion it was made with, and only that one
+	var redeemed *Promotion
+	redemption, err := s.store.Promotions().ForBooking(r.Context(), bookingID)
+	if err == nil {
+		redeemed, err = s.store.Promotions().Get(r.Context(), redemption.PromotionID)
+	}
+	if err != nil && !errors.Is(err, errRedemptionNotFound) {
+		log.Printf("Error fetching promotion of booking %d: %v", bookingID, err)
+		http.Error(w, "Error updating billing entry", http.StatusInternalServerError)
+		return
+	}
+
+	quote, err := s.calculateQuote(r.Context(), quoteRequest{
+		UserID:    input.UserID,
+		VehicleID: input.VehicleID,
+		StartTime: input.StartTime,
+		EndTime:   input.EndTime,
+		Reprice:   true,
+		Redeemed:  redeemed,
+		LateAfter: input.LateAfter,
+	})
+	if err != nil {
+		writeQuoteError(w, err)
+		return
+	}
+
+	var refunds []Refund
+	var closed bool
+	err = s.store.InTx(r.Context(), func(bills BillStore, promotions PromotionStore, invoices InvoiceStore) error {
+		// Locked so a payment can't land for the old price
+		bill, err := bills.LockByBooking(r.Context(), bookingID)
+		if err != nil {
+			return err
+		}
+		if bill.PaymentStatus == PaymentStatusAuthorized {
+			return errInvalidPaymentState
+		}
+
+		// A refunded or cancelled bill stays as it is, even if the booking's window changes after
+		existing, err := bills.Refunds(r.Context(), bill.BillingID)
+		if err != nil {
+			return err
+		}
+		closed = bill.PaymentStatus == PaymentStatusRefunded
+		for _, refund := range existing {
+			closed = closed || refund.Kind == RefundKindCancellation
+		}
+		if closed {
+			return errInvalidPaymentState
+		}
+
+		// Whatever was paid beyond the new price goes back. A price that went up leaves the
+		// difference due, and the bill Pending until it is paid.
+		overpaid := math.Max(0, roundCents(bill.AmountPaid-quote.Total))
+		percentage := 100.0
+		if price := roundCents(bill.TotalAmount - bill.RefundedAmount); price > 0 {
+			percentage = math.Min(100, roundCents(overpaid/price*100))
+		}
+		refunds, err = payBack(r.Context(), bills, *bill, overpaid, Refund{
+			Kind:       RefundKindRepricing,
+			Percentage: percentage,
+			Reason:     fmt.Sprintf("Repriced from $%.2f to $%.2f", bill.TotalAmount-bill.RefundedAmount, quote.Total),
+		})
+		if err != nil {
+			return err
+		}
+
+		// The total is what was charged before any refunds, so it is the new price plus them
+		refunded := bill.RefundedAmount
+		for _, refund := range refunds {
+			refunded += refund.Amount
+		}
+		if err := bills.SetTotal(r.Context(), bookingID, roundCents(quote.Total+refunded)); err != nil {
+			return err
+		}
+		// Repricing without a late return clears any late fee charged before
+		if err := s.recordPricing(r.Context(), bills, *bill, quote); err != nil {
+			return err
+		}
+		if redeemed != nil {
+			if err := promotions.SetDiscount(r.Context(), bookingID, quote.PromotionDiscount); err != nil {
+				return err
+			}
+		}
+		if err := settleStatus(r.Context(), bills, bookingID); err != nil {
+			return err
+		}
+		if !input.Final {
+			return nil
+		}
+
+		// Invoiced as repriced, in the same transaction so a billed trip always has its invoice
+		repriced, err := bills.GetByBooking(r.Context(), bookingID)
+		if err != nil {
+			return err
+		}
+		return s.issueInvoice(r.Context(), bills, invoices, *repriced, input)
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, errBillNotFound):
+			http.Error(w, "Billing record not found", http.StatusNotFound)
+		case closed:
+			http.Error(w, "This booking's bill was cancelled or refunded and can't be repriced", http.StatusConflict)
+		case errors.Is(err, errInvalidPaymentState):
+			http.Error(w, "A payment for this booking is in progress, please try again shortly", http.StatusConflict)
+		default:
+			log.Printf("Error updating billing entry: %v", err)
+			http.Error(w, "Error updating billing entry", http.StatusInternalServerError)
+		}
+		return
+	}
+	// Only once the refunds are recorded, so money never goes out without a record of it
+	s.sendRefunds(r.Context(), refunds)
+
+	bill, err := s.store.Bills().GetByBooking(r.Context(), bookingID)
+	if err != nil {
+		log.Printf("Error fetching billing entry: %v", err)
+		http.Error(w, "Error updating billing entry", http.StatusInternalServerError)
+		return
+	}
+
+	writeBillResponse(w, http.StatusOK, *bill, quote)
+}
+
+// Refund the bill of a cancelled booking as the user's cancellation policy allows. What was
+// paid beyond what is still owed goes back through the gateway; the rest of the refund is
+// taken off what is owed. Cancelling again returns the refund already given.
+func (s *Server) cancelBillHandler(w http.ResponseWriter, r *http.Request) {
+	bookingID, err := strconv.Atoi(mux.Vars(r)["bookingId"])
+	if err != nil {
+		http.Error(w, "Invalid booking ID", http.StatusBadRequest)
+		return
+	}
+
+	var input clients.CancelRequest
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil || input.StartTime.IsZero() {
+		http.Error(w, "Invalid input", http.StatusBadRequest)
+		return
+	}
+
+	bill, err := s.store.Bills().GetByBooking(r.Context(), bookingID)
+	if err != nil {
+		if errors.Is(err, errBillNotFound) {
+			// Nothing billed means nothing to refund
+			writeCancelResult(w, clients.CancelResult{})
+			return
+		}
+		log.Printf("Error fetching bill for booking %d: %v", bookingID, err)
+		http.Error(w, "Error cancelling bill", http.StatusInternalServerError)
+		return
+	}
+
+	policy, err := s.cancellationPolicy(r.Context(), bill.UserID)
+	if err != nil {
+		writeQuoteError(w, err)
+		return
+	}
+	notice := input.StartTime.Sub(time.Now())
+	percentage := policy.refundPercentage(notice)
+
+	var result clients.CancelResult
+	var refunds []Refund
+	err = s.store.InTx(r.Context(), func(bills BillStore, promotions PromotionStore, invoices InvoiceStore) error {
+		// Lock the bill so a payment can't land while we cancel
+		bill, err := bills.LockByBooking(r.Context(), bookingID)
+		if err != nil {
+			return err
+		}
+		if bill.PaymentStatus == PaymentStatusAuthorized {
+			return errInvalidPaymentState
+		}
+
+		// Already cancelled, so hand back that refund rather than refunding twice. Any of it
+		// still pending is sent again.
+		existing, err := bills.Refunds(r.Context(), bill.BillingID)
+		if err != nil {
+			return err
+		}
+		for _, refund := range existing {
+			if refund.Kind != RefundKindCancellation {
+				continue
+			}
+			result.RefundPercentage = refund.Percentage
+			result.RefundAmount = roundCents(result.RefundAmount + refund.Amount)
+			refunds = append(refunds, refund)
+		}
+		if refunds != nil {
+			result.AmountDue = bill.amountDue()
+			return nil
+		}
+		if bill.PaymentStatus == PaymentStatusRefunded {
+			return nil
+		}
+
+		// A cancelled booking doesn't count against the promotion's caps
+		if err := promotions.Release(r.Context(), bookingID); err != nil {
+			return err
+		}
+
+		refundable := roundCents(bill.TotalAmount - bill.RefundedAmount)
+		amount := roundCents(refundable * percentage / 100)
+		result = clients.CancelResult{
+			RefundPercentage: percentage,
+			RefundAmount:     amount,
+			AmountDue:        math.Max(0, roundCents(refundable-amount-bill.AmountPaid)),
+		}
+
+		if amount > 0 {
+			refunds, err = refundBill(r.Context(), bills, *bill, amount, Refund{
+				Kind:       RefundKindCancellation,
+				Percentage: percentage,
+				Reason:     refundReason(policy, notice, percentage),
+			})
+			if err != nil {
+				return err
+			}
+		}
+		// Partly refunded bills stay Paid, or Pending for the rest
+		if amount == refundable {
+			return bills.MarkRefunded(r.Context(), bookingID)
+		}
+		return settleStatus(r.Context(), bills, bookingID)
+	})
+
+	switch {
+	case err == nil:
+		// Only once the refunds are recorded, so money never goes out without a record of it
+		s.sendRefunds(r.Context(), refunds)
+		writeCancelResult(w, result)
+	case errors.Is(err, errInvalidPaymentState):
+		http.Error(w, "A payment for this booking is in progress, please try again shortly", http.StatusConflict)
+	default:
+		log.Printf("Error cancelling bill for booking %d: %v", bookingID, err)
+		http.Error(w, "Error cancelling bill", http.StatusInternalServerError)
+	}
+}
+
+func writeCancelResult(w http.ResponseWriter, result clients.CancelResult) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+// Remove the pending bill of a booking that was rolled back
+func (s *Server) deleteBillHandler(w http.ResponseWriter, r *http.Request) {
+	bookingID, err := strconv.Atoi(mux.Vars(r)["bookingId"])
+	if err != nil {
+		http.Error(w, "Invalid booking ID", http.StatusBadRequest)
+		return
+	}
+
+	err = s.store.InTx(r.Context(), func(bills BillStore, promotions PromotionStore, invoices InvoiceStore) error {
+		if err := bills.DeletePending(r.Context(), bookingID); err != nil {
+			return err
+		}
+		return promotions.Release(r.Context(), bookingID)
+	})
+	if err != nil {
+		log.Printf("Error deleting billing record: %v", err)
+		http.Error(w, "Error deleting billing information", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Bills of one user, newest first
+func (s *Server) listBillsHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.Atoi(r.URL.Query().Get("user_id"))
+	if err != nil {
+		http.Error(w, "user_id parameter is required", http.StatusBadRequest)
+		return
+	}
+
+	bills, err := s.store.Bills().ListByUser(r.Context(), userID)
+	if err != nil {
+		log.Printf("Error fetching bills for user %d: %v", userID, err)
+		http.Error(w, "Error fetching bills", http.StatusInternalServerError)
+		return
+	}
+
+	infos := []clients.BillInfo{}
+	for _, bill := range bills {
+		infos = append(infos, billInfo(bill))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(infos)
+}
@@ -0,0 +1,635 @@
+package billingservice
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/yongkaiyu/CNAD_Assg1/internal/auth"
+	"github.com/yongkaiyu/CNAD_Assg1/internal/clients"
+	"github.com/yongkaiyu/CNAD_Assg1/internal/config"
+)
+
+const testInternalKey = "test-internal-key"
+
+func TestMain(m *testing.M) {
+	auth.Init("test-secret", testInternalKey)
+	os.Exit(m.Run())
+}
+
+// fakeUsers puts every user on the Basic tier, without a discount
+type fakeUsers struct{}
+
+func (fakeUsers) GetMembership(ctx context.Context, userID int) (*clients.Membership, error) {
+	return &clients.Membership{UserID: userID, Tier: "Basic", BookingLimit: 1}, nil
+}
+
+// fakeVehicles has every vehicle in the default class
+type fakeVehicles struct{}
+
+func (fakeVehicles) GetVehicle(ctx context.Context, vehicleID int) (*clients.VehicleInfo, error) {
+	return &clients.VehicleInfo{VehicleID: vehicleID, VehicleClass: "Standard"}, nil
+}
+
+const testWebhookSecret = "whsec_test"
+
+type testServer struct {
+	*Server
+	store   *MemoryStore
+	gateway *mockPaymentGateway
+}
+
+// A server pricing at $10 an hour plus 9% tax, refunding in full 24 hours ahead and half 2 hours ahead
+func newTestServer(t *testing.T) *testServer {
+	t.Helper()
+	store := NewMemoryStore()
+	gateway := newMockPaymentGateway()
+	pricing := config.Default().Pricing
+	return &testServer{
+		Server: NewServer(store, fakeUsers{}, fakeVehicles{}, gateway,
+			config.Payments{Gateway: "mock", WebhookSecret: testWebhookSecret}, pricing),
+		store:   store,
+		gateway: gateway,
+	}
+}
+
+// Call an /internal endpoint as another service would
+func (ts *testServer) internal(t *testing.T, method, path string, body interface{}) *httptest.ResponseRecorder {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := json.NewEncoder(&buf).Encode(body); err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest(method, path, &buf)
+	req.Header.Set("X-Internal-Key", testInternalKey)
+	rec := httptest.NewRecorder()
+	ts.Routes().ServeHTTP(rec, req)
+	return rec
+}
+
+// Bill booking 1 of user 1 for two hours starting at start
+func (ts *testServer) createBill(t *testing.T, start time.Time, promoCode string) *httptest.ResponseRecorder {
+	t.Helper()
+	return ts.internal(t, http.MethodPost, "/internal/billings", clients.BillRequest{
+		BookingID: 1, UserID: 1, VehicleID: 1,
+		StartTime: start, EndTime: start.Add(2 * time.Hour),
+		PromoCode: promoCode,
+	})
+}
+
+// Pay what is due on the bill of booking 1, as user 1 would
+func (ts *testServer) pay(t *testing.T) {
+	t.Helper()
+	token, err := auth.IssueAccessToken(1, auth.RoleCustomer)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	body := `{"booking_id": 1, "payment_method": "Credit Card", "payment_token": "tok_visa"}`
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/billing/pay", strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer "+token)
+	rec := httptest.NewRecorder()
+	ts.Routes().ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("paying: status = %d: %s", rec.Code, rec.Body)
+	}
+}
+
+func (ts *testServer) bill(t *testing.T) *Billing {
+	t.Helper()
+	bill, err := ts.store.Bills().GetByBooking(context.Background(), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return bill
+}
+
+func TestCreateBill(t *testing.T) {
+	start := time.Now().UTC().Add(48 * time.Hour).Truncate(time.Hour)
+	tests := []struct {
+		name       string
+		promotions []Promotion
+		promoCode  string
+		// Bookings already made with the first promotion
+		redeemed  int
+		want      int
+		wantTotal float64
+	}{
+		{name: "no promotion", want: http.StatusCreated, wantTotal: 21.80},
+		{
+			name:       "automatic promotion",
+			promotions: []Promotion{{Name: "Launch", DiscountPercentage: 10}},
+			want:       http.StatusCreated, wantTotal: 19.62,
+		},
+		{
+			name:       "fully redeemed automatic promotion is skipped",
+			promotions: []Promotion{{Name: "Launch", DiscountPercentage: 10, MaxUses: 1}},
+			redeemed:   1,
+			want:       http.StatusCreated, wantTotal: 21.80,
+		},
+		{
+			name:       "promo code beats a smaller automatic promotion",
+			promotions: []Promotion{{Name: "Launch", DiscountPercentage: 10}, {Name: "Friends", Code: "FRIENDS", DiscountPercentage: 25}},
+			promoCode:  "friends",
+			want:       http.StatusCreated, wantTotal: 16.35,
+		},
+		{
+			name:       "fully redeemed promo code",
+			promotions: []Promotion{{Name: "Friends", Code: "FRIENDS", DiscountPercentage: 25, MaxUses: 1}},
+			promoCode:  "FRIENDS",
+			redeemed:   1,
+			want:       http.StatusBadRequest,
+		},
+		{name: "unknown promo code", promoCode: "NOPE", want: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts := newTestServer(t)
+			for _, p := range tt.promotions {
+				p.Active = true
+				p.StartDate, p.ExpiryDate = time.Now().Add(-time.Hour), time.Now().Add(time.Hour)
+				ts.store.AddPromotion(p)
+			}
+			for i := 0; i < tt.redeemed; i++ {
+				err := ts.store.Promotions().Redeem(context.Background(), Redemption{PromotionID: 1, UserID: 2, BookingID: 100 + i})
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			rec := ts.createBill(t, start, tt.promoCode)
+			if rec.Code != tt.want {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.want, rec.Body)
+			}
+			if tt.want != http.StatusCreated {
+				return
+			}
+			if bill := ts.bill(t); bill.TotalAmount != tt.wantTotal || bill.PaymentStatus != PaymentStatusPending {
+				t.Errorf("bill = %s $%.2f, want %s $%.2f", bill.PaymentStatus, bill.TotalAmount, PaymentStatusPending, tt.wantTotal)
+			}
+		})
+	}
+}
+
+// promotionTaken redeems promotion 1 for another booking just before the first transaction,
+// as if that booking took its last use between the quote and the bill
+type promotionTaken struct {
+	*MemoryStore
+	taken bool
+}
+
+func (s *promotionTaken) InTx(ctx context.Context, fn func(bills BillStore, promotions PromotionStore, invoices InvoiceStore) error) error {
+	if !s.taken {
+		s.taken = true
+		if err := s.Promotions().Redeem(ctx, Redemption{PromotionID: 1, UserID: 2, BookingID: 100}); err != nil {
+			return err
+		}
+	}
+	return s.MemoryStore.InTx(ctx, fn)
+}
+
+func TestCreateBillPromotionRunsOut(t *testing.T) {
+	start := time.Now().UTC().Add(48 * time.Hour).Truncate(time.Hour)
+	tests := []struct {
+		name       string
+		promotions []Promotion
+		promoCode  string
+		want       int
+		wantTotal  float64
+		// The promotion the booking is billed with, if any
+		wantPromotion int
+	}{
+		{
+			name:       "automatic promotion is dropped",
+			promotions: []Promotion{{Name: "Launch", DiscountPercentage: 10, MaxUses: 1}},
+			want:       http.StatusCreated, wantTotal: 21.80,
+		},
+		{
+			name:       "the next automatic promotion applies",
+			promotions: []Promotion{{Name: "Launch", DiscountPercentage: 10, MaxUses: 1}, {Name: "Spring", DiscountPercentage: 5}},
+			want:       http.StatusCreated, wantTotal: 20.71, wantPromotion: 2,
+		},
+		{
+			name:       "promo code the user entered",
+			promotions: []Promotion{{Name: "Friends", Code: "FRIENDS", DiscountPercentage: 25, MaxUses: 1}},
+			promoCode:  "FRIENDS",
+			want:       http.StatusConflict,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			store := NewMemoryStore()
+			for _, p := range tt.promotions {
+				p.Active = true
+				p.StartDate, p.ExpiryDate = time.Now().Add(-time.Hour), time.Now().Add(time.Hour)
+				store.AddPromotion(p)
+			}
+			gateway := newMockPaymentGateway()
+			ts := &testServer{
+				Server: NewServer(&promotionTaken{MemoryStore: store}, fakeUsers{}, fakeVehicles{}, gateway,
+					config.Payments{Gateway: "mock", WebhookSecret: testWebhookSecret}, config.Default().Pricing),
+				store:   store,
+				gateway: gateway,
+			}
+
+			rec := ts.createBill(t, start, tt.promoCode)
+			if rec.Code != tt.want {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.want, rec.Body)
+			}
+			if tt.want != http.StatusCreated {
+				if _, err := store.Bills().GetByBooking(ctx, 1); !errors.Is(err, errBillNotFound) {
+					t.Errorf("bill of a rejected booking: %v, want %v", err, errBillNotFound)
+				}
+				return
+			}
+			if bill := ts.bill(t); bill.TotalAmount != tt.wantTotal {
+				t.Errorf("total = $%.2f, want $%.2f", bill.TotalAmount, tt.wantTotal)
+			}
+			redemption, err := store.Promotions().ForBooking(ctx, 1)
+			switch {
+			case tt.wantPromotion == 0 && !errors.Is(err, errRedemptionNotFound):
+				t.Errorf("redemption = %+v, %v, want none", redemption, err)
+			case tt.wantPromotion != 0 && (err != nil || redemption.PromotionID != tt.wantPromotion):
+				t.Errorf("redemption = %+v, %v, want promotion %d", redemption, err, tt.wantPromotion)
+			}
+		})
+	}
+}
+
+func TestCancelBill(t *testing.T) {
+	tests := []struct {
+		name   string
+		notice time.Duration
+		paid   bool
+		want   clients.CancelResult
+		// Given back through the gateway
+		wantRefunded float64
+		wantStatus   string
+	}{
+		{
+			name: "paid, full refund", notice: 48 * time.Hour, paid: true,
+			want:         clients.CancelResult{RefundPercentage: 100, RefundAmount: 21.80},
+			wantRefunded: 21.80, wantStatus: PaymentStatusRefunded,
+		},
+		{
+			name: "paid, partial refund", notice: 5 * time.Hour, paid: true,
+			want:         clients.CancelResult{RefundPercentage: 50, RefundAmount: 10.90},
+			wantRefunded: 10.90, wantStatus: PaymentStatusPaid,
+		},
+		{
+			name: "paid, too late for a refund", notice: time.Hour, paid: true,
+			want:       clients.CancelResult{},
+			wantStatus: PaymentStatusPaid,
+		},
+		{
+			name: "unpaid, full refund", notice: 48 * time.Hour,
+			want:       clients.CancelResult{RefundPercentage: 100, RefundAmount: 21.80},
+			wantStatus: PaymentStatusRefunded,
+		},
+		{
+			name: "unpaid, partial refund", notice: 5 * time.Hour,
+			want:       clients.CancelResult{RefundPercentage: 50, RefundAmount: 10.90, AmountDue: 10.90},
+			wantStatus: PaymentStatusPending,
+		},
+		{
+			name: "unpaid, too late for a refund", notice: time.Hour,
+			want:       clients.CancelResult{AmountDue: 21.80},
+			wantStatus: PaymentStatusPending,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts := newTestServer(t)
+			// Round up to the minute so the notice doesn't drop below the policy's windows
+			start := time.Now().UTC().Add(tt.notice).Add(time.Minute).Truncate(time.Minute)
+			if rec := ts.createBill(t, start, ""); rec.Code != http.StatusCreated {
+				t.Fatalf("creating bill: status = %d: %s", rec.Code, rec.Body)
+			}
+			if tt.paid {
+				ts.pay(t)
+			}
+
+			rec := ts.internal(t, http.MethodPost, "/internal/billings/1/cancel", clients.CancelRequest{StartTime: start})
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status = %d: %s", rec.Code, rec.Body)
+			}
+			var result clients.CancelResult
+			if err := json.NewDecoder(rec.Body).Decode(&result); err != nil {
+				t.Fatal(err)
+			}
+			if result != tt.want {
+				t.Errorf("result = %+v, want %+v", result, tt.want)
+			}
+
+			bill := ts.bill(t)
+			if bill.PaymentStatus != tt.wantStatus || bill.RefundedAmount != tt.want.RefundAmount {
+				t.Errorf("bill = %s with $%.2f refunded, want %s with $%.2f", bill.PaymentStatus, bill.RefundedAmount, tt.wantStatus, tt.want.RefundAmount)
+			}
+			refunded := 0.0
+			for _, p := range ts.gateway.payments {
+				refunded += p.refunded
+			}
+			if refunded != tt.wantRefunded {
+				t.Errorf("gateway refunded $%.2f, want $%.2f", refunded, tt.wantRefunded)
+			}
+		})
+	}
+}
+
+// Pay for booking 1 and cancel it 5 hours ahead, for a half refund
+func (ts *testServer) cancelPaidBill(t *testing.T) (time.Time, clients.CancelResult) {
+	t.Helper()
+	start := time.Now().UTC().Add(5 * time.Hour).Add(time.Minute).Truncate(time.Minute)
+	if rec := ts.createBill(t, start, ""); rec.Code != http.StatusCreated {
+		t.Fatalf("creating bill: status = %d: %s", rec.Code, rec.Body)
+	}
+	ts.pay(t)
+	return start, ts.cancel(t, start)
+}
+
+func (ts *testServer) cancel(t *testing.T, start time.Time) clients.CancelResult {
+	t.Helper()
+	rec := ts.internal(t, http.MethodPost, "/internal/billings/1/cancel", clients.CancelRequest{StartTime: start})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("cancelling: status = %d: %s", rec.Code, rec.Body)
+	}
+	var result clients.CancelResult
+	if err := json.NewDecoder(rec.Body).Decode(&result); err != nil {
+		t.Fatal(err)
+	}
+	return result
+}
+
+func TestCancelBillTwice(t *testing.T) {
+	ts := newTestServer(t)
+	start, first := ts.cancelPaidBill(t)
+
+	// A retried cancel gets the same refund, not a second one
+	if second := ts.cancel(t, start); second != first {
+		t.Errorf("second cancel = %+v, want %+v", second, first)
+	}
+	if bill := ts.bill(t); bill.RefundedAmount != 10.90 {
+		t.Errorf("bill has $%.2f refunded, want $10.90", bill.RefundedAmount)
+	}
+	if collected := ts.collected(); collected != 10.90 {
+		t.Errorf("gateway holds $%.2f, want $10.90", collected)
+	}
+}
+
+// A gateway whose refunds fail while down
+type flakyGateway struct {
+	PaymentGateway
+	down bool
+}
+
+func (g *flakyGateway) Refund(ctx context.Context, reference string, amount float64, idempotencyKey string) (*PaymentResult, error) {
+	if g.down {
+		return nil, errors.New("gateway unavailable")
+	}
+	return g.PaymentGateway.Refund(ctx, reference, amount, idempotencyKey)
+}
+
+func TestRefundRetried(t *testing.T) {
+	ts := newTestServer(t)
+	gateway := &flakyGateway{PaymentGateway: ts.gateway, down: true}
+	ts.Server.gateway = gateway
+
+	// The cancellation stands and the refund waits for the gateway
+	if _, result := ts.cancelPaidBill(t); result.RefundAmount != 10.90 {
+		t.Fatalf("refund = $%.2f, want $10.90", result.RefundAmount)
+	}
+	pending, err := ts.store.Bills().PendingRefunds(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pending) != 1 || ts.collected() != 21.80 {
+		t.Fatalf("%d refunds pending and the gateway holds $%.2f, want 1 and $21.80", len(pending), ts.collected())
+	}
+
+	gateway.down = false
+	ts.retryRefunds(context.Background())
+	// Sending it again, as after losing track of it having gone out, doesn't refund twice
+	ts.sendRefunds(context.Background(), pending)
+	pending, err = ts.store.Bills().PendingRefunds(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pending) != 0 || ts.collected() != 10.90 {
+		t.Errorf("%d refunds pending and the gateway holds $%.2f, want none and $10.90", len(pending), ts.collected())
+	}
+}
+
+func TestUpdateBillPromotion(t *testing.T) {
+	start := time.Now().UTC().Add(48 * time.Hour).Truncate(time.Hour)
+	launch := Promotion{Name: "Launch", DiscountPercentage: 10, Active: true,
+		StartDate: time.Now().Add(-time.Hour), ExpiryDate: time.Now().Add(time.Hour)}
+	tests := []struct {
+		name string
+		// Whether the promotion runs when the booking is made, and when it is repriced
+		before, after bool
+		wantTotal     float64
+		wantDiscount  float64
+	}{
+		{name: "no promotion", wantTotal: 32.70},
+		{name: "keeps its promotion", before: true, after: true, wantTotal: 29.43, wantDiscount: 3},
+		{name: "keeps its promotion after it ends", before: true, wantTotal: 29.43, wantDiscount: 3},
+		{name: "gets no new promotion", after: true, wantTotal: 32.70},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			ts := newTestServer(t)
+			promotion := launch
+			promotion.Active = tt.before
+			promotionID := ts.store.AddPromotion(promotion)
+			if rec := ts.createBill(t, start, ""); rec.Code != http.StatusCreated {
+				t.Fatalf("creating bill: status = %d: %s", rec.Code, rec.Body)
+			}
+
+			promotion.PromotionID, promotion.Active = promotionID, tt.after
+			if err := ts.store.Promotions().Update(ctx, promotion); err != nil {
+				t.Fatal(err)
+			}
+			rec := ts.internal(t, http.MethodPut, "/internal/billings/1", clients.BillRequest{
+				BookingID: 1, UserID: 1, VehicleID: 1,
+				StartTime: start, EndTime: start.Add(3 * time.Hour),
+			})
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status = %d: %s", rec.Code, rec.Body)
+			}
+
+			if bill := ts.bill(t); bill.TotalAmount != tt.wantTotal {
+				t.Errorf("total = $%.2f, want $%.2f", bill.TotalAmount, tt.wantTotal)
+			}
+			redemption, err := ts.store.Promotions().ForBooking(ctx, 1)
+			if tt.wantDiscount == 0 {
+				if err != errRedemptionNotFound {
+					t.Errorf("redemption = %+v, %v, want none", redemption, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if redemption.Discount != tt.wantDiscount {
+				t.Errorf("recorded discount = $%.2f, want $%.2f", redemption.Discount, tt.wantDiscount)
+			}
+		})
+	}
+}
+
+// What the gateway holds for the customer: captured less refunded
+func (ts *testServer) collected() float64 {
+	held := 0.0
+	for _, p := range ts.gateway.payments {
+		held += p.captured - p.refunded
+	}
+	return roundCents(held)
+}
+
+func TestUpdatePaidBill(t *testing.T) {
+	start := time.Now().UTC().Add(48 * time.Hour).Truncate(time.Hour)
+	tests := []struct {
+		name string
+		// Hours the paid two hour booking is repriced to in turn, paying what is due after each
+		hours []int
+		// The price is what the bill comes to after refunds
+		wantPrice     float64
+		wantDue       float64
+		wantCollected float64
+	}{
+		{name: "longer leaves the difference due", hours: []int{3}, wantPrice: 32.70, wantDue: 10.90, wantCollected: 21.80},
+		{name: "shorter refunds the difference", hours: []int{1}, wantPrice: 10.90, wantCollected: 10.90},
+		{name: "unchanged", hours: []int{2}, wantPrice: 21.80, wantCollected: 21.80},
+		{name: "longer then paid", hours: []int{3, 3}, wantPrice: 32.70, wantCollected: 32.70},
+		{name: "longer, paid, then shorter refunds both payments", hours: []int{3, 1}, wantPrice: 10.90, wantCollected: 10.90},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts := newTestServer(t)
+			if rec := ts.createBill(t, start, ""); rec.Code != http.StatusCreated {
+				t.Fatalf("creating bill: status = %d: %s", rec.Code, rec.Body)
+			}
+			ts.pay(t)
+
+			for i, hours := range tt.hours {
+				if i > 0 && ts.bill(t).amountDue() > 0 {
+					ts.pay(t)
+				}
+				rec := ts.internal(t, http.MethodPut, "/internal/billings/1", clients.BillRequest{
+					BookingID: 1, UserID: 1, VehicleID: 1,
+					StartTime: start, EndTime: start.Add(time.Duration(hours) * time.Hour),
+				})
+				if rec.Code != http.StatusOK {
+					t.Fatalf("repricing to %dh: status = %d: %s", hours, rec.Code, rec.Body)
+				}
+			}
+
+			bill := ts.bill(t)
+			if price := roundCents(bill.TotalAmount - bill.RefundedAmount); price != tt.wantPrice {
+				t.Errorf("price = $%.2f, want $%.2f", price, tt.wantPrice)
+			}
+			wantStatus := PaymentStatusPaid
+			if tt.wantDue > 0 {
+				wantStatus = PaymentStatusPending
+			}
+			if bill.amountDue() != tt.wantDue || bill.PaymentStatus != wantStatus {
+				t.Errorf("bill = %s with $%.2f due, want %s with $%.2f", bill.PaymentStatus, bill.amountDue(), wantStatus, tt.wantDue)
+			}
+			if collected := ts.collected(); collected != tt.wantCollected || bill.AmountPaid != tt.wantCollected {
+				t.Errorf("gateway holds $%.2f and the bill $%.2f paid, want $%.2f", collected, bill.AmountPaid, tt.wantCollected)
+			}
+		})
+	}
+}
+
+func TestUpdateCancelledBill(t *testing.T) {
+	tests := []struct {
+		name   string
+		notice time.Duration
+		paid   bool
+	}{
+		{"refunded in full", 48 * time.Hour, true},
+		{"partly refunded", 5 * time.Hour, true},
+		{"unpaid and partly refunded", 5 * time.Hour, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts := newTestServer(t)
+			start := time.Now().UTC().Add(tt.notice).Add(time.Minute).Truncate(time.Minute)
+			if rec := ts.createBill(t, start, ""); rec.Code != http.StatusCreated {
+				t.Fatalf("creating bill: status = %d: %s", rec.Code, rec.Body)
+			}
+			if tt.paid {
+				ts.pay(t)
+			}
+			ts.cancel(t, start)
+			before, collected := ts.bill(t), ts.collected()
+
+			rec := ts.internal(t, http.MethodPut, "/internal/billings/1", clients.BillRequest{
+				BookingID: 1, UserID: 1, VehicleID: 1,
+				StartTime: start, EndTime: start.Add(time.Hour),
+			})
+			if rec.Code != http.StatusConflict {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusConflict, rec.Body)
+			}
+			after := ts.bill(t)
+			if after.TotalAmount != before.TotalAmount || after.RefundedAmount != before.RefundedAmount ||
+				after.PaymentStatus != before.PaymentStatus || ts.collected() != collected {
+				t.Errorf("bill = %+v, want it left as %+v", after, before)
+			}
+		})
+	}
+}
+
+func TestLateFeeOnPaidBill(t *testing.T) {
+	ts := newTestServer(t)
+	start := time.Now().UTC().Add(48 * time.Hour).Truncate(time.Hour)
+	if rec := ts.createBill(t, start, ""); rec.Code != http.StatusCreated {
+		t.Fatalf("creating bill: status = %d: %s", rec.Code, rec.Body)
+	}
+	ts.pay(t)
+
+	// The trip takes its two hours but was due back a minute before it ended: one $5 late fee plus tax
+	end := start.Add(2 * time.Hour)
+	rec := ts.internal(t, http.MethodPut, "/internal/billings/1", clients.BillRequest{
+		BookingID: 1, UserID: 1, VehicleID: 1,
+		StartTime: start, EndTime: end, LateAfter: end.Add(-time.Minute),
+	})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", rec.Code, rec.Body)
+	}
+	var response clients.BillResponse
+	if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+		t.Fatal(err)
+	}
+	if response.Bill.AmountDue != 5.45 || response.Bill.PaymentStatus != PaymentStatusPending {
+		t.Fatalf("bill = %s with $%.2f due, want %s with $5.45", response.Bill.PaymentStatus, response.Bill.AmountDue, PaymentStatusPending)
+	}
+
+	// Paying charges the late fee alone
+	ts.pay(t)
+	bill := ts.bill(t)
+	if bill.PaymentStatus != PaymentStatusPaid || bill.amountDue() != 0 || ts.collected() != 27.25 {
+		t.Errorf("after paying: bill = %s with $%.2f due and the gateway holds $%.2f, want %s with none due and $27.25",
+			bill.PaymentStatus, bill.amountDue(), ts.collected(), PaymentStatusPaid)
+	}
+	var lateFee float64
+	for _, p := range ts.gateway.payments {
+		if p.captured < 21.80 {
+			lateFee = p.captured
+		}
+	}
+	if lateFee != 5.45 {
+		t.Errorf("late fee captured as $%.2f, want a separate $5.45 charge", lateFee)
+	}
+}
@@ -0,0 +1,344 @@
+package billingservice
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/yongkaiyu/CNAD_Assg1/internal/clients"
+)
+
+/* Invoices: a completed rental's bill is invoiced once, under the next invoice number, with
+   its line items and tax as they were priced. Invoices are never changed afterwards; the
+   finance team corrects one by issuing credit notes against it, which refund the bill. */
+
+// Invoice is an issued invoice or credit note. Credit notes have negative amounts and
+// CreditsInvoiceID set to the invoice they correct.
+type Invoice struct {
+	InvoiceID        int           `json:"invoice_id"`
+	InvoiceNumber    string        `json:"invoice_number"`
+	Kind             string        `json:"kind"`
+	BillingID        int           `json:"billing_id"`
+	BookingID        int           `json:"booking_id"`
+	UserID           int           `json:"user_id"`
+	VehicleID        int           `json:"vehicle_id"`
+	RentalStart      time.Time     `json:"rental_start"`
+	RentalEnd        time.Time     `json:"rental_end"`
+	CreditsInvoiceID int           `json:"credits_invoice_id,omitempty"`
+	Reason           string        `json:"reason,omitempty"`
+	Currency         string        `json:"currency"`
+	Subtotal         float64       `json:"subtotal"`
+	TaxName          string        `json:"tax_name"`
+	TaxRate          float64       `json:"tax_rate"`
+	TaxAmount        float64       `json:"tax_amount"`
+	Total            float64       `json:"total"`
+	IssuedAt         time.Time     `json:"issued_at"`
+	Lines            []InvoiceLine `json:"lines"`
+}
+
+// InvoiceLine is one charge, discount or credit on an invoice, before tax
+type InvoiceLine struct {
+	Kind        string  `json:"kind"`
+	Description string  `json:"description"`
+	Quantity    int     `json:"quantity"`
+	UnitAmount  float64 `json:"unit_amount"`
+	Amount      float64 `json:"amount"`
+}
+
+const (
+	InvoiceKindInvoice    = "Invoice"
+	InvoiceKindCreditNote = "Credit Note"
+)
+
+// Invoice numbers are the kind's prefix and its number in sequence
+var invoicePrefixes = map[string]string{
+	InvoiceKindInvoice:    "INV",
+	InvoiceKindCreditNote: "CN",
+}
+
+const LineItemCredit = "credit"
+
+// creditNoteError says why a credit note can't be issued, in words for the finance team
+type creditNoteError struct {
+	message string
+}
+
+func (e *creditNoteError) Error() string { return e.message }
+
+// What the customer sees: the invoice with any credit notes issued against it, and what has
+// been paid on the bill and is still due as of now
+type invoiceResponse struct {
+	Invoice
+	CreditNotes []Invoice `json:"credit_notes"`
+	AmountPaid  float64   `json:"amount_paid,omitempty"`
+	AmountDue   float64   `json:"amount_due,omitempty"`
+}
+
+func newInvoiceResponse(documents []Invoice) (invoiceResponse, bool) {
+	response := invoiceResponse{CreditNotes: []Invoice{}}
+	found := false
+	for _, document := range documents {
+		if document.Kind == InvoiceKindInvoice {
+			response.Invoice, found = document, true
+		} else {
+			response.CreditNotes = append(response.CreditNotes, document)
+		}
+	}
+	return response, found
+}
+
+// Issue the invoice of the bill of a trip that has ended, unless it already has one. It is
+// called with the bill locked and as repriced for the trip.
+func (s *Server) issueInvoice(ctx context.Context, bills BillStore, invoices InvoiceStore, bill Billing, trip clients.BillRequest) error {
+	documents, err := invoices.ForBilling(ctx, bill.BillingID)
+	if err != nil {
+		return err
+	}
+	if _, found := newInvoiceResponse(documents); found {
+		return nil
+	}
+
+	items, err := bills.LineItems(ctx, bill.BillingID)
+	if err != nil {
+		return err
+	}
+	// Refunds made when the trip was repriced down are already out of the price
+	total := roundCents(bill.TotalAmount - bill.RefundedAmount)
+	invoice := Invoice{
+		Kind:        InvoiceKindInvoice,
+		BillingID:   bill.BillingID,
+		BookingID:   bill.BookingID,
+		UserID:      bill.UserID,
+		VehicleID:   trip.VehicleID,
+		RentalStart: trip.StartTime.UTC(),
+		RentalEnd:   trip.EndTime.UTC(),
+		Currency:    currency,
+		TaxName:     s.pricing.TaxName,
+		TaxRate:     bill.TaxRate,
+		TaxAmount:   bill.TaxAmount,
+		Total:       total,
+		IssuedAt:    time.Now().UTC().Truncate(time.Second),
+		Lines:       []InvoiceLine{},
+	}
+
+	subtotal := 0.0
+	for _, item := range items {
+		invoice.Lines = append(invoice.Lines, InvoiceLine{
+			Kind:        item.Kind,
+			Description: item.Description,
+			Quantity:    item.Quantity,
+			UnitAmount:  item.UnitAmount,
+			Amount:      item.Amount,
+		})
+		subtotal += item.Amount
+	}
+	// Bills priced before they were itemised don't add up from their items
+	if diff := roundCents(total - bill.TaxAmount - subtotal); diff != 0 {
+		invoice.Lines = append(invoice.Lines, InvoiceLine{
+			Kind:        LineItemAdjustment,
+			Description: "Adjustment to the billed amount",
+			Quantity:    1,
+			UnitAmount:  diff,
+			Amount:      diff,
+		})
+		subtotal += diff
+	}
+	invoice.Subtotal = roundCents(subtotal)
+
+	_, err = invoices.Issue(ctx, invoice)
+	return err
+}
+
+// Credit some or all of an invoice: issue a credit note against it and refund the bill by
+// as much. What was paid beyond what is still owed goes back through the gateway.
+func (s *Server) issueCreditNote(ctx context.Context, invoiceID int, reason string, requested *float64) (*Invoice, error) {
+	var note *Invoice
+	var refunds []Refund
+	err := s.store.InTx(ctx, func(bills BillStore, promotions PromotionStore, invoices InvoiceStore) error {
+		// Locked so concurrent credit notes can't credit more than the invoice
+		original, err := invoices.Lock(ctx, invoiceID)
+		if err != nil {
+			return err
+		}
+		if original.Kind != InvoiceKindInvoice {
+			return &creditNoteError{"Only invoices can be credited"}
+		}
+		documents, err := invoices.ForBilling(ctx, original.BillingID)
+		if err != nil {
+			return err
+		}
+		creditable := original.Total
+		for _, document := range documents {
+			if document.CreditsInvoiceID == original.InvoiceID {
+				creditable += document.Total
+			}
+		}
+		creditable = roundCents(creditable)
+
+		amount := creditable
+		if requested != nil {
+			amount = roundCents(*requested)
+		}
+		switch {
+		case creditable <= 0:
+			return &creditNoteError{fmt.Sprintf("Invoice %s has already been fully credited", original.InvoiceNumber)}
+		case amount > creditable:
+			return &creditNoteError{fmt.Sprintf("At most $%.2f of invoice %s can still be credited", creditable, original.InvoiceNumber)}
+		}
+
+		// Lock the bill so a payment can't land while we credit and refund
+		bill, err := bills.LockByBooking(ctx, original.BookingID)
+		if err != nil {
+			return err
+		}
+		if bill.PaymentStatus == PaymentStatusAuthorized {
+			return errInvalidPaymentState
+		}
+
+		// The amount credited includes tax at the invoice's rate
+		net := roundCents(amount / (1 + original.TaxRate/100))
+		note, err = invoices.Issue(ctx, Invoice{
+			Kind:             InvoiceKindCreditNote,
+			BillingID:        original.BillingID,
+			BookingID:        original.BookingID,
+			UserID:           original.UserID,
+			VehicleID:        original.VehicleID,
+			RentalStart:      original.RentalStart,
+			RentalEnd:        original.RentalEnd,
+			CreditsInvoiceID: original.InvoiceID,
+			Reason:           reason,
+			Currency:         original.Currency,
+			Subtotal:         -net,
+			TaxName:          original.TaxName,
+			TaxRate:          original.TaxRate,
+			TaxAmount:        -roundCents(amount - net),
+			Total:            -amount,
+			IssuedAt:         time.Now().UTC().Truncate(time.Second),
+			Lines: []InvoiceLine{{
+				Kind:        LineItemCredit,
+				Description: fmt.Sprintf("Credit against invoice %s: %s", original.InvoiceNumber, reason),
+				Quantity:    1,
+				UnitAmount:  -net,
+				Amount:      -net,
+			}},
+		})
+		if err != nil {
+			return err
+		}
+
+		refundable := roundCents(bill.TotalAmount - bill.RefundedAmount)
+		refund := math.Min(amount, refundable)
+		if refund <= 0 {
+			return nil
+		}
+		// As a share of the bill, which may total nothing
+		percentage := 100.0
+		if bill.TotalAmount > 0 {
+			percentage = roundCents(refund / bill.TotalAmount * 100)
+		}
+		refunds, err = refundBill(ctx, bills, *bill, refund, Refund{
+			Kind:       RefundKindCreditNote,
+			Percentage: percentage,
+			Reason:     fmt.Sprintf("Credit note %s: %s", note.InvoiceNumber, reason),
+		})
+		if err != nil {
+			return err
+		}
+		if refund == refundable {
+			return bills.MarkRefunded(ctx, bill.BookingID)
+		}
+		return settleStatus(ctx, bills, bill.BookingID)
+	})
+	if err != nil {
+		return nil, err
+	}
+	// Only once the refunds are recorded, so money never goes out without a record of it
+	s.sendRefunds(ctx, refunds)
+	return note, nil
+}
+
+/* Handlers */
+
+func writeInvoiceError(w http.ResponseWriter, err error) {
+	var creditErr *creditNoteError
+	switch {
+	case errors.Is(err, errInvoiceNotFound):
+		http.Error(w, "Invoice not found", http.StatusNotFound)
+	case errors.As(err, &creditErr):
+		http.Error(w, creditErr.Error(), http.StatusConflict)
+	case errors.Is(err, errInvalidPaymentState):
+		http.Error(w, "A payment for this bill is in progress, please try again shortly", http.StatusConflict)
+	default:
+		log.Printf("Error handling invoice: %v", err)
+		http.Error(w, "Error handling invoice", http.StatusInternalServerError)
+	}
+}
+
+// An invoice or credit note with the credit notes issued against it, for the finance team
+func (s *Server) getInvoiceHandler(w http.ResponseWriter, r *http.Request) {
+	invoiceID, _ := strconv.Atoi(mux.Vars(r)["invoiceId"])
+
+	invoice, err := s.store.Invoices().Get(r.Context(), invoiceID)
+	if err != nil {
+		writeInvoiceError(w, err)
+		return
+	}
+	documents, err := s.store.Invoices().ForBilling(r.Context(), invoice.BillingID)
+	if err != nil {
+		writeInvoiceError(w, err)
+		return
+	}
+
+	response, _ := newInvoiceResponse(documents)
+	if invoice.Kind != InvoiceKindInvoice {
+		response = invoiceResponse{Invoice: *invoice, CreditNotes: []Invoice{}}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// Issue a credit note against an invoice. The body is {"reason", "amount"}; amount includes
+// tax and defaults to everything not yet credited.
+func (s *Server) createCreditNoteHandler(w http.ResponseWriter, r *http.Request) {
+	invoiceID, _ := strconv.Atoi(mux.Vars(r)["invoiceId"])
+
+	var input struct {
+		Reason string   `json:"reason"`
+		Amount *float64 `json:"amount"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		http.Error(w, "Invalid input", http.StatusBadRequest)
+		return
+	}
+	input.Reason = strings.TrimSpace(input.Reason)
+	switch {
+	case input.Reason == "":
+		http.Error(w, "reason is required", http.StatusBadRequest)
+		return
+	case len(input.Reason) > 200:
+		http.Error(w, "reason must be at most 200 characters", http.StatusBadRequest)
+		return
+	case input.Amount != nil && roundCents(*input.Amount) <= 0:
+		http.Error(w, "amount must be positive", http.StatusBadRequest)
+		return
+	}
+
+	note, err := s.issueCreditNote(r.Context(), invoiceID, input.Reason, input.Amount)
+	if err != nil {
+		writeInvoiceError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(note)
+}
@@ -0,0 +1,224 @@
+package billingservice
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/yongkaiyu/CNAD_Assg1/internal/auth"
+	"github.com/yongkaiyu/CNAD_Assg1/internal/clients"
+)
+
+// The booking of user 1 for two hours from start, as the vehicle service bills it
+func tripRequest(bookingID int, start time.Time) clients.BillRequest {
+	return clients.BillRequest{
+		BookingID: bookingID, UserID: 1, VehicleID: 1,
+		StartTime: start, EndTime: start.Add(2 * time.Hour),
+	}
+}
+
+func (ts *testServer) book(t *testing.T, bookingID int, start time.Time) {
+	t.Helper()
+	if rec := ts.internal(t, http.MethodPost, "/internal/billings", tripRequest(bookingID, start)); rec.Code != http.StatusCreated {
+		t.Fatalf("creating bill: status = %d: %s", rec.Code, rec.Body)
+	}
+}
+
+// Bill the trip as taken, as the vehicle service does once it has ended
+func (ts *testServer) endTrip(t *testing.T, bookingID int, start time.Time) *httptest.ResponseRecorder {
+	t.Helper()
+	trip := tripRequest(bookingID, start)
+	trip.Final = true
+	return ts.internal(t, http.MethodPut, fmt.Sprintf("/internal/billings/%d", bookingID), trip)
+}
+
+// Call the API as the given user and role
+func (ts *testServer) as(t *testing.T, userID int, role, method, path string, body interface{}) *httptest.ResponseRecorder {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := json.NewEncoder(&buf).Encode(body); err != nil {
+		t.Fatal(err)
+	}
+	token, err := auth.IssueAccessToken(userID, role)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest(method, path, &buf)
+	req.Header.Set("Authorization", "Bearer "+token)
+	rec := httptest.NewRecorder()
+	ts.Routes().ServeHTTP(rec, req)
+	return rec
+}
+
+// The invoice of a booking of user 1, as they see it
+func (ts *testServer) invoice(t *testing.T, bookingID int) (invoiceResponse, int) {
+	t.Helper()
+	rec := ts.as(t, 1, auth.RoleCustomer, http.MethodGet, fmt.Sprintf("/api/v1/billing/invoice?booking_id=%d", bookingID), nil)
+	var response invoiceResponse
+	if rec.Code == http.StatusOK {
+		if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return response, rec.Code
+}
+
+func (ts *testServer) creditNote(t *testing.T, invoiceID int, amount *float64) *httptest.ResponseRecorder {
+	t.Helper()
+	body := map[string]interface{}{"reason": "Goodwill", "amount": amount}
+	return ts.as(t, 9, auth.RoleFinance, http.MethodPost, fmt.Sprintf("/api/v1/admin/invoices/%d/credit-notes", invoiceID), body)
+}
+
+func TestInvoiceNumbering(t *testing.T) {
+	ts := newTestServer(t)
+	start := time.Now().UTC().Add(48 * time.Hour).Truncate(time.Hour)
+	for bookingID := 1; bookingID <= 4; bookingID++ {
+		ts.book(t, bookingID, start)
+	}
+
+	// Reading the invoice before the trip is billed doesn't issue it
+	if _, code := ts.invoice(t, 1); code != http.StatusNotFound {
+		t.Fatalf("before the trip is billed: status = %d, want %d", code, http.StatusNotFound)
+	}
+
+	// Invoices are numbered in the order trips are billed, and billing again changes nothing
+	for _, bookingID := range []int{2, 1, 1} {
+		if rec := ts.endTrip(t, bookingID, start); rec.Code != http.StatusOK {
+			t.Fatalf("billing trip of booking %d: status = %d: %s", bookingID, rec.Code, rec.Body)
+		}
+	}
+	// A trip whose bill can't be repriced isn't invoiced and doesn't use up a number
+	if rec := ts.internal(t, http.MethodPost, "/internal/billings/3/cancel", clients.CancelRequest{StartTime: start}); rec.Code != http.StatusOK {
+		t.Fatalf("cancelling: status = %d: %s", rec.Code, rec.Body)
+	}
+	if rec := ts.endTrip(t, 3, start); rec.Code != http.StatusConflict {
+		t.Fatalf("billing trip of cancelled booking: status = %d, want %d", rec.Code, http.StatusConflict)
+	}
+	if rec := ts.endTrip(t, 4, start); rec.Code != http.StatusOK {
+		t.Fatalf("billing trip of booking 4: status = %d: %s", rec.Code, rec.Body)
+	}
+
+	// Credit notes have numbers of their own
+	first, _ := ts.invoice(t, 1)
+	for i := 0; i < 2; i++ {
+		if rec := ts.creditNote(t, first.InvoiceID, floatPtr(1)); rec.Code != http.StatusCreated {
+			t.Fatalf("crediting: status = %d: %s", rec.Code, rec.Body)
+		}
+	}
+
+	tests := []struct {
+		bookingID   int
+		wantNumber  string
+		wantCredits []string
+	}{
+		{1, "INV-000002", []string{"CN-000001", "CN-000002"}},
+		{2, "INV-000001", nil},
+		{4, "INV-000003", nil},
+	}
+	for _, tt := range tests {
+		response, code := ts.invoice(t, tt.bookingID)
+		if code != http.StatusOK {
+			t.Fatalf("invoice of booking %d: status = %d", tt.bookingID, code)
+		}
+		if response.InvoiceNumber != tt.wantNumber || response.Total != 21.80 || response.RentalStart != start {
+			t.Errorf("invoice of booking %d = %s for $%.2f from %s, want %s for $21.80 from %s",
+				tt.bookingID, response.InvoiceNumber, response.Total, response.RentalStart, tt.wantNumber, start)
+		}
+		var credits []string
+		for _, note := range response.CreditNotes {
+			credits = append(credits, note.InvoiceNumber)
+		}
+		if fmt.Sprint(credits) != fmt.Sprint(tt.wantCredits) {
+			t.Errorf("credit notes of booking %d = %v, want %v", tt.bookingID, credits, tt.wantCredits)
+		}
+	}
+	if _, code := ts.invoice(t, 3); code != http.StatusNotFound {
+		t.Errorf("invoice of cancelled booking: status = %d, want %d", code, http.StatusNotFound)
+	}
+}
+
+func floatPtr(f float64) *float64 { return &f }
+
+func TestCreditNoteLimits(t *testing.T) {
+	tests := []struct {
+		name string
+		// The trip is free
+		free       bool
+		authorized bool
+		// Credited before the credit note under test
+		credited []float64
+		// Credit the first credit note instead of the invoice
+		creditNote bool
+		amount     *float64
+		want       int
+		// What the bill is refunded in all
+		wantRefunded float64
+	}{
+		{name: "whole invoice", want: http.StatusCreated, wantRefunded: 21.80},
+		{name: "part of the invoice", amount: floatPtr(10), want: http.StatusCreated, wantRefunded: 10},
+		{name: "rest of the invoice", credited: []float64{10}, want: http.StatusCreated, wantRefunded: 21.80},
+		{name: "more than invoiced", amount: floatPtr(21.81), want: http.StatusConflict},
+		{name: "more than is left", credited: []float64{20}, amount: floatPtr(5), want: http.StatusConflict, wantRefunded: 20},
+		{name: "fully credited", credited: []float64{21.80}, want: http.StatusConflict, wantRefunded: 21.80},
+		{name: "a credit note", credited: []float64{5}, creditNote: true, amount: floatPtr(1), want: http.StatusConflict, wantRefunded: 5},
+		{name: "free trip", free: true, want: http.StatusConflict},
+		{name: "payment in progress", authorized: true, want: http.StatusConflict},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts := newTestServer(t)
+			if tt.free {
+				ts.store.AddPromotion(Promotion{Name: "Free", DiscountPercentage: 100, Active: true,
+					StartDate: time.Now().Add(-time.Hour), ExpiryDate: time.Now().Add(time.Hour)})
+			}
+			start := time.Now().UTC().Add(48 * time.Hour).Truncate(time.Hour)
+			ts.book(t, 1, start)
+			if rec := ts.endTrip(t, 1, start); rec.Code != http.StatusOK {
+				t.Fatalf("billing trip: status = %d: %s", rec.Code, rec.Body)
+			}
+			invoice, _ := ts.invoice(t, 1)
+			if tt.free && invoice.Total != 0 {
+				t.Fatalf("free trip invoiced for $%.2f", invoice.Total)
+			}
+
+			for _, amount := range tt.credited {
+				if rec := ts.creditNote(t, invoice.InvoiceID, floatPtr(amount)); rec.Code != http.StatusCreated {
+					t.Fatalf("crediting $%.2f first: status = %d: %s", amount, rec.Code, rec.Body)
+				}
+			}
+			target := invoice.InvoiceID
+			if tt.creditNote {
+				credited, _ := ts.invoice(t, 1)
+				target = credited.CreditNotes[0].InvoiceID
+			}
+			if tt.authorized {
+				err := ts.store.Bills().SetPaymentStatus(context.Background(), ts.bill(t).BillingID,
+					[]string{PaymentStatusPending}, PaymentStatusAuthorized, PaymentMethodCreditCard, "ref_1")
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			if rec := ts.creditNote(t, target, tt.amount); rec.Code != tt.want {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.want, rec.Body)
+			}
+			response, _ := ts.invoice(t, 1)
+			want := len(tt.credited)
+			if tt.want == http.StatusCreated {
+				want++
+			}
+			if len(response.CreditNotes) != want {
+				t.Errorf("%d credit notes issued, want %d", len(response.CreditNotes), want)
+			}
+			if bill := ts.bill(t); bill.RefundedAmount != tt.wantRefunded {
+				t.Errorf("bill refunded $%.2f, want $%.2f", bill.RefundedAmount, tt.wantRefunded)
+			}
+		})
+	}
+}
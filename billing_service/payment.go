@@ -0,0 +1,619 @@
+package billingservice
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/yongkaiyu/CNAD_Assg1/internal/auth"
+)
+
+// Every price is in Singapore dollars
+const currency = "SGD"
+
+const (
+	PaymentStatusAuthorized = "Authorized"
+	PaymentStatusFailed     = "Failed"
+)
+
+var (
+	errPaymentDeclined     = errors.New("payment declined")
+	errPaymentNotFound     = errors.New("payment not found")
+	errInvalidPaymentState = errors.New("payment is not in a state that allows this operation")
+)
+
+// PaymentGateway is implemented by each payment provider
+type PaymentGateway interface {
+	// Authorize reserves the amount on the customer's payment method
+	Authorize(ctx context.Context, req PaymentRequest) (*PaymentResult, error)
+	// Capture collects a previously authorized amount
+	Capture(ctx context.Context, reference string, amount float64) (*PaymentResult, error)
+	// Refund returns some or all of a captured amount. Repeating a refund with the same
+	// idempotency key returns the original result instead of refunding again.
+	Refund(ctx context.Context, reference string, amount float64, idempotencyKey string) (*PaymentResult, error)
+}
+
+type PaymentRequest struct {
+	// Repeating a request with the same key returns the original authorization
+	IdempotencyKey string
+	Amount         float64
+	Currency       string
+	PaymentMethod  string
+	PaymentToken   string
+}
+
+// Payment is money collected on a bill. Refunded is how much of it was given back.
+type Payment struct {
+	PaymentID        int       `json:"payment_id"`
+	BillingID        int       `json:"billing_id"`
+	Amount           float64   `json:"amount"`
+	Refunded         float64   `json:"refunded"`
+	GatewayReference string    `json:"-"`
+	CreatedAt        time.Time `json:"created_at"`
+}
+
+type PaymentResult struct {
+	Reference string  `json:"reference"`
+	Status    string  `json:"status"`
+	Amount    float64 `json:"amount"`
+}
+
+// Webhook event sent by the gateway when a payment changes state
+type PaymentEvent struct {
+	EventID   string  `json:"id"`
+	Type      string  `json:"type"`
+	Reference string  `json:"reference"`
+	Amount    float64 `json:"amount"`
+	// Echoed on refunds we asked for, which are recorded already
+	IdempotencyKey string `json:"idempotency_key,omitempty"`
+}
+
+const (
+	PaymentEventAuthorized = "payment.authorized"
+	PaymentEventCaptured   = "payment.captured"
+	PaymentEventFailed     = "payment.failed"
+	PaymentEventRefunded   = "payment.refunded"
+)
+
+// NewPaymentGateway returns the named payment provider. Only the local mock ships for now.
+func NewPaymentGateway(provider string) (PaymentGateway, error) {
+	switch provider {
+	case "mock":
+		log.Println("Using mock payment gateway")
+		return newMockPaymentGateway(), nil
+	default:
+		return nil, fmt.Errorf("unknown payment gateway: %s", provider)
+	}
+}
+
+/* Mock gateway */
+
+type mockPayment struct {
+	reference string
+	status    string
+	amount    float64
+	captured  float64
+	refunded  float64
+}
+
+// mockPaymentGateway is an in-process gateway for local runs and tests.
+// The token "tok_decline" is always declined; anything else is approved.
+type mockPaymentGateway struct {
+	mu          sync.Mutex
+	payments    map[string]*mockPayment
+	idempotency map[string]string
+	refunds     map[string]PaymentResult // by idempotency key
+}
+
+func newMockPaymentGateway() *mockPaymentGateway {
+	return &mockPaymentGateway{
+		payments:    make(map[string]*mockPayment),
+		idempotency: make(map[string]string),
+		refunds:     make(map[string]PaymentResult),
+	}
+}
+
+func (g *mockPaymentGateway) Authorize(ctx context.Context, req PaymentRequest) (*PaymentResult, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if reference, ok := g.idempotency[req.IdempotencyKey]; ok && req.IdempotencyKey != "" {
+		p := g.payments[reference]
+		return &PaymentResult{Reference: p.reference, Status: p.status, Amount: p.amount}, nil
+	}
+
+	if req.PaymentToken == "tok_decline" || req.Amount <= 0 {
+		return nil, errPaymentDeclined
+	}
+
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+	p := &mockPayment{
+		reference: "mock_" + hex.EncodeToString(b),
+		status:    PaymentStatusAuthorized,
+		amount:    req.Amount,
+	}
+	g.payments[p.reference] = p
+	if req.IdempotencyKey != "" {
+		g.idempotency[req.IdempotencyKey] = p.reference
+	}
+
+	return &PaymentResult{Reference: p.reference, Status: p.status, Amount: p.amount}, nil
+}
+
+func (g *mockPaymentGateway) Capture(ctx context.Context, reference string, amount float64) (*PaymentResult, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	p, ok := g.payments[reference]
+	if !ok {
+		return nil, errPaymentNotFound
+	}
+	if p.status == PaymentStatusPaid && p.captured == amount {
+		return &PaymentResult{Reference: p.reference, Status: p.status, Amount: p.captured}, nil
+	}
+	if p.status != PaymentStatusAuthorized || amount > p.amount {
+		return nil, errInvalidPaymentState
+	}
+
+	p.status = PaymentStatusPaid
+	p.captured = amount
+	return &PaymentResult{Reference: p.reference, Status: p.status, Amount: p.captured}, nil
+}
+
+func (g *mockPaymentGateway) Refund(ctx context.Context, reference string, amount float64, idempotencyKey string) (*PaymentResult, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if result, ok := g.refunds[idempotencyKey]; ok && idempotencyKey != "" {
+		return &result, nil
+	}
+
+	p, ok := g.payments[reference]
+	if !ok {
+		return nil, errPaymentNotFound
+	}
+	if p.status != PaymentStatusPaid || p.refunded+amount > p.captured {
+		return nil, errInvalidPaymentState
+	}
+
+	p.refunded += amount
+	if p.refunded == p.captured {
+		p.status = PaymentStatusRefunded
+	}
+	result := PaymentResult{Reference: p.reference, Status: p.status, Amount: amount}
+	if idempotencyKey != "" {
+		g.refunds[idempotencyKey] = result
+	}
+	return &result, nil
+}
+
+/* Handlers */
+
+// Take payment for a booking's bill: authorize, then capture straight away
+func (s *Server) paymentHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var input struct {
+		BookingID     int    `json:"booking_id"`
+		PaymentMethod string `json:"payment_method"`
+		PaymentToken  string `json:"payment_token"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	switch input.PaymentMethod {
+	case PaymentMethodCreditCard, PaymentMethodDebitCard, PaymentMethodPayPal, PaymentMethodOther:
+	default:
+		http.Error(w, "Invalid payment method", http.StatusBadRequest)
+		return
+	}
+
+	// Fetch the bill, making sure it belongs to the caller
+	bill, err := s.store.Bills().GetByBooking(r.Context(), input.BookingID)
+	if err == nil && bill.UserID != auth.UserID(r) {
+		err = errBillNotFound
+	}
+	if err != nil {
+		if errors.Is(err, errBillNotFound) {
+			http.Error(w, "Billing record not found", http.StatusNotFound)
+			return
+		}
+		log.Printf("Error fetching billing record: %v", err)
+		http.Error(w, "Error fetching billing record", http.StatusInternalServerError)
+		return
+	}
+
+	// Only what is due is charged: the rest after a late cancellation's refund, or what a
+	// paid bill went up by when it was repriced
+	billingID, totalAmount := bill.BillingID, bill.amountDue()
+	if bill.PaymentStatus != PaymentStatusPending && bill.PaymentStatus != PaymentStatusFailed {
+		http.Error(w, fmt.Sprintf("Bill is already %s", bill.PaymentStatus), http.StatusConflict)
+		return
+	}
+	if totalAmount <= 0 {
+		http.Error(w, "Nothing is due on this bill", http.StatusConflict)
+		return
+	}
+
+	authorization, err := s.gateway.Authorize(r.Context(), PaymentRequest{
+		// What was paid before tells a second payment on a repriced bill from a retry of the first
+		IdempotencyKey: fmt.Sprintf("billing-%d-%.2f-%.2f", billingID, bill.AmountPaid, totalAmount),
+		Amount:         totalAmount,
+		Currency:       currency,
+		PaymentMethod:  input.PaymentMethod,
+		PaymentToken:   input.PaymentToken,
+	})
+	if err != nil {
+		log.Printf("Payment authorization failed for billing %d: %v", billingID, err)
+		err := s.store.Bills().SetPaymentStatus(r.Context(), billingID,
+			[]string{PaymentStatusPending, PaymentStatusFailed}, PaymentStatusFailed, input.PaymentMethod, "")
+		if err != nil && err != errInvalidPaymentState {
+			log.Printf("Error recording failed payment: %v", err)
+		}
+		http.Error(w, "Payment was declined", http.StatusPaymentRequired)
+		return
+	}
+
+	// Only one request may move the bill out of Pending/Failed
+	err = s.store.Bills().SetPaymentStatus(r.Context(), billingID,
+		[]string{PaymentStatusPending, PaymentStatusFailed}, PaymentStatusAuthorized, input.PaymentMethod, authorization.Reference)
+	if err != nil {
+		if err == errInvalidPaymentState {
+			http.Error(w, "Payment is already being processed", http.StatusConflict)
+			return
+		}
+		log.Printf("Error recording authorization: %v", err)
+		http.Error(w, "Error processing payment", http.StatusInternalServerError)
+		return
+	}
+
+	capture, err := s.gateway.Capture(r.Context(), authorization.Reference, totalAmount)
+	if err != nil {
+		// Pending again so the bill can be paid, cancelled or repriced. Paying again reuses
+		// the authorization, as it has the same idempotency key.
+		log.Printf("Payment capture failed for billing %d: %v", billingID, err)
+		err := s.store.Bills().SetPaymentStatus(r.Context(), billingID,
+			[]string{PaymentStatusAuthorized}, PaymentStatusPending, input.PaymentMethod, "")
+		if err != nil && err != errInvalidPaymentState {
+			log.Printf("Error recording failed capture: %v", err)
+		}
+		http.Error(w, "Payment authorized but capture failed, please try again", http.StatusBadGateway)
+		return
+	}
+
+	if err := s.settlePayment(r.Context(), authorization.Reference, capture.Amount); err != nil && err != errInvalidPaymentState {
+		log.Printf("Error recording capture: %v", err)
+		http.Error(w, "Error processing payment", http.StatusInternalServerError)
+		return
+	}
+
+	// Still Pending if the bill was repriced up while the payment went through
+	status := PaymentStatusPaid
+	if paid, err := s.store.Bills().GetByBooking(r.Context(), input.BookingID); err == nil {
+		status = paid.PaymentStatus
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message":        "Payment successful",
+		"billing_id":     billingID,
+		"payment_status": status,
+		"reference":      capture.Reference,
+		"amount":         capture.Amount,
+	})
+}
+
+// Allowed payment status transitions
+var paymentTransitions = map[string][]string{
+	PaymentStatusAuthorized: {PaymentStatusPending, PaymentStatusFailed},
+	PaymentStatusPaid:       {PaymentStatusPending, PaymentStatusAuthorized},
+	PaymentStatusFailed:     {PaymentStatusPending, PaymentStatusAuthorized},
+}
+
+// Move the billing row with the given gateway reference to a new status
+func (s *Server) transitionPayment(ctx context.Context, reference, status string) error {
+	from, ok := paymentTransitions[status]
+	if !ok {
+		return errInvalidPaymentState
+	}
+	return s.store.Bills().TransitionByReference(ctx, reference, from, status)
+}
+
+// Mark the bill with the given gateway reference Paid and record the payment captured on it.
+// A bill repriced up while the payment went through is left Pending with the rest due.
+func (s *Server) settlePayment(ctx context.Context, reference string, amount float64) error {
+	return s.store.InTx(ctx, func(bills BillStore, promotions PromotionStore, invoices InvoiceStore) error {
+		err := bills.TransitionByReference(ctx, reference, paymentTransitions[PaymentStatusPaid], PaymentStatusPaid)
+		if err != nil {
+			return err
+		}
+		if err := bills.RecordPayment(ctx, reference, amount); err != nil {
+			return err
+		}
+		bill, err := bills.GetByReference(ctx, reference)
+		if err != nil {
+			return err
+		}
+		return settleStatus(ctx, bills, bill.BookingID)
+	})
+}
+
+// Record a refund the gateway made on its own, of amount from the payment with the given
+// reference. It comes off the price like any refund, so the bill is only Refunded once all
+// of it is.
+func (s *Server) applyGatewayRefund(ctx context.Context, reference string, amount float64) error {
+	return s.store.InTx(ctx, func(bills BillStore, promotions PromotionStore, invoices InvoiceStore) error {
+		bill, err := bills.GetByReference(ctx, reference)
+		if err != nil {
+			return err
+		}
+		// Locked so a payment or another refund can't land at the same time
+		bill, err = bills.LockByBooking(ctx, bill.BookingID)
+		if err != nil {
+			return err
+		}
+
+		payments, err := bills.Payments(ctx, bill.BillingID)
+		if err != nil {
+			return err
+		}
+		for _, payment := range payments {
+			if payment.GatewayReference == reference {
+				amount = math.Min(amount, roundCents(payment.Amount-payment.Refunded))
+			}
+		}
+		if amount <= 0 {
+			return errInvalidPaymentState
+		}
+
+		percentage := 100.0
+		if bill.TotalAmount > 0 {
+			percentage = math.Min(100, roundCents(amount/bill.TotalAmount*100))
+		}
+		_, err = bills.AddRefund(ctx, Refund{
+			BillingID:        bill.BillingID,
+			Kind:             RefundKindGateway,
+			Status:           RefundStatusCompleted,
+			Amount:           amount,
+			Percentage:       percentage,
+			Reason:           "Refunded through the payment gateway",
+			GatewayReference: reference,
+		})
+		if err != nil {
+			return err
+		}
+		if roundCents(bill.TotalAmount-bill.RefundedAmount-amount) <= 0 {
+			return bills.MarkRefunded(ctx, bill.BookingID)
+		}
+		return settleStatus(ctx, bills, bill.BookingID)
+	})
+}
+
+// Bring a bill's status in line with what is due after its amounts changed: a paid bill
+// that now owes more is Pending again, and an unpaid one whose balance is covered is Paid
+func settleStatus(ctx context.Context, bills BillStore, bookingID int) error {
+	bill, err := bills.GetByBooking(ctx, bookingID)
+	if err != nil {
+		return err
+	}
+	due := bill.amountDue()
+	switch {
+	case due > 0 && bill.PaymentStatus == PaymentStatusPaid:
+		return bills.SetPaymentStatus(ctx, bill.BillingID, []string{PaymentStatusPaid},
+			PaymentStatusPending, bill.PaymentMethod, "")
+	case due == 0 && bill.AmountPaid > 0 && (bill.PaymentStatus == PaymentStatusPending || bill.PaymentStatus == PaymentStatusFailed):
+		return bills.SetPaymentStatus(ctx, bill.BillingID, []string{PaymentStatusPending, PaymentStatusFailed},
+			PaymentStatusPaid, bill.PaymentMethod, "")
+	}
+	return nil
+}
+
+// Receives payment events from the gateway. Requests must carry an
+// X-Gateway-Signature header: hex HMAC-SHA256 of the body with PAYMENT_WEBHOOK_SECRET.
+func (s *Server) paymentWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, "Invalid input", http.StatusBadRequest)
+		return
+	}
+
+	if !s.verifyWebhookSignature(body, r.Header.Get("X-Gateway-Signature")) {
+		http.Error(w, "Invalid signature", http.StatusUnauthorized)
+		return
+	}
+
+	var event PaymentEvent
+	if err := json.Unmarshal(body, &event); err != nil || event.EventID == "" || event.Reference == "" {
+		http.Error(w, "Invalid event", http.StatusBadRequest)
+		return
+	}
+
+	var status string
+	switch event.Type {
+	case PaymentEventAuthorized:
+		status = PaymentStatusAuthorized
+	case PaymentEventCaptured:
+		status = PaymentStatusPaid
+	case PaymentEventFailed:
+		status = PaymentStatusFailed
+	case PaymentEventRefunded:
+		status = PaymentStatusRefunded
+		if event.IdempotencyKey != "" {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+	default:
+		// Acknowledge events we don't care about so the gateway stops retrying
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	// Gateways redeliver events, so each one is only applied once
+	processed, err := s.store.PaymentEvents().Record(r.Context(), event)
+	if err != nil {
+		log.Printf("Error recording payment event: %v", err)
+		http.Error(w, "Error processing event", http.StatusInternalServerError)
+		return
+	}
+	if processed {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	switch status {
+	case PaymentStatusPaid:
+		// A capture collects money on the bill as well as settling it
+		err = s.settlePayment(r.Context(), event.Reference, event.Amount)
+	case PaymentStatusRefunded:
+		err = s.applyGatewayRefund(r.Context(), event.Reference, event.Amount)
+	default:
+		err = s.transitionPayment(r.Context(), event.Reference, status)
+	}
+	if err != nil {
+		if err != errInvalidPaymentState && err != errBillNotFound {
+			log.Printf("Error applying payment event %s: %v", event.EventID, err)
+			http.Error(w, "Error processing event", http.StatusInternalServerError)
+			return
+		}
+		// Out of order or duplicate state change, nothing to do
+		log.Printf("Ignoring payment event %s (%s) for %s", event.EventID, event.Type, event.Reference)
+	}
+
+	if err := s.store.PaymentEvents().MarkProcessed(r.Context(), event.EventID); err != nil {
+		log.Printf("Error marking payment event processed: %v", err)
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func (s *Server) verifyWebhookSignature(body []byte, signature string) bool {
+	if len(s.webhookSecret) == 0 {
+		log.Println("PAYMENT_WEBHOOK_SECRET not set, rejecting webhook")
+		return false
+	}
+
+	mac := hmac.New(sha256.New, s.webhookSecret)
+	mac.Write(body)
+	expected := hex.EncodeToString(mac.Sum(nil))
+	return hmac.Equal([]byte(expected), []byte(signature))
+}
+
+// Give amount back on the bill, newest payment first, as refunds like refund: of its kind,
+// percentage and reason. They are recorded Pending and returned, for sendRefunds to make
+// once the transaction has committed.
+func payBack(ctx context.Context, bills BillStore, bill Billing, amount float64, refund Refund) ([]Refund, error) {
+	payments, err := bills.Payments(ctx, bill.BillingID)
+	if err != nil {
+		return nil, err
+	}
+	var refunds []Refund
+	for i := len(payments) - 1; i >= 0 && amount > 0; i-- {
+		part := math.Min(amount, roundCents(payments[i].Amount-payments[i].Refunded))
+		if part <= 0 {
+			continue
+		}
+		refund.BillingID, refund.Amount, refund.Status = bill.BillingID, part, RefundStatusPending
+		refund.GatewayReference = payments[i].GatewayReference
+		refund.RefundID, err = bills.AddRefund(ctx, refund)
+		if err != nil {
+			return nil, err
+		}
+		refunds = append(refunds, refund)
+		amount = roundCents(amount - part)
+	}
+	return refunds, nil
+}
+
+// Refund amount of the bill, described by refund. The customer gets back whatever they have
+// paid beyond what they now owe; the rest of the refund only lowers what they owe. Returns
+// the refunds for sendRefunds to make.
+func refundBill(ctx context.Context, bills BillStore, bill Billing, amount float64, refund Refund) ([]Refund, error) {
+	owed := roundCents(bill.TotalAmount - bill.RefundedAmount - amount)
+	back := math.Min(amount, math.Max(0, roundCents(bill.AmountPaid-owed)))
+	refunds, err := payBack(ctx, bills, bill, back, refund)
+	if err != nil {
+		return nil, err
+	}
+
+	credit := amount
+	for _, r := range refunds {
+		credit = roundCents(credit - r.Amount)
+	}
+	if credit > 0 {
+		refund.BillingID, refund.Amount, refund.Status = bill.BillingID, credit, RefundStatusCompleted
+		if _, err := bills.AddRefund(ctx, refund); err != nil {
+			return nil, err
+		}
+	}
+	return refunds, nil
+}
+
+// How often refunds the gateway failed to make are tried again
+const refundRetryInterval = time.Minute
+
+// Make pending refunds through the gateway and mark them Completed. Any the gateway fails
+// to make stay Pending for RetryRefunds.
+func (s *Server) sendRefunds(ctx context.Context, refunds []Refund) {
+	for _, refund := range refunds {
+		if refund.Status != RefundStatusPending {
+			continue
+		}
+		// Keyed by the refund so a retry never refunds twice
+		_, err := s.gateway.Refund(ctx, refund.GatewayReference, refund.Amount, fmt.Sprintf("refund-%d", refund.RefundID))
+		if err != nil {
+			log.Printf("Error making refund %d of $%.2f on bill %d, it will be retried: %v", refund.RefundID, refund.Amount, refund.BillingID, err)
+			continue
+		}
+		if err := s.store.Bills().CompleteRefund(ctx, refund.RefundID); err != nil {
+			log.Printf("Error completing refund %d: %v", refund.RefundID, err)
+		}
+	}
+}
+
+// RetryRefunds makes the refunds left pending by gateway failures until ctx is cancelled
+func (s *Server) RetryRefunds(ctx context.Context) {
+	ticker := time.NewTicker(refundRetryInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.retryRefunds(ctx)
+		}
+	}
+}
+
+func (s *Server) retryRefunds(ctx context.Context) {
+	refunds, err := s.store.Bills().PendingRefunds(ctx)
+	if err != nil {
+		log.Printf("Error fetching pending refunds: %v", err)
+		return
+	}
+	s.sendRefunds(ctx, refunds)
+}
@@ -0,0 +1,300 @@
+package billingservice
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/yongkaiyu/CNAD_Assg1/internal/auth"
+)
+
+func TestMockGatewayAuthorize(t *testing.T) {
+	tests := []struct {
+		name    string
+		token   string
+		amount  float64
+		wantErr error
+	}{
+		{"approved", "tok_visa", 42.50, nil},
+		{"declined card", "tok_decline", 42.50, errPaymentDeclined},
+		{"nothing to pay", "tok_visa", 0, errPaymentDeclined},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := newMockPaymentGateway()
+			result, err := g.Authorize(context.Background(), PaymentRequest{
+				Amount: tt.amount, Currency: currency, PaymentToken: tt.token,
+			})
+			if err != tt.wantErr {
+				t.Fatalf("Authorize() error = %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && (result.Status != PaymentStatusAuthorized || result.Amount != tt.amount) {
+				t.Errorf("Authorize() = %+v, want %s for %.2f", result, PaymentStatusAuthorized, tt.amount)
+			}
+		})
+	}
+}
+
+func TestMockGatewayAuthorizeIsIdempotent(t *testing.T) {
+	g := newMockPaymentGateway()
+	req := PaymentRequest{IdempotencyKey: "billing-1-42.50", Amount: 42.50, Currency: currency, PaymentToken: "tok_visa"}
+
+	first, err := g.Authorize(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := g.Authorize(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.Reference != second.Reference {
+		t.Errorf("repeated Authorize gave reference %s, want %s", second.Reference, first.Reference)
+	}
+	if len(g.payments) != 1 {
+		t.Errorf("gateway holds %d payments, want 1", len(g.payments))
+	}
+}
+
+func TestMockGatewayCaptureAndRefund(t *testing.T) {
+	tests := []struct {
+		name    string
+		capture float64
+		refunds []float64
+		wantErr error
+		status  string
+	}{
+		{"capture", 42.50, nil, nil, PaymentStatusPaid},
+		{"capture more than authorized", 50, nil, errInvalidPaymentState, PaymentStatusAuthorized},
+		{"partial refund", 42.50, []float64{20}, nil, PaymentStatusPaid},
+		{"full refund", 42.50, []float64{20, 22.50}, nil, PaymentStatusRefunded},
+		{"refund more than captured", 42.50, []float64{42.51}, errInvalidPaymentState, PaymentStatusPaid},
+		{"refunds add up to more than captured", 42.50, []float64{30, 30}, errInvalidPaymentState, PaymentStatusPaid},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			g := newMockPaymentGateway()
+			auth, err := g.Authorize(ctx, PaymentRequest{Amount: 42.50, Currency: currency, PaymentToken: "tok_visa"})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			_, err = g.Capture(ctx, auth.Reference, tt.capture)
+			for _, amount := range tt.refunds {
+				if err != nil {
+					break
+				}
+				_, err = g.Refund(ctx, auth.Reference, amount, "")
+			}
+			if err != tt.wantErr {
+				t.Fatalf("error = %v, want %v", err, tt.wantErr)
+			}
+			if status := g.payments[auth.Reference].status; status != tt.status {
+				t.Errorf("payment status = %s, want %s", status, tt.status)
+			}
+		})
+	}
+}
+
+// Create a bill for booking 1 that the gateway has authorized as ref_1
+func createAuthorizedBill(t *testing.T, store *MemoryStore) *Billing {
+	t.Helper()
+	ctx := context.Background()
+	bill, err := store.Bills().Create(ctx, 1, 1, 42.50)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = store.Bills().SetPaymentStatus(ctx, bill.BillingID,
+		[]string{PaymentStatusPending}, PaymentStatusAuthorized, PaymentMethodCreditCard, "ref_1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return bill
+}
+
+func sendWebhook(server *testServer, event PaymentEvent, secret string) *httptest.ResponseRecorder {
+	body, _ := json.Marshal(event)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/billing/webhook", strings.NewReader(string(body)))
+	req.Header.Set("X-Gateway-Signature", hex.EncodeToString(mac.Sum(nil)))
+	rec := httptest.NewRecorder()
+	server.Routes().ServeHTTP(rec, req)
+	return rec
+}
+
+func TestWebhookRejectsBadSignature(t *testing.T) {
+	server := newTestServer(t)
+	createAuthorizedBill(t, server.store)
+
+	event := PaymentEvent{EventID: "evt_1", Type: PaymentEventCaptured, Reference: "ref_1", Amount: 42.50}
+	if rec := sendWebhook(server, event, "not the secret"); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusUnauthorized)
+	}
+
+	bill, err := server.store.Bills().GetByBooking(context.Background(), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bill.PaymentStatus != PaymentStatusAuthorized {
+		t.Errorf("payment status = %s, want %s", bill.PaymentStatus, PaymentStatusAuthorized)
+	}
+}
+
+func TestWebhookIgnoresDuplicateEvent(t *testing.T) {
+	server := newTestServer(t)
+	createAuthorizedBill(t, server.store)
+
+	failed := PaymentEvent{EventID: "evt_1", Type: PaymentEventFailed, Reference: "ref_1"}
+	authorized := PaymentEvent{EventID: "evt_2", Type: PaymentEventAuthorized, Reference: "ref_1", Amount: 42.50}
+
+	// Redelivering evt_1 would fail the bill again if it were applied twice
+	for i, event := range []PaymentEvent{failed, authorized, failed} {
+		if rec := sendWebhook(server, event, testWebhookSecret); rec.Code != http.StatusOK {
+			t.Fatalf("event %d: status = %d, want %d", i, rec.Code, http.StatusOK)
+		}
+	}
+
+	bill, err := server.store.Bills().GetByBooking(context.Background(), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bill.PaymentStatus != PaymentStatusAuthorized {
+		t.Errorf("payment status = %s, want %s", bill.PaymentStatus, PaymentStatusAuthorized)
+	}
+}
+
+func TestWebhookSettlesBill(t *testing.T) {
+	tests := []struct {
+		name   string
+		total  float64
+		events []PaymentEvent
+		// Of the bill after the events
+		wantStatus   string
+		wantRefunded float64
+		wantDue      float64
+	}{
+		{
+			name:       "captured",
+			total:      42.50,
+			events:     []PaymentEvent{{Type: PaymentEventCaptured, Amount: 42.50}},
+			wantStatus: PaymentStatusPaid,
+		},
+		{
+			name:       "captured after the bill was repriced up",
+			total:      50,
+			events:     []PaymentEvent{{Type: PaymentEventCaptured, Amount: 42.50}},
+			wantStatus: PaymentStatusPending, wantDue: 7.50,
+		},
+		{
+			name:  "partly refunded by the gateway",
+			total: 42.50,
+			events: []PaymentEvent{
+				{Type: PaymentEventCaptured, Amount: 42.50},
+				{Type: PaymentEventRefunded, Amount: 20},
+			},
+			wantStatus: PaymentStatusPaid, wantRefunded: 20,
+		},
+		{
+			name:  "fully refunded by the gateway",
+			total: 42.50,
+			events: []PaymentEvent{
+				{Type: PaymentEventCaptured, Amount: 42.50},
+				{Type: PaymentEventRefunded, Amount: 20},
+				{Type: PaymentEventRefunded, Amount: 22.50},
+			},
+			wantStatus: PaymentStatusRefunded, wantRefunded: 42.50,
+		},
+		{
+			name:  "refund we asked for",
+			total: 42.50,
+			events: []PaymentEvent{
+				{Type: PaymentEventCaptured, Amount: 42.50},
+				{Type: PaymentEventRefunded, Amount: 20, IdempotencyKey: "refund-1"},
+			},
+			wantStatus: PaymentStatusPaid,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			server := newTestServer(t)
+			createAuthorizedBill(t, server.store)
+			if err := server.store.Bills().SetTotal(ctx, 1, tt.total); err != nil {
+				t.Fatal(err)
+			}
+
+			for i, event := range tt.events {
+				event.EventID, event.Reference = fmt.Sprintf("evt_%d", i), "ref_1"
+				if rec := sendWebhook(server, event, testWebhookSecret); rec.Code != http.StatusOK {
+					t.Fatalf("event %d: status = %d, want %d", i, rec.Code, http.StatusOK)
+				}
+			}
+
+			bill, err := server.store.Bills().GetByBooking(ctx, 1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if bill.PaymentStatus != tt.wantStatus || bill.RefundedAmount != tt.wantRefunded || bill.amountDue() != tt.wantDue {
+				t.Errorf("bill = %s with $%.2f refunded and $%.2f due, want %s with $%.2f and $%.2f",
+					bill.PaymentStatus, bill.RefundedAmount, bill.amountDue(), tt.wantStatus, tt.wantRefunded, tt.wantDue)
+			}
+		})
+	}
+}
+
+// A gateway whose captures fail while down
+type captureFailingGateway struct {
+	PaymentGateway
+	down bool
+}
+
+func (g *captureFailingGateway) Capture(ctx context.Context, reference string, amount float64) (*PaymentResult, error) {
+	if g.down {
+		return nil, errors.New("gateway unavailable")
+	}
+	return g.PaymentGateway.Capture(ctx, reference, amount)
+}
+
+func TestPaymentCaptureFails(t *testing.T) {
+	ts := newTestServer(t)
+	gateway := &captureFailingGateway{PaymentGateway: ts.gateway, down: true}
+	ts.Server.gateway = gateway
+	start := time.Now().UTC().Add(48 * time.Hour).Truncate(time.Hour)
+	if rec := ts.createBill(t, start, ""); rec.Code != http.StatusCreated {
+		t.Fatalf("creating bill: status = %d: %s", rec.Code, rec.Body)
+	}
+
+	token, err := auth.IssueAccessToken(1, auth.RoleCustomer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/billing/pay",
+		strings.NewReader(`{"booking_id": 1, "payment_method": "Credit Card", "payment_token": "tok_visa"}`))
+	req.Header.Set("Authorization", "Bearer "+token)
+	rec := httptest.NewRecorder()
+	ts.Routes().ServeHTTP(rec, req)
+	if rec.Code != http.StatusBadGateway {
+		t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusBadGateway, rec.Body)
+	}
+
+	// Not stuck Authorized: the bill can be paid again, reusing the authorization
+	if bill := ts.bill(t); bill.PaymentStatus != PaymentStatusPending {
+		t.Fatalf("payment status = %s, want %s", bill.PaymentStatus, PaymentStatusPending)
+	}
+	gateway.down = false
+	ts.pay(t)
+	if bill := ts.bill(t); bill.PaymentStatus != PaymentStatusPaid || len(ts.gateway.payments) != 1 {
+		t.Errorf("bill = %s with %d gateway payments, want %s with 1", bill.PaymentStatus, len(ts.gateway.payments), PaymentStatusPaid)
+	}
+}
@@ -0,0 +1,391 @@
+package billingservice
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/yongkaiyu/CNAD_Assg1/internal/auth"
+	"github.com/yongkaiyu/CNAD_Assg1/internal/clients"
+)
+
+const (
+	BillingUnitHour   = "hour"
+	BillingUnitMinute = "minute"
+)
+
+var (
+	errInvalidBookingWindow = errors.New("end time must be after start time")
+	errVehicleNotFound      = errors.New("vehicle not found")
+	errMembershipNotFound   = errors.New("membership tier not found")
+)
+
+// RateCard holds the pricing rules for one vehicle class.
+// Units that start inside [PeakStartHour, PeakEndHour) are charged at UnitRate * PeakMultiplier.
+// Peak hours are local time in the pricing time zone (PRICING_TIME_ZONE), not UTC.
+type RateCard struct {
+	VehicleClass   string  `json:"vehicle_class"`
+	BillingUnit    string  `json:"billing_unit"`
+	UnitRate       float64 `json:"unit_rate"`
+	PeakMultiplier float64 `json:"peak_multiplier"`
+	PeakStartHour  int     `json:"peak_start_hour"`
+	PeakEndHour    int     `json:"peak_end_hour"`
+}
+
+// PriceQuote is the itemised price of a booking window
+type PriceQuote struct {
+	VehicleID             int       `json:"vehicle_id"`
+	VehicleClass          string    `json:"vehicle_class"`
+	StartTime             time.Time `json:"start_time"`
+	EndTime               time.Time `json:"end_time"`
+	DurationMinutes       int       `json:"duration_minutes"`
+	BillingUnit           string    `json:"billing_unit"`
+	BillableUnits         int       `json:"billable_units"`
+	PeakUnits             int       `json:"peak_units"`
+	BaseRate              float64   `json:"base_rate"`
+	PeakMultiplier        float64   `json:"peak_multiplier"`
+	BaseAmount            float64   `json:"base_amount"`
+	PeakSurcharge         float64   `json:"peak_surcharge"`
+	Subtotal              float64   `json:"subtotal"`
+	MembershipTier        string    `json:"membership_tier"`
+	TierDiscountRate      float64   `json:"tier_discount_rate"`
+	TierDiscount          float64   `json:"tier_discount"`
+	PromotionID           int       `json:"promotion_id,omitempty"`
+	PromotionName         string    `json:"promotion_name,omitempty"`
+	PromotionCode         string    `json:"promotion_code,omitempty"`
+	PromotionDiscountRate float64   `json:"promotion_discount_rate"`
+	PromotionDiscount     float64   `json:"promotion_discount"`
+	// Late fees are charged on top, after the discounts
+	LateIntervals int     `json:"late_intervals"`
+	LateFeeRate   float64 `json:"late_fee_rate"`
+	LateFee       float64 `json:"late_fee"`
+	// Sales tax on everything above
+	TaxName string  `json:"tax_name"`
+	TaxRate float64 `json:"tax_rate"`
+	Tax     float64 `json:"tax"`
+	Total   float64 `json:"total"`
+	// How the total was worked out, one line per step, for showing to the user
+	Explanation []string `json:"explanation"`
+}
+
+// What to price. PromoCode is the code the user entered, if any. A booking being repriced
+// keeps the promotion it was made with, passed as Redeemed, without checking it again, and
+// gets no new one as nothing would redeem it. A trip that ends after LateAfter, if set, is
+// charged late fees.
+type quoteRequest struct {
+	UserID    int
+	VehicleID int
+	StartTime time.Time
+	EndTime   time.Time
+	PromoCode string
+	Reprice   bool
+	Redeemed  *Promotion
+	LateAfter time.Time
+	// Automatic promotions to leave out, such as ones that ran out while billing
+	Without []int
+}
+
+// Used when a vehicle class has no rate card configured
+func (s *Server) defaultRateCard(vehicleClass string) RateCard {
+	if vehicleClass == "" {
+		vehicleClass = s.pricing.DefaultVehicleClass
+	}
+	return RateCard{
+		VehicleClass:   vehicleClass,
+		BillingUnit:    BillingUnitHour,
+		UnitRate:       s.pricing.DefaultHourlyRate,
+		PeakMultiplier: 1,
+	}
+}
+
+// Fetch the rate card for a vehicle's class. The class comes from the vehicle service.
+func (s *Server) rateCardForVehicle(ctx context.Context, vehicleID int) (RateCard, error) {
+	vehicle, err := s.vehicles.GetVehicle(ctx, vehicleID)
+	if err != nil {
+		if clients.IsNotFound(err) {
+			return RateCard{}, errVehicleNotFound
+		}
+		return RateCard{}, err
+	}
+
+	card, err := s.store.RateCards().Get(ctx, vehicle.VehicleClass)
+	if err != nil {
+		if errors.Is(err, errRateCardNotFound) {
+			return s.defaultRateCard(vehicle.VehicleClass), nil
+		}
+		return RateCard{}, err
+	}
+
+	return *card, nil
+}
+
+// Work out the price of a booking window before any discounts, with peak hours in loc
+func applyRateCard(card RateCard, loc *time.Location, startTime, endTime time.Time) PriceQuote {
+	unit := time.Hour
+	if card.BillingUnit == BillingUnitMinute {
+		unit = time.Minute
+	}
+
+	duration := endTime.Sub(startTime)
+	units := int(math.Ceil(float64(duration) / float64(unit)))
+
+	// Count the units that start inside the peak window
+	peakUnits := 0
+	if card.PeakMultiplier > 1 {
+		for i := 0; i < units; i++ {
+			if isPeakHour(card, startTime.Add(time.Duration(i)*unit).In(loc).Hour()) {
+				peakUnits++
+			}
+		}
+	}
+
+	baseAmount := float64(units) * card.UnitRate
+	peakSurcharge := float64(peakUnits) * card.UnitRate * (card.PeakMultiplier - 1)
+
+	return PriceQuote{
+		VehicleClass:    card.VehicleClass,
+		StartTime:       startTime,
+		EndTime:         endTime,
+		DurationMinutes: int(math.Ceil(duration.Minutes())),
+		BillingUnit:     card.BillingUnit,
+		BillableUnits:   units,
+		PeakUnits:       peakUnits,
+		BaseRate:        card.UnitRate,
+		PeakMultiplier:  card.PeakMultiplier,
+		BaseAmount:      roundCents(baseAmount),
+		PeakSurcharge:   roundCents(peakSurcharge),
+		Subtotal:        roundCents(baseAmount + peakSurcharge),
+	}
+}
+
+// The peak window may wrap past midnight, e.g. 22 to 6
+func isPeakHour(card RateCard, hour int) bool {
+	if card.PeakStartHour == card.PeakEndHour {
+		return false
+	}
+	if card.PeakStartHour < card.PeakEndHour {
+		return hour >= card.PeakStartHour && hour < card.PeakEndHour
+	}
+	return hour >= card.PeakStartHour || hour < card.PeakEndHour
+}
+
+// Price a booking window for a user: rate card, then tier discount, then one promotion
+func (s *Server) calculateQuote(ctx context.Context, req quoteRequest) (*PriceQuote, error) {
+	if !req.EndTime.After(req.StartTime) {
+		return nil, errInvalidBookingWindow
+	}
+
+	card, err := s.rateCardForVehicle(ctx, req.VehicleID)
+	if err != nil {
+		return nil, err
+	}
+
+	quote := applyRateCard(card, s.location, req.StartTime, req.EndTime)
+	quote.VehicleID = req.VehicleID
+
+	// Fetch the discount rate for the user's membership tier
+	membership, err := s.users.GetMembership(ctx, req.UserID)
+	if err != nil {
+		if clients.IsNotFound(err) {
+			return nil, errMembershipNotFound
+		}
+		return nil, err
+	}
+	quote.MembershipTier = membership.Tier
+	quote.TierDiscountRate = membership.DiscountRate
+	quote.TierDiscount = roundCents(quote.Subtotal * (quote.TierDiscountRate / 100))
+
+	// The promotion applies to what remains after the tier discount
+	notes, err := s.choosePromotion(ctx, s.store.Promotions(), req, &quote)
+	if err != nil {
+		return nil, err
+	}
+	afterTier := quote.Subtotal - quote.TierDiscount
+	quote.PromotionDiscount = roundCents(afterTier * (quote.PromotionDiscountRate / 100))
+
+	// Every interval past the grace, or part of one, costs the late fee
+	if !req.LateAfter.IsZero() && req.EndTime.After(req.LateAfter) && s.pricing.LateFee > 0 {
+		late := req.EndTime.Sub(req.LateAfter)
+		quote.LateIntervals = int(math.Ceil(float64(late) / float64(s.pricing.LateFeeInterval)))
+		quote.LateFeeRate = s.pricing.LateFee
+		quote.LateFee = roundCents(float64(quote.LateIntervals) * s.pricing.LateFee)
+	}
+	beforeTax := roundCents(afterTier - quote.PromotionDiscount + quote.LateFee)
+	quote.TaxName, quote.TaxRate = s.pricing.TaxName, s.pricing.TaxRate
+	quote.Tax = roundCents(beforeTax * (quote.TaxRate / 100))
+	quote.Total = roundCents(beforeTax + quote.Tax)
+
+	quote.Explanation = explainQuote(quote, notes)
+	return &quote, nil
+}
+
+// Describe each step of the price, with notes about the promotion before the total
+func explainQuote(q PriceQuote, notes []string) []string {
+	lines := []string{fmt.Sprintf("%d %s(s) at $%.2f = $%.2f", q.BillableUnits, q.BillingUnit, q.BaseRate, q.BaseAmount)}
+	if q.PeakSurcharge > 0 {
+		lines = append(lines, fmt.Sprintf("%d peak %s(s) at %gx the rate: +$%.2f", q.PeakUnits, q.BillingUnit, q.PeakMultiplier, q.PeakSurcharge))
+	}
+	if q.TierDiscount > 0 {
+		lines = append(lines, fmt.Sprintf("%s membership discount of %g%%: -$%.2f", q.MembershipTier, q.TierDiscountRate, q.TierDiscount))
+	}
+	switch {
+	case q.PromotionCode != "":
+		lines = append(lines, fmt.Sprintf("Promo code %s (%s), %g%% off: -$%.2f", q.PromotionCode, q.PromotionName, q.PromotionDiscountRate, q.PromotionDiscount))
+	case q.PromotionName != "":
+		lines = append(lines, fmt.Sprintf("Promotion %s, %g%% off: -$%.2f", q.PromotionName, q.PromotionDiscountRate, q.PromotionDiscount))
+	}
+	if q.LateFee > 0 {
+		lines = append(lines, fmt.Sprintf("Late return, %d interval(s) at $%.2f: +$%.2f", q.LateIntervals, q.LateFeeRate, q.LateFee))
+	}
+	if q.Tax > 0 {
+		lines = append(lines, fmt.Sprintf("%s of %g%%: +$%.2f", q.TaxName, q.TaxRate, q.Tax))
+	}
+	lines = append(lines, notes...)
+	return append(lines, fmt.Sprintf("Total: $%.2f", q.Total))
+}
+
+// The charges and discounts of a quote, before tax, as line items on the bill
+func (s *Server) quoteLineItems(q PriceQuote) []LineItem {
+	items := []LineItem{{
+		Kind: LineItemRental,
+		Description: fmt.Sprintf("%s rental of vehicle %d, %s to %s",
+			q.VehicleClass, q.VehicleID, q.StartTime.UTC().Format(timeLayout), q.EndTime.UTC().Format(timeLayout)),
+		Quantity:   q.BillableUnits,
+		UnitAmount: q.BaseRate,
+		Amount:     q.BaseAmount,
+	}}
+	if q.PeakSurcharge > 0 {
+		items = append(items, LineItem{
+			Kind:        LineItemPeakSurcharge,
+			Description: fmt.Sprintf("Peak %s(s) at %gx the rate", q.BillingUnit, q.PeakMultiplier),
+			Quantity:    q.PeakUnits,
+			UnitAmount:  roundCents(q.BaseRate * (q.PeakMultiplier - 1)),
+			Amount:      q.PeakSurcharge,
+		})
+	}
+	if q.TierDiscount > 0 {
+		items = append(items, LineItem{
+			Kind:        LineItemTierDiscount,
+			Description: fmt.Sprintf("%s membership discount of %g%%", q.MembershipTier, q.TierDiscountRate),
+			Quantity:    1,
+			UnitAmount:  -q.TierDiscount,
+			Amount:      -q.TierDiscount,
+		})
+	}
+	if q.PromotionDiscount > 0 {
+		description := fmt.Sprintf("Promotion %s, %g%% off", q.PromotionName, q.PromotionDiscountRate)
+		if q.PromotionCode != "" {
+			description = fmt.Sprintf("Promo code %s (%s), %g%% off", q.PromotionCode, q.PromotionName, q.PromotionDiscountRate)
+		}
+		items = append(items, LineItem{
+			Kind:        LineItemPromotion,
+			Description: description,
+			Quantity:    1,
+			UnitAmount:  -q.PromotionDiscount,
+			Amount:      -q.PromotionDiscount,
+		})
+	}
+	if q.LateFee > 0 {
+		items = append(items, LineItem{
+			Kind:        LineItemLateFee,
+			Description: fmt.Sprintf("Late return, returned %s, %s per late fee", q.EndTime.UTC().Format(timeLayout), s.pricing.LateFeeInterval),
+			Quantity:    q.LateIntervals,
+			UnitAmount:  q.LateFeeRate,
+			Amount:      q.LateFee,
+		})
+	}
+	return items
+}
+
+func roundCents(amount float64) float64 {
+	return math.Round(amount*100) / 100
+}
+
+// Accepts both the RFC 3339 times sent by the booking page and MySQL's DATETIME format
+func parseBookingTime(value string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	return time.Parse(timeLayout, value)
+}
+
+// quoteHandler returns an itemised price for a prospective booking.
+//
+//	GET /api/v1/billing/quote?vehicle_id=1&start_time=2024-12-01T09:00:00Z&end_time=2024-12-01T11:30:00Z&promo_code=SAVE10
+//
+// start_time and end_time accept RFC 3339 or "YYYY-MM-DD HH:MM:SS" and promo_code is optional.
+// The response is a PriceQuote: base rate and billable units from the vehicle class's rate card,
+// any peak surcharge, the caller's tier discount, the promotion discount, the total and an
+// explanation of each step.
+func (s *Server) quoteHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	params := r.URL.Query()
+	vehicleID, err := strconv.Atoi(params.Get("vehicle_id"))
+	if err != nil {
+		http.Error(w, "vehicle_id parameter is required", http.StatusBadRequest)
+		return
+	}
+
+	startTime, err := parseBookingTime(params.Get("start_time"))
+	if err != nil {
+		http.Error(w, "Invalid start_time", http.StatusBadRequest)
+		return
+	}
+
+	endTime, err := parseBookingTime(params.Get("end_time"))
+	if err != nil {
+		http.Error(w, "Invalid end_time", http.StatusBadRequest)
+		return
+	}
+
+	quote, err := s.calculateQuote(r.Context(), quoteRequest{
+		UserID:    auth.UserID(r),
+		VehicleID: vehicleID,
+		StartTime: startTime,
+		EndTime:   endTime,
+		PromoCode: params.Get("promo_code"),
+	})
+	if err != nil {
+		writeQuoteError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(quote)
+}
+
+// Map pricing errors to HTTP responses
+func writeQuoteError(w http.ResponseWriter, err error) {
+	switch err {
+	case errInvalidBookingWindow:
+		http.Error(w, "End time must be after start time", http.StatusBadRequest)
+	case errVehicleNotFound:
+		http.Error(w, "Vehicle not found", http.StatusNotFound)
+	case errMembershipNotFound:
+		http.Error(w, "Membership tier not found", http.StatusNotFound)
+	default:
+		var promotionErr *promotionError
+		if errors.As(err, &promotionErr) {
+			http.Error(w, promotionErr.Error(), http.StatusBadRequest)
+			return
+		}
+		var serviceErr *clients.Error
+		if errors.As(err, &serviceErr) {
+			log.Printf("Error calculating quote: %v", err)
+			http.Error(w, "Error calculating price", http.StatusBadGateway)
+			return
+		}
+		log.Printf("Error calculating quote: %v", err)
+		http.Error(w, "Error calculating price", http.StatusInternalServerError)
+	}
+}
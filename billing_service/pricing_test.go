@@ -0,0 +1,42 @@
+package billingservice
+
+import (
+	"testing"
+	"time"
+)
+
+func TestApplyRateCardPeakHours(t *testing.T) {
+	singapore, err := time.LoadLocation("Asia/Singapore")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Peak from 8am to 10am local time at half as much again
+	card := RateCard{VehicleClass: "Standard", BillingUnit: BillingUnitHour, UnitRate: 10, PeakMultiplier: 1.5, PeakStartHour: 8, PeakEndHour: 10}
+
+	tests := []struct {
+		name          string
+		loc           *time.Location
+		start         string
+		wantPeakUnits int
+	}{
+		// 7am to 9am in Singapore
+		{"into the peak in Singapore", singapore, "2025-01-06T23:00:00Z", 1},
+		{"the same window in UTC", time.UTC, "2025-01-06T23:00:00Z", 0},
+		// 9am to 11am in Singapore
+		{"out of the peak in Singapore", singapore, "2025-01-07T01:00:00Z", 1},
+		// 8am to 10am in Singapore
+		{"all peak in Singapore", singapore, "2025-01-07T00:00:00Z", 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start, err := time.Parse(time.RFC3339, tt.start)
+			if err != nil {
+				t.Fatal(err)
+			}
+			quote := applyRateCard(card, tt.loc, start, start.Add(2*time.Hour))
+			if quote.PeakUnits != tt.wantPeakUnits || quote.PeakSurcharge != float64(tt.wantPeakUnits)*5 {
+				t.Errorf("peak units = %d with $%.2f surcharge, want %d", quote.PeakUnits, quote.PeakSurcharge, tt.wantPeakUnits)
+			}
+		})
+	}
+}
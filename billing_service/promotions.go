@@ -0,0 +1,351 @@
+package billingservice
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/yongkaiyu/CNAD_Assg1/internal/auth"
+)
+
+// promotionError says why a promotion can't be applied, in words for the user
+type promotionError struct {
+	subject string
+	reason  string
+}
+
+func (e *promotionError) Error() string { return e.subject + " " + e.reason }
+
+// How a promotion is named to the user: by its code if it has one
+func promotionSubject(p Promotion) string {
+	if p.Code != "" {
+		return "Promo code " + p.Code
+	}
+	return "Promotion " + p.Name
+}
+
+// Check that userID may have promotion p on quote, whose tier and tier discount are already set.
+// The minimum spend is compared with the price after the tier discount.
+func (s *Server) checkPromotion(ctx context.Context, promotions PromotionStore, p Promotion, userID int, quote *PriceQuote) error {
+	now := time.Now()
+	reason := ""
+	switch {
+	case !p.Active:
+		reason = "is no longer available"
+	case now.Before(p.StartDate):
+		reason = "starts on " + p.StartDate.Format("2 Jan 2006")
+	case now.After(p.ExpiryDate):
+		reason = "expired on " + p.ExpiryDate.Format("2 Jan 2006")
+	case len(p.EligibleTiers) > 0 && !slices.Contains(p.EligibleTiers, quote.MembershipTier):
+		reason = fmt.Sprintf("is only for %s members", strings.Join(p.EligibleTiers, " and "))
+	case quote.Subtotal-quote.TierDiscount < p.MinSpend:
+		reason = fmt.Sprintf("needs a minimum spend of $%.2f", p.MinSpend)
+	case p.MaxUses > 0 && p.Uses >= p.MaxUses:
+		reason = "has been fully redeemed"
+	}
+	if reason == "" && p.MaxUsesPerUser > 0 {
+		uses, err := promotions.UsesByUser(ctx, p.PromotionID, userID)
+		if err != nil {
+			return err
+		}
+		if uses >= p.MaxUsesPerUser {
+			reason = fmt.Sprintf("can only be used %d time(s) per member", p.MaxUsesPerUser)
+		}
+	}
+
+	if reason != "" {
+		return &promotionError{promotionSubject(p), reason}
+	}
+	return nil
+}
+
+// Pick the one promotion for quote: the bigger of the best automatic promotion and the
+// user's code. A code that can't be used is an error so the user isn't surprised by the
+// price. Returns notes explaining the choice.
+func (s *Server) choosePromotion(ctx context.Context, promotions PromotionStore, req quoteRequest, quote *PriceQuote) ([]string, error) {
+	if req.Redeemed != nil {
+		applyPromotion(quote, *req.Redeemed)
+		return []string{promotionSubject(*req.Redeemed) + " was applied when the booking was made"}, nil
+	}
+	if req.Reprice {
+		return nil, nil
+	}
+
+	automatic, err := promotions.Automatic(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var best *Promotion
+	for i, p := range automatic {
+		if slices.Contains(req.Without, p.PromotionID) {
+			continue
+		}
+		err := s.checkPromotion(ctx, promotions, p, req.UserID, quote)
+		var promotionErr *promotionError
+		if errors.As(err, &promotionErr) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if best == nil || p.DiscountPercentage > best.DiscountPercentage {
+			best = &automatic[i]
+		}
+	}
+
+	var notes []string
+	if code := strings.TrimSpace(req.PromoCode); code != "" {
+		p, err := promotions.ByCode(ctx, code)
+		if errors.Is(err, errPromotionNotFound) {
+			return nil, &promotionError{"Promo code " + strings.ToUpper(code), "doesn't exist"}
+		}
+		if err != nil {
+			return nil, err
+		}
+		if err := s.checkPromotion(ctx, promotions, *p, req.UserID, quote); err != nil {
+			return nil, err
+		}
+
+		if best == nil || p.DiscountPercentage >= best.DiscountPercentage {
+			best = p
+		} else {
+			notes = append(notes, fmt.Sprintf("Promo code %s (%g%% off) wasn't used because promotion %s gives more",
+				p.Code, p.DiscountPercentage, best.Name))
+		}
+	}
+
+	if best != nil {
+		applyPromotion(quote, *best)
+	}
+	return notes, nil
+}
+
+func applyPromotion(quote *PriceQuote, p Promotion) {
+	quote.PromotionID = p.PromotionID
+	quote.PromotionName = p.Name
+	quote.PromotionCode = p.Code
+	quote.PromotionDiscountRate = p.DiscountPercentage
+}
+
+/* Admin endpoints for managing promotions, for the finance team */
+
+var promoCodePattern = regexp.MustCompile(`^[A-Z0-9_-]{3,32}$`)
+
+// Fields accepted when creating or updating a promotion. Omitted fields keep their current
+// value on update. Dates accept RFC 3339 or "YYYY-MM-DD HH:MM:SS".
+type promotionInput struct {
+	Name               *string  `json:"name"`
+	Code               *string  `json:"code"`
+	DiscountPercentage *float64 `json:"discount_percentage"`
+	StartDate          *string  `json:"start_date"`
+	ExpiryDate         *string  `json:"expiry_date"`
+	MaxUses            *int     `json:"max_uses"`
+	MaxUsesPerUser     *int     `json:"max_uses_per_user"`
+	MinSpend           *float64 `json:"min_spend"`
+	EligibleTiers      []string `json:"eligible_tiers"`
+	Active             *bool    `json:"active"`
+}
+
+// Copy the given fields onto p and check the result
+func (in promotionInput) apply(p *Promotion) error {
+	if in.Name != nil {
+		p.Name = strings.TrimSpace(*in.Name)
+	}
+	if in.Code != nil {
+		p.Code = strings.ToUpper(strings.TrimSpace(*in.Code))
+	}
+	if in.DiscountPercentage != nil {
+		p.DiscountPercentage = *in.DiscountPercentage
+	}
+	if in.StartDate != nil {
+		t, err := parseBookingTime(*in.StartDate)
+		if err != nil {
+			return errors.New("invalid start_date")
+		}
+		p.StartDate = t
+	}
+	if in.ExpiryDate != nil {
+		t, err := parseBookingTime(*in.ExpiryDate)
+		if err != nil {
+			return errors.New("invalid expiry_date")
+		}
+		p.ExpiryDate = t
+	}
+	if in.MaxUses != nil {
+		p.MaxUses = *in.MaxUses
+	}
+	if in.MaxUsesPerUser != nil {
+		p.MaxUsesPerUser = *in.MaxUsesPerUser
+	}
+	if in.MinSpend != nil {
+		p.MinSpend = *in.MinSpend
+	}
+	if in.EligibleTiers != nil {
+		p.EligibleTiers = []string{}
+		for _, tier := range in.EligibleTiers {
+			if tier = strings.TrimSpace(tier); tier != "" && !slices.Contains(p.EligibleTiers, tier) {
+				p.EligibleTiers = append(p.EligibleTiers, tier)
+			}
+		}
+	}
+	if in.Active != nil {
+		p.Active = *in.Active
+	}
+
+	switch {
+	case p.Name == "" || len(p.Name) > 100:
+		return errors.New("name is required and at most 100 characters")
+	case p.Code != "" && !promoCodePattern.MatchString(p.Code):
+		return errors.New("code must be 3 to 32 letters, digits, dashes or underscores")
+	case p.DiscountPercentage <= 0 || p.DiscountPercentage > 100:
+		return errors.New("discount_percentage must be more than 0 and at most 100")
+	case p.ExpiryDate.IsZero():
+		return errors.New("expiry_date is required")
+	case !p.ExpiryDate.After(p.StartDate):
+		return errors.New("expiry_date must be after start_date")
+	case p.MaxUses < 0 || p.MaxUsesPerUser < 0:
+		return errors.New("max_uses and max_uses_per_user can't be negative")
+	case p.MinSpend < 0:
+		return errors.New("min_spend can't be negative")
+	case len(strings.Join(p.EligibleTiers, ",")) > 255 || slices.ContainsFunc(p.EligibleTiers, func(t string) bool { return strings.Contains(t, ",") }):
+		return errors.New("invalid eligible_tiers")
+	}
+	return nil
+}
+
+func writePromotion(w http.ResponseWriter, status int, promotion *Promotion) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(promotion)
+}
+
+// Every promotion, newest first
+func (s *Server) listPromotionsHandler(w http.ResponseWriter, r *http.Request) {
+	promotions, err := s.store.Promotions().List(r.Context())
+	if err != nil {
+		log.Printf("Error listing promotions: %v", err)
+		http.Error(w, "Error fetching promotions", http.StatusInternalServerError)
+		return
+	}
+	if promotions == nil {
+		promotions = []Promotion{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(promotions)
+}
+
+func (s *Server) getPromotionHandler(w http.ResponseWriter, r *http.Request) {
+	promotionID, _ := strconv.Atoi(mux.Vars(r)["promotionId"])
+
+	promotion, err := s.store.Promotions().Get(r.Context(), promotionID)
+	if err != nil {
+		writePromotionError(w, err)
+		return
+	}
+	writePromotion(w, http.StatusOK, promotion)
+}
+
+// New promotions start now and are active unless told otherwise
+func (s *Server) createPromotionHandler(w http.ResponseWriter, r *http.Request) {
+	var input promotionInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		http.Error(w, "Invalid input", http.StatusBadRequest)
+		return
+	}
+
+	promotion := Promotion{StartDate: time.Now().UTC().Truncate(time.Second), Active: true, EligibleTiers: []string{}}
+	if err := input.apply(&promotion); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	promotionID, err := s.store.Promotions().Create(r.Context(), promotion)
+	if err != nil {
+		writePromotionError(w, err)
+		return
+	}
+	created, err := s.store.Promotions().Get(r.Context(), promotionID)
+	if err != nil {
+		writePromotionError(w, err)
+		return
+	}
+
+	log.Printf("User %d created promotion %d (%s)", auth.UserID(r), promotionID, promotion.Name)
+	writePromotion(w, http.StatusCreated, created)
+}
+
+func (s *Server) updatePromotionHandler(w http.ResponseWriter, r *http.Request) {
+	promotionID, _ := strconv.Atoi(mux.Vars(r)["promotionId"])
+
+	var input promotionInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		http.Error(w, "Invalid input", http.StatusBadRequest)
+		return
+	}
+
+	promotion, err := s.store.Promotions().Get(r.Context(), promotionID)
+	if err != nil {
+		writePromotionError(w, err)
+		return
+	}
+	if err := input.apply(promotion); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := s.store.Promotions().Update(r.Context(), *promotion); err != nil {
+		writePromotionError(w, err)
+		return
+	}
+	updated, err := s.store.Promotions().Get(r.Context(), promotionID)
+	if err != nil {
+		writePromotionError(w, err)
+		return
+	}
+
+	log.Printf("User %d updated promotion %d", auth.UserID(r), promotionID)
+	writePromotion(w, http.StatusOK, updated)
+}
+
+// Promotions that have been used are kept for the bills that refer to them, so deleting one deactivates it
+func (s *Server) deletePromotionHandler(w http.ResponseWriter, r *http.Request) {
+	promotionID, _ := strconv.Atoi(mux.Vars(r)["promotionId"])
+
+	promotion, err := s.store.Promotions().Get(r.Context(), promotionID)
+	if err != nil {
+		writePromotionError(w, err)
+		return
+	}
+	promotion.Active = false
+	if err := s.store.Promotions().Update(r.Context(), *promotion); err != nil {
+		writePromotionError(w, err)
+		return
+	}
+
+	log.Printf("User %d deactivated promotion %d", auth.UserID(r), promotionID)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Map promotion admin errors to HTTP responses
+func writePromotionError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, errPromotionNotFound):
+		http.Error(w, "Promotion not found", http.StatusNotFound)
+	case errors.Is(err, errPromoCodeTaken):
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		log.Printf("Error updating promotion: %v", err)
+		http.Error(w, "Error updating promotion", http.StatusInternalServerError)
+	}
+}
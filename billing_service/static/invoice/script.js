@@ -1,39 +1,68 @@
-document.addEventListener('DOMContentLoaded', function () {
-    const bookingId = localStorage.getItem('bookingInvoiceId');
-
-    if (!bookingId) {
-        document.getElementById('invoice-details').innerHTML = '<p class="error">No booking ID provided.</p>';
-        return;
-    }
-
-    fetch(`/api/v1/billing/invoice?booking_id=${bookingId}`)
-        .then(response => response.json())
-        .then(data => {
-            if (data.error) {
-                document.getElementById('invoice-details').innerHTML = `<p class="error">${data.error}</p>`;
-            } else {
-                displayInvoice(data);
-            }
-        })
-        .catch(error => {
-            console.error('Error fetching invoice:', error);
-            document.getElementById('invoice-details').innerHTML = '<p class="error">An error occurred while fetching invoice details.</p>';
-        });
-});
-
-function displayInvoice(invoice) {
-    const invoiceDiv = document.getElementById('invoice-details');
-    invoiceDiv.innerHTML = `
-        <h1>Invoice</h1>
-        <p><strong>Booking ID:</strong> ${invoice.booking_id}</p>
-        <p><strong>User ID:</strong> ${invoice.user_id}</p>
-        <p><strong>Vehicle ID:</strong> ${invoice.vehicle_id}</p>
-        <p><strong>Start Time:</strong> ${new Date(invoice.start_time).toLocaleString()}</p>
-        <p><strong>End Time:</strong> ${new Date(invoice.end_time).toLocaleString()}</p>
-        <p><strong>Total Cost:</strong> $${parseFloat(invoice.total_cost).toFixed(2)}</p>
-        <p><strong>Status:</strong> ${invoice.status}</p>
-        <p><strong>Created At:</strong> ${new Date(invoice.created_at).toLocaleString()}</p>
-        <p><strong>Updated At:</strong> ${new Date(invoice.updated_at).toLocaleString()}</p>
-        <p><strong>Generated At:</strong> ${new Date(invoice.generated_at).toLocaleString()}</p>
-    `;
-}
+document.addEventListener('DOMContentLoaded', function () {
+    const bookingId = localStorage.getItem('bookingInvoiceId');
+
+    if (!bookingId) {
+        document.getElementById('invoice-details').innerHTML = '<p class="error">No booking ID provided.</p>';
+        return;
+    }
+
+    authFetch(`/api/v1/billing/invoice?booking_id=${bookingId}`)
+        .then(response => response.json())
+        .then(data => {
+            if (data.error) {
+                document.getElementById('invoice-details').innerHTML = `<p class="error">${data.error}</p>`;
+            } else {
+                displayInvoice(data);
+            }
+        })
+        .catch(error => {
+            console.error('Error fetching invoice:', error);
+            document.getElementById('invoice-details').innerHTML = '<p class="error">An error occurred while fetching invoice details.</p>';
+        });
+});
+
+const money = (amount) => `${amount < 0 ? "-" : ""}$${Math.abs(parseFloat(amount)).toFixed(2)}`;
+
+// The lines and totals of an invoice or credit note
+function documentTable(doc) {
+    const lines = doc.lines.map(line => `
+        <tr>
+            <td>${line.description}</td>
+            <td>${line.quantity}</td>
+            <td>${money(line.unit_amount)}</td>
+            <td>${money(line.amount)}</td>
+        </tr>`).join('');
+    return `
+        <table class="line-items">
+            <thead>
+                <tr><th>Description</th><th>Qty</th><th>Unit</th><th>Amount</th></tr>
+            </thead>
+            <tbody>${lines}</tbody>
+            <tfoot>
+                <tr><td colspan="3">Subtotal</td><td>${money(doc.subtotal)}</td></tr>
+                <tr><td colspan="3">${doc.tax_name} (${doc.tax_rate}%)</td><td>${money(doc.tax_amount)}</td></tr>
+                <tr class="total"><td colspan="3">Total (${doc.currency})</td><td>${money(doc.total)}</td></tr>
+            </tfoot>
+        </table>`;
+}
+
+function displayInvoice(invoice) {
+    const invoiceDiv = document.getElementById('invoice-details');
+    const creditNotes = invoice.credit_notes.map(note => `
+        <h2>Credit Note ${note.invoice_number}</h2>
+        <p><strong>Issued:</strong> ${new Date(note.issued_at).toLocaleString()}</p>
+        <p><strong>Reason:</strong> ${note.reason}</p>
+        ${documentTable(note)}
+    `).join('');
+    invoiceDiv.innerHTML = `
+        <h1>Invoice ${invoice.invoice_number}</h1>
+        <p><strong>Issued:</strong> ${new Date(invoice.issued_at).toLocaleString()}</p>
+        <p><strong>Booking ID:</strong> ${invoice.booking_id}</p>
+        <p><strong>Vehicle ID:</strong> ${invoice.vehicle_id}</p>
+        <p><strong>Rental:</strong> ${new Date(invoice.rental_start).toLocaleString()} to ${new Date(invoice.rental_end).toLocaleString()}</p>
+        ${documentTable(invoice)}
+        <p><strong>Paid:</strong> ${money(invoice.amount_paid || 0)}</p>
+        ${invoice.amount_due > 0 ? `<p class="error"><strong>Still to pay:</strong> ${money(invoice.amount_due)}, from your bills</p>` : ''}
+        ${creditNotes}
+    `;
+}
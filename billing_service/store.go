@@ -0,0 +1,136 @@
+package billingservice
+
+import (
+	"context"
+	"errors"
+)
+
+var (
+	errBillNotFound       = errors.New("billing record not found")
+	errBillExists         = errors.New("booking already has a billing record")
+	errRateCardNotFound   = errors.New("rate card not found")
+	errPromotionNotFound  = errors.New("promotion not found")
+	errPromoCodeTaken     = errors.New("promotion code is already in use")
+	errRedemptionNotFound = errors.New("no promotion was applied to the booking")
+
+	errCancellationPolicyNotFound = errors.New("cancellation policy not found")
+	errInvoiceNotFound            = errors.New("invoice not found")
+)
+
+// Layout MySQL returns DATETIME and TIMESTAMP columns in
+const timeLayout = "2006-01-02 15:04:05"
+
+// BillStore reads and writes bills, one per booking
+type BillStore interface {
+	// Create adds a pending bill and returns it as stored
+	Create(ctx context.Context, bookingID, userID int, totalAmount float64) (*Billing, error)
+	GetByBooking(ctx context.Context, bookingID int) (*Billing, error)
+	// LockByBooking is GetByBooking that also locks the bill until the transaction ends
+	LockByBooking(ctx context.Context, bookingID int) (*Billing, error)
+	// GetByReference returns the bill a payment with the given gateway reference was taken
+	// for, whether it is the bill's latest payment or an earlier one
+	GetByReference(ctx context.Context, reference string) (*Billing, error)
+	// ListByUser returns the user's bills, newest first
+	ListByUser(ctx context.Context, userID int) ([]Billing, error)
+	SetTotal(ctx context.Context, bookingID int, totalAmount float64) error
+	// SetTax records the sales tax rate the bill was priced with and the tax in its total
+	SetTax(ctx context.Context, bookingID int, rate, amount float64) error
+	// MarkRefunded sets the bill to Refunded. Its total stays, the refunds record what was given back.
+	MarkRefunded(ctx context.Context, bookingID int) error
+	// DeletePending removes the bill if it is Pending and nothing has been paid on it
+	DeletePending(ctx context.Context, bookingID int) error
+	// SetPaymentStatus moves a bill whose status is one of from to status, recording the
+	// payment method and, unless empty, the gateway reference. It returns
+	// errInvalidPaymentState if the bill was in any other status.
+	SetPaymentStatus(ctx context.Context, billingID int, from []string, status, paymentMethod, reference string) error
+	// TransitionByReference is SetPaymentStatus for the bill with the given gateway reference
+	TransitionByReference(ctx context.Context, reference string, from []string, status string) error
+
+	// ReplaceLineItems swaps the bill's line items of the given kinds for items
+	ReplaceLineItems(ctx context.Context, billingID int, kinds []string, items []LineItem) error
+	// LineItems returns the bill's line items in the order they were added
+	LineItems(ctx context.Context, billingID int) ([]LineItem, error)
+
+	// RecordPayment records money captured for the bill with the given gateway reference.
+	// A payment already recorded under the reference is left as it is.
+	RecordPayment(ctx context.Context, reference string, amount float64) error
+	// Payments returns the bill's payments with what was refunded to each, oldest first
+	Payments(ctx context.Context, billingID int) ([]Payment, error)
+
+	// AddRefund records money given back on a bill, which counts towards its RefundedAmount
+	// whether or not it is still pending, and returns its ID
+	AddRefund(ctx context.Context, refund Refund) (int, error)
+	// Refunds returns the bill's refunds, oldest first
+	Refunds(ctx context.Context, billingID int) ([]Refund, error)
+	// PendingRefunds returns the refunds of every bill that the gateway hasn't made yet, oldest first
+	PendingRefunds(ctx context.Context) ([]Refund, error)
+	CompleteRefund(ctx context.Context, refundID int) error
+}
+
+// PromotionStore reads and writes promotions and their redemptions
+type PromotionStore interface {
+	// List returns every promotion, newest first
+	List(ctx context.Context) ([]Promotion, error)
+	// Automatic returns the active promotions without a code. Their dates aren't checked.
+	Automatic(ctx context.Context) ([]Promotion, error)
+	Get(ctx context.Context, promotionID int) (*Promotion, error)
+	// Lock is Get that also locks the promotion until the transaction ends, so its caps hold
+	Lock(ctx context.Context, promotionID int) (*Promotion, error)
+	// ByCode finds a promotion by its code, ignoring case
+	ByCode(ctx context.Context, code string) (*Promotion, error)
+	// Create adds a promotion and returns its ID, or errPromoCodeTaken
+	Create(ctx context.Context, promotion Promotion) (int, error)
+	Update(ctx context.Context, promotion Promotion) error
+
+	// UsesByUser counts the bookings of the user the promotion was applied to
+	UsesByUser(ctx context.Context, promotionID, userID int) (int, error)
+	Redeem(ctx context.Context, redemption Redemption) error
+	// ForBooking returns the booking's redemption, or errRedemptionNotFound
+	ForBooking(ctx context.Context, bookingID int) (*Redemption, error)
+	SetDiscount(ctx context.Context, bookingID int, discount float64) error
+	// Release removes the booking's redemption, if any, so it no longer counts against the caps
+	Release(ctx context.Context, bookingID int) error
+}
+
+// RateCardStore reads the pricing rules per vehicle class
+type RateCardStore interface {
+	Get(ctx context.Context, vehicleClass string) (*RateCard, error)
+}
+
+// InvoiceStore issues and reads invoices and credit notes. Nothing issued is ever changed.
+type InvoiceStore interface {
+	// Issue gives the invoice the next number of its kind and stores it with its lines.
+	// Numbers have no gaps as long as Issue runs in the transaction that needs the invoice.
+	Issue(ctx context.Context, invoice Invoice) (*Invoice, error)
+	Get(ctx context.Context, invoiceID int) (*Invoice, error)
+	// Lock is Get that also locks the invoice until the transaction ends
+	Lock(ctx context.Context, invoiceID int) (*Invoice, error)
+	// ForBilling returns the bill's invoice and credit notes in the order they were issued
+	ForBilling(ctx context.Context, billingID int) ([]Invoice, error)
+}
+
+// CancellationPolicyStore reads the refund rules per membership tier
+type CancellationPolicyStore interface {
+	// Get returns the tier's policy, or errCancellationPolicyNotFound
+	Get(ctx context.Context, membershipTier string) (*CancellationPolicy, error)
+}
+
+// PaymentEventStore remembers which gateway events have been applied
+type PaymentEventStore interface {
+	// Record stores the event if it is new and reports whether it was already processed
+	Record(ctx context.Context, event PaymentEvent) (processed bool, err error)
+	MarkProcessed(ctx context.Context, eventID string) error
+}
+
+// Store gives the billing service its data
+type Store interface {
+	Bills() BillStore
+	Promotions() PromotionStore
+	Invoices() InvoiceStore
+	RateCards() RateCardStore
+	CancellationPolicies() CancellationPolicyStore
+	PaymentEvents() PaymentEventStore
+	// InTx runs fn in a transaction. If fn returns an error nothing it did through
+	// the given stores is kept.
+	InTx(ctx context.Context, fn func(bills BillStore, promotions PromotionStore, invoices InvoiceStore) error) error
+}
@@ -0,0 +1,705 @@
+package billingservice
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MemoryStore keeps the billing service's data in memory, for tests and local runs without MySQL.
+// Transactions hold a single lock, so they never interleave.
+type MemoryStore struct {
+	mu   sync.Mutex
+	data *memoryData
+}
+
+type memoryData struct {
+	bills           map[int]Billing // by booking ID
+	promotions      []Promotion
+	redemptions     map[int]Redemption // by booking ID
+	rateCards       map[string]RateCard
+	paymentEvents   map[string]bool // event ID to processed
+	lineItems       []LineItem
+	payments        []Payment
+	policies        map[string]CancellationPolicy // by membership tier
+	refunds         []Refund
+	invoices        []Invoice
+	invoiceNumbers  map[string]int // last number issued, by kind
+	nextBillingID   int
+	nextPromotionID int
+	nextLineItemID  int
+	nextPaymentID   int
+	nextRefundID    int
+	nextInvoiceID   int
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{data: &memoryData{
+		bills:           map[int]Billing{},
+		redemptions:     map[int]Redemption{},
+		rateCards:       map[string]RateCard{},
+		paymentEvents:   map[string]bool{},
+		policies:        map[string]CancellationPolicy{},
+		invoiceNumbers:  map[string]int{},
+		nextBillingID:   1,
+		nextPromotionID: 1,
+		nextLineItemID:  1,
+		nextPaymentID:   1,
+		nextRefundID:    1,
+		nextInvoiceID:   1,
+	}}
+}
+
+// AddPromotion stores a promotion and returns its ID
+func (s *MemoryStore) AddPromotion(promotion Promotion) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.data.addPromotion(promotion)
+}
+
+func (d *memoryData) addPromotion(promotion Promotion) int {
+	promotion.PromotionID = d.nextPromotionID
+	d.nextPromotionID++
+	now := time.Now().UTC()
+	promotion.CreatedAt, promotion.UpdatedAt = now, now
+	d.promotions = append(d.promotions, promotion)
+	return promotion.PromotionID
+}
+
+// SetRateCard adds or replaces the rate card of card.VehicleClass
+func (s *MemoryStore) SetRateCard(card RateCard) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.data.rateCards[card.VehicleClass] = card
+}
+
+// SetCancellationPolicy adds or replaces the cancellation policy of policy.MembershipTier
+func (s *MemoryStore) SetCancellationPolicy(policy CancellationPolicy) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.data.policies[policy.MembershipTier] = policy
+}
+
+func (s *MemoryStore) Bills() BillStore                 { return memoryBills{s, false} }
+func (s *MemoryStore) Promotions() PromotionStore       { return memoryPromotions{s, false} }
+func (s *MemoryStore) RateCards() RateCardStore         { return memoryRateCards{s} }
+func (s *MemoryStore) PaymentEvents() PaymentEventStore { return memoryPaymentEvents{s} }
+
+func (s *MemoryStore) CancellationPolicies() CancellationPolicyStore {
+	return memoryCancellationPolicies{s}
+}
+
+func (s *MemoryStore) Invoices() InvoiceStore { return memoryInvoices{s, false} }
+
+func (s *MemoryStore) InTx(ctx context.Context, fn func(bills BillStore, promotions PromotionStore, invoices InvoiceStore) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	snapshot := s.data.clone()
+	if err := fn(memoryBills{s, true}, memoryPromotions{s, true}, memoryInvoices{s, true}); err != nil {
+		s.data = snapshot
+		return err
+	}
+	return nil
+}
+
+// Stores handed to InTx already hold the lock
+func (s *MemoryStore) lock(inTx bool) func() {
+	if inTx {
+		return func() {}
+	}
+	s.mu.Lock()
+	return s.mu.Unlock
+}
+
+func (d *memoryData) clone() *memoryData {
+	c := *d
+	c.bills = make(map[int]Billing, len(d.bills))
+	for id, b := range d.bills {
+		c.bills[id] = b
+	}
+	c.promotions = append([]Promotion(nil), d.promotions...)
+	c.lineItems = append([]LineItem(nil), d.lineItems...)
+	c.payments = append([]Payment(nil), d.payments...)
+	c.refunds = append([]Refund(nil), d.refunds...)
+	// Issued invoices are never changed, so sharing their lines is safe
+	c.invoices = append([]Invoice(nil), d.invoices...)
+	c.invoiceNumbers = make(map[string]int, len(d.invoiceNumbers))
+	for kind, number := range d.invoiceNumbers {
+		c.invoiceNumbers[kind] = number
+	}
+	c.redemptions = make(map[int]Redemption, len(d.redemptions))
+	for id, r := range d.redemptions {
+		c.redemptions[id] = r
+	}
+	c.rateCards = make(map[string]RateCard, len(d.rateCards))
+	for class, card := range d.rateCards {
+		c.rateCards[class] = card
+	}
+	c.policies = make(map[string]CancellationPolicy, len(d.policies))
+	for tier, policy := range d.policies {
+		c.policies[tier] = policy
+	}
+	c.paymentEvents = make(map[string]bool, len(d.paymentEvents))
+	for id, processed := range d.paymentEvents {
+		c.paymentEvents[id] = processed
+	}
+	return &c
+}
+
+type memoryBills struct {
+	s    *MemoryStore
+	inTx bool
+}
+
+func (m memoryBills) Create(ctx context.Context, bookingID, userID int, totalAmount float64) (*Billing, error) {
+	defer m.s.lock(m.inTx)()
+
+	if _, ok := m.s.data.bills[bookingID]; ok {
+		return nil, errBillExists
+	}
+
+	now := time.Now().UTC()
+	bill := Billing{
+		BillingID:     m.s.data.nextBillingID,
+		BookingID:     bookingID,
+		UserID:        userID,
+		PaymentStatus: PaymentStatusPending,
+		PaymentMethod: PaymentMethodOther,
+		TotalAmount:   totalAmount,
+		CreatedAt:     now,
+		UpdatedAt:     now,
+	}
+	m.s.data.nextBillingID++
+	m.s.data.bills[bookingID] = bill
+	return &bill, nil
+}
+
+func (m memoryBills) GetByBooking(ctx context.Context, bookingID int) (*Billing, error) {
+	defer m.s.lock(m.inTx)()
+
+	bill, ok := m.s.data.bills[bookingID]
+	if !ok {
+		return nil, errBillNotFound
+	}
+	bill = m.withAmounts(bill)
+	return &bill, nil
+}
+
+func (m memoryBills) LockByBooking(ctx context.Context, bookingID int) (*Billing, error) {
+	return m.GetByBooking(ctx, bookingID)
+}
+
+func (m memoryBills) GetByReference(ctx context.Context, reference string) (*Billing, error) {
+	defer m.s.lock(m.inTx)()
+
+	billingID := 0
+	for _, payment := range m.s.data.payments {
+		if payment.GatewayReference == reference {
+			billingID = payment.BillingID
+		}
+	}
+	for _, bill := range m.s.data.bills {
+		if reference != "" && (bill.GatewayReference == reference || bill.BillingID == billingID) {
+			bill = m.withAmounts(bill)
+			return &bill, nil
+		}
+	}
+	return nil, errBillNotFound
+}
+
+func (m memoryBills) ListByUser(ctx context.Context, userID int) ([]Billing, error) {
+	defer m.s.lock(m.inTx)()
+
+	var bills []Billing
+	for _, bill := range m.s.data.bills {
+		if bill.UserID == userID {
+			bills = append(bills, m.withAmounts(bill))
+		}
+	}
+	sort.Slice(bills, func(i, j int) bool { return bills[i].BillingID > bills[j].BillingID })
+	return bills, nil
+}
+
+// Copy of the bill with its refunds and payments added up
+func (m memoryBills) withAmounts(bill Billing) Billing {
+	bill.RefundedAmount, bill.AmountPaid = 0, 0
+	for _, payment := range m.s.data.payments {
+		if payment.BillingID == bill.BillingID {
+			bill.AmountPaid = roundCents(bill.AmountPaid + payment.Amount)
+		}
+	}
+	for _, refund := range m.s.data.refunds {
+		if refund.BillingID != bill.BillingID {
+			continue
+		}
+		bill.RefundedAmount = roundCents(bill.RefundedAmount + refund.Amount)
+		if refund.GatewayReference != "" {
+			bill.AmountPaid = roundCents(bill.AmountPaid - refund.Amount)
+		}
+	}
+	return bill
+}
+
+func (m memoryBills) update(bookingID int, fn func(bill *Billing)) error {
+	bill, ok := m.s.data.bills[bookingID]
+	if !ok {
+		return errBillNotFound
+	}
+	fn(&bill)
+	bill.UpdatedAt = time.Now().UTC()
+	m.s.data.bills[bookingID] = bill
+	return nil
+}
+
+func (m memoryBills) SetTotal(ctx context.Context, bookingID int, totalAmount float64) error {
+	defer m.s.lock(m.inTx)()
+
+	return m.update(bookingID, func(bill *Billing) { bill.TotalAmount = totalAmount })
+}
+
+func (m memoryBills) SetTax(ctx context.Context, bookingID int, rate, amount float64) error {
+	defer m.s.lock(m.inTx)()
+
+	return m.update(bookingID, func(bill *Billing) { bill.TaxRate, bill.TaxAmount = rate, amount })
+}
+
+func (m memoryBills) MarkRefunded(ctx context.Context, bookingID int) error {
+	defer m.s.lock(m.inTx)()
+
+	m.update(bookingID, func(bill *Billing) { bill.PaymentStatus = PaymentStatusRefunded })
+	return nil
+}
+
+func (m memoryBills) DeletePending(ctx context.Context, bookingID int) error {
+	defer m.s.lock(m.inTx)()
+
+	bill, ok := m.s.data.bills[bookingID]
+	if !ok || bill.PaymentStatus != PaymentStatusPending {
+		return nil
+	}
+	for _, payment := range m.s.data.payments {
+		if payment.BillingID == bill.BillingID {
+			return nil
+		}
+	}
+	delete(m.s.data.bills, bookingID)
+	return nil
+}
+
+func (m memoryBills) SetPaymentStatus(ctx context.Context, billingID int, from []string, status, paymentMethod, reference string) error {
+	defer m.s.lock(m.inTx)()
+
+	for bookingID, bill := range m.s.data.bills {
+		if bill.BillingID != billingID {
+			continue
+		}
+		if !containsStatus(from, bill.PaymentStatus) {
+			return errInvalidPaymentState
+		}
+		return m.update(bookingID, func(bill *Billing) {
+			bill.PaymentStatus = status
+			bill.PaymentMethod = paymentMethod
+			if reference != "" {
+				bill.GatewayReference = reference
+			}
+		})
+	}
+	return errInvalidPaymentState
+}
+
+func (m memoryBills) TransitionByReference(ctx context.Context, reference string, from []string, status string) error {
+	defer m.s.lock(m.inTx)()
+
+	for bookingID, bill := range m.s.data.bills {
+		if bill.GatewayReference != reference || reference == "" {
+			continue
+		}
+		if !containsStatus(from, bill.PaymentStatus) {
+			return errInvalidPaymentState
+		}
+		return m.update(bookingID, func(bill *Billing) { bill.PaymentStatus = status })
+	}
+	return errInvalidPaymentState
+}
+
+func (m memoryBills) ReplaceLineItems(ctx context.Context, billingID int, kinds []string, items []LineItem) error {
+	defer m.s.lock(m.inTx)()
+
+	kept := m.s.data.lineItems[:0:0]
+	for _, item := range m.s.data.lineItems {
+		if item.BillingID != billingID || !slices.Contains(kinds, item.Kind) {
+			kept = append(kept, item)
+		}
+	}
+	now := time.Now().UTC()
+	for _, item := range items {
+		item.LineItemID = m.s.data.nextLineItemID
+		item.BillingID, item.CreatedAt = billingID, now
+		m.s.data.nextLineItemID++
+		kept = append(kept, item)
+	}
+	m.s.data.lineItems = kept
+	return nil
+}
+
+func (m memoryBills) LineItems(ctx context.Context, billingID int) ([]LineItem, error) {
+	defer m.s.lock(m.inTx)()
+
+	var items []LineItem
+	for _, item := range m.s.data.lineItems {
+		if item.BillingID == billingID {
+			items = append(items, item)
+		}
+	}
+	return items, nil
+}
+
+func (m memoryBills) RecordPayment(ctx context.Context, reference string, amount float64) error {
+	defer m.s.lock(m.inTx)()
+
+	for _, payment := range m.s.data.payments {
+		if payment.GatewayReference == reference {
+			return nil
+		}
+	}
+	for _, bill := range m.s.data.bills {
+		if bill.GatewayReference != reference || reference == "" {
+			continue
+		}
+		m.s.data.payments = append(m.s.data.payments, Payment{
+			PaymentID:        m.s.data.nextPaymentID,
+			BillingID:        bill.BillingID,
+			Amount:           amount,
+			GatewayReference: reference,
+			CreatedAt:        time.Now().UTC(),
+		})
+		m.s.data.nextPaymentID++
+	}
+	return nil
+}
+
+func (m memoryBills) Payments(ctx context.Context, billingID int) ([]Payment, error) {
+	defer m.s.lock(m.inTx)()
+
+	var payments []Payment
+	for _, payment := range m.s.data.payments {
+		if payment.BillingID != billingID {
+			continue
+		}
+		for _, refund := range m.s.data.refunds {
+			if refund.BillingID == billingID && refund.GatewayReference == payment.GatewayReference {
+				payment.Refunded = roundCents(payment.Refunded + refund.Amount)
+			}
+		}
+		payments = append(payments, payment)
+	}
+	return payments, nil
+}
+
+func (m memoryBills) AddRefund(ctx context.Context, refund Refund) (int, error) {
+	defer m.s.lock(m.inTx)()
+
+	refund.RefundID = m.s.data.nextRefundID
+	refund.CreatedAt = time.Now().UTC()
+	m.s.data.nextRefundID++
+	m.s.data.refunds = append(m.s.data.refunds, refund)
+	return refund.RefundID, nil
+}
+
+func (m memoryBills) Refunds(ctx context.Context, billingID int) ([]Refund, error) {
+	defer m.s.lock(m.inTx)()
+
+	var refunds []Refund
+	for _, refund := range m.s.data.refunds {
+		if refund.BillingID == billingID {
+			refunds = append(refunds, refund)
+		}
+	}
+	return refunds, nil
+}
+
+func (m memoryBills) PendingRefunds(ctx context.Context) ([]Refund, error) {
+	defer m.s.lock(m.inTx)()
+
+	var refunds []Refund
+	for _, refund := range m.s.data.refunds {
+		if refund.Status == RefundStatusPending {
+			refunds = append(refunds, refund)
+		}
+	}
+	return refunds, nil
+}
+
+func (m memoryBills) CompleteRefund(ctx context.Context, refundID int) error {
+	defer m.s.lock(m.inTx)()
+
+	for i := range m.s.data.refunds {
+		if m.s.data.refunds[i].RefundID == refundID {
+			m.s.data.refunds[i].Status = RefundStatusCompleted
+		}
+	}
+	return nil
+}
+
+func containsStatus(statuses []string, status string) bool {
+	for _, s := range statuses {
+		if s == status {
+			return true
+		}
+	}
+	return false
+}
+
+type memoryPromotions struct {
+	s    *MemoryStore
+	inTx bool
+}
+
+// Copy of the promotion with its uses counted
+func (m memoryPromotions) withUses(promotion Promotion) Promotion {
+	promotion.Uses = 0
+	for _, r := range m.s.data.redemptions {
+		if r.PromotionID == promotion.PromotionID {
+			promotion.Uses++
+		}
+	}
+	promotion.EligibleTiers = append([]string{}, promotion.EligibleTiers...)
+	return promotion
+}
+
+func (m memoryPromotions) List(ctx context.Context) ([]Promotion, error) {
+	defer m.s.lock(m.inTx)()
+
+	var promotions []Promotion
+	for i := len(m.s.data.promotions) - 1; i >= 0; i-- {
+		promotions = append(promotions, m.withUses(m.s.data.promotions[i]))
+	}
+	return promotions, nil
+}
+
+func (m memoryPromotions) Automatic(ctx context.Context) ([]Promotion, error) {
+	defer m.s.lock(m.inTx)()
+
+	var promotions []Promotion
+	for _, p := range m.s.data.promotions {
+		if p.Active && p.Code == "" {
+			promotions = append(promotions, m.withUses(p))
+		}
+	}
+	return promotions, nil
+}
+
+func (m memoryPromotions) Get(ctx context.Context, promotionID int) (*Promotion, error) {
+	defer m.s.lock(m.inTx)()
+
+	for _, p := range m.s.data.promotions {
+		if p.PromotionID == promotionID {
+			promotion := m.withUses(p)
+			return &promotion, nil
+		}
+	}
+	return nil, errPromotionNotFound
+}
+
+// Transactions already hold the store's lock, so this is the same as Get
+func (m memoryPromotions) Lock(ctx context.Context, promotionID int) (*Promotion, error) {
+	return m.Get(ctx, promotionID)
+}
+
+func (m memoryPromotions) ByCode(ctx context.Context, code string) (*Promotion, error) {
+	defer m.s.lock(m.inTx)()
+
+	for _, p := range m.s.data.promotions {
+		if p.Code != "" && strings.EqualFold(p.Code, code) {
+			promotion := m.withUses(p)
+			return &promotion, nil
+		}
+	}
+	return nil, errPromotionNotFound
+}
+
+func (m memoryPromotions) codeTaken(code string, promotionID int) bool {
+	for _, p := range m.s.data.promotions {
+		if code != "" && strings.EqualFold(p.Code, code) && p.PromotionID != promotionID {
+			return true
+		}
+	}
+	return false
+}
+
+func (m memoryPromotions) Create(ctx context.Context, promotion Promotion) (int, error) {
+	defer m.s.lock(m.inTx)()
+
+	if m.codeTaken(promotion.Code, 0) {
+		return 0, errPromoCodeTaken
+	}
+	return m.s.data.addPromotion(promotion), nil
+}
+
+func (m memoryPromotions) Update(ctx context.Context, promotion Promotion) error {
+	defer m.s.lock(m.inTx)()
+
+	if m.codeTaken(promotion.Code, promotion.PromotionID) {
+		return errPromoCodeTaken
+	}
+	for i, p := range m.s.data.promotions {
+		if p.PromotionID == promotion.PromotionID {
+			promotion.CreatedAt = p.CreatedAt
+			promotion.UpdatedAt = time.Now().UTC()
+			m.s.data.promotions[i] = promotion
+		}
+	}
+	return nil
+}
+
+func (m memoryPromotions) UsesByUser(ctx context.Context, promotionID, userID int) (int, error) {
+	defer m.s.lock(m.inTx)()
+
+	uses := 0
+	for _, r := range m.s.data.redemptions {
+		if r.PromotionID == promotionID && r.UserID == userID {
+			uses++
+		}
+	}
+	return uses, nil
+}
+
+func (m memoryPromotions) Redeem(ctx context.Context, redemption Redemption) error {
+	defer m.s.lock(m.inTx)()
+
+	if _, ok := m.s.data.redemptions[redemption.BookingID]; ok {
+		return errors.New("booking already has a promotion")
+	}
+	m.s.data.redemptions[redemption.BookingID] = redemption
+	return nil
+}
+
+func (m memoryPromotions) ForBooking(ctx context.Context, bookingID int) (*Redemption, error) {
+	defer m.s.lock(m.inTx)()
+
+	r, ok := m.s.data.redemptions[bookingID]
+	if !ok {
+		return nil, errRedemptionNotFound
+	}
+	return &r, nil
+}
+
+func (m memoryPromotions) SetDiscount(ctx context.Context, bookingID int, discount float64) error {
+	defer m.s.lock(m.inTx)()
+
+	if r, ok := m.s.data.redemptions[bookingID]; ok {
+		r.Discount = discount
+		m.s.data.redemptions[bookingID] = r
+	}
+	return nil
+}
+
+func (m memoryPromotions) Release(ctx context.Context, bookingID int) error {
+	defer m.s.lock(m.inTx)()
+
+	delete(m.s.data.redemptions, bookingID)
+	return nil
+}
+
+type memoryRateCards struct {
+	s *MemoryStore
+}
+
+func (m memoryRateCards) Get(ctx context.Context, vehicleClass string) (*RateCard, error) {
+	defer m.s.lock(false)()
+
+	card, ok := m.s.data.rateCards[vehicleClass]
+	if !ok {
+		return nil, errRateCardNotFound
+	}
+	return &card, nil
+}
+
+type memoryInvoices struct {
+	s    *MemoryStore
+	inTx bool
+}
+
+func (m memoryInvoices) Issue(ctx context.Context, invoice Invoice) (*Invoice, error) {
+	defer m.s.lock(m.inTx)()
+
+	m.s.data.invoiceNumbers[invoice.Kind]++
+	invoice.InvoiceNumber = fmt.Sprintf("%s-%06d", invoicePrefixes[invoice.Kind], m.s.data.invoiceNumbers[invoice.Kind])
+	invoice.InvoiceID = m.s.data.nextInvoiceID
+	invoice.Lines = append([]InvoiceLine{}, invoice.Lines...)
+	m.s.data.nextInvoiceID++
+	m.s.data.invoices = append(m.s.data.invoices, invoice)
+	return &invoice, nil
+}
+
+func (m memoryInvoices) Get(ctx context.Context, invoiceID int) (*Invoice, error) {
+	defer m.s.lock(m.inTx)()
+
+	for _, invoice := range m.s.data.invoices {
+		if invoice.InvoiceID == invoiceID {
+			return &invoice, nil
+		}
+	}
+	return nil, errInvoiceNotFound
+}
+
+// Transactions already hold the store's lock, so this is the same as Get
+func (m memoryInvoices) Lock(ctx context.Context, invoiceID int) (*Invoice, error) {
+	return m.Get(ctx, invoiceID)
+}
+
+func (m memoryInvoices) ForBilling(ctx context.Context, billingID int) ([]Invoice, error) {
+	defer m.s.lock(m.inTx)()
+
+	var invoices []Invoice
+	for _, invoice := range m.s.data.invoices {
+		if invoice.BillingID == billingID {
+			invoices = append(invoices, invoice)
+		}
+	}
+	return invoices, nil
+}
+
+type memoryCancellationPolicies struct {
+	s *MemoryStore
+}
+
+func (m memoryCancellationPolicies) Get(ctx context.Context, membershipTier string) (*CancellationPolicy, error) {
+	defer m.s.lock(false)()
+
+	policy, ok := m.s.data.policies[membershipTier]
+	if !ok {
+		return nil, errCancellationPolicyNotFound
+	}
+	return &policy, nil
+}
+
+type memoryPaymentEvents struct {
+	s *MemoryStore
+}
+
+func (m memoryPaymentEvents) Record(ctx context.Context, event PaymentEvent) (bool, error) {
+	defer m.s.lock(false)()
+
+	processed, ok := m.s.data.paymentEvents[event.EventID]
+	if !ok {
+		m.s.data.paymentEvents[event.EventID] = false
+	}
+	return processed, nil
+}
+
+func (m memoryPaymentEvents) MarkProcessed(ctx context.Context, eventID string) error {
+	defer m.s.lock(false)()
+
+	m.s.data.paymentEvents[eventID] = true
+	return nil
+}
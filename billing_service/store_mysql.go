@@ -0,0 +1,676 @@
+package billingservice
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/yongkaiyu/CNAD_Assg1/internal/database"
+)
+
+type mysqlStore struct {
+	db *sql.DB
+}
+
+// NewMySQLStore keeps the billing service's data in MySQL
+func NewMySQLStore(db *sql.DB) Store {
+	return &mysqlStore{db: db}
+}
+
+func (s *mysqlStore) Bills() BillStore                 { return mysqlBills{s.db} }
+func (s *mysqlStore) Promotions() PromotionStore       { return mysqlPromotions{s.db} }
+func (s *mysqlStore) RateCards() RateCardStore         { return mysqlRateCards{s.db} }
+func (s *mysqlStore) PaymentEvents() PaymentEventStore { return mysqlPaymentEvents{s.db} }
+
+func (s *mysqlStore) CancellationPolicies() CancellationPolicyStore {
+	return mysqlCancellationPolicies{s.db}
+}
+
+func (s *mysqlStore) Invoices() InvoiceStore { return mysqlInvoices{s.db} }
+
+func (s *mysqlStore) InTx(ctx context.Context, fn func(bills BillStore, promotions PromotionStore, invoices InvoiceStore) error) error {
+	return database.InTx(ctx, s.db, func(tx *sql.Tx) error {
+		return fn(mysqlBills{tx}, mysqlPromotions{tx}, mysqlInvoices{tx})
+	})
+}
+
+type mysqlBills struct {
+	q database.Queryer
+}
+
+const billColumns = `billing_id, booking_id, user_id, payment_status, payment_method, total_amount,
+	COALESCE((SELECT SUM(r.amount) FROM refunds r WHERE r.billing_id = billings.billing_id), 0),
+	COALESCE((SELECT SUM(p.amount) FROM payments p WHERE p.billing_id = billings.billing_id), 0)
+		- COALESCE((SELECT SUM(r.amount) FROM refunds r
+			WHERE r.billing_id = billings.billing_id AND r.gateway_reference IS NOT NULL), 0),
+	tax_rate, tax_amount, gateway_reference, created_at, updated_at`
+
+func scanBill(row database.Scanner) (Billing, error) {
+	var bill Billing
+	var gatewayReference sql.NullString
+	var createdAt, updatedAt string
+	err := row.Scan(&bill.BillingID, &bill.BookingID, &bill.UserID, &bill.PaymentStatus, &bill.PaymentMethod,
+		&bill.TotalAmount, &bill.RefundedAmount, &bill.AmountPaid, &bill.TaxRate, &bill.TaxAmount, &gatewayReference, &createdAt, &updatedAt)
+	if err != nil {
+		return bill, err
+	}
+	bill.GatewayReference = gatewayReference.String
+	bill.CreatedAt, _ = time.Parse(timeLayout, createdAt)
+	bill.UpdatedAt, _ = time.Parse(timeLayout, updatedAt)
+	return bill, nil
+}
+
+func (m mysqlBills) getOne(ctx context.Context, query string, args ...interface{}) (*Billing, error) {
+	bill, err := scanBill(m.q.QueryRowContext(ctx, query, args...))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, errBillNotFound
+		}
+		return nil, err
+	}
+	return &bill, nil
+}
+
+func (m mysqlBills) Create(ctx context.Context, bookingID, userID int, totalAmount float64) (*Billing, error) {
+	_, err := m.q.ExecContext(ctx, `
+		INSERT INTO billings (booking_id, user_id, total_amount)
+		VALUES (?, ?, ?)`,
+		bookingID, userID, totalAmount)
+	if err != nil {
+		return nil, err
+	}
+	return m.GetByBooking(ctx, bookingID)
+}
+
+func (m mysqlBills) GetByBooking(ctx context.Context, bookingID int) (*Billing, error) {
+	return m.getOne(ctx, `SELECT `+billColumns+` FROM billings WHERE booking_id = ?`, bookingID)
+}
+
+func (m mysqlBills) LockByBooking(ctx context.Context, bookingID int) (*Billing, error) {
+	return m.getOne(ctx, `SELECT `+billColumns+` FROM billings WHERE booking_id = ? FOR UPDATE`, bookingID)
+}
+
+func (m mysqlBills) GetByReference(ctx context.Context, reference string) (*Billing, error) {
+	return m.getOne(ctx, `
+		SELECT `+billColumns+` FROM billings
+		WHERE gateway_reference = ?
+		OR billing_id IN (SELECT billing_id FROM payments WHERE gateway_reference = ?)
+		LIMIT 1`, reference, reference)
+}
+
+func (m mysqlBills) ListByUser(ctx context.Context, userID int) ([]Billing, error) {
+	rows, err := m.q.QueryContext(ctx, `SELECT `+billColumns+` FROM billings WHERE user_id = ? ORDER BY created_at DESC`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var bills []Billing
+	for rows.Next() {
+		bill, err := scanBill(rows)
+		if err != nil {
+			return nil, err
+		}
+		bills = append(bills, bill)
+	}
+	return bills, rows.Err()
+}
+
+func (m mysqlBills) SetTotal(ctx context.Context, bookingID int, totalAmount float64) error {
+	result, err := m.q.ExecContext(ctx, `UPDATE billings SET total_amount = ? WHERE booking_id = ?`, totalAmount, bookingID)
+	if err != nil {
+		return err
+	}
+	if err := database.RequireRow(result, errBillNotFound); err != errBillNotFound {
+		return err
+	}
+
+	// MySQL reports 0 rows when the amount is unchanged, so check the bill exists
+	var exists bool
+	if err := m.q.QueryRowContext(ctx, `SELECT EXISTS(SELECT 1 FROM billings WHERE booking_id = ?)`, bookingID).Scan(&exists); err != nil {
+		return err
+	}
+	if !exists {
+		return errBillNotFound
+	}
+	return nil
+}
+
+func (m mysqlBills) SetTax(ctx context.Context, bookingID int, rate, amount float64) error {
+	_, err := m.q.ExecContext(ctx, `UPDATE billings SET tax_rate = ?, tax_amount = ? WHERE booking_id = ?`, rate, amount, bookingID)
+	return err
+}
+
+func (m mysqlBills) MarkRefunded(ctx context.Context, bookingID int) error {
+	_, err := m.q.ExecContext(ctx, `UPDATE billings SET payment_status = ? WHERE booking_id = ?`,
+		PaymentStatusRefunded, bookingID)
+	return err
+}
+
+func (m mysqlBills) DeletePending(ctx context.Context, bookingID int) error {
+	_, err := m.q.ExecContext(ctx, `
+		DELETE FROM billings
+		WHERE booking_id = ? AND payment_status = ?
+		AND NOT EXISTS (SELECT 1 FROM payments p WHERE p.billing_id = billings.billing_id)`,
+		bookingID, PaymentStatusPending)
+	return err
+}
+
+func (m mysqlBills) SetPaymentStatus(ctx context.Context, billingID int, from []string, status, paymentMethod, reference string) error {
+	query := `UPDATE billings SET payment_status = ?, payment_method = ?`
+	args := []interface{}{status, paymentMethod}
+	if reference != "" {
+		query += `, gateway_reference = ?`
+		args = append(args, reference)
+	}
+	query += ` WHERE billing_id = ? AND payment_status IN (` + database.Placeholders(len(from)) + `)`
+	args = append(args, billingID)
+	for _, prev := range from {
+		args = append(args, prev)
+	}
+
+	result, err := m.q.ExecContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	return database.RequireRow(result, errInvalidPaymentState)
+}
+
+func (m mysqlBills) TransitionByReference(ctx context.Context, reference string, from []string, status string) error {
+	args := []interface{}{status, reference}
+	for _, prev := range from {
+		args = append(args, prev)
+	}
+
+	result, err := m.q.ExecContext(ctx, `
+		UPDATE billings SET payment_status = ?
+		WHERE gateway_reference = ? AND payment_status IN (`+database.Placeholders(len(from))+`)`,
+		args...)
+	if err != nil {
+		return err
+	}
+	return database.RequireRow(result, errInvalidPaymentState)
+}
+
+func (m mysqlBills) ReplaceLineItems(ctx context.Context, billingID int, kinds []string, items []LineItem) error {
+	args := []interface{}{billingID}
+	for _, kind := range kinds {
+		args = append(args, kind)
+	}
+	_, err := m.q.ExecContext(ctx, `DELETE FROM billing_line_items WHERE billing_id = ? AND kind IN (`+database.Placeholders(len(kinds))+`)`, args...)
+	if err != nil {
+		return err
+	}
+	for _, item := range items {
+		_, err := m.q.ExecContext(ctx, `
+			INSERT INTO billing_line_items (billing_id, kind, description, quantity, unit_amount, amount)
+			VALUES (?, ?, ?, ?, ?, ?)`,
+			billingID, item.Kind, item.Description, item.Quantity, item.UnitAmount, item.Amount)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m mysqlBills) LineItems(ctx context.Context, billingID int) ([]LineItem, error) {
+	rows, err := m.q.QueryContext(ctx, `
+		SELECT line_item_id, billing_id, kind, description, quantity, unit_amount, amount, created_at
+		FROM billing_line_items WHERE billing_id = ? ORDER BY line_item_id`, billingID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var items []LineItem
+	for rows.Next() {
+		var item LineItem
+		var createdAt string
+		err := rows.Scan(&item.LineItemID, &item.BillingID, &item.Kind, &item.Description, &item.Quantity,
+			&item.UnitAmount, &item.Amount, &createdAt)
+		if err != nil {
+			return nil, err
+		}
+		item.CreatedAt, _ = time.Parse(timeLayout, createdAt)
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
+
+func (m mysqlBills) RecordPayment(ctx context.Context, reference string, amount float64) error {
+	_, err := m.q.ExecContext(ctx, `
+		INSERT INTO payments (billing_id, amount, gateway_reference)
+		SELECT billing_id, ?, gateway_reference FROM billings WHERE gateway_reference = ?
+		ON DUPLICATE KEY UPDATE payment_id = payment_id`,
+		amount, reference)
+	return err
+}
+
+func (m mysqlBills) Payments(ctx context.Context, billingID int) ([]Payment, error) {
+	rows, err := m.q.QueryContext(ctx, `
+		SELECT p.payment_id, p.billing_id, p.amount,
+			COALESCE((SELECT SUM(r.amount) FROM refunds r
+				WHERE r.billing_id = p.billing_id AND r.gateway_reference = p.gateway_reference), 0),
+			p.gateway_reference, p.created_at
+		FROM payments p WHERE p.billing_id = ? ORDER BY p.payment_id`, billingID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var payments []Payment
+	for rows.Next() {
+		var payment Payment
+		var createdAt string
+		err := rows.Scan(&payment.PaymentID, &payment.BillingID, &payment.Amount, &payment.Refunded,
+			&payment.GatewayReference, &createdAt)
+		if err != nil {
+			return nil, err
+		}
+		payment.CreatedAt, _ = time.Parse(timeLayout, createdAt)
+		payments = append(payments, payment)
+	}
+	return payments, rows.Err()
+}
+
+func (m mysqlBills) AddRefund(ctx context.Context, refund Refund) (int, error) {
+	result, err := m.q.ExecContext(ctx, `
+		INSERT INTO refunds (billing_id, kind, status, amount, percentage, reason, gateway_reference)
+		VALUES (?, ?, ?, ?, ?, ?, NULLIF(?, ''))`,
+		refund.BillingID, refund.Kind, refund.Status, refund.Amount, refund.Percentage, refund.Reason, refund.GatewayReference)
+	if err != nil {
+		return 0, err
+	}
+	id, err := result.LastInsertId()
+	return int(id), err
+}
+
+func (m mysqlBills) listRefunds(ctx context.Context, query string, args ...interface{}) ([]Refund, error) {
+	rows, err := m.q.QueryContext(ctx, `
+		SELECT refund_id, billing_id, kind, status, amount, percentage, reason, COALESCE(gateway_reference, ''), created_at
+		FROM refunds `+query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var refunds []Refund
+	for rows.Next() {
+		var refund Refund
+		var createdAt string
+		err := rows.Scan(&refund.RefundID, &refund.BillingID, &refund.Kind, &refund.Status, &refund.Amount,
+			&refund.Percentage, &refund.Reason, &refund.GatewayReference, &createdAt)
+		if err != nil {
+			return nil, err
+		}
+		refund.CreatedAt, _ = time.Parse(timeLayout, createdAt)
+		refunds = append(refunds, refund)
+	}
+	return refunds, rows.Err()
+}
+
+func (m mysqlBills) Refunds(ctx context.Context, billingID int) ([]Refund, error) {
+	return m.listRefunds(ctx, `WHERE billing_id = ? ORDER BY refund_id`, billingID)
+}
+
+func (m mysqlBills) PendingRefunds(ctx context.Context) ([]Refund, error) {
+	return m.listRefunds(ctx, `WHERE status = ? ORDER BY refund_id`, RefundStatusPending)
+}
+
+func (m mysqlBills) CompleteRefund(ctx context.Context, refundID int) error {
+	_, err := m.q.ExecContext(ctx, `UPDATE refunds SET status = ? WHERE refund_id = ?`, RefundStatusCompleted, refundID)
+	return err
+}
+
+type mysqlPromotions struct {
+	q database.Queryer
+}
+
+const promotionColumns = `p.promotion_id, p.name, COALESCE(p.code, ''), p.discount_percentage, p.start_date, p.expiry_date,
+	p.max_uses, p.max_uses_per_user, p.min_spend, p.eligible_tiers, p.active,
+	(SELECT COUNT(*) FROM promotion_redemptions r WHERE r.promotion_id = p.promotion_id), p.created_at, p.updated_at`
+
+func scanPromotion(row database.Scanner) (Promotion, error) {
+	var promotion Promotion
+	var tiers, startDate, expiryDate, createdAt, updatedAt string
+	err := row.Scan(&promotion.PromotionID, &promotion.Name, &promotion.Code, &promotion.DiscountPercentage,
+		&startDate, &expiryDate, &promotion.MaxUses, &promotion.MaxUsesPerUser, &promotion.MinSpend, &tiers,
+		&promotion.Active, &promotion.Uses, &createdAt, &updatedAt)
+	if err != nil {
+		return promotion, err
+	}
+	promotion.EligibleTiers = splitTiers(tiers)
+	promotion.StartDate, _ = time.Parse(timeLayout, startDate)
+	promotion.ExpiryDate, _ = time.Parse(timeLayout, expiryDate)
+	promotion.CreatedAt, _ = time.Parse(timeLayout, createdAt)
+	promotion.UpdatedAt, _ = time.Parse(timeLayout, updatedAt)
+	return promotion, nil
+}
+
+// Eligible tiers are stored comma separated
+func splitTiers(tiers string) []string {
+	if tiers == "" {
+		return []string{}
+	}
+	return strings.Split(tiers, ",")
+}
+
+func (m mysqlPromotions) list(ctx context.Context, query string, args ...interface{}) ([]Promotion, error) {
+	rows, err := m.q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var promotions []Promotion
+	for rows.Next() {
+		promotion, err := scanPromotion(rows)
+		if err != nil {
+			return nil, err
+		}
+		promotions = append(promotions, promotion)
+	}
+	return promotions, rows.Err()
+}
+
+func (m mysqlPromotions) getOne(ctx context.Context, query string, args ...interface{}) (*Promotion, error) {
+	promotion, err := scanPromotion(m.q.QueryRowContext(ctx, query, args...))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, errPromotionNotFound
+		}
+		return nil, err
+	}
+	return &promotion, nil
+}
+
+func (m mysqlPromotions) List(ctx context.Context) ([]Promotion, error) {
+	return m.list(ctx, `SELECT `+promotionColumns+` FROM promotions p ORDER BY p.promotion_id DESC`)
+}
+
+func (m mysqlPromotions) Automatic(ctx context.Context) ([]Promotion, error) {
+	return m.list(ctx, `SELECT `+promotionColumns+` FROM promotions p WHERE p.active AND p.code IS NULL`)
+}
+
+func (m mysqlPromotions) Get(ctx context.Context, promotionID int) (*Promotion, error) {
+	return m.getOne(ctx, `SELECT `+promotionColumns+` FROM promotions p WHERE p.promotion_id = ?`, promotionID)
+}
+
+func (m mysqlPromotions) Lock(ctx context.Context, promotionID int) (*Promotion, error) {
+	return m.getOne(ctx, `SELECT `+promotionColumns+` FROM promotions p WHERE p.promotion_id = ? FOR UPDATE`, promotionID)
+}
+
+func (m mysqlPromotions) ByCode(ctx context.Context, code string) (*Promotion, error) {
+	return m.getOne(ctx, `SELECT `+promotionColumns+` FROM promotions p WHERE p.code = ?`, strings.ToUpper(code))
+}
+
+func (m mysqlPromotions) Create(ctx context.Context, promotion Promotion) (int, error) {
+	result, err := m.q.ExecContext(ctx, `
+		INSERT INTO promotions (name, code, discount_percentage, start_date, expiry_date,
+			max_uses, max_uses_per_user, min_spend, eligible_tiers, active)
+		VALUES (?, NULLIF(?, ''), ?, ?, ?, ?, ?, ?, ?, ?)`,
+		promotion.Name, promotion.Code, promotion.DiscountPercentage,
+		promotion.StartDate.UTC().Format(timeLayout), promotion.ExpiryDate.UTC().Format(timeLayout),
+		promotion.MaxUses, promotion.MaxUsesPerUser, promotion.MinSpend, strings.Join(promotion.EligibleTiers, ","), promotion.Active)
+	if err != nil {
+		if database.IsDuplicate(err) {
+			return 0, errPromoCodeTaken
+		}
+		return 0, err
+	}
+	promotionID, err := result.LastInsertId()
+	return int(promotionID), err
+}
+
+func (m mysqlPromotions) Update(ctx context.Context, promotion Promotion) error {
+	_, err := m.q.ExecContext(ctx, `
+		UPDATE promotions
+		SET name = ?, code = NULLIF(?, ''), discount_percentage = ?, start_date = ?, expiry_date = ?,
+			max_uses = ?, max_uses_per_user = ?, min_spend = ?, eligible_tiers = ?, active = ?
+		WHERE promotion_id = ?`,
+		promotion.Name, promotion.Code, promotion.DiscountPercentage,
+		promotion.StartDate.UTC().Format(timeLayout), promotion.ExpiryDate.UTC().Format(timeLayout),
+		promotion.MaxUses, promotion.MaxUsesPerUser, promotion.MinSpend, strings.Join(promotion.EligibleTiers, ","), promotion.Active,
+		promotion.PromotionID)
+	if database.IsDuplicate(err) {
+		return errPromoCodeTaken
+	}
+	return err
+}
+
+func (m mysqlPromotions) UsesByUser(ctx context.Context, promotionID, userID int) (int, error) {
+	var uses int
+	err := m.q.QueryRowContext(ctx, `
+		SELECT COUNT(*) FROM promotion_redemptions
+		WHERE promotion_id = ? AND user_id = ?`, promotionID, userID).Scan(&uses)
+	return uses, err
+}
+
+func (m mysqlPromotions) Redeem(ctx context.Context, redemption Redemption) error {
+	_, err := m.q.ExecContext(ctx, `
+		INSERT INTO promotion_redemptions (promotion_id, user_id, booking_id, discount)
+		VALUES (?, ?, ?, ?)`,
+		redemption.PromotionID, redemption.UserID, redemption.BookingID, redemption.Discount)
+	return err
+}
+
+func (m mysqlPromotions) ForBooking(ctx context.Context, bookingID int) (*Redemption, error) {
+	var redemption Redemption
+	err := m.q.QueryRowContext(ctx, `
+		SELECT promotion_id, user_id, booking_id, discount
+		FROM promotion_redemptions WHERE booking_id = ?`, bookingID).Scan(
+		&redemption.PromotionID, &redemption.UserID, &redemption.BookingID, &redemption.Discount)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, errRedemptionNotFound
+		}
+		return nil, err
+	}
+	return &redemption, nil
+}
+
+func (m mysqlPromotions) SetDiscount(ctx context.Context, bookingID int, discount float64) error {
+	_, err := m.q.ExecContext(ctx, `UPDATE promotion_redemptions SET discount = ? WHERE booking_id = ?`, discount, bookingID)
+	return err
+}
+
+func (m mysqlPromotions) Release(ctx context.Context, bookingID int) error {
+	_, err := m.q.ExecContext(ctx, `DELETE FROM promotion_redemptions WHERE booking_id = ?`, bookingID)
+	return err
+}
+
+type mysqlRateCards struct {
+	q database.Queryer
+}
+
+func (m mysqlRateCards) Get(ctx context.Context, vehicleClass string) (*RateCard, error) {
+	card := RateCard{VehicleClass: vehicleClass}
+	err := m.q.QueryRowContext(ctx, `
+		SELECT billing_unit, unit_rate, peak_multiplier, peak_start_hour, peak_end_hour
+		FROM rate_cards
+		WHERE vehicle_class = ?`, vehicleClass).Scan(
+		&card.BillingUnit, &card.UnitRate, &card.PeakMultiplier, &card.PeakStartHour, &card.PeakEndHour)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, errRateCardNotFound
+		}
+		return nil, err
+	}
+	return &card, nil
+}
+
+type mysqlInvoices struct {
+	q database.Queryer
+}
+
+const invoiceColumns = `invoice_id, invoice_number, kind, billing_id, booking_id, user_id, vehicle_id, rental_start,
+	rental_end, COALESCE(credits_invoice_id, 0), reason, currency, subtotal, tax_name, tax_rate, tax_amount, total, issued_at`
+
+func scanInvoice(row database.Scanner) (Invoice, error) {
+	var invoice Invoice
+	var rentalStart, rentalEnd, issuedAt string
+	err := row.Scan(&invoice.InvoiceID, &invoice.InvoiceNumber, &invoice.Kind, &invoice.BillingID, &invoice.BookingID,
+		&invoice.UserID, &invoice.VehicleID, &rentalStart, &rentalEnd, &invoice.CreditsInvoiceID, &invoice.Reason,
+		&invoice.Currency, &invoice.Subtotal, &invoice.TaxName, &invoice.TaxRate, &invoice.TaxAmount, &invoice.Total, &issuedAt)
+	if err != nil {
+		return invoice, err
+	}
+	invoice.RentalStart, _ = time.Parse(timeLayout, rentalStart)
+	invoice.RentalEnd, _ = time.Parse(timeLayout, rentalEnd)
+	invoice.IssuedAt, _ = time.Parse(timeLayout, issuedAt)
+	return invoice, nil
+}
+
+func (m mysqlInvoices) lines(ctx context.Context, invoice *Invoice) error {
+	rows, err := m.q.QueryContext(ctx, `
+		SELECT kind, description, quantity, unit_amount, amount
+		FROM invoice_lines WHERE invoice_id = ? ORDER BY line_id`, invoice.InvoiceID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	invoice.Lines = []InvoiceLine{}
+	for rows.Next() {
+		var line InvoiceLine
+		if err := rows.Scan(&line.Kind, &line.Description, &line.Quantity, &line.UnitAmount, &line.Amount); err != nil {
+			return err
+		}
+		invoice.Lines = append(invoice.Lines, line)
+	}
+	return rows.Err()
+}
+
+func (m mysqlInvoices) getOne(ctx context.Context, query string, args ...interface{}) (*Invoice, error) {
+	invoice, err := scanInvoice(m.q.QueryRowContext(ctx, query, args...))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, errInvoiceNotFound
+		}
+		return nil, err
+	}
+	if err := m.lines(ctx, &invoice); err != nil {
+		return nil, err
+	}
+	return &invoice, nil
+}
+
+func (m mysqlInvoices) Issue(ctx context.Context, invoice Invoice) (*Invoice, error) {
+	// Locking the sequence row makes concurrent issues wait for the number
+	var number int
+	err := m.q.QueryRowContext(ctx, `SELECT next_number FROM invoice_sequences WHERE kind = ? FOR UPDATE`, invoice.Kind).Scan(&number)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := m.q.ExecContext(ctx, `UPDATE invoice_sequences SET next_number = next_number + 1 WHERE kind = ?`, invoice.Kind); err != nil {
+		return nil, err
+	}
+
+	result, err := m.q.ExecContext(ctx, `
+		INSERT INTO invoices (invoice_number, kind, billing_id, booking_id, user_id, vehicle_id, rental_start, rental_end,
+			credits_invoice_id, reason, currency, subtotal, tax_name, tax_rate, tax_amount, total, issued_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, NULLIF(?, 0), ?, ?, ?, ?, ?, ?, ?, ?)`,
+		fmt.Sprintf("%s-%06d", invoicePrefixes[invoice.Kind], number), invoice.Kind, invoice.BillingID, invoice.BookingID,
+		invoice.UserID, invoice.VehicleID, invoice.RentalStart.Format(timeLayout), invoice.RentalEnd.Format(timeLayout),
+		invoice.CreditsInvoiceID, invoice.Reason, invoice.Currency, invoice.Subtotal, invoice.TaxName, invoice.TaxRate,
+		invoice.TaxAmount, invoice.Total, invoice.IssuedAt.Format(timeLayout))
+	if err != nil {
+		return nil, err
+	}
+	invoiceID, err := result.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, line := range invoice.Lines {
+		_, err := m.q.ExecContext(ctx, `
+			INSERT INTO invoice_lines (invoice_id, kind, description, quantity, unit_amount, amount)
+			VALUES (?, ?, ?, ?, ?, ?)`,
+			invoiceID, line.Kind, line.Description, line.Quantity, line.UnitAmount, line.Amount)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return m.Get(ctx, int(invoiceID))
+}
+
+func (m mysqlInvoices) Get(ctx context.Context, invoiceID int) (*Invoice, error) {
+	return m.getOne(ctx, `SELECT `+invoiceColumns+` FROM invoices WHERE invoice_id = ?`, invoiceID)
+}
+
+func (m mysqlInvoices) Lock(ctx context.Context, invoiceID int) (*Invoice, error) {
+	return m.getOne(ctx, `SELECT `+invoiceColumns+` FROM invoices WHERE invoice_id = ? FOR UPDATE`, invoiceID)
+}
+
+func (m mysqlInvoices) ForBilling(ctx context.Context, billingID int) ([]Invoice, error) {
+	rows, err := m.q.QueryContext(ctx, `SELECT `+invoiceColumns+` FROM invoices WHERE billing_id = ? ORDER BY invoice_id`, billingID)
+	if err != nil {
+		return nil, err
+	}
+	var invoices []Invoice
+	for rows.Next() {
+		invoice, err := scanInvoice(rows)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		invoices = append(invoices, invoice)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// Lines are read once the invoice rows are closed, a transaction has one connection
+	for i := range invoices {
+		if err := m.lines(ctx, &invoices[i]); err != nil {
+			return nil, err
+		}
+	}
+	return invoices, nil
+}
+
+type mysqlCancellationPolicies struct {
+	q database.Queryer
+}
+
+func (m mysqlCancellationPolicies) Get(ctx context.Context, membershipTier string) (*CancellationPolicy, error) {
+	policy := CancellationPolicy{MembershipTier: membershipTier}
+	var fullMinutes, partialMinutes int
+	err := m.q.QueryRowContext(ctx, `
+		SELECT full_refund_minutes, partial_refund_minutes, partial_refund_percentage
+		FROM cancellation_policies
+		WHERE membership_tier = ?`, membershipTier).Scan(&fullMinutes, &partialMinutes, &policy.PartialRefundPercentage)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, errCancellationPolicyNotFound
+		}
+		return nil, err
+	}
+	policy.FullRefundBefore = time.Duration(fullMinutes) * time.Minute
+	policy.PartialRefundBefore = time.Duration(partialMinutes) * time.Minute
+	return &policy, nil
+}
+
+type mysqlPaymentEvents struct {
+	q database.Queryer
+}
+
+func (m mysqlPaymentEvents) Record(ctx context.Context, event PaymentEvent) (bool, error) {
+	_, err := m.q.ExecContext(ctx, `INSERT IGNORE INTO payment_events (event_id, event_type, gateway_reference) VALUES (?, ?, ?)`,
+		event.EventID, event.Type, event.Reference)
+	if err != nil {
+		return false, err
+	}
+
+	var processed bool
+	err = m.q.QueryRowContext(ctx, `SELECT processed FROM payment_events WHERE event_id = ?`, event.EventID).Scan(&processed)
+	return processed, err
+}
+
+func (m mysqlPaymentEvents) MarkProcessed(ctx context.Context, eventID string) error {
+	_, err := m.q.ExecContext(ctx, `UPDATE payment_events SET processed = TRUE WHERE event_id = ?`, eventID)
+	return err
+}
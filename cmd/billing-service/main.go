@@ -0,0 +1,62 @@
+// Command billing-service runs the billing service: pricing, bills and payments.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+
+	billingservice "github.com/yongkaiyu/CNAD_Assg1/billing_service"
+	"github.com/yongkaiyu/CNAD_Assg1/internal/auth"
+	"github.com/yongkaiyu/CNAD_Assg1/internal/clients"
+	"github.com/yongkaiyu/CNAD_Assg1/internal/config"
+	"github.com/yongkaiyu/CNAD_Assg1/internal/database"
+	"github.com/yongkaiyu/CNAD_Assg1/internal/migrations"
+)
+
+func main() {
+	configFile := flag.String("config", os.Getenv("CONFIG_FILE"), "path to a YAML config file")
+	flag.Parse()
+
+	cfg, err := config.Load(*configFile, config.BinaryBillingService)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	db, err := database.Open(cfg.Database.DSN)
+	if err != nil {
+		log.Fatalf("Error connecting to database: %v", err)
+	}
+	defer db.Close()
+
+	// "<service> migrate [up|down|version|force]" manages the schema and exits
+	if flag.Arg(0) == "migrate" {
+		if err := migrations.Run(context.Background(), db, flag.Args()[1:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	if err := migrations.Check(context.Background(), db); err != nil {
+		log.Fatal(err)
+	}
+
+	auth.Init(cfg.Auth.Secret, cfg.Auth.InternalKey)
+
+	gateway, err := billingservice.NewPaymentGateway(cfg.Payments.Gateway)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	server := billingservice.NewServer(billingservice.NewMySQLStore(db),
+		clients.NewUserClient(cfg.Services.User.URL),
+		clients.NewVehicleClient(cfg.Services.Vehicle.URL),
+		gateway, cfg.Payments, cfg.Pricing)
+	go server.RetryRefunds(context.Background())
+
+	fmt.Printf("Billing service listening at %s\n", cfg.Services.Billing.Addr)
+	log.Fatal(http.ListenAndServe(cfg.Services.Billing.Addr, server.Routes()))
+}
@@ -0,0 +1,40 @@
+// Command gateway runs the API gateway: the single address the browser talks to.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+
+	billingservice "github.com/yongkaiyu/CNAD_Assg1/billing_service"
+	"github.com/yongkaiyu/CNAD_Assg1/gateway"
+	"github.com/yongkaiyu/CNAD_Assg1/internal/auth"
+	"github.com/yongkaiyu/CNAD_Assg1/internal/config"
+	"github.com/yongkaiyu/CNAD_Assg1/internal/static"
+	userservice "github.com/yongkaiyu/CNAD_Assg1/user_service"
+	vehicleservice "github.com/yongkaiyu/CNAD_Assg1/vehicle_service"
+)
+
+func main() {
+	configFile := flag.String("config", os.Getenv("CONFIG_FILE"), "path to a YAML config file")
+	flag.Parse()
+
+	cfg, err := config.Load(*configFile, config.BinaryGateway)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	auth.Init(cfg.Auth.Secret, cfg.Auth.InternalKey)
+
+	pages := static.Merge(userservice.Pages, vehicleservice.Pages, billingservice.Pages)
+
+	handler, err := gateway.New(cfg.Gateway, cfg.Services, pages).Routes()
+	if err != nil {
+		log.Fatalf("Error setting up gateway: %v", err)
+	}
+
+	fmt.Printf("Gateway listening at %s\n", cfg.Gateway.Addr)
+	log.Fatal(http.ListenAndServe(cfg.Gateway.Addr, handler))
+}
@@ -0,0 +1,284 @@
+// Command telemetry-simulator pretends to be the in-car units of the fleet and sends their
+// telemetry to the vehicle service, for trying telemetry out locally.
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"math"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/yongkaiyu/CNAD_Assg1/internal/config"
+	"github.com/yongkaiyu/CNAD_Assg1/internal/database"
+	vehicleservice "github.com/yongkaiyu/CNAD_Assg1/vehicle_service"
+)
+
+// Vehicles without coordinates start somewhere around here
+const homeLat, homeLng = 1.3521, 103.8198
+
+// How the simulated cars drive and charge
+const (
+	speedKmh       = 30.0
+	drainPerKm     = 0.5 // charge level points
+	chargePerTick  = 2.0
+	chargeBelow    = 25.0
+	faultChance    = 0.01
+	faultFixChance = 0.2
+)
+
+var faultCodes = []string{"P0A80", "P0AA6", "U0100", "B1318", "C0035"}
+
+// One simulated in-car unit
+type unit struct {
+	vehicleID   int
+	charge      float64
+	odometer    float64
+	lat, lng    float64
+	driving     bool
+	charging    bool
+	heading     float64
+	doorsLocked bool
+	faults      []string
+}
+
+func newUnit(v vehicleservice.Vehicle) *unit {
+	u := &unit{
+		vehicleID:   v.VehicleID,
+		charge:      float64(v.ChargeLevel),
+		odometer:    5000 + rand.Float64()*45000,
+		lat:         homeLat + (rand.Float64()-0.5)*0.1,
+		lng:         homeLng + (rand.Float64()-0.5)*0.1,
+		doorsLocked: true,
+		faults:      []string{},
+	}
+	if v.OdometerKm != nil {
+		u.odometer = *v.OdometerKm
+	}
+	if v.Latitude != nil && v.Longitude != nil {
+		u.lat, u.lng = *v.Latitude, *v.Longitude
+	}
+	return u
+}
+
+// Move the unit on by one tick and report where it is
+func (u *unit) tick(interval time.Duration, now time.Time) vehicleservice.TelemetryReading {
+	switch {
+	case u.charging:
+		u.charge = math.Min(u.charge+chargePerTick, 100)
+		u.charging = u.charge < 100
+	case u.driving:
+		km := speedKmh * interval.Hours() * (0.5 + rand.Float64())
+		u.heading += (rand.Float64() - 0.5) * math.Pi / 4
+		u.lat += km / 111.32 * math.Cos(u.heading)
+		u.lng += km / (111.32 * math.Cos(u.lat*math.Pi/180)) * math.Sin(u.heading)
+		u.odometer += km
+		u.charge = math.Max(u.charge-km*drainPerKm, 0)
+		// Trips end now and then, and always when the battery runs low
+		if rand.Float64() < 0.1 || u.charge < chargeBelow {
+			u.driving = false
+			u.charging = u.charge < chargeBelow
+		}
+	case rand.Float64() < 0.1:
+		u.driving = true
+		u.heading = rand.Float64() * 2 * math.Pi
+	}
+	u.doorsLocked = u.driving || rand.Float64() < 0.9
+
+	if len(u.faults) > 0 && rand.Float64() < faultFixChance {
+		u.faults = []string{}
+	} else if rand.Float64() < faultChance {
+		u.faults = append(u.faults, faultCodes[rand.Intn(len(faultCodes))])
+	}
+
+	charge := int(math.Round(u.charge))
+	odometer := math.Round(u.odometer*10) / 10
+	lat, lng := math.Round(u.lat*1e6)/1e6, math.Round(u.lng*1e6)/1e6
+	doorsLocked := u.doorsLocked
+	return vehicleservice.TelemetryReading{
+		VehicleID:   u.vehicleID,
+		RecordedAt:  now,
+		ChargeLevel: &charge,
+		OdometerKm:  &odometer,
+		Latitude:    &lat,
+		Longitude:   &lng,
+		DoorsLocked: &doorsLocked,
+		Faults:      append([]string{}, u.faults...),
+	}
+}
+
+func main() {
+	configFile := flag.String("config", os.Getenv("CONFIG_FILE"), "path to a YAML config file")
+	serviceURL := flag.String("url", "", "vehicle service or gateway URL, the vehicle service's URL from the config by default")
+	interval := flag.Duration("interval", 5*time.Second, "time between readings")
+	vehicleList := flag.String("vehicles", "", "comma separated vehicle IDs to simulate, the whole fleet by default")
+	stream := flag.Bool("stream", false, "send readings over the WebSocket stream instead of HTTP batches")
+	flag.Parse()
+
+	cfg, err := config.Load(*configFile, config.BinaryTelemetrySimulator)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if *serviceURL == "" {
+		*serviceURL = cfg.Services.Vehicle.URL
+	}
+	if *interval <= 0 {
+		log.Fatal("-interval must be positive")
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	units, err := loadUnits(ctx, cfg.Database.DSN, *vehicleList)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if len(units) == 0 {
+		log.Fatal("No vehicles to simulate")
+	}
+
+	var send func(context.Context, []vehicleservice.TelemetryReading) error
+	if *stream {
+		conn, err := openStream(ctx, *serviceURL, cfg.Vehicles.TelemetryKey)
+		if err != nil {
+			log.Fatalf("Error opening telemetry stream: %v", err)
+		}
+		defer conn.Close()
+		send = func(ctx context.Context, readings []vehicleservice.TelemetryReading) error {
+			return sendStream(conn, readings)
+		}
+	} else {
+		send = func(ctx context.Context, readings []vehicleservice.TelemetryReading) error {
+			return sendBatch(ctx, *serviceURL, cfg.Vehicles.TelemetryKey, readings)
+		}
+	}
+
+	fmt.Printf("Simulating %d vehicle(s) every %s against %s\n", len(units), *interval, *serviceURL)
+	ticker := time.NewTicker(*interval)
+	defer ticker.Stop()
+	for {
+		now := time.Now().UTC()
+		readings := make([]vehicleservice.TelemetryReading, 0, len(units))
+		for _, u := range units {
+			readings = append(readings, u.tick(*interval, now))
+		}
+		if err := send(ctx, readings); err != nil {
+			log.Printf("Error sending telemetry: %v", err)
+		} else {
+			log.Printf("Sent %d reading(s)", len(readings))
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Start each unit from its vehicle's current state
+func loadUnits(ctx context.Context, dsn, vehicleList string) ([]*unit, error) {
+	db, err := database.Open(dsn)
+	if err != nil {
+		return nil, fmt.Errorf("connecting to database: %w", err)
+	}
+	defer db.Close()
+
+	fleet, err := vehicleservice.NewMySQLStore(db).Vehicles().List(ctx, vehicleservice.VehicleFilter{})
+	if err != nil {
+		return nil, fmt.Errorf("listing the fleet: %w", err)
+	}
+
+	wanted := map[int]bool{}
+	for _, field := range strings.Split(vehicleList, ",") {
+		if field = strings.TrimSpace(field); field == "" {
+			continue
+		}
+		id, err := strconv.Atoi(field)
+		if err != nil {
+			return nil, fmt.Errorf("invalid vehicle ID %q", field)
+		}
+		wanted[id] = true
+	}
+
+	var units []*unit
+	for _, v := range fleet {
+		if len(wanted) == 0 || wanted[v.VehicleID] {
+			units = append(units, newUnit(v))
+		}
+	}
+	return units, nil
+}
+
+func sendBatch(ctx context.Context, serviceURL, key string, readings []vehicleservice.TelemetryReading) error {
+	body, err := json.Marshal(readings)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimSuffix(serviceURL, "/")+"/api/v1/telemetry", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Telemetry-Key", key)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		var message bytes.Buffer
+		message.ReadFrom(resp.Body)
+		return fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(message.String()))
+	}
+	return nil
+}
+
+func openStream(ctx context.Context, serviceURL, key string) (*websocket.Conn, error) {
+	u, err := url.Parse(strings.TrimSuffix(serviceURL, "/") + "/api/v1/telemetry/stream")
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme == "https" {
+		u.Scheme = "wss"
+	} else {
+		u.Scheme = "ws"
+	}
+
+	header := http.Header{}
+	header.Set("X-Telemetry-Key", key)
+	conn, _, err := websocket.DefaultDialer.DialContext(ctx, u.String(), header)
+	return conn, err
+}
+
+// Send each reading and wait for the service to acknowledge it
+func sendStream(conn *websocket.Conn, readings []vehicleservice.TelemetryReading) error {
+	for _, reading := range readings {
+		if err := conn.WriteJSON(reading); err != nil {
+			return err
+		}
+		var ack struct {
+			Error string `json:"error"`
+		}
+		if err := conn.ReadJSON(&ack); err != nil {
+			return err
+		}
+		if ack.Error != "" {
+			log.Printf("Vehicle %d: %s", reading.VehicleID, ack.Error)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,101 @@
+// Command user-service runs the user service: accounts, tokens, membership and tier evaluation.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+
+	"github.com/yongkaiyu/CNAD_Assg1/internal/auth"
+	"github.com/yongkaiyu/CNAD_Assg1/internal/clients"
+	"github.com/yongkaiyu/CNAD_Assg1/internal/config"
+	"github.com/yongkaiyu/CNAD_Assg1/internal/database"
+	"github.com/yongkaiyu/CNAD_Assg1/internal/mail"
+	"github.com/yongkaiyu/CNAD_Assg1/internal/migrations"
+	"github.com/yongkaiyu/CNAD_Assg1/internal/sms"
+	userservice "github.com/yongkaiyu/CNAD_Assg1/user_service"
+)
+
+func main() {
+	configFile := flag.String("config", os.Getenv("CONFIG_FILE"), "path to a YAML config file")
+	flag.Parse()
+
+	cfg, err := config.Load(*configFile, config.BinaryUserService)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	db, err := database.Open(cfg.Database.DSN)
+	if err != nil {
+		log.Fatalf("Error connecting to database: %v", err)
+	}
+	defer db.Close()
+
+	// "<service> migrate [up|down|version|force]" manages the schema and exits
+	if flag.Arg(0) == "migrate" {
+		if err := migrations.Run(context.Background(), db, flag.Args()[1:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	if err := migrations.Check(context.Background(), db); err != nil {
+		log.Fatal(err)
+	}
+
+	store := userservice.NewMySQLStore(db)
+
+	// "user-service role <email> <role>" assigns a role and exits, e.g. to create the first admin
+	if flag.Arg(0) == "role" {
+		if err := setRole(context.Background(), store, flag.Arg(1), flag.Arg(2)); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	auth.Init(cfg.Auth.Secret, cfg.Auth.InternalKey)
+
+	mailer, err := mail.New(cfg.Mail)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	smsSender, err := sms.New(cfg.SMS)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	server := userservice.NewServer(store,
+		clients.NewVehicleClient(cfg.Services.Vehicle.URL),
+		clients.NewBillingClient(cfg.Services.Billing.URL),
+		mailer, smsSender, cfg.Users)
+
+	if cfg.Users.TierEvaluationInterval > 0 {
+		go userservice.NewTierScheduler(db, server).Run(context.Background(), cfg.Users.TierEvaluationInterval)
+	}
+
+	fmt.Printf("User service listening at %s\n", cfg.Services.User.Addr)
+	log.Fatal(http.ListenAndServe(cfg.Services.User.Addr, server.Routes()))
+}
+
+func setRole(ctx context.Context, store userservice.UserStore, email, role string) error {
+	if email == "" || !auth.ValidRole(role) {
+		return fmt.Errorf("usage: role <email> <customer|fleet_operator|finance|admin>")
+	}
+	user, err := store.GetByEmail(ctx, email)
+	if err != nil {
+		return fmt.Errorf("looking up %s: %w", email, err)
+	}
+	if user.Role == role {
+		log.Printf("%s already has role %s", email, role)
+		return nil
+	}
+	if err := store.SetRole(ctx, user.UserID, role); err != nil {
+		return err
+	}
+	log.Printf("Changed the role of %s from %s to %s", email, user.Role, role)
+	return nil
+}
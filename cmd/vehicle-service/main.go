@@ -0,0 +1,77 @@
+// Command vehicle-service runs the vehicle service: the fleet, bookings and the booking scheduler.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+
+	"github.com/yongkaiyu/CNAD_Assg1/internal/auth"
+	"github.com/yongkaiyu/CNAD_Assg1/internal/clients"
+	"github.com/yongkaiyu/CNAD_Assg1/internal/config"
+	"github.com/yongkaiyu/CNAD_Assg1/internal/database"
+	"github.com/yongkaiyu/CNAD_Assg1/internal/migrations"
+	"github.com/yongkaiyu/CNAD_Assg1/internal/sms"
+	vehicleservice "github.com/yongkaiyu/CNAD_Assg1/vehicle_service"
+)
+
+func main() {
+	configFile := flag.String("config", os.Getenv("CONFIG_FILE"), "path to a YAML config file")
+	flag.Parse()
+
+	cfg, err := config.Load(*configFile, config.BinaryVehicleService)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	db, err := database.Open(cfg.Database.DSN)
+	if err != nil {
+		log.Fatalf("Error connecting to database: %v", err)
+	}
+	defer db.Close()
+
+	// "<service> migrate [up|down|version|force]" manages the schema and exits
+	if flag.Arg(0) == "migrate" {
+		if err := migrations.Run(context.Background(), db, flag.Args()[1:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	if err := migrations.Check(context.Background(), db); err != nil {
+		log.Fatal(err)
+	}
+
+	auth.Init(cfg.Auth.Secret, cfg.Auth.InternalKey)
+
+	users := clients.NewUserClient(cfg.Services.User.URL)
+
+	// Notifications are always logged, and texted as well if SMS notifications are on
+	var smsSender sms.SMSSender
+	if cfg.SMS.Notifications {
+		smsSender, err = sms.New(cfg.SMS)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+	notifier := vehicleservice.NewNotifier(users, smsSender)
+
+	commander, err := vehicleservice.NewCommander(cfg.Vehicles.Commander)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	billing := clients.NewBillingClient(cfg.Services.Billing.URL)
+	server := vehicleservice.NewServer(vehicleservice.NewMySQLStore(db),
+		users,
+		billing,
+		notifier, commander, cfg.Vehicles)
+
+	go vehicleservice.NewScheduler(db, billing, notifier, cfg.Vehicles).Run(context.Background(), cfg.Scheduler)
+
+	fmt.Printf("Vehicle service listening at %s\n", cfg.Services.Vehicle.Addr)
+	log.Fatal(http.ListenAndServe(cfg.Services.Vehicle.Addr, server.Routes()))
+}
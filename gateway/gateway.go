@@ -0,0 +1,100 @@
+// Package gateway is the single entry point in front of the user, vehicle and
+// billing services. It proxies the API, serves the static pages and handles
+// authentication, CORS, request IDs and rate limiting for every request.
+package gateway
+
+import (
+	"log"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+
+	"github.com/gorilla/mux"
+
+	"github.com/yongkaiyu/CNAD_Assg1/internal/config"
+	"github.com/yongkaiyu/CNAD_Assg1/internal/static"
+)
+
+// Endpoints reachable without an access token
+var publicPaths = map[string]bool{
+	"/api/v1/user/signup":          true,
+	"/api/v1/user/login":           true,
+	"/api/v1/user/token/refresh":   true,
+	"/api/v1/user/password/forgot": true,
+	"/api/v1/user/password/reset":  true,
+	"/api/v1/user/verify":          true,
+	"/api/v1/billing/webhook":      true,
+	// In-car units send the telemetry key instead, checked by the vehicle service
+	"/api/v1/telemetry":        true,
+	"/api/v1/telemetry/stream": true,
+}
+
+type Gateway struct {
+	cfg      config.Gateway
+	services config.Services
+	pages    static.Pages
+	limiter  *rateLimiter
+}
+
+func New(cfg config.Gateway, services config.Services, pages static.Pages) *Gateway {
+	g := &Gateway{cfg: cfg, services: services, pages: pages}
+	if cfg.RateLimitPerSecond > 0 {
+		g.limiter = newRateLimiter(cfg.RateLimitPerSecond, cfg.RateLimitBurst)
+	}
+	return g
+}
+
+func (g *Gateway) Routes() (http.Handler, error) {
+	router := mux.NewRouter()
+
+	// Prefixes under /api/v1 and the service that handles them
+	upstreams := []struct {
+		prefix, target string
+	}{
+		{"/user/", g.services.User.URL},
+		{"/booking/", g.services.Vehicle.URL},
+		{"/billing/", g.services.Billing.URL},
+		{"/admin/users", g.services.User.URL},
+		{"/admin/tiers", g.services.User.URL},
+		{"/admin/vehicles", g.services.Vehicle.URL},
+		{"/admin/promotions", g.services.Billing.URL},
+		{"/admin/invoices", g.services.Billing.URL},
+		{"/telemetry", g.services.Vehicle.URL},
+	}
+
+	api := router.PathPrefix("/api/v1").Subrouter()
+	api.Use(g.authenticate)
+
+	for _, upstream := range upstreams {
+		proxy, err := newProxy(upstream.target)
+		if err != nil {
+			return nil, err
+		}
+		api.PathPrefix(upstream.prefix).Handler(proxy)
+	}
+
+	static.Register(router, g.pages)
+
+	// Outermost first: every response gets a request ID and CORS headers, even when rate limited
+	var handler http.Handler = router
+	handler = g.rateLimit(handler)
+	handler = g.cors(handler)
+	handler = logRequests(handler)
+	handler = requestID(handler)
+	return handler, nil
+}
+
+// Forward requests unchanged to the service at target
+func newProxy(target string) (*httputil.ReverseProxy, error) {
+	upstream, err := url.Parse(target)
+	if err != nil {
+		return nil, err
+	}
+
+	proxy := httputil.NewSingleHostReverseProxy(upstream)
+	proxy.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) {
+		log.Printf("[%s] Error proxying %s to %s: %v", r.Header.Get(RequestIDHeader), r.URL.Path, upstream.Host, err)
+		http.Error(w, "Service unavailable", http.StatusBadGateway)
+	}
+	return proxy, nil
+}
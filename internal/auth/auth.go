@@ -0,0 +1,209 @@
+// Package auth issues and verifies the access tokens shared by all services.
+package auth
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+)
+
+const AccessTokenTTL = 15 * time.Minute
+
+type contextKey string
+
+const (
+	userIDContextKey contextKey = "userID"
+	roleContextKey   contextKey = "role"
+)
+
+// Roles a user can have. Admins may do anything the other roles can.
+const (
+	RoleCustomer      = "customer"
+	RoleFleetOperator = "fleet_operator"
+	RoleFinance       = "finance"
+	RoleAdmin         = "admin"
+)
+
+// ValidRole reports whether role is one of the roles above
+func ValidRole(role string) bool {
+	switch role {
+	case RoleCustomer, RoleFleetOperator, RoleFinance, RoleAdmin:
+		return true
+	}
+	return false
+}
+
+var (
+	ErrInvalidToken = errors.New("invalid token")
+	ErrExpiredToken = errors.New("token expired")
+)
+
+// Secret used to sign access tokens. Every service must use the same one.
+var secret []byte
+
+// Key services send each other on /internal endpoints
+var internalKey string
+
+type Claims struct {
+	Subject   int    `json:"sub"`
+	Type      string `json:"typ"`
+	Role      string `json:"role,omitempty"`
+	IssuedAt  int64  `json:"iat"`
+	ExpiresAt int64  `json:"exp"`
+}
+
+// Init sets the token signing secret and the internal API key
+func Init(tokenSecret, internalAPIKey string) {
+	secret = []byte(tokenSecret)
+
+	internalKey = internalAPIKey
+	if internalKey == "" {
+		log.Println("INTERNAL_API_KEY not set, rejecting requests to internal endpoints")
+	}
+}
+
+// InternalKey is sent by service clients in the X-Internal-Key header
+func InternalKey() string {
+	return internalKey
+}
+
+// IssueAccessToken signs an access token for the user. The role is carried in the token,
+// so a change of role takes effect when the token is next refreshed.
+func IssueAccessToken(userID int, role string) (string, error) {
+	now := time.Now()
+	claims := Claims{
+		Subject:   userID,
+		Type:      "access",
+		Role:      role,
+		IssuedAt:  now.Unix(),
+		ExpiresAt: now.Add(AccessTokenTTL).Unix(),
+	}
+
+	header, err := json.Marshal(map[string]string{"alg": "HS256", "typ": "JWT"})
+	if err != nil {
+		return "", err
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+
+	unsigned := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	return unsigned + "." + sign(unsigned), nil
+}
+
+// ParseAccessToken verifies an access token and returns its claims
+func ParseAccessToken(token string) (*Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, ErrInvalidToken
+	}
+
+	expected := sign(parts[0] + "." + parts[1])
+	if !hmac.Equal([]byte(expected), []byte(parts[2])) {
+		return nil, ErrInvalidToken
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	var claims Claims
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return nil, ErrInvalidToken
+	}
+	if claims.Type != "access" || claims.Subject == 0 {
+		return nil, ErrInvalidToken
+	}
+	// Tokens issued before roles existed belong to customers
+	if claims.Role == "" {
+		claims.Role = RoleCustomer
+	}
+	if time.Now().Unix() >= claims.ExpiresAt {
+		return nil, ErrExpiredToken
+	}
+
+	return &claims, nil
+}
+
+func sign(unsigned string) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(unsigned))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// Middleware rejects requests without a valid access token and
+// stores the caller's user ID and role in the request context
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, found := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !found || token == "" {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		claims, err := ParseAccessToken(token)
+		if err != nil {
+			log.Printf("Rejected access token: %v", err)
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), userIDContextKey, claims.Subject)
+		ctx = context.WithValue(ctx, roleContextKey, claims.Role)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// RequireRole only lets through users with one of the given roles, and admins.
+// It must run after Middleware.
+func RequireRole(roles ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			role := Role(r)
+			if UserID(r) == 0 || role == "" {
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+			if role != RoleAdmin && !slices.Contains(roles, role) {
+				log.Printf("User %d with role %s denied %s %s", UserID(r), role, r.Method, r.URL.Path)
+				http.Error(w, "Forbidden", http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// InternalMiddleware only lets through requests from other services.
+// Without an internal key it lets nothing through.
+func InternalMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if internalKey == "" || !hmac.Equal([]byte(r.Header.Get("X-Internal-Key")), []byte(internalKey)) {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// UserID returns the authenticated user set by Middleware
+func UserID(r *http.Request) int {
+	userID, _ := r.Context().Value(userIDContextKey).(int)
+	return userID
+}
+
+// Role returns the authenticated user's role set by Middleware
+func Role(r *http.Request) string {
+	role, _ := r.Context().Value(roleContextKey).(string)
+	return role
+}
@@ -0,0 +1,128 @@
+package clients
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+type BillInfo struct {
+	BillingID     int     `json:"billing_id"`
+	BookingID     int     `json:"booking_id"`
+	UserID        int     `json:"user_id"`
+	PaymentStatus string  `json:"payment_status"`
+	PaymentMethod string  `json:"payment_method"`
+	TotalAmount   float64 `json:"total_amount"`
+	// Given back through refunds, out of TotalAmount. The booking costs TotalAmount less this.
+	RefundedAmount float64 `json:"refunded_amount"`
+	// Paid and not refunded, and still to pay. A paid bill owes more after it is repriced up.
+	AmountPaid float64 `json:"amount_paid"`
+	AmountDue  float64 `json:"amount_due"`
+	CreatedAt  string  `json:"created_at"`
+	UpdatedAt  string  `json:"updated_at"`
+}
+
+// Cost is what the booking costs after refunds
+func (b BillInfo) Cost() float64 {
+	return math.Round((b.TotalAmount-b.RefundedAmount)*100) / 100
+}
+
+// BillRequest asks the billing service to price a booking window.
+// PromoCode is only used when the bill is created.
+type BillRequest struct {
+	BookingID int       `json:"booking_id"`
+	UserID    int       `json:"user_id"`
+	VehicleID int       `json:"vehicle_id"`
+	StartTime time.Time `json:"start_time"`
+	EndTime   time.Time `json:"end_time"`
+	PromoCode string    `json:"promo_code,omitempty"`
+	// A trip still running after this is charged late fees. Zero means none.
+	LateAfter time.Time `json:"late_after,omitempty"`
+	// The trip has ended, so the bill is final and its invoice is issued
+	Final bool `json:"final,omitempty"`
+}
+
+// CancelRequest tells the billing service when the cancelled booking was due to start,
+// which decides the refund
+type CancelRequest struct {
+	StartTime time.Time `json:"start_time"`
+}
+
+// CancelResult is what the customer gets back for a cancelled booking
+type CancelResult struct {
+	RefundPercentage float64 `json:"refund_percentage"`
+	RefundAmount     float64 `json:"refund_amount"`
+	// Still to pay on a bill that hadn't been paid in full, the part of it that isn't refunded
+	AmountDue float64 `json:"amount_due"`
+}
+
+// BillResponse carries the bill and the itemised quote it was priced from
+type BillResponse struct {
+	Bill  BillInfo        `json:"bill"`
+	Quote json.RawMessage `json:"quote"`
+}
+
+// BillingClient calls the billing service
+type BillingClient struct {
+	client
+}
+
+func NewBillingClient(baseURL string) *BillingClient {
+	return &BillingClient{newClient(baseURL)}
+}
+
+// Quote prices a booking window without billing it
+func (c *BillingClient) Quote(ctx context.Context, req BillRequest) (json.RawMessage, error) {
+	var quote json.RawMessage
+	if err := c.do(ctx, http.MethodPost, "/internal/quotes", req, &quote); err != nil {
+		return nil, err
+	}
+	return quote, nil
+}
+
+// CreateBill prices a new booking and creates its pending bill
+func (c *BillingClient) CreateBill(ctx context.Context, req BillRequest) (*BillResponse, error) {
+	var resp BillResponse
+	if err := c.do(ctx, http.MethodPost, "/internal/billings", req, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// UpdateBill reprices a booking after its window changed
+func (c *BillingClient) UpdateBill(ctx context.Context, req BillRequest) (*BillResponse, error) {
+	var resp BillResponse
+	if err := c.do(ctx, http.MethodPut, fmt.Sprintf("/internal/billings/%d", req.BookingID), req, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// CancelBill refunds the booking's bill as its cancellation policy allows
+func (c *BillingClient) CancelBill(ctx context.Context, bookingID int, req CancelRequest) (*CancelResult, error) {
+	var result CancelResult
+	if err := c.do(ctx, http.MethodPost, fmt.Sprintf("/internal/billings/%d/cancel", bookingID), req, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// DeleteBill removes an unpaid bill whose booking could not be saved
+func (c *BillingClient) DeleteBill(ctx context.Context, bookingID int) error {
+	return c.do(ctx, http.MethodDelete, fmt.Sprintf("/internal/billings/%d", bookingID), nil, nil)
+}
+
+func (c *BillingClient) ListBills(ctx context.Context, userID int) ([]BillInfo, error) {
+	query := url.Values{"user_id": {strconv.Itoa(userID)}}
+
+	var bills []BillInfo
+	if err := c.do(ctx, http.MethodGet, "/internal/billings?"+query.Encode(), nil, &bills); err != nil {
+		return nil, err
+	}
+	return bills, nil
+}
@@ -0,0 +1,51 @@
+package clients
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+)
+
+type UserInfo struct {
+	UserID         int    `json:"user_id"`
+	Name           string `json:"name"`
+	Email          string `json:"email"`
+	Phone          string `json:"phone"`
+	MembershipTier string `json:"membership_tier"`
+	EmailVerified  bool   `json:"email_verified"`
+	PhoneVerified  bool   `json:"phone_verified"`
+}
+
+type Membership struct {
+	UserID         int     `json:"user_id"`
+	Tier           string  `json:"tier"`
+	DiscountRate   float64 `json:"discount_rate"`
+	PriorityAccess bool    `json:"priority_access"`
+	BookingLimit   int     `json:"booking_limit"`
+}
+
+// UserClient calls the user service
+type UserClient struct {
+	client
+}
+
+func NewUserClient(baseURL string) *UserClient {
+	return &UserClient{newClient(baseURL)}
+}
+
+func (c *UserClient) GetUser(ctx context.Context, userID int) (*UserInfo, error) {
+	var user UserInfo
+	if err := c.do(ctx, http.MethodGet, fmt.Sprintf("/internal/users/%d", userID), nil, &user); err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// GetMembership returns the user's tier and its benefits
+func (c *UserClient) GetMembership(ctx context.Context, userID int) (*Membership, error) {
+	var membership Membership
+	if err := c.do(ctx, http.MethodGet, fmt.Sprintf("/internal/users/%d/membership", userID), nil, &membership); err != nil {
+		return nil, err
+	}
+	return &membership, nil
+}
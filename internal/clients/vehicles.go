@@ -0,0 +1,94 @@
+package clients
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+type VehicleInfo struct {
+	VehicleID    int    `json:"vehicle_id"`
+	LicensePlate string `json:"license_plate"`
+	Location     string `json:"location"`
+	ChargeLevel  int    `json:"charge_level"`
+	Status       string `json:"status"`
+	Cleanliness  string `json:"cleanliness"`
+	VehicleClass string `json:"vehicle_class"`
+}
+
+// Times use MySQL's "2006-01-02 15:04:05" format
+type BookingInfo struct {
+	BookingID int     `json:"booking_id"`
+	UserID    int     `json:"user_id"`
+	VehicleID int     `json:"vehicle_id"`
+	StartTime string  `json:"start_time"`
+	EndTime   string  `json:"end_time"`
+	Status    string  `json:"status"`
+	TotalCost float64 `json:"total_cost"`
+	CreatedAt string  `json:"created_at"`
+	UpdatedAt string  `json:"updated_at"`
+	// The trip has ended but its bill hasn't been repriced for it yet
+	BillPending bool `json:"bill_pending"`
+}
+
+// RentalSummary is how much one user rented over a period
+type RentalSummary struct {
+	UserID  int     `json:"user_id"`
+	Rentals int     `json:"rentals"`
+	Spend   float64 `json:"spend"`
+}
+
+// VehicleClient calls the vehicle service
+type VehicleClient struct {
+	client
+}
+
+func NewVehicleClient(baseURL string) *VehicleClient {
+	return &VehicleClient{newClient(baseURL)}
+}
+
+func (c *VehicleClient) GetVehicle(ctx context.Context, vehicleID int) (*VehicleInfo, error) {
+	var vehicle VehicleInfo
+	if err := c.do(ctx, http.MethodGet, fmt.Sprintf("/internal/vehicles/%d", vehicleID), nil, &vehicle); err != nil {
+		return nil, err
+	}
+	return &vehicle, nil
+}
+
+func (c *VehicleClient) GetBooking(ctx context.Context, bookingID int) (*BookingInfo, error) {
+	var booking BookingInfo
+	if err := c.do(ctx, http.MethodGet, fmt.Sprintf("/internal/bookings/%d", bookingID), nil, &booking); err != nil {
+		return nil, err
+	}
+	return &booking, nil
+}
+
+// ListBookings returns the user's bookings, most recently updated first.
+// An empty status returns bookings in every status.
+func (c *VehicleClient) ListBookings(ctx context.Context, userID int, status string) ([]BookingInfo, error) {
+	query := url.Values{"user_id": {strconv.Itoa(userID)}}
+	if status != "" {
+		query.Set("status", status)
+	}
+
+	var bookings []BookingInfo
+	if err := c.do(ctx, http.MethodGet, "/internal/bookings?"+query.Encode(), nil, &bookings); err != nil {
+		return nil, err
+	}
+	return bookings, nil
+}
+
+// RentalSummaries returns completed rentals and spend per user for bookings that ended in
+// the last period. Users without any are left out.
+func (c *VehicleClient) RentalSummaries(ctx context.Context, period time.Duration) ([]RentalSummary, error) {
+	query := url.Values{"period_seconds": {strconv.Itoa(int(period.Seconds()))}}
+
+	var summaries []RentalSummary
+	if err := c.do(ctx, http.MethodGet, "/internal/rentals/summary?"+query.Encode(), nil, &summaries); err != nil {
+		return nil, err
+	}
+	return summaries, nil
+}
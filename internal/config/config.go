@@ -0,0 +1,512 @@
+// Package config loads the settings shared by the services and the gateway.
+//
+// Settings come from built-in defaults, then an optional YAML file, then
+// environment variables, so the same binary can run in every environment.
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+type Config struct {
+	Database  Database  `yaml:"database"`
+	Auth      Auth      `yaml:"auth"`
+	Services  Services  `yaml:"services"`
+	Gateway   Gateway   `yaml:"gateway"`
+	Scheduler Scheduler `yaml:"scheduler"`
+	Payments  Payments  `yaml:"payments"`
+	Pricing   Pricing   `yaml:"pricing"`
+	Vehicles  Vehicles  `yaml:"vehicles"`
+	Users     Users     `yaml:"users"`
+	Mail      Mail      `yaml:"mail"`
+	SMS       SMS       `yaml:"sms"`
+}
+
+type Database struct {
+	DSN string `yaml:"dsn"`
+}
+
+type Auth struct {
+	// Signs access tokens. Must be the same for every service.
+	Secret string `yaml:"secret"`
+	// Sent between services on /internal endpoints. Must be the same for every service.
+	InternalKey string `yaml:"internal_key"`
+}
+
+// Service describes where one service listens and where the others reach it
+type Service struct {
+	Addr string `yaml:"addr"`
+	URL  string `yaml:"url"`
+}
+
+type Services struct {
+	User    Service `yaml:"user"`
+	Vehicle Service `yaml:"vehicle"`
+	Billing Service `yaml:"billing"`
+}
+
+type Gateway struct {
+	Addr string `yaml:"addr"`
+	// Origins allowed to call the API from a browser. "*" allows any origin.
+	AllowedOrigins []string `yaml:"allowed_origins"`
+	// Requests per second per client, zero disables rate limiting
+	RateLimitPerSecond float64 `yaml:"rate_limit_per_second"`
+	RateLimitBurst     int     `yaml:"rate_limit_burst"`
+}
+
+type Scheduler struct {
+	// How often the jobs run
+	Interval time.Duration `yaml:"interval"`
+	// How long before the start time a reminder goes out
+	ReminderLead time.Duration `yaml:"reminder_lead"`
+	// How long after the start time an unclaimed booking counts as a no-show. Zero disables the check.
+	NoShowGrace time.Duration `yaml:"no_show_grace"`
+}
+
+type Payments struct {
+	// Payment provider, only "mock" for now
+	Gateway string `yaml:"gateway"`
+	// Shared with the provider to sign webhook payloads
+	WebhookSecret string `yaml:"webhook_secret"`
+}
+
+type Pricing struct {
+	// Used for vehicle classes without a rate card
+	DefaultVehicleClass string  `yaml:"default_vehicle_class"`
+	DefaultHourlyRate   float64 `yaml:"default_hourly_rate"`
+	// IANA time zone the rate cards' peak hours are in, such as Asia/Singapore. Empty means
+	// the server's local time zone.
+	TimeZone string `yaml:"time_zone"`
+	// Charged for every LateFeeInterval, or part of one, that a trip runs past its late
+	// return grace. Zero disables late fees.
+	LateFee         float64       `yaml:"late_fee"`
+	LateFeeInterval time.Duration `yaml:"late_fee_interval"`
+	// Cancellation policy for membership tiers without one of their own. Cancelling at least
+	// FullRefundBefore ahead of the start refunds everything, at least PartialRefundBefore
+	// ahead refunds PartialRefundPercentage, and any later nothing.
+	FullRefundBefore        time.Duration `yaml:"full_refund_before"`
+	PartialRefundBefore     time.Duration `yaml:"partial_refund_before"`
+	PartialRefundPercentage float64       `yaml:"partial_refund_percentage"`
+	// Sales tax added to every price, shown under TaxName on quotes and invoices
+	TaxName string  `yaml:"tax_name"`
+	TaxRate float64 `yaml:"tax_rate"`
+}
+
+type Vehicles struct {
+	// Vehicles below this charge level aren't offered for booking
+	MinChargeLevel int `yaml:"min_charge_level"`
+	// For this long after a vehicle is added, back from maintenance or charged past
+	// MinChargeLevel, only tiers with priority access can see and book it. Zero disables it.
+	PriorityWindow time.Duration `yaml:"priority_window"`
+	// Sent by in-car units in the X-Telemetry-Key header
+	TelemetryKey string `yaml:"telemetry_key"`
+	// Sends lock and unlock commands to vehicles. Only "fake" is available.
+	Commander string `yaml:"commander"`
+	// How long after the booked end a trip can run before it counts as a late return
+	LateReturnGrace time.Duration `yaml:"late_return_grace"`
+}
+
+type Users struct {
+	// Address users open the pages at, used for links in emails
+	PublicURL string `yaml:"public_url"`
+	// How long a password reset link works
+	PasswordResetTTL time.Duration `yaml:"password_reset_ttl"`
+	// How long an email verification link works
+	EmailVerificationTTL time.Duration `yaml:"email_verification_ttl"`
+	// Minimum time between verification emails or texts, or password reset emails, to one user
+	VerificationResendInterval time.Duration `yaml:"verification_resend_interval"`
+	// How long a phone verification code works, and how many wrong guesses it allows
+	PhoneCodeTTL         time.Duration `yaml:"phone_code_ttl"`
+	PhoneCodeMaxAttempts int           `yaml:"phone_code_max_attempts"`
+	// Added to phone numbers entered without one, e.g. "+65"
+	DefaultCountryCode string `yaml:"default_country_code"`
+	// Rentals completed in this rolling period count towards a membership tier
+	TierPeriod time.Duration `yaml:"tier_period"`
+	// How often every user's tier is re-evaluated. Zero disables the evaluation.
+	TierEvaluationInterval time.Duration `yaml:"tier_evaluation_interval"`
+}
+
+type Mail struct {
+	// "log", "smtp" or "sendgrid"
+	Provider string `yaml:"provider"`
+	From     string `yaml:"from"`
+	// The log provider also writes each message to a file here when set
+	OutboxDir      string `yaml:"outbox_dir"`
+	SMTP           SMTP   `yaml:"smtp"`
+	SendGridAPIKey string `yaml:"sendgrid_api_key"`
+}
+
+type SMS struct {
+	// "fake" or "twilio"
+	Provider string `yaml:"provider"`
+	// Number messages are sent from
+	From             string `yaml:"from"`
+	TwilioAccountSID string `yaml:"twilio_account_sid"`
+	TwilioAuthToken  string `yaml:"twilio_auth_token"`
+	// Also text booking confirmations, reminders and cancellations to verified phone numbers
+	Notifications bool `yaml:"notifications"`
+}
+
+type SMTP struct {
+	Host     string `yaml:"host"`
+	Port     int    `yaml:"port"`
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+}
+
+// Default returns the settings used for local development
+func Default() Config {
+	return Config{
+		Database: Database{
+			DSN: "user:password@tcp(127.0.0.1:3306)/electric_car_sharing_db",
+		},
+		Services: Services{
+			User:    Service{Addr: ":5001", URL: "http://localhost:5001"},
+			Vehicle: Service{Addr: ":5002", URL: "http://localhost:5002"},
+			Billing: Service{Addr: ":5003", URL: "http://localhost:5003"},
+		},
+		Gateway: Gateway{
+			Addr:               ":5000",
+			AllowedOrigins:     []string{"http://localhost:5000"},
+			RateLimitPerSecond: 10,
+			RateLimitBurst:     20,
+		},
+		Scheduler: Scheduler{
+			Interval:     time.Minute,
+			ReminderLead: 30 * time.Minute,
+		},
+		Payments: Payments{
+			Gateway: "mock",
+		},
+		Pricing: Pricing{
+			DefaultVehicleClass:     "Standard",
+			DefaultHourlyRate:       10.00,
+			LateFee:                 5.00,
+			LateFeeInterval:         15 * time.Minute,
+			FullRefundBefore:        24 * time.Hour,
+			PartialRefundBefore:     2 * time.Hour,
+			PartialRefundPercentage: 50,
+			TaxName:                 "GST",
+			TaxRate:                 9,
+		},
+		Vehicles: Vehicles{
+			MinChargeLevel:  20,
+			PriorityWindow:  30 * time.Minute,
+			Commander:       "fake",
+			LateReturnGrace: 15 * time.Minute,
+		},
+		Users: Users{
+			PublicURL:                  "http://localhost:5000",
+			PasswordResetTTL:           time.Hour,
+			EmailVerificationTTL:       24 * time.Hour,
+			VerificationResendInterval: time.Minute,
+			PhoneCodeTTL:               10 * time.Minute,
+			PhoneCodeMaxAttempts:       5,
+			DefaultCountryCode:         "+65",
+			TierPeriod:                 90 * 24 * time.Hour,
+			TierEvaluationInterval:     24 * time.Hour,
+		},
+		Mail: Mail{
+			Provider: "log",
+			From:     "no-reply@localhost",
+			SMTP:     SMTP{Port: 587},
+		},
+		SMS: SMS{
+			Provider: "fake",
+		},
+	}
+}
+
+// Location is the time zone peak hours are in
+func (p Pricing) Location() (*time.Location, error) {
+	if p.TimeZone == "" {
+		return time.Local, nil
+	}
+	return time.LoadLocation(p.TimeZone)
+}
+
+// The programs that load the configuration, so each is only held to the settings it uses
+const (
+	BinaryGateway            = "gateway"
+	BinaryUserService        = "user-service"
+	BinaryVehicleService     = "vehicle-service"
+	BinaryBillingService     = "billing-service"
+	BinaryTelemetrySimulator = "telemetry-simulator"
+)
+
+// Load builds the configuration from the defaults, the YAML file at path
+// (skipped if path is empty) and the environment, then validates it for binary
+func Load(path, binary string) (*Config, error) {
+	cfg := Default()
+
+	if path != "" {
+		if err := cfg.loadFile(path); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := cfg.loadEnv(); err != nil {
+		return nil, err
+	}
+
+	if err := cfg.Validate(binary); err != nil {
+		return nil, err
+	}
+	return &cfg, nil
+}
+
+func (c *Config) loadFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("config: %w", err)
+	}
+	defer f.Close()
+
+	// Misspelt keys would otherwise be silently ignored
+	decoder := yaml.NewDecoder(f)
+	decoder.KnownFields(true)
+	if err := decoder.Decode(c); err != nil {
+		return fmt.Errorf("config: reading %s: %w", path, err)
+	}
+	return nil
+}
+
+func (c *Config) loadEnv() error {
+	env := envLoader{}
+
+	env.str("DATABASE_DSN", &c.Database.DSN)
+
+	env.str("AUTH_SECRET", &c.Auth.Secret)
+	env.str("INTERNAL_API_KEY", &c.Auth.InternalKey)
+
+	env.str("USER_SERVICE_ADDR", &c.Services.User.Addr)
+	env.str("USER_SERVICE_URL", &c.Services.User.URL)
+	env.str("VEHICLE_SERVICE_ADDR", &c.Services.Vehicle.Addr)
+	env.str("VEHICLE_SERVICE_URL", &c.Services.Vehicle.URL)
+	env.str("BILLING_SERVICE_ADDR", &c.Services.Billing.Addr)
+	env.str("BILLING_SERVICE_URL", &c.Services.Billing.URL)
+
+	env.str("GATEWAY_ADDR", &c.Gateway.Addr)
+	env.list("CORS_ALLOWED_ORIGINS", &c.Gateway.AllowedOrigins)
+	env.float("RATE_LIMIT_PER_SECOND", &c.Gateway.RateLimitPerSecond)
+	env.int("RATE_LIMIT_BURST", &c.Gateway.RateLimitBurst)
+
+	env.duration("SCHEDULER_INTERVAL", &c.Scheduler.Interval)
+	env.duration("SCHEDULER_REMINDER_LEAD", &c.Scheduler.ReminderLead)
+	env.duration("SCHEDULER_NO_SHOW_GRACE", &c.Scheduler.NoShowGrace)
+
+	env.str("PAYMENT_GATEWAY", &c.Payments.Gateway)
+	env.str("PAYMENT_WEBHOOK_SECRET", &c.Payments.WebhookSecret)
+
+	env.str("DEFAULT_VEHICLE_CLASS", &c.Pricing.DefaultVehicleClass)
+	env.float("DEFAULT_HOURLY_RATE", &c.Pricing.DefaultHourlyRate)
+	env.str("PRICING_TIME_ZONE", &c.Pricing.TimeZone)
+	env.float("LATE_FEE", &c.Pricing.LateFee)
+	env.duration("LATE_FEE_INTERVAL", &c.Pricing.LateFeeInterval)
+	env.duration("FULL_REFUND_BEFORE", &c.Pricing.FullRefundBefore)
+	env.duration("PARTIAL_REFUND_BEFORE", &c.Pricing.PartialRefundBefore)
+	env.float("PARTIAL_REFUND_PERCENTAGE", &c.Pricing.PartialRefundPercentage)
+	env.str("TAX_NAME", &c.Pricing.TaxName)
+	env.float("TAX_RATE", &c.Pricing.TaxRate)
+
+	env.int("MIN_CHARGE_LEVEL", &c.Vehicles.MinChargeLevel)
+	env.duration("PRIORITY_WINDOW", &c.Vehicles.PriorityWindow)
+	env.str("TELEMETRY_KEY", &c.Vehicles.TelemetryKey)
+	env.str("VEHICLE_COMMANDER", &c.Vehicles.Commander)
+	env.duration("LATE_RETURN_GRACE", &c.Vehicles.LateReturnGrace)
+
+	env.str("PUBLIC_URL", &c.Users.PublicURL)
+	env.duration("PASSWORD_RESET_TTL", &c.Users.PasswordResetTTL)
+	env.duration("EMAIL_VERIFICATION_TTL", &c.Users.EmailVerificationTTL)
+	env.duration("VERIFICATION_RESEND_INTERVAL", &c.Users.VerificationResendInterval)
+	env.duration("PHONE_CODE_TTL", &c.Users.PhoneCodeTTL)
+	env.int("PHONE_CODE_MAX_ATTEMPTS", &c.Users.PhoneCodeMaxAttempts)
+	env.str("DEFAULT_COUNTRY_CODE", &c.Users.DefaultCountryCode)
+	env.duration("TIER_PERIOD", &c.Users.TierPeriod)
+	env.duration("TIER_EVALUATION_INTERVAL", &c.Users.TierEvaluationInterval)
+
+	env.str("MAIL_PROVIDER", &c.Mail.Provider)
+	env.str("MAIL_FROM", &c.Mail.From)
+	env.str("MAIL_OUTBOX_DIR", &c.Mail.OutboxDir)
+	env.str("SMTP_HOST", &c.Mail.SMTP.Host)
+	env.int("SMTP_PORT", &c.Mail.SMTP.Port)
+	env.str("SMTP_USERNAME", &c.Mail.SMTP.Username)
+	env.str("SMTP_PASSWORD", &c.Mail.SMTP.Password)
+	env.str("SENDGRID_API_KEY", &c.Mail.SendGridAPIKey)
+
+	env.str("SMS_PROVIDER", &c.SMS.Provider)
+	env.str("SMS_FROM", &c.SMS.From)
+	env.str("TWILIO_ACCOUNT_SID", &c.SMS.TwilioAccountSID)
+	env.str("TWILIO_AUTH_TOKEN", &c.SMS.TwilioAuthToken)
+	env.bool("SMS_NOTIFICATIONS", &c.SMS.Notifications)
+
+	return errors.Join(env.errs...)
+}
+
+// Validate reports every invalid setting at once. Keys are only required by the binaries that use them.
+func (c *Config) Validate(binary string) error {
+	var errs []error
+	check := func(ok bool, format string, args ...interface{}) {
+		if !ok {
+			errs = append(errs, fmt.Errorf("config: "+format, args...))
+		}
+	}
+
+	check(c.Database.DSN != "", "database.dsn (DATABASE_DSN) is required")
+	check(c.Auth.Secret != "", "auth.secret (AUTH_SECRET) is required and must be the same for every service")
+	switch binary {
+	case BinaryUserService, BinaryVehicleService, BinaryBillingService:
+		check(c.Auth.InternalKey != "", "auth.internal_key (INTERNAL_API_KEY) is required and must be the same for every service")
+	}
+
+	for name, svc := range map[string]Service{"user": c.Services.User, "vehicle": c.Services.Vehicle, "billing": c.Services.Billing} {
+		check(svc.Addr != "", "services.%s.addr is required", name)
+		u, err := url.Parse(svc.URL)
+		check(err == nil && u.Scheme != "" && u.Host != "", "services.%s.url must be an absolute URL, got %q", name, svc.URL)
+	}
+
+	check(c.Gateway.Addr != "", "gateway.addr is required")
+	check(c.Gateway.RateLimitPerSecond >= 0, "gateway.rate_limit_per_second must not be negative")
+	check(c.Gateway.RateLimitPerSecond == 0 || c.Gateway.RateLimitBurst >= 1, "gateway.rate_limit_burst must be at least 1")
+
+	check(c.Scheduler.Interval > 0, "scheduler.interval must be positive")
+	check(c.Scheduler.ReminderLead >= 0, "scheduler.reminder_lead must not be negative")
+	check(c.Scheduler.NoShowGrace >= 0, "scheduler.no_show_grace must not be negative")
+
+	check(c.Payments.Gateway == "mock", "payments.gateway %q is not supported", c.Payments.Gateway)
+
+	check(c.Pricing.DefaultVehicleClass != "", "pricing.default_vehicle_class is required")
+	check(c.Pricing.DefaultHourlyRate > 0, "pricing.default_hourly_rate must be positive")
+	_, err := c.Pricing.Location()
+	check(err == nil, "pricing.time_zone %q is not a known time zone", c.Pricing.TimeZone)
+	check(c.Pricing.LateFee >= 0, "pricing.late_fee must not be negative")
+	check(c.Pricing.LateFeeInterval > 0, "pricing.late_fee_interval must be positive")
+	check(c.Pricing.PartialRefundBefore >= 0 && c.Pricing.PartialRefundBefore <= c.Pricing.FullRefundBefore,
+		"pricing.partial_refund_before must be between 0 and pricing.full_refund_before")
+	check(c.Pricing.PartialRefundPercentage >= 0 && c.Pricing.PartialRefundPercentage <= 100,
+		"pricing.partial_refund_percentage must be between 0 and 100")
+	check(c.Pricing.TaxName != "", "pricing.tax_name is required")
+	check(c.Pricing.TaxRate >= 0 && c.Pricing.TaxRate <= 100, "pricing.tax_rate must be between 0 and 100")
+
+	check(c.Vehicles.MinChargeLevel >= 0 && c.Vehicles.MinChargeLevel <= 100, "vehicles.min_charge_level must be between 0 and 100")
+	check(c.Vehicles.PriorityWindow >= 0, "vehicles.priority_window must not be negative")
+	switch binary {
+	case BinaryVehicleService, BinaryTelemetrySimulator:
+		check(c.Vehicles.TelemetryKey != "", "vehicles.telemetry_key (TELEMETRY_KEY) is required")
+	}
+	check(c.Vehicles.Commander == "fake", "vehicles.commander %q is not supported", c.Vehicles.Commander)
+	check(c.Vehicles.LateReturnGrace >= 0, "vehicles.late_return_grace must not be negative")
+
+	u, err := url.Parse(c.Users.PublicURL)
+	check(err == nil && u.Scheme != "" && u.Host != "", "users.public_url must be an absolute URL, got %q", c.Users.PublicURL)
+	check(c.Users.PasswordResetTTL > 0, "users.password_reset_ttl must be positive")
+	check(c.Users.EmailVerificationTTL > 0, "users.email_verification_ttl must be positive")
+	check(c.Users.VerificationResendInterval >= 0, "users.verification_resend_interval must not be negative")
+	check(c.Users.PhoneCodeTTL > 0, "users.phone_code_ttl must be positive")
+	check(c.Users.PhoneCodeMaxAttempts >= 1, "users.phone_code_max_attempts must be at least 1")
+	check(c.Users.DefaultCountryCode == "" || strings.HasPrefix(c.Users.DefaultCountryCode, "+"),
+		"users.default_country_code must start with +, got %q", c.Users.DefaultCountryCode)
+	check(c.Users.TierPeriod > 0, "users.tier_period must be positive")
+	check(c.Users.TierEvaluationInterval >= 0, "users.tier_evaluation_interval must not be negative")
+
+	check(c.Mail.From != "", "mail.from (MAIL_FROM) is required")
+	switch c.Mail.Provider {
+	case "log":
+	case "smtp":
+		check(c.Mail.SMTP.Host != "", "mail.smtp.host (SMTP_HOST) is required for the smtp provider")
+		check(c.Mail.SMTP.Port > 0, "mail.smtp.port must be positive")
+	case "sendgrid":
+		check(c.Mail.SendGridAPIKey != "", "mail.sendgrid_api_key (SENDGRID_API_KEY) is required for the sendgrid provider")
+	default:
+		check(false, "mail.provider %q is not supported, expected log, smtp or sendgrid", c.Mail.Provider)
+	}
+
+	switch c.SMS.Provider {
+	case "fake":
+	case "twilio":
+		check(c.SMS.TwilioAccountSID != "" && c.SMS.TwilioAuthToken != "",
+			"sms.twilio_account_sid (TWILIO_ACCOUNT_SID) and sms.twilio_auth_token (TWILIO_AUTH_TOKEN) are required for the twilio provider")
+		check(c.SMS.From != "", "sms.from (SMS_FROM) is required for the twilio provider")
+	default:
+		check(false, "sms.provider %q is not supported, expected fake or twilio", c.SMS.Provider)
+	}
+
+	return errors.Join(errs...)
+}
+
+// Reads environment overrides, collecting parse errors
+type envLoader struct {
+	errs []error
+}
+
+func (e *envLoader) str(key string, dst *string) {
+	if value := os.Getenv(key); value != "" {
+		*dst = value
+	}
+}
+
+func (e *envLoader) list(key string, dst *[]string) {
+	value := os.Getenv(key)
+	if value == "" {
+		return
+	}
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	*dst = items
+}
+
+func (e *envLoader) int(key string, dst *int) {
+	if value := os.Getenv(key); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			e.errs = append(e.errs, fmt.Errorf("config: invalid %s: %w", key, err))
+			return
+		}
+		*dst = n
+	}
+}
+
+func (e *envLoader) float(key string, dst *float64) {
+	if value := os.Getenv(key); value != "" {
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			e.errs = append(e.errs, fmt.Errorf("config: invalid %s: %w", key, err))
+			return
+		}
+		*dst = f
+	}
+}
+
+func (e *envLoader) bool(key string, dst *bool) {
+	if value := os.Getenv(key); value != "" {
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			e.errs = append(e.errs, fmt.Errorf("config: invalid %s: %w", key, err))
+			return
+		}
+		*dst = b
+	}
+}
+
+func (e *envLoader) duration(key string, dst *time.Duration) {
+	if value := os.Getenv(key); value != "" {
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			e.errs = append(e.errs, fmt.Errorf("config: invalid %s: %w", key, err))
+			return
+		}
+		*dst = d
+	}
+}
@@ -0,0 +1,40 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidateKeysPerBinary(t *testing.T) {
+	tests := []struct {
+		binary string
+		// Whether the binary needs each key
+		internalKey, telemetryKey bool
+	}{
+		{BinaryGateway, false, false},
+		{BinaryUserService, true, false},
+		{BinaryVehicleService, true, true},
+		{BinaryBillingService, true, false},
+		{BinaryTelemetrySimulator, false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.binary, func(t *testing.T) {
+			cfg := Default()
+			cfg.Database.DSN = "user:password@tcp(127.0.0.1:3306)/db"
+			cfg.Auth.Secret = "secret"
+			msg := ""
+			if err := cfg.Validate(tt.binary); err != nil {
+				msg = err.Error()
+			}
+			if strings.Contains(msg, "INTERNAL_API_KEY") != tt.internalKey || strings.Contains(msg, "TELEMETRY_KEY") != tt.telemetryKey {
+				t.Errorf("without either key: %q, want internal key required %t and telemetry key required %t",
+					msg, tt.internalKey, tt.telemetryKey)
+			}
+
+			cfg.Auth.InternalKey, cfg.Vehicles.TelemetryKey = "internal", "telemetry"
+			if err := cfg.Validate(tt.binary); err != nil {
+				t.Errorf("with both keys: %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,41 @@
+// Package mail sends email to users through a pluggable provider.
+package mail
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/yongkaiyu/CNAD_Assg1/internal/config"
+)
+
+// Message is a plain text email to one recipient
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer is implemented by each email provider
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// New returns the mailer named by cfg.Provider
+func New(cfg config.Mail) (Mailer, error) {
+	switch cfg.Provider {
+	case "log":
+		return &LogMailer{Dir: cfg.OutboxDir}, nil
+	case "smtp":
+		return &SMTPMailer{
+			Host:     cfg.SMTP.Host,
+			Port:     cfg.SMTP.Port,
+			Username: cfg.SMTP.Username,
+			Password: cfg.SMTP.Password,
+			From:     cfg.From,
+		}, nil
+	case "sendgrid":
+		return NewSendGridMailer(cfg.SendGridAPIKey, cfg.From), nil
+	default:
+		return nil, fmt.Errorf("unknown mail provider: %s", cfg.Provider)
+	}
+}
@@ -0,0 +1,32 @@
+package mail
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/sendgrid/sendgrid-go"
+	sgmail "github.com/sendgrid/sendgrid-go/helpers/mail"
+)
+
+// SendGridMailer sends through the SendGrid v3 API
+type SendGridMailer struct {
+	client *sendgrid.Client
+	from   string
+}
+
+func NewSendGridMailer(apiKey, from string) *SendGridMailer {
+	return &SendGridMailer{client: sendgrid.NewSendClient(apiKey), from: from}
+}
+
+func (m *SendGridMailer) Send(ctx context.Context, msg Message) error {
+	message := sgmail.NewSingleEmail(sgmail.NewEmail("", m.from), msg.Subject, sgmail.NewEmail("", msg.To), msg.Body, "")
+
+	response, err := m.client.SendWithContext(ctx, message)
+	if err != nil {
+		return fmt.Errorf("mail: sendgrid: %w", err)
+	}
+	if response.StatusCode >= 300 {
+		return fmt.Errorf("mail: sendgrid returned %d: %s", response.StatusCode, response.Body)
+	}
+	return nil
+}
@@ -0,0 +1,330 @@
+// Package migrations holds the versioned database schema and applies it.
+//
+// Each change is a pair of files in sql/: NNNN_name.up.sql and NNNN_name.down.sql.
+// Applied versions are recorded in the schema_migrations table.
+package migrations
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+	"log"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+//go:embed sql/*.sql
+var files embed.FS
+
+// Name of the MySQL advisory lock held while migrating, so two instances can't migrate at once
+const lockName = "electric_car_sharing_migrations"
+
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+var fileName = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+// All returns the embedded migrations in version order
+func All() ([]Migration, error) {
+	entries, err := fs.ReadDir(files, "sql")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := map[int]*Migration{}
+	for _, entry := range entries {
+		match := fileName.FindStringSubmatch(entry.Name())
+		if match == nil {
+			return nil, fmt.Errorf("migrations: unexpected file %s", entry.Name())
+		}
+
+		version, _ := strconv.Atoi(match[1])
+		contents, err := files.ReadFile("sql/" + entry.Name())
+		if err != nil {
+			return nil, err
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = m
+		}
+		if m.Name != match[2] {
+			return nil, fmt.Errorf("migrations: version %d has two names, %s and %s", version, m.Name, match[2])
+		}
+		if match[3] == "up" {
+			m.Up = string(contents)
+		} else {
+			m.Down = string(contents)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" || m.Down == "" {
+			return nil, fmt.Errorf("migrations: version %d needs both an up and a down file", m.Version)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+
+	for i, m := range migrations {
+		if m.Version != i+1 {
+			return nil, fmt.Errorf("migrations: expected version %d, found %d", i+1, m.Version)
+		}
+	}
+	return migrations, nil
+}
+
+// Latest is the schema version this build expects
+func Latest() int {
+	migrations, err := All()
+	if err != nil || len(migrations) == 0 {
+		return 0
+	}
+	return migrations[len(migrations)-1].Version
+}
+
+// Version returns the highest version applied to the database, 0 if none
+func Version(ctx context.Context, db *sql.DB) (int, error) {
+	var exists bool
+	err := db.QueryRowContext(ctx, `
+		SELECT COUNT(*) > 0 FROM information_schema.tables
+		WHERE table_schema = DATABASE() AND table_name = 'schema_migrations'`).Scan(&exists)
+	if err != nil || !exists {
+		return 0, err
+	}
+
+	var version sql.NullInt64
+	if err := db.QueryRowContext(ctx, `SELECT MAX(version) FROM schema_migrations`).Scan(&version); err != nil {
+		return 0, err
+	}
+	return int(version.Int64), nil
+}
+
+// Check returns an error unless the database is at exactly the version this build expects
+func Check(ctx context.Context, db *sql.DB) error {
+	version, err := Version(ctx, db)
+	if err != nil {
+		return fmt.Errorf("migrations: reading schema version: %w", err)
+	}
+
+	latest := Latest()
+	switch {
+	case version > latest:
+		return fmt.Errorf("database schema version %d is newer than this build understands (%d)", version, latest)
+	case version < latest:
+		return fmt.Errorf("database schema is at version %d, run \"migrate up\" to upgrade to %d", version, latest)
+	}
+	return nil
+}
+
+// Up applies every pending migration and returns how many were applied
+func Up(ctx context.Context, db *sql.DB) (int, error) {
+	migrations, err := All()
+	if err != nil {
+		return 0, err
+	}
+
+	applied := 0
+	err = withLock(ctx, db, func(conn *sql.Conn) error {
+		version, err := Version(ctx, db)
+		if err != nil {
+			return err
+		}
+		if version > len(migrations) {
+			return fmt.Errorf("database schema version %d is newer than this build understands (%d)", version, len(migrations))
+		}
+
+		for _, m := range migrations[version:] {
+			log.Printf("Applying migration %d_%s", m.Version, m.Name)
+			if err := execScript(ctx, conn, m.Up); err != nil {
+				return fmt.Errorf("migration %d_%s: %w", m.Version, m.Name, err)
+			}
+			if _, err := conn.ExecContext(ctx, `INSERT INTO schema_migrations (version, name) VALUES (?, ?)`, m.Version, m.Name); err != nil {
+				return err
+			}
+			applied++
+		}
+		return nil
+	})
+	return applied, err
+}
+
+// Down reverts the most recent steps migrations
+func Down(ctx context.Context, db *sql.DB, steps int) (int, error) {
+	migrations, err := All()
+	if err != nil {
+		return 0, err
+	}
+
+	reverted := 0
+	err = withLock(ctx, db, func(conn *sql.Conn) error {
+		version, err := Version(ctx, db)
+		if err != nil {
+			return err
+		}
+		if version > len(migrations) {
+			return fmt.Errorf("database schema version %d is newer than this build understands (%d)", version, len(migrations))
+		}
+
+		for ; reverted < steps && version > 0; version-- {
+			m := migrations[version-1]
+			log.Printf("Reverting migration %d_%s", m.Version, m.Name)
+			if err := execScript(ctx, conn, m.Down); err != nil {
+				return fmt.Errorf("migration %d_%s: %w", m.Version, m.Name, err)
+			}
+			if _, err := conn.ExecContext(ctx, `DELETE FROM schema_migrations WHERE version = ?`, m.Version); err != nil {
+				return err
+			}
+			reverted++
+		}
+		return nil
+	})
+	return reverted, err
+}
+
+// Force records the database as being at version without running anything.
+// Used to adopt a database whose schema was created by hand.
+func Force(ctx context.Context, db *sql.DB, version int) error {
+	migrations, err := All()
+	if err != nil {
+		return err
+	}
+	if version < 0 || version > len(migrations) {
+		return fmt.Errorf("unknown schema version %d", version)
+	}
+
+	return withLock(ctx, db, func(conn *sql.Conn) error {
+		if _, err := conn.ExecContext(ctx, `DELETE FROM schema_migrations WHERE version > ?`, version); err != nil {
+			return err
+		}
+		for _, m := range migrations[:version] {
+			if _, err := conn.ExecContext(ctx, `INSERT IGNORE INTO schema_migrations (version, name) VALUES (?, ?)`, m.Version, m.Name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Run the migrate subcommand: "up", "down [steps]", "version" or "force <version>"
+func Run(ctx context.Context, db *sql.DB, args []string) error {
+	command := "up"
+	if len(args) > 0 {
+		command = args[0]
+	}
+
+	switch command {
+	case "up":
+		applied, err := Up(ctx, db)
+		if err != nil {
+			return err
+		}
+		log.Printf("Applied %d migration(s), schema is at version %d", applied, Latest())
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			n, err := strconv.Atoi(args[1])
+			if err != nil || n < 1 {
+				return fmt.Errorf("invalid number of steps: %s", args[1])
+			}
+			steps = n
+		}
+		reverted, err := Down(ctx, db, steps)
+		if err != nil {
+			return err
+		}
+		log.Printf("Reverted %d migration(s)", reverted)
+	case "version":
+		version, err := Version(ctx, db)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Schema version %d (this build expects %d)\n", version, Latest())
+	case "force":
+		if len(args) < 2 {
+			return fmt.Errorf("usage: migrate force <version>")
+		}
+		version, err := strconv.Atoi(args[1])
+		if err != nil {
+			return fmt.Errorf("invalid version: %s", args[1])
+		}
+		if err := Force(ctx, db, version); err != nil {
+			return err
+		}
+		log.Printf("Schema marked as version %d", version)
+	default:
+		return fmt.Errorf("unknown migrate command %q, expected up, down, version or force", command)
+	}
+	return nil
+}
+
+// Run fn on a single connection while holding the migration lock
+func withLock(ctx context.Context, db *sql.DB, fn func(conn *sql.Conn) error) error {
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	var acquired sql.NullInt64
+	if err := conn.QueryRowContext(ctx, `SELECT GET_LOCK(?, 60)`, lockName).Scan(&acquired); err != nil {
+		return err
+	}
+	if acquired.Int64 != 1 {
+		return fmt.Errorf("another migration is already running")
+	}
+	defer conn.ExecContext(context.Background(), `SELECT RELEASE_LOCK(?)`, lockName)
+
+	_, err = conn.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version INT PRIMARY KEY,
+			name VARCHAR(100) NOT NULL,
+			applied_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		)`)
+	if err != nil {
+		return err
+	}
+
+	return fn(conn)
+}
+
+// The MySQL driver runs one statement per Exec, so split scripts on the ";" ending a line
+func execScript(ctx context.Context, conn *sql.Conn, script string) error {
+	for _, statement := range splitStatements(script) {
+		if _, err := conn.ExecContext(ctx, statement); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func splitStatements(script string) []string {
+	var statements []string
+	var current strings.Builder
+	for _, line := range strings.Split(script, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "--") {
+			continue
+		}
+		current.WriteString(line)
+		current.WriteString("\n")
+		if strings.HasSuffix(trimmed, ";") {
+			statements = append(statements, strings.TrimSuffix(strings.TrimSpace(current.String()), ";"))
+			current.Reset()
+		}
+	}
+	if rest := strings.TrimSpace(current.String()); rest != "" {
+		statements = append(statements, rest)
+	}
+	return statements
+}
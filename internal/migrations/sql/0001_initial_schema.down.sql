@@ -0,0 +1,6 @@
+DROP TABLE promotions;
+DROP TABLE billings;
+DROP TABLE bookings;
+DROP TABLE vehicles;
+DROP TABLE users;
+DROP TABLE membershipbenefits;
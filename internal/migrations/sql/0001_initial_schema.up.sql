@@ -0,0 +1,67 @@
+CREATE TABLE membershipbenefits (
+    tier VARCHAR(20) PRIMARY KEY,
+    discount_rate DECIMAL(5, 2) NOT NULL DEFAULT 0.00,
+    priority_access BOOLEAN NOT NULL DEFAULT FALSE,
+    booking_limit INT NOT NULL DEFAULT 1
+);
+
+INSERT INTO membershipbenefits (tier, discount_rate, priority_access, booking_limit) VALUES
+    ('Basic', 0.00, FALSE, 2),
+    ('Premium', 10.00, TRUE, 5),
+    ('VIP', 20.00, TRUE, 10);
+
+CREATE TABLE users (
+    user_id INT AUTO_INCREMENT PRIMARY KEY,
+    name VARCHAR(100) NOT NULL,
+    email VARCHAR(255) NOT NULL UNIQUE,
+    phone VARCHAR(20) NOT NULL,
+    password VARCHAR(255) NOT NULL,
+    membership_tier VARCHAR(20) NOT NULL DEFAULT 'Basic',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    FOREIGN KEY (membership_tier) REFERENCES membershipbenefits(tier)
+);
+
+CREATE TABLE vehicles (
+    vehicle_id INT AUTO_INCREMENT PRIMARY KEY,
+    license_plate VARCHAR(20) NOT NULL UNIQUE,
+    location VARCHAR(255) NOT NULL,
+    charge_level INT NOT NULL DEFAULT 100,
+    status ENUM('Available', 'Booked', 'Maintenance') NOT NULL DEFAULT 'Available',
+    cleanliness ENUM('Clean', 'Moderate', 'Dirty') NOT NULL DEFAULT 'Clean',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP
+);
+
+CREATE TABLE bookings (
+    booking_id INT AUTO_INCREMENT PRIMARY KEY,
+    user_id INT NOT NULL,
+    vehicle_id INT NOT NULL,
+    start_time DATETIME NOT NULL,
+    end_time DATETIME NOT NULL,
+    status ENUM('Active', 'Completed', 'Cancelled') NOT NULL DEFAULT 'Active',
+    total_cost DECIMAL(10, 2) NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    INDEX idx_bookings_vehicle_window (vehicle_id, start_time, end_time),
+    INDEX idx_bookings_user (user_id)
+);
+
+CREATE TABLE billings (
+    billing_id INT AUTO_INCREMENT PRIMARY KEY,
+    booking_id INT NOT NULL UNIQUE,
+    payment_status ENUM('Pending', 'Paid', 'Refunded') NOT NULL DEFAULT 'Pending',
+    payment_method ENUM('Credit Card', 'Debit Card', 'PayPal', 'Other') NOT NULL DEFAULT 'Other',
+    total_amount DECIMAL(10, 2) NOT NULL DEFAULT 0.00,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP
+);
+
+CREATE TABLE promotions (
+    promotion_id INT AUTO_INCREMENT PRIMARY KEY,
+    name VARCHAR(100) NOT NULL,
+    discount_percentage DECIMAL(5, 2) NOT NULL,
+    expiry_date DATETIME NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP
+);
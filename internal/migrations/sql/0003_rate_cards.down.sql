@@ -0,0 +1,2 @@
+DROP TABLE rate_cards;
+ALTER TABLE vehicles DROP COLUMN vehicle_class;
@@ -0,0 +1,10 @@
+ALTER TABLE vehicles ADD COLUMN vehicle_class VARCHAR(50) NOT NULL DEFAULT 'Standard';
+
+CREATE TABLE rate_cards (
+    vehicle_class VARCHAR(50) PRIMARY KEY,
+    billing_unit ENUM('hour', 'minute') NOT NULL DEFAULT 'hour',
+    unit_rate DECIMAL(10, 2) NOT NULL,
+    peak_multiplier DECIMAL(4, 2) NOT NULL DEFAULT 1.00,
+    peak_start_hour TINYINT NOT NULL DEFAULT 0,
+    peak_end_hour TINYINT NOT NULL DEFAULT 0
+);
@@ -0,0 +1,5 @@
+DROP TABLE payment_events;
+UPDATE billings SET payment_status = 'Pending' WHERE payment_status IN ('Authorized', 'Failed');
+ALTER TABLE billings
+    DROP COLUMN gateway_reference,
+    MODIFY COLUMN payment_status ENUM('Pending', 'Paid', 'Refunded') NOT NULL DEFAULT 'Pending';
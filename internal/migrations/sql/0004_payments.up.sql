@@ -0,0 +1,11 @@
+ALTER TABLE billings
+    MODIFY COLUMN payment_status ENUM('Pending', 'Authorized', 'Paid', 'Failed', 'Refunded') NOT NULL DEFAULT 'Pending',
+    ADD COLUMN gateway_reference VARCHAR(100) NULL UNIQUE;
+
+CREATE TABLE payment_events (
+    event_id VARCHAR(100) PRIMARY KEY,
+    event_type VARCHAR(50) NOT NULL,
+    gateway_reference VARCHAR(100) NOT NULL,
+    processed BOOLEAN NOT NULL DEFAULT FALSE,
+    received_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
@@ -0,0 +1,5 @@
+UPDATE bookings SET status = 'Cancelled' WHERE status = 'NoShow';
+ALTER TABLE bookings
+    DROP COLUMN reminder_sent_at,
+    DROP COLUMN picked_up_at,
+    MODIFY COLUMN status ENUM('Active', 'Completed', 'Cancelled') NOT NULL DEFAULT 'Active';
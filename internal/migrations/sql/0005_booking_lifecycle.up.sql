@@ -0,0 +1,4 @@
+ALTER TABLE bookings
+    MODIFY COLUMN status ENUM('Active', 'Completed', 'Cancelled', 'NoShow') NOT NULL DEFAULT 'Active',
+    ADD COLUMN picked_up_at DATETIME NULL,
+    ADD COLUMN reminder_sent_at DATETIME NULL;
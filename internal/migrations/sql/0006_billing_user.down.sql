@@ -0,0 +1 @@
+ALTER TABLE billings DROP INDEX idx_billings_user, DROP COLUMN user_id;
@@ -0,0 +1,5 @@
+ALTER TABLE billings ADD COLUMN user_id INT NOT NULL DEFAULT 0 AFTER booking_id;
+
+UPDATE billings bi INNER JOIN bookings b ON bi.booking_id = b.booking_id SET bi.user_id = b.user_id;
+
+ALTER TABLE billings ALTER COLUMN user_id DROP DEFAULT, ADD INDEX idx_billings_user (user_id);
@@ -0,0 +1,3 @@
+DROP TABLE phone_verification_codes;
+
+ALTER TABLE users DROP COLUMN phone_verified_at;
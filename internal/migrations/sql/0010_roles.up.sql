@@ -0,0 +1 @@
+ALTER TABLE users ADD COLUMN role ENUM('customer', 'fleet_operator', 'finance', 'admin') NOT NULL DEFAULT 'customer';
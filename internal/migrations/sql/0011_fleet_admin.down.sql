@@ -0,0 +1,3 @@
+DROP TABLE vehicle_changes;
+
+ALTER TABLE vehicles DROP COLUMN retired_at;
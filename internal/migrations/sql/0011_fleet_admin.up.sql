@@ -0,0 +1,17 @@
+ALTER TABLE vehicles ADD COLUMN retired_at DATETIME NULL;
+
+-- Audit trail of every change made through the fleet admin API.
+-- changed_by is a user in the user service, so it has no foreign key.
+CREATE TABLE vehicle_changes (
+    change_id INT AUTO_INCREMENT PRIMARY KEY,
+    vehicle_id INT NOT NULL,
+    changed_by INT NOT NULL,
+    action ENUM('create', 'update', 'status', 'retire') NOT NULL,
+    from_status VARCHAR(20) NULL,
+    to_status VARCHAR(20) NULL,
+    details VARCHAR(1000) NOT NULL DEFAULT '',
+    reason VARCHAR(500) NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (vehicle_id) REFERENCES vehicles(vehicle_id),
+    INDEX idx_vehicle_changes_vehicle (vehicle_id, change_id)
+);
@@ -0,0 +1,10 @@
+DROP TABLE promotion_redemptions;
+
+ALTER TABLE promotions
+    DROP COLUMN code,
+    DROP COLUMN start_date,
+    DROP COLUMN max_uses,
+    DROP COLUMN max_uses_per_user,
+    DROP COLUMN min_spend,
+    DROP COLUMN eligible_tiers,
+    DROP COLUMN active;
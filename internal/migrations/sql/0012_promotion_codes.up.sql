@@ -0,0 +1,26 @@
+-- Promotions without a code apply automatically; the rest need their code entered.
+-- A cap of 0 means unlimited and an empty eligible_tiers (comma separated) means every tier.
+ALTER TABLE promotions
+    ADD COLUMN code VARCHAR(32) NULL UNIQUE AFTER name,
+    ADD COLUMN start_date DATETIME NULL AFTER discount_percentage,
+    ADD COLUMN max_uses INT NOT NULL DEFAULT 0,
+    ADD COLUMN max_uses_per_user INT NOT NULL DEFAULT 0,
+    ADD COLUMN min_spend DECIMAL(10, 2) NOT NULL DEFAULT 0,
+    ADD COLUMN eligible_tiers VARCHAR(255) NOT NULL DEFAULT '',
+    ADD COLUMN active BOOLEAN NOT NULL DEFAULT TRUE;
+
+-- Existing promotions have been running since they were created
+UPDATE promotions SET start_date = created_at;
+ALTER TABLE promotions MODIFY COLUMN start_date DATETIME NOT NULL;
+
+-- One row per booking a promotion was applied to, counted against the caps
+CREATE TABLE promotion_redemptions (
+    redemption_id INT AUTO_INCREMENT PRIMARY KEY,
+    promotion_id INT NOT NULL,
+    user_id INT NOT NULL,
+    booking_id INT NOT NULL UNIQUE,
+    discount DECIMAL(10, 2) NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (promotion_id) REFERENCES promotions(promotion_id),
+    INDEX idx_redemptions_promotion_user (promotion_id, user_id)
+);
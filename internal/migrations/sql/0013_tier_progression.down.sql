@@ -0,0 +1,6 @@
+DROP TABLE tier_changes;
+
+ALTER TABLE membershipbenefits
+    DROP COLUMN tier_rank,
+    DROP COLUMN min_rentals,
+    DROP COLUMN min_spend;
@@ -0,0 +1,21 @@
+-- Tiers are ordered by tier_rank, lowest first. New users start on the lowest tier and
+-- the tier evaluation moves them to the highest tier whose thresholds they meet.
+ALTER TABLE membershipbenefits
+    ADD COLUMN tier_rank INT NOT NULL DEFAULT 0,
+    ADD COLUMN min_rentals INT NOT NULL DEFAULT 0,
+    ADD COLUMN min_spend DECIMAL(10, 2) NOT NULL DEFAULT 0.00;
+
+UPDATE membershipbenefits SET tier_rank = 1, min_rentals = 5, min_spend = 150.00 WHERE tier = 'Premium';
+UPDATE membershipbenefits SET tier_rank = 2, min_rentals = 15, min_spend = 500.00 WHERE tier = 'VIP';
+
+-- History of every tier change. The tiers have no foreign keys so the history outlives deleted tiers.
+CREATE TABLE tier_changes (
+    change_id INT AUTO_INCREMENT PRIMARY KEY,
+    user_id INT NOT NULL,
+    from_tier VARCHAR(20) NOT NULL,
+    to_tier VARCHAR(20) NOT NULL,
+    reason VARCHAR(500) NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES users(user_id),
+    INDEX idx_tier_changes_user (user_id, change_id)
+);
@@ -0,0 +1,3 @@
+DROP TABLE waitlist_entries;
+
+ALTER TABLE vehicles DROP COLUMN released_at;
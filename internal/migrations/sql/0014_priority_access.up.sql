@@ -0,0 +1,18 @@
+-- When the vehicle was last released to customers: added, back from maintenance or charged
+-- past the minimum. Priority tiers get it to themselves for a while after.
+ALTER TABLE vehicles ADD COLUMN released_at DATETIME NULL;
+
+-- Users waiting for a vehicle to become available. priority is the user's priority access
+-- when they joined; priority members are notified first.
+-- user_id is a user in the user service, so it has no foreign key.
+CREATE TABLE waitlist_entries (
+    entry_id INT AUTO_INCREMENT PRIMARY KEY,
+    vehicle_id INT NOT NULL,
+    user_id INT NOT NULL,
+    priority BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    notified_at DATETIME NULL,
+    UNIQUE (vehicle_id, user_id),
+    FOREIGN KEY (vehicle_id) REFERENCES vehicles(vehicle_id),
+    INDEX idx_waitlist_user (user_id)
+);
@@ -0,0 +1,4 @@
+ALTER TABLE vehicles
+    DROP INDEX idx_vehicles_coordinates,
+    DROP COLUMN latitude,
+    DROP COLUMN longitude;
@@ -0,0 +1,6 @@
+-- Where the vehicle is parked, for the nearest vehicle search. location stays as the
+-- description shown to users.
+ALTER TABLE vehicles
+    ADD COLUMN latitude DECIMAL(9, 6) NULL,
+    ADD COLUMN longitude DECIMAL(9, 6) NULL,
+    ADD INDEX idx_vehicles_coordinates (latitude, longitude);
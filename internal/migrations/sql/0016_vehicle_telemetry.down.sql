@@ -0,0 +1,7 @@
+ALTER TABLE vehicles
+    DROP COLUMN odometer_km,
+    DROP COLUMN doors_locked,
+    DROP COLUMN faults,
+    DROP COLUMN telemetry_at;
+
+DROP TABLE telemetry_readings;
@@ -0,0 +1,22 @@
+-- Readings reported by in-car units, kept as a time series
+CREATE TABLE telemetry_readings (
+    reading_id BIGINT AUTO_INCREMENT PRIMARY KEY,
+    vehicle_id INT NOT NULL,
+    recorded_at DATETIME NOT NULL,
+    received_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    charge_level INT NULL,
+    odometer_km DECIMAL(10, 1) NULL,
+    latitude DECIMAL(9, 6) NULL,
+    longitude DECIMAL(9, 6) NULL,
+    doors_locked BOOLEAN NULL,
+    faults VARCHAR(500) NULL,
+    FOREIGN KEY (vehicle_id) REFERENCES vehicles(vehicle_id),
+    INDEX idx_telemetry_vehicle_time (vehicle_id, recorded_at)
+);
+
+-- The latest reported values. faults is a comma separated list of fault codes.
+ALTER TABLE vehicles
+    ADD COLUMN odometer_km DECIMAL(10, 1) NULL,
+    ADD COLUMN doors_locked BOOLEAN NULL,
+    ADD COLUMN faults VARCHAR(500) NULL,
+    ADD COLUMN telemetry_at DATETIME NULL;
@@ -0,0 +1,6 @@
+ALTER TABLE bookings
+    DROP COLUMN returned_at,
+    DROP COLUMN start_odometer_km,
+    DROP COLUMN end_odometer_km,
+    DROP COLUMN start_charge_level,
+    DROP COLUMN end_charge_level;
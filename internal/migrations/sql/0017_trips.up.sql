@@ -0,0 +1,7 @@
+-- What actually happened on the trip. picked_up_at, from 0005, is when it started.
+ALTER TABLE bookings
+    ADD COLUMN returned_at DATETIME NULL,
+    ADD COLUMN start_odometer_km DECIMAL(10, 1) NULL,
+    ADD COLUMN end_odometer_km DECIMAL(10, 1) NULL,
+    ADD COLUMN start_charge_level INT NULL,
+    ADD COLUMN end_charge_level INT NULL;
@@ -0,0 +1,4 @@
+ALTER TABLE bookings
+    DROP COLUMN late_notice_sent_at;
+
+DROP TABLE billing_line_items;
@@ -0,0 +1,17 @@
+-- Charges on a bill beyond the price of the trip, such as late return fees
+CREATE TABLE billing_line_items (
+    line_item_id INT AUTO_INCREMENT PRIMARY KEY,
+    billing_id INT NOT NULL,
+    kind VARCHAR(20) NOT NULL,
+    description VARCHAR(255) NOT NULL,
+    quantity INT NOT NULL,
+    unit_amount DECIMAL(10, 2) NOT NULL,
+    amount DECIMAL(10, 2) NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (billing_id) REFERENCES billings(billing_id) ON DELETE CASCADE,
+    INDEX idx_line_items_billing (billing_id)
+);
+
+-- When the customer and whoever booked the vehicle next were told the trip is overdue
+ALTER TABLE bookings
+    ADD COLUMN late_notice_sent_at DATETIME NULL;
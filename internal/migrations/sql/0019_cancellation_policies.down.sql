@@ -0,0 +1,3 @@
+DROP TABLE refunds;
+
+DROP TABLE cancellation_policies;
@@ -0,0 +1,31 @@
+-- How much of a cancelled booking's bill is refunded, per membership tier. Cancelling at least
+-- full_refund_minutes before the start refunds everything, at least partial_refund_minutes
+-- before refunds partial_refund_percentage, and any later nothing. Tiers without a row use
+-- the configured policy.
+CREATE TABLE cancellation_policies (
+    membership_tier VARCHAR(20) PRIMARY KEY,
+    full_refund_minutes INT NOT NULL,
+    partial_refund_minutes INT NOT NULL,
+    partial_refund_percentage DECIMAL(5, 2) NOT NULL
+);
+
+INSERT INTO cancellation_policies (membership_tier, full_refund_minutes, partial_refund_minutes, partial_refund_percentage) VALUES
+    ('Basic', 1440, 120, 50.00),
+    ('Premium', 720, 60, 50.00),
+    ('VIP', 120, 0, 75.00);
+
+-- Money given back on a bill. kind says what the refund was for; a booking's cancellation
+-- refund is only ever made once. gateway_reference is the payment it was returned to, NULL
+-- when the bill hadn't been paid and the refund only reduces what is owed.
+CREATE TABLE refunds (
+    refund_id INT AUTO_INCREMENT PRIMARY KEY,
+    billing_id INT NOT NULL,
+    kind VARCHAR(20) NOT NULL,
+    amount DECIMAL(10, 2) NOT NULL,
+    percentage DECIMAL(5, 2) NOT NULL,
+    reason VARCHAR(255) NOT NULL,
+    gateway_reference VARCHAR(100) NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (billing_id) REFERENCES billings(billing_id) ON DELETE CASCADE,
+    INDEX idx_refunds_billing (billing_id)
+);
@@ -0,0 +1,9 @@
+DROP TABLE invoice_lines;
+
+DROP TABLE invoices;
+
+DROP TABLE invoice_sequences;
+
+ALTER TABLE billings
+    DROP COLUMN tax_rate,
+    DROP COLUMN tax_amount;
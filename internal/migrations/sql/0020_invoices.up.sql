@@ -0,0 +1,53 @@
+-- The tax a bill was priced with, so its invoice shows the tax that was charged
+ALTER TABLE billings
+    ADD COLUMN tax_rate DECIMAL(5, 2) NOT NULL DEFAULT 0.00,
+    ADD COLUMN tax_amount DECIMAL(10, 2) NOT NULL DEFAULT 0.00;
+
+-- The next number of each kind of document. The row is locked while a document is issued,
+-- so numbers are handed out in order without gaps.
+CREATE TABLE invoice_sequences (
+    kind VARCHAR(20) PRIMARY KEY,
+    next_number INT NOT NULL
+);
+
+INSERT INTO invoice_sequences (kind, next_number) VALUES
+    ('Invoice', 1),
+    ('Credit Note', 1);
+
+-- Issued invoices and credit notes. They are never changed once issued; a credit note,
+-- with negative amounts, corrects the invoice it credits.
+CREATE TABLE invoices (
+    invoice_id INT AUTO_INCREMENT PRIMARY KEY,
+    invoice_number VARCHAR(20) NOT NULL UNIQUE,
+    kind ENUM('Invoice', 'Credit Note') NOT NULL,
+    billing_id INT NOT NULL,
+    booking_id INT NOT NULL,
+    user_id INT NOT NULL,
+    vehicle_id INT NOT NULL,
+    rental_start DATETIME NOT NULL,
+    rental_end DATETIME NOT NULL,
+    credits_invoice_id INT NULL,
+    reason VARCHAR(255) NOT NULL DEFAULT '',
+    currency CHAR(3) NOT NULL,
+    subtotal DECIMAL(10, 2) NOT NULL,
+    tax_name VARCHAR(20) NOT NULL,
+    tax_rate DECIMAL(5, 2) NOT NULL,
+    tax_amount DECIMAL(10, 2) NOT NULL,
+    total DECIMAL(10, 2) NOT NULL,
+    issued_at DATETIME NOT NULL,
+    FOREIGN KEY (billing_id) REFERENCES billings(billing_id),
+    FOREIGN KEY (credits_invoice_id) REFERENCES invoices(invoice_id),
+    INDEX idx_invoices_billing (billing_id)
+);
+
+CREATE TABLE invoice_lines (
+    line_id INT AUTO_INCREMENT PRIMARY KEY,
+    invoice_id INT NOT NULL,
+    kind VARCHAR(20) NOT NULL,
+    description VARCHAR(255) NOT NULL,
+    quantity INT NOT NULL,
+    unit_amount DECIMAL(10, 2) NOT NULL,
+    amount DECIMAL(10, 2) NOT NULL,
+    FOREIGN KEY (invoice_id) REFERENCES invoices(invoice_id),
+    INDEX idx_invoice_lines_invoice (invoice_id)
+);
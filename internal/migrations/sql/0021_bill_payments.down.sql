@@ -0,0 +1,3 @@
+ALTER TABLE bookings DROP COLUMN bill_pending;
+
+DROP TABLE payments;
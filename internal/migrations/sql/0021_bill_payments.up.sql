@@ -0,0 +1,22 @@
+-- Money collected on a bill. A bill repriced after it was paid takes a second payment for
+-- what it went up by, so a bill can have several. Refunds go back to the payment named by
+-- their gateway_reference.
+CREATE TABLE payments (
+    payment_id INT AUTO_INCREMENT PRIMARY KEY,
+    billing_id INT NOT NULL,
+    amount DECIMAL(10, 2) NOT NULL,
+    gateway_reference VARCHAR(100) NOT NULL UNIQUE,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (billing_id) REFERENCES billings(billing_id) ON DELETE CASCADE,
+    INDEX idx_payments_billing (billing_id)
+);
+
+-- Bills paid so far were paid in one go, for their whole total
+INSERT INTO payments (billing_id, amount, gateway_reference)
+SELECT billing_id, total_amount, gateway_reference
+FROM billings
+WHERE payment_status IN ('Paid', 'Refunded') AND gateway_reference IS NOT NULL;
+
+-- Set when a trip ends and cleared once the billing service has repriced its bill, so the
+-- scheduler can retry bills that couldn't be updated straight away
+ALTER TABLE bookings ADD COLUMN bill_pending BOOLEAN NOT NULL DEFAULT FALSE;
@@ -0,0 +1,3 @@
+ALTER TABLE refunds
+    DROP INDEX idx_refunds_status,
+    DROP COLUMN status;
@@ -0,0 +1,6 @@
+-- A refund through the gateway is recorded Pending before the gateway is asked to make it and
+-- Completed once it has, so money never goes back without a record of it. Pending refunds
+-- are retried until the gateway takes them.
+ALTER TABLE refunds
+    ADD COLUMN status VARCHAR(20) NOT NULL DEFAULT 'Completed',
+    ADD INDEX idx_refunds_status (status);
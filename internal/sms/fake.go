@@ -0,0 +1,35 @@
+package sms
+
+import (
+	"context"
+	"log"
+	"sync"
+)
+
+// Message is a text message the FakeSender was asked to send
+type Message struct {
+	To   string
+	Body string
+}
+
+// FakeSender is for development and tests: it logs each message and keeps it in Sent
+type FakeSender struct {
+	mu   sync.Mutex
+	sent []Message
+}
+
+func (f *FakeSender) Send(ctx context.Context, to, body string) error {
+	log.Printf("SMS to %s: %s", to, body)
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.sent = append(f.sent, Message{To: to, Body: body})
+	return nil
+}
+
+// Sent returns every message sent so far
+func (f *FakeSender) Sent() []Message {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]Message(nil), f.sent...)
+}
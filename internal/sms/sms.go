@@ -0,0 +1,27 @@
+// Package sms sends text messages to users through a pluggable provider.
+package sms
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/yongkaiyu/CNAD_Assg1/internal/config"
+)
+
+// SMSSender is implemented by each SMS provider
+type SMSSender interface {
+	// Send delivers body to the phone number to, in E.164 format
+	Send(ctx context.Context, to, body string) error
+}
+
+// New returns the sender named by cfg.Provider
+func New(cfg config.SMS) (SMSSender, error) {
+	switch cfg.Provider {
+	case "fake":
+		return &FakeSender{}, nil
+	case "twilio":
+		return NewTwilioSender(cfg.TwilioAccountSID, cfg.TwilioAuthToken, cfg.From), nil
+	default:
+		return nil, fmt.Errorf("unknown SMS provider: %s", cfg.Provider)
+	}
+}
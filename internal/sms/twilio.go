@@ -0,0 +1,39 @@
+package sms
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/twilio/twilio-go"
+	openapi "github.com/twilio/twilio-go/rest/api/v2010"
+)
+
+// TwilioSender sends through Twilio's Messages API
+type TwilioSender struct {
+	client *twilio.RestClient
+	from   string
+}
+
+func NewTwilioSender(accountSID, authToken, from string) *TwilioSender {
+	client := twilio.NewRestClientWithParams(twilio.ClientParams{
+		Username: accountSID,
+		Password: authToken,
+	})
+	return &TwilioSender{client: client, from: from}
+}
+
+func (t *TwilioSender) Send(ctx context.Context, to, body string) error {
+	params := &openapi.CreateMessageParams{}
+	params.SetTo(to)
+	params.SetFrom(t.from)
+	params.SetBody(body)
+
+	// The Twilio client doesn't take a context, so only check it hasn't already been cancelled
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if _, err := t.client.Api.CreateMessage(params); err != nil {
+		return fmt.Errorf("sms: twilio: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,75 @@
+// Package static serves the HTML/JS/CSS pages kept under each service's static folder.
+package static
+
+import (
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"github.com/gorilla/mux"
+)
+
+// Pages maps each page name to the folder holding its index.html, script.js and styles.css
+type Pages map[string]string
+
+// Dir lists the pages found in a service's static folder, e.g. "./user_service/static"
+func Dir(root string, pages ...string) Pages {
+	p := Pages{}
+	for _, page := range pages {
+		p[page] = filepath.Join(root, page)
+	}
+	return p
+}
+
+// Merge combines several page sets into one
+func Merge(sets ...Pages) Pages {
+	merged := Pages{}
+	for _, set := range sets {
+		for page, dir := range set {
+			merged[page] = dir
+		}
+	}
+	return merged
+}
+
+// Register serves /static/{page}/ and /static/{page}/{file}
+func Register(router *mux.Router, pages Pages) {
+	router.HandleFunc("/static/{page}/", pages.servePage)
+	router.HandleFunc("/static/{page}/{file}", pages.serveFile) // Serve JS/CSS files
+}
+
+func (p Pages) serveFile(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+
+	dir, ok := p[vars["page"]]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	// Base() stops the file name escaping the page folder
+	http.ServeFile(w, r, filepath.Join(dir, filepath.Base(vars["file"])))
+}
+
+func (p Pages) servePage(w http.ResponseWriter, r *http.Request) {
+	page := mux.Vars(r)["page"] // The page name (e.g., login, vehicles_available)
+
+	dir, ok := p[page]
+	if !ok {
+		http.Error(w, "Page not found", http.StatusNotFound)
+		return
+	}
+
+	filePath := filepath.Join(dir, "index.html")
+	log.Printf("Serving file: %s", filePath)
+
+	// Check if the file exists before serving
+	if _, err := os.Stat(filePath); os.IsNotExist(err) {
+		log.Printf("File not found: %s", filePath)
+		http.Error(w, "Page not found", http.StatusNotFound)
+		return
+	}
+
+	http.ServeFile(w, r, filePath)
+}
@@ -0,0 +1,90 @@
+package userservice
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+
+	"github.com/yongkaiyu/CNAD_Assg1/internal/auth"
+)
+
+/* Admin endpoints, only reachable by admins */
+
+// List accounts, optionally only those with ?role=
+func (s *Server) listUsersHandler(w http.ResponseWriter, r *http.Request) {
+	role := r.URL.Query().Get("role")
+	if role != "" && !auth.ValidRole(role) {
+		http.Error(w, "Invalid role", http.StatusBadRequest)
+		return
+	}
+
+	users, err := s.store.List(r.Context(), role)
+	if err != nil {
+		log.Printf("Error listing users: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	// Never send password hashes back
+	for i := range users {
+		users[i].Password = ""
+	}
+	if users == nil {
+		users = []User{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(users)
+}
+
+// Give a user a new role. It applies once their current access token is refreshed.
+func (s *Server) setRoleHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.Atoi(mux.Vars(r)["userId"])
+	if err != nil {
+		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+
+	var input struct {
+		Role string `json:"role"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil || !auth.ValidRole(input.Role) {
+		http.Error(w, "role must be one of customer, fleet_operator, finance or admin", http.StatusBadRequest)
+		return
+	}
+
+	// An admin demoting themselves could leave nobody able to assign roles
+	if userID == auth.UserID(r) && input.Role != auth.RoleAdmin {
+		http.Error(w, "You can't remove your own admin role", http.StatusConflict)
+		return
+	}
+
+	user, err := s.store.Get(r.Context(), userID)
+	if err != nil {
+		if errors.Is(err, errUserNotFound) {
+			http.Error(w, "User not found", http.StatusNotFound)
+			return
+		}
+		log.Printf("Error fetching user %d: %v", userID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	if user.Role != input.Role {
+		if err := s.store.SetRole(r.Context(), userID, input.Role); err != nil {
+			log.Printf("Error setting role of user %d: %v", userID, err)
+			http.Error(w, "Failed to update role", http.StatusInternalServerError)
+			return
+		}
+		log.Printf("Admin %d changed the role of user %d from %s to %s", auth.UserID(r), userID, user.Role, input.Role)
+		user.Role = input.Role
+	}
+
+	user.Password = ""
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(user)
+}
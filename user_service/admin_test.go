@@ -0,0 +1,77 @@
+package userservice
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"testing"
+
+	"github.com/yongkaiyu/CNAD_Assg1/internal/auth"
+	"github.com/yongkaiyu/CNAD_Assg1/internal/config"
+)
+
+func TestAdminRoutesRequireAdmin(t *testing.T) {
+	server := NewServer(NewMemoryStore(), nil, nil, nil, nil, config.Default().Users)
+
+	tests := []struct {
+		name   string
+		userID int
+		role   string
+		want   int
+	}{
+		{"anonymous", 0, "", http.StatusUnauthorized},
+		{"customer", 1, auth.RoleCustomer, http.StatusForbidden},
+		{"fleet operator", 1, auth.RoleFleetOperator, http.StatusForbidden},
+		{"finance", 1, auth.RoleFinance, http.StatusForbidden},
+		{"admin", 1, auth.RoleAdmin, http.StatusOK},
+	}
+	for _, path := range []string{"/api/v1/admin/users", "/api/v1/admin/tiers"} {
+		for _, tt := range tests {
+			t.Run(path+" as "+tt.name, func(t *testing.T) {
+				rec := do(t, server, http.MethodGet, path, tt.userID, tt.role, nil)
+				if rec.Code != tt.want {
+					t.Errorf("status = %d, want %d", rec.Code, tt.want)
+				}
+			})
+		}
+	}
+}
+
+func TestSetRole(t *testing.T) {
+	store := NewMemoryStore()
+	adminID := addUser(t, store, User{Name: "Admin", Email: "admin@example.com", Role: auth.RoleAdmin})
+	userID := addUser(t, store, User{Name: "Alice", Email: "alice@example.com", Role: auth.RoleCustomer})
+	server := NewServer(store, nil, nil, nil, nil, config.Default().Users)
+
+	tests := []struct {
+		name     string
+		userID   int
+		role     string
+		want     int
+		wantRole string
+	}{
+		{"promote to fleet operator", userID, auth.RoleFleetOperator, http.StatusOK, auth.RoleFleetOperator},
+		{"unknown role", userID, "owner", http.StatusBadRequest, auth.RoleFleetOperator},
+		{"unknown user", 999, auth.RoleFinance, http.StatusNotFound, ""},
+		{"demote yourself", adminID, auth.RoleCustomer, http.StatusConflict, auth.RoleAdmin},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := "/api/v1/admin/users/" + strconv.Itoa(tt.userID) + "/role"
+			rec := do(t, server, http.MethodPut, path, adminID, auth.RoleAdmin, map[string]string{"role": tt.role})
+			if rec.Code != tt.want {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.want, rec.Body)
+			}
+			if tt.wantRole == "" {
+				return
+			}
+			user, err := store.Get(context.Background(), tt.userID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if user.Role != tt.wantRole {
+				t.Errorf("role = %s, want %s", user.Role, tt.wantRole)
+			}
+		})
+	}
+}
@@ -0,0 +1,404 @@
+package userservice
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/yongkaiyu/CNAD_Assg1/internal/auth"
+	"github.com/yongkaiyu/CNAD_Assg1/internal/clients"
+)
+
+// Hash password
+func hashPassword(password string) (string, error) {
+	bytes, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	return string(bytes), err
+}
+
+// Verify password
+func checkPassword(hashedPassword, password string) bool {
+	err := bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(password))
+	return err == nil
+}
+
+func (s *Server) userRegistrationHandler(w http.ResponseWriter, r *http.Request) {
+
+	if r.Method != http.MethodPost {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var user User
+	if err := json.NewDecoder(r.Body).Decode(&user); err != nil {
+		log.Printf("JSON Decode Error: %v", err)
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	// Log the received data
+	log.Printf("Received user data: %+v", user)
+
+	name := user.Name
+	email := user.Email
+	phone := user.Phone
+	password := user.Password
+
+	// Validate inputs
+	if name == "" || email == "" || phone == "" || password == "" {
+		log.Printf("Validation failed: name='%s', email='%s', phone='%s', password='%s'", name, email, phone, password)
+		http.Error(w, "Name, email, phone and password are required", http.StatusBadRequest)
+		return
+	}
+
+	phone, ok := s.normalizePhone(phone)
+	if !ok {
+		http.Error(w, "Invalid phone number", http.StatusBadRequest)
+		return
+	}
+
+	// Everyone starts on the lowest tier and moves up as they rent
+	tiers, err := s.store.Tiers(r.Context())
+	if err != nil || len(tiers) == 0 {
+		log.Printf("Error fetching membership tiers: %v", err)
+		http.Error(w, "Failed to register user", http.StatusInternalServerError)
+		return
+	}
+	membershipTier := tiers[0].Tier
+
+	// Encrypt password
+	hashedPassword, err := hashPassword(password)
+	if err != nil {
+		http.Error(w, "Failed to hash password", http.StatusInternalServerError)
+		return
+	}
+
+	// Insert user into database, unverified until they follow the emailed link
+	newUser := User{
+		Name:           name,
+		Email:          email,
+		Phone:          phone,
+		Password:       hashedPassword,
+		MembershipTier: membershipTier,
+		Role:           auth.RoleCustomer,
+	}
+	newUser.UserID, err = s.store.Create(r.Context(), newUser)
+	if err != nil {
+		log.Printf("Error registering user: %v", err)
+		http.Error(w, "Failed to register user", http.StatusInternalServerError)
+		return
+	}
+
+	// The account exists either way; the user can ask for another link
+	if err := s.sendEmailVerification(r.Context(), newUser); err != nil {
+		log.Printf("Error sending verification email to user %d: %v", newUser.UserID, err)
+	}
+	if err := s.sendPhoneVerification(r.Context(), newUser.UserID, newUser.Phone); err != nil {
+		log.Printf("Error sending verification code to user %d: %v", newUser.UserID, err)
+	}
+
+	// Prepare a JSON response
+	response := map[string]string{
+		"message": "User registered successfully, check your email and phone to verify them",
+	}
+
+	// Set the response header to JSON and send the response
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK) // Optional, defaults to 200
+	json.NewEncoder(w).Encode(response)
+}
+
+func (s *Server) userAuthenticationHandler(w http.ResponseWriter, r *http.Request) {
+
+	if r.Method != http.MethodPost {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var decodeUser User
+	if err := json.NewDecoder(r.Body).Decode(&decodeUser); err != nil {
+		log.Printf("JSON Decode Error: %v", err)
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	email := decodeUser.Email
+	password := decodeUser.Password
+
+	// Validate inputs
+	if email == "" || password == "" {
+		log.Printf("Validation failed: email='%s', password='%s'", email, password)
+		http.Error(w, "Email and password are required", http.StatusBadRequest)
+		return
+	}
+
+	// Retrieve the user and their hashed password
+	user, err := s.store.GetByEmail(r.Context(), email)
+	if err != nil {
+		if !errors.Is(err, errUserNotFound) {
+			log.Printf("Error retrieving user '%s': %v", email, err)
+		}
+		http.Error(w, "Invalid credentials", http.StatusUnauthorized)
+		return
+	}
+
+	// Compare and verify passwords
+	if !checkPassword(user.Password, password) {
+		http.Error(w, "Invalid credentials", http.StatusUnauthorized)
+		return
+	}
+
+	// Respond with an access/refresh token pair and the user data
+	s.writeAuthResponse(w, r, *user)
+}
+
+func (s *Server) membershipBenefitsHandler(w http.ResponseWriter, r *http.Request) {
+	userID := auth.UserID(r)
+
+	// Fetch membership tier for the user
+	user, err := s.store.Get(r.Context(), userID)
+	if err != nil {
+		if errors.Is(err, errUserNotFound) {
+			http.Error(w, "User not found", http.StatusNotFound)
+		} else {
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+		}
+		log.Printf("Error retrieving membership tier for user_id %d: %v", userID, err)
+		return
+	}
+
+	// Fetch the tier's benefits
+	benefits, err := s.store.Benefits(r.Context(), user.MembershipTier)
+	if err != nil {
+		if errors.Is(err, errTierNotFound) {
+			http.Error(w, "Membership tier not found", http.StatusNotFound)
+		} else {
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+		}
+		log.Printf("Error retrieving benefits for tier '%s': %v", user.MembershipTier, err)
+		return
+	}
+
+	// Send benefits as a JSON response
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(benefits)
+
+}
+
+func httpError(w http.ResponseWriter, message string, statusCode int) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	response := map[string]string{"error": message}
+	json.NewEncoder(w).Encode(response)
+}
+
+func (s *Server) userProfileHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "GET": // View Membership Status
+		userID := auth.UserID(r)
+
+		user, err := s.store.Get(r.Context(), userID)
+		if err != nil {
+			if errors.Is(err, errUserNotFound) {
+				httpError(w, "User not found", http.StatusNotFound)
+			} else {
+				httpError(w, "Database error", http.StatusInternalServerError)
+			}
+			return
+		}
+
+		// Respond with JSON data
+		w.Header().Set("Content-Type", "application/json")
+		response := map[string]string{"membership_tier": user.MembershipTier}
+		json.NewEncoder(w).Encode(response)
+
+		fmt.Fprintf(w, "Membership Tier: %s", user.MembershipTier)
+
+	case "PUT": // Update User Profile
+		userID := auth.UserID(r)
+
+		var decodeUser User
+		if err := json.NewDecoder(r.Body).Decode(&decodeUser); err != nil {
+			log.Printf("JSON Decode Error: %v", err)
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+
+		name := decodeUser.Name
+		email := decodeUser.Email
+		phone := decodeUser.Phone
+		password := decodeUser.Password
+
+		// Validate inputs
+		if name == "" || email == "" || phone == "" || password == "" {
+			log.Printf("Validation failed: name='%s', email='%s', phone='%s', password='%s'", name, email, phone, password)
+			http.Error(w, "Name, email, phone and password are required", http.StatusBadRequest)
+			return
+		}
+
+		phone, ok := s.normalizePhone(phone)
+		if !ok {
+			http.Error(w, "Invalid phone number", http.StatusBadRequest)
+			return
+		}
+
+		var hashedPassword string
+
+		// Only hash the password if it's provided
+		if password != "" {
+			hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+			if err != nil {
+				http.Error(w, "Failed to hash password", http.StatusInternalServerError)
+				return
+			}
+			hashedPassword = string(hash)
+		}
+
+		current, err := s.store.Get(r.Context(), userID)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to update profile: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		// Update user profile, the password only if one was provided
+		if err := s.store.UpdateProfile(r.Context(), userID, name, email, phone, hashedPassword); err != nil {
+			http.Error(w, fmt.Sprintf("Failed to update profile: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		// A changed address or number has to be verified again
+		if email != current.Email {
+			if err := s.sendEmailVerification(r.Context(), User{UserID: userID, Name: name, Email: email}); err != nil {
+				log.Printf("Error sending verification email to user %d: %v", userID, err)
+			}
+		}
+		if phone != current.Phone {
+			if err := s.sendPhoneVerification(r.Context(), userID, phone); err != nil {
+				log.Printf("Error sending verification code to user %d: %v", userID, err)
+			}
+		}
+
+		// Respond with success message
+		w.Header().Set("Content-Type", "application/json")
+		response := map[string]string{"message": "Profile updated successfully"}
+		json.NewEncoder(w).Encode(response)
+	}
+}
+
+// Completed rentals come from the vehicle service and their amounts from the billing service
+func (s *Server) rentalHistoryHandler(w http.ResponseWriter, r *http.Request) {
+	userID := auth.UserID(r)
+
+	bookings, err := s.vehicles.ListBookings(r.Context(), userID, "Completed")
+	if err != nil {
+		log.Printf("Error fetching bookings for user %d: %v", userID, err)
+		http.Error(w, "Error retrieving rental history", http.StatusInternalServerError)
+		return
+	}
+
+	bills, err := s.billing.ListBills(r.Context(), userID)
+	if err != nil {
+		log.Printf("Error fetching bills for user %d: %v", userID, err)
+		http.Error(w, "Error retrieving rental history", http.StatusInternalServerError)
+		return
+	}
+
+	totals := make(map[int]float64)
+	for _, bill := range bills {
+		totals[bill.BookingID] = bill.Cost()
+	}
+
+	var rentals []map[string]interface{}
+	for _, booking := range bookings {
+		// Only rentals that were billed, same as before the split
+		totalCost, billed := totals[booking.BookingID]
+		if !billed {
+			continue
+		}
+
+		rental := map[string]interface{}{
+			"booking_id": strconv.Itoa(booking.BookingID),
+			"user_id":    strconv.Itoa(booking.UserID),
+			"vehicle_id": strconv.Itoa(booking.VehicleID),
+			"start_time": booking.StartTime,
+			"end_time":   booking.EndTime,
+			"status":     booking.Status,
+			"total_cost": totalCost,
+			"created_at": booking.CreatedAt,
+			"updated_at": booking.UpdatedAt,
+		}
+
+		rentals = append(rentals, rental)
+	}
+
+	// Check if rentals is empty
+	if len(rentals) == 0 {
+		http.Error(w, "No completed rentals found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(rentals)
+}
+
+/* Internal endpoints */
+
+func (s *Server) getUserHandler(w http.ResponseWriter, r *http.Request) {
+	userID, _ := strconv.Atoi(mux.Vars(r)["userId"])
+
+	user, err := s.store.Get(r.Context(), userID)
+	if err != nil {
+		if errors.Is(err, errUserNotFound) {
+			http.Error(w, "User not found", http.StatusNotFound)
+			return
+		}
+		log.Printf("Error fetching user %d: %v", userID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(clients.UserInfo{
+		UserID:         user.UserID,
+		Name:           user.Name,
+		Email:          user.Email,
+		Phone:          user.Phone,
+		MembershipTier: user.MembershipTier,
+		EmailVerified:  user.EmailVerified,
+		PhoneVerified:  user.PhoneVerified,
+	})
+}
+
+// The user's tier together with its benefits
+func (s *Server) getMembershipHandler(w http.ResponseWriter, r *http.Request) {
+	userID, _ := strconv.Atoi(mux.Vars(r)["userId"])
+
+	user, err := s.store.Get(r.Context(), userID)
+	var benefits *MembershipBenefits
+	if err == nil {
+		benefits, err = s.store.Benefits(r.Context(), user.MembershipTier)
+	}
+	if err != nil {
+		if errors.Is(err, errUserNotFound) || errors.Is(err, errTierNotFound) {
+			http.Error(w, "User not found", http.StatusNotFound)
+			return
+		}
+		log.Printf("Error fetching membership for user %d: %v", userID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(clients.Membership{
+		UserID:         user.UserID,
+		Tier:           benefits.Tier,
+		DiscountRate:   benefits.DiscountRate,
+		PriorityAccess: benefits.PriorityAccess,
+		BookingLimit:   benefits.BookingLimit,
+	})
+}
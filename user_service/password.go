@@ -0,0 +1,125 @@
+package userservice
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/yongkaiyu/CNAD_Assg1/internal/mail"
+)
+
+// Start a password reset: email the user a single-use link, at most once per
+// VerificationResendInterval. The email is sent in the background so the response,
+// and how long it takes, is the same whether or not the email is registered.
+func (s *Server) forgotPasswordHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var input struct {
+		Email string `json:"email"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil || input.Email == "" {
+		http.Error(w, "Email is required", http.StatusBadRequest)
+		return
+	}
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+
+		if err := s.sendPasswordReset(ctx, input.Email); err != nil {
+			log.Printf("Error sending password reset to '%s': %v", input.Email, err)
+		}
+	}()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "If that email is registered, a password reset link has been sent",
+	})
+}
+
+func (s *Server) sendPasswordReset(ctx context.Context, email string) error {
+	user, err := s.store.GetByEmail(ctx, email)
+	if err != nil {
+		if errors.Is(err, errUserNotFound) {
+			return nil
+		}
+		return err
+	}
+
+	// Throttled quietly, as telling the caller would reveal that the account exists
+	recent, err := s.store.PasswordResetSentWithin(ctx, user.UserID, s.cfg.VerificationResendInterval)
+	if err != nil {
+		return err
+	}
+	if recent {
+		log.Printf("Password reset for user %d was sent recently, not sending another", user.UserID)
+		return nil
+	}
+
+	token, err := generateToken()
+	if err != nil {
+		return err
+	}
+	if err := s.store.CreatePasswordReset(ctx, user.UserID, hashToken(token), time.Now().UTC().Add(s.cfg.PasswordResetTTL)); err != nil {
+		return err
+	}
+
+	link := s.cfg.PublicURL + "/static/reset_password/?token=" + url.QueryEscape(token)
+	return s.mailer.Send(ctx, mail.Message{
+		To:      user.Email,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf("Hi %s,\n\nUse this link to choose a new password. It works once and expires in %s:\n\n%s\n\n"+
+			"If you didn't ask to reset your password you can ignore this email.\n",
+			user.Name, s.cfg.PasswordResetTTL, link),
+	})
+}
+
+// Set a new password with a token from the reset email. Every session of the user is logged out.
+func (s *Server) resetPasswordHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var input struct {
+		Token    string `json:"token"`
+		Password string `json:"password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	if input.Token == "" || input.Password == "" {
+		http.Error(w, "Token and password are required", http.StatusBadRequest)
+		return
+	}
+
+	hashedPassword, err := hashPassword(input.Password)
+	if err != nil {
+		http.Error(w, "Failed to hash password", http.StatusInternalServerError)
+		return
+	}
+
+	userID, err := s.store.ResetPassword(r.Context(), hashToken(input.Token), hashedPassword)
+	if err != nil {
+		if errors.Is(err, errResetTokenInvalid) {
+			http.Error(w, "Invalid or expired reset token", http.StatusBadRequest)
+			return
+		}
+		log.Printf("Error resetting password: %v", err)
+		http.Error(w, "Failed to reset password", http.StatusInternalServerError)
+		return
+	}
+	log.Printf("Password reset for user %d", userID)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Password reset successfully"})
+}
@@ -0,0 +1,77 @@
+package userservice
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/yongkaiyu/CNAD_Assg1/internal/config"
+	"github.com/yongkaiyu/CNAD_Assg1/internal/mail"
+)
+
+// chanMailer hands every message it sends to the test
+type chanMailer chan mail.Message
+
+func (c chanMailer) Send(ctx context.Context, msg mail.Message) error {
+	c <- msg
+	return nil
+}
+
+func forgotPassword(server *Server, email string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/user/password/forgot", strings.NewReader(`{"email":"`+email+`"}`))
+	rec := httptest.NewRecorder()
+	server.Routes().ServeHTTP(rec, req)
+	return rec
+}
+
+func TestForgotPassword(t *testing.T) {
+	store := NewMemoryStore()
+	if _, err := store.Create(context.Background(), User{Name: "Alice", Email: "alice@example.com"}); err != nil {
+		t.Fatal(err)
+	}
+	mailer := make(chanMailer, 10)
+	cfg := config.Default().Users
+	cfg.VerificationResendInterval = time.Hour
+	server := NewServer(store, nil, nil, mailer, nil, cfg)
+
+	tests := []struct {
+		name     string
+		email    string
+		wantMail bool
+	}{
+		{"registered email", "alice@example.com", true},
+		{"again straight away", "alice@example.com", false},
+		{"unknown email", "bob@example.com", false},
+	}
+	var body string
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := forgotPassword(server, tt.email)
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status = %d: %s", rec.Code, rec.Body)
+			}
+			// The response mustn't tell the cases apart
+			if body == "" {
+				body = rec.Body.String()
+			} else if rec.Body.String() != body {
+				t.Errorf("body = %q, want %q", rec.Body.String(), body)
+			}
+
+			select {
+			case msg := <-mailer:
+				if !tt.wantMail {
+					t.Errorf("unexpected email to %s", msg.To)
+				} else if msg.To != tt.email {
+					t.Errorf("email sent to %s, want %s", msg.To, tt.email)
+				}
+			case <-time.After(200 * time.Millisecond):
+				if tt.wantMail {
+					t.Error("no email was sent")
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,127 @@
+package userservice
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/yongkaiyu/CNAD_Assg1/internal/auth"
+)
+
+var e164 = regexp.MustCompile(`^\+[1-9][0-9]{6,14}$`)
+
+// Normalize a phone number to E.164, adding the default country code if it has none
+func (s *Server) normalizePhone(phone string) (string, bool) {
+	phone = strings.NewReplacer(" ", "", "-", "", "(", "", ")", "").Replace(phone)
+	if !strings.HasPrefix(phone, "+") {
+		phone = s.cfg.DefaultCountryCode + phone
+	}
+	return phone, e164.MatchString(phone)
+}
+
+// Six random digits
+func generatePhoneCode() (string, error) {
+	n, err := rand.Int(rand.Reader, big.NewInt(1000000))
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%06d", n.Int64()), nil
+}
+
+// Text the user a code that verifies phone
+func (s *Server) sendPhoneVerification(ctx context.Context, userID int, phone string) error {
+	code, err := generatePhoneCode()
+	if err != nil {
+		return err
+	}
+	expiresAt := time.Now().UTC().Add(s.cfg.PhoneCodeTTL)
+	if err := s.store.CreatePhoneVerification(ctx, userID, phone, hashToken(code), expiresAt); err != nil {
+		return err
+	}
+
+	return s.sms.Send(ctx, phone, fmt.Sprintf("Your verification code is %s. It expires in %s.", code, s.cfg.PhoneCodeTTL))
+}
+
+// Text the logged in user a new code, at most once per VerificationResendInterval
+func (s *Server) sendPhoneCodeHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	user, err := s.store.Get(r.Context(), auth.UserID(r))
+	if err != nil {
+		if errors.Is(err, errUserNotFound) {
+			http.Error(w, "User not found", http.StatusNotFound)
+			return
+		}
+		log.Printf("Error fetching user %d: %v", auth.UserID(r), err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	if user.PhoneVerified {
+		http.Error(w, "Phone number is already verified", http.StatusConflict)
+		return
+	}
+
+	recent, err := s.store.PhoneVerificationSentWithin(r.Context(), user.UserID, s.cfg.VerificationResendInterval)
+	if err != nil {
+		log.Printf("Error checking verification codes for user %d: %v", user.UserID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if recent {
+		w.Header().Set("Retry-After", strconv.Itoa(int(s.cfg.VerificationResendInterval.Seconds())))
+		http.Error(w, "A code was sent recently, please wait before asking again", http.StatusTooManyRequests)
+		return
+	}
+
+	if err := s.sendPhoneVerification(r.Context(), user.UserID, user.Phone); err != nil {
+		log.Printf("Error sending verification code to user %d: %v", user.UserID, err)
+		http.Error(w, "Failed to send verification code", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Verification code sent"})
+}
+
+// Confirm the logged in user's phone number with the code they were texted
+func (s *Server) verifyPhoneHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var input struct {
+		Code string `json:"code"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil || input.Code == "" {
+		http.Error(w, "Code is required", http.StatusBadRequest)
+		return
+	}
+
+	err := s.store.VerifyPhone(r.Context(), auth.UserID(r), hashToken(strings.TrimSpace(input.Code)), s.cfg.PhoneCodeMaxAttempts)
+	if err != nil {
+		if errors.Is(err, errPhoneCodeInvalid) {
+			http.Error(w, "Invalid or expired code", http.StatusBadRequest)
+			return
+		}
+		log.Printf("Error verifying phone for user %d: %v", auth.UserID(r), err)
+		http.Error(w, "Failed to verify phone number", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Phone number verified successfully"})
+}
@@ -0,0 +1,126 @@
+package userservice
+
+import (
+	"context"
+	"net/http"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/yongkaiyu/CNAD_Assg1/internal/auth"
+	"github.com/yongkaiyu/CNAD_Assg1/internal/config"
+	"github.com/yongkaiyu/CNAD_Assg1/internal/sms"
+)
+
+func TestNormalizePhone(t *testing.T) {
+	server := NewServer(NewMemoryStore(), nil, nil, nil, nil, config.Users{DefaultCountryCode: "+65"})
+	tests := []struct {
+		phone  string
+		want   string
+		wantOK bool
+	}{
+		{"+65 9123 4567", "+6591234567", true},
+		{"9123-4567", "+6591234567", true},
+		{"(+44) 20 7946 0958", "+442079460958", true},
+		{"12", "+6512", false},
+		{"+65 9123 abcd", "+659123abcd", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.phone, func(t *testing.T) {
+			got, ok := server.normalizePhone(tt.phone)
+			if got != tt.want || ok != tt.wantOK {
+				t.Errorf("normalizePhone(%q) = %q, %t, want %q, %t", tt.phone, got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+var phoneCode = regexp.MustCompile(`\b[0-9]{6}\b`)
+
+func TestVerifyPhone(t *testing.T) {
+	tests := []struct {
+		name string
+		ttl  time.Duration
+		// Guessed before the right code
+		wrongGuesses int
+		want         int
+	}{
+		{name: "right code", ttl: time.Hour, want: http.StatusOK},
+		{name: "after a wrong guess", ttl: time.Hour, wrongGuesses: 1, want: http.StatusOK},
+		{name: "out of attempts", ttl: time.Hour, wrongGuesses: 3, want: http.StatusBadRequest},
+		{name: "expired code", ttl: -time.Minute, want: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := NewMemoryStore()
+			userID := addUser(t, store, User{Name: "Alice", Email: "alice@example.com", Phone: "+6591234567"})
+			sender := &sms.FakeSender{}
+			cfg := config.Default().Users
+			cfg.PhoneCodeTTL, cfg.PhoneCodeMaxAttempts = tt.ttl, 3
+			server := NewServer(store, nil, nil, nil, sender, cfg)
+
+			if rec := do(t, server, http.MethodPost, "/api/v1/user/phone/send", userID, auth.RoleCustomer, nil); rec.Code != http.StatusOK {
+				t.Fatalf("sending: status = %d: %s", rec.Code, rec.Body)
+			}
+			sent := sender.Sent()
+			if len(sent) != 1 || sent[0].To != "+6591234567" {
+				t.Fatalf("texts sent = %+v, want one to +6591234567", sent)
+			}
+			code := phoneCode.FindString(sent[0].Body)
+
+			for i := 0; i < tt.wrongGuesses; i++ {
+				wrong := "000000"
+				if code == wrong {
+					wrong = "111111"
+				}
+				rec := do(t, server, http.MethodPost, "/api/v1/user/phone/verify", userID, auth.RoleCustomer, map[string]string{"code": wrong})
+				if rec.Code != http.StatusBadRequest {
+					t.Fatalf("wrong guess %d: status = %d, want %d", i, rec.Code, http.StatusBadRequest)
+				}
+			}
+
+			rec := do(t, server, http.MethodPost, "/api/v1/user/phone/verify", userID, auth.RoleCustomer, map[string]string{"code": code})
+			if rec.Code != tt.want {
+				t.Fatalf("verifying: status = %d, want %d: %s", rec.Code, tt.want, rec.Body)
+			}
+			user, err := store.Get(context.Background(), userID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if user.PhoneVerified != (tt.want == http.StatusOK) {
+				t.Errorf("phone verified = %t", user.PhoneVerified)
+			}
+		})
+	}
+}
+
+func TestSendPhoneCodeThrottled(t *testing.T) {
+	store := NewMemoryStore()
+	userID := addUser(t, store, User{Name: "Alice", Email: "alice@example.com", Phone: "+6591234567"})
+	verified := addUser(t, store, User{Name: "Bob", Email: "bob@example.com", Phone: "+6591234568", PhoneVerified: true})
+	sender := &sms.FakeSender{}
+	cfg := config.Default().Users
+	cfg.VerificationResendInterval = time.Hour
+	server := NewServer(store, nil, nil, nil, sender, cfg)
+
+	tests := []struct {
+		name   string
+		userID int
+		want   int
+	}{
+		{"first code", userID, http.StatusOK},
+		{"again straight away", userID, http.StatusTooManyRequests},
+		{"already verified", verified, http.StatusConflict},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := do(t, server, http.MethodPost, "/api/v1/user/phone/send", tt.userID, auth.RoleCustomer, nil)
+			if rec.Code != tt.want {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.want, rec.Body)
+			}
+		})
+	}
+	if sent := sender.Sent(); len(sent) != 1 {
+		t.Errorf("%d texts sent, want 1", len(sent))
+	}
+}
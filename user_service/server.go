@@ -0,0 +1,132 @@
+// Package userservice owns user accounts, membership tiers and login.
+// It owns the users, membershipbenefits, tier_changes and refresh_tokens tables.
+package userservice
+
+import (
+	"context"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/yongkaiyu/CNAD_Assg1/internal/auth"
+	"github.com/yongkaiyu/CNAD_Assg1/internal/clients"
+	"github.com/yongkaiyu/CNAD_Assg1/internal/config"
+	"github.com/yongkaiyu/CNAD_Assg1/internal/mail"
+	"github.com/yongkaiyu/CNAD_Assg1/internal/sms"
+	"github.com/yongkaiyu/CNAD_Assg1/internal/static"
+)
+
+type User struct {
+	UserID         int       `json:"user_id"`
+	Name           string    `json:"name"`
+	Email          string    `json:"email"`
+	Phone          string    `json:"phone"`
+	Password       string    `json:"password"`
+	MembershipTier string    `json:"membership_tier"`
+	Role           string    `json:"role"`
+	EmailVerified  bool      `json:"email_verified"`
+	PhoneVerified  bool      `json:"phone_verified"`
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+// MembershipBenefits is a membership tier. Tiers are ordered by Rank; users move to the
+// highest tier whose MinRentals and MinSpend they meet over the tier period.
+type MembershipBenefits struct {
+	Tier           string  `json:"tier"`
+	DiscountRate   float64 `json:"discount_rate"`
+	PriorityAccess bool    `json:"priority_access"`
+	BookingLimit   int     `json:"booking_limit"`
+	Rank           int     `json:"rank"`
+	MinRentals     int     `json:"min_rentals"`
+	MinSpend       float64 `json:"min_spend"`
+}
+
+// TierChange is one entry in a user's tier history
+type TierChange struct {
+	ChangeID  int       `json:"change_id"`
+	UserID    int       `json:"user_id"`
+	FromTier  string    `json:"from_tier"`
+	ToTier    string    `json:"to_tier"`
+	Reason    string    `json:"reason"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Pages of the user service, served by the gateway
+var Pages = static.Dir("./user_service/static", "login", "signup", "reset_password", "verify_email", "home", "settings", "history", "common")
+
+// Vehicles is the part of the vehicle service the user service calls
+type Vehicles interface {
+	ListBookings(ctx context.Context, userID int, status string) ([]clients.BookingInfo, error)
+	RentalSummaries(ctx context.Context, period time.Duration) ([]clients.RentalSummary, error)
+}
+
+// Billing is the part of the billing service the user service calls
+type Billing interface {
+	ListBills(ctx context.Context, userID int) ([]clients.BillInfo, error)
+}
+
+type Server struct {
+	store    UserStore
+	vehicles Vehicles
+	billing  Billing
+	mailer   mail.Mailer
+	sms      sms.SMSSender
+	cfg      config.Users
+}
+
+func NewServer(store UserStore, vehicles Vehicles, billing Billing, mailer mail.Mailer, smsSender sms.SMSSender, cfg config.Users) *Server {
+	return &Server{store: store, vehicles: vehicles, billing: billing, mailer: mailer, sms: smsSender, cfg: cfg}
+}
+
+func (s *Server) Routes() *mux.Router {
+	router := mux.NewRouter()
+
+	// Public endpoints
+	router.HandleFunc("/api/v1/user/signup", s.userRegistrationHandler)
+	router.HandleFunc("/api/v1/user/login", s.userAuthenticationHandler)
+	router.HandleFunc("/api/v1/user/token/refresh", s.refreshTokenHandler)
+	router.HandleFunc("/api/v1/user/password/forgot", s.forgotPasswordHandler)
+	router.HandleFunc("/api/v1/user/password/reset", s.resetPasswordHandler)
+	router.HandleFunc("/api/v1/user/verify", s.verifyEmailHandler)
+
+	// Everything else under /api/v1/user requires a valid access token
+	api := router.PathPrefix("/api/v1/user").Subrouter()
+	api.Use(auth.Middleware)
+
+	api.HandleFunc("/logout", s.logoutHandler)
+	api.HandleFunc("/verify/resend", s.resendVerificationHandler)
+	api.HandleFunc("/phone/send", s.sendPhoneCodeHandler)
+	api.HandleFunc("/phone/verify", s.verifyPhoneHandler)
+	api.HandleFunc("/settings", s.userProfileHandler)
+	api.HandleFunc("/benefits", s.membershipBenefitsHandler)
+	api.HandleFunc("/history", s.rentalHistoryHandler)
+	api.HandleFunc("/tier/history", s.tierHistoryHandler).Methods("GET")
+
+	// Account administration, for admins only
+	admin := router.PathPrefix("/api/v1/admin/users").Subrouter()
+	admin.Use(auth.Middleware, auth.RequireRole(auth.RoleAdmin))
+
+	admin.HandleFunc("", s.listUsersHandler).Methods("GET")
+	admin.HandleFunc("/{userId}/role", s.setRoleHandler).Methods("PUT")
+
+	// Membership tiers and their progression rules, for admins only
+	tiers := router.PathPrefix("/api/v1/admin/tiers").Subrouter()
+	tiers.Use(auth.Middleware, auth.RequireRole(auth.RoleAdmin))
+
+	tiers.HandleFunc("", s.listTiersHandler).Methods("GET")
+	tiers.HandleFunc("", s.createTierHandler).Methods("POST")
+	tiers.HandleFunc("/evaluate", s.evaluateTiersHandler).Methods("POST")
+	tiers.HandleFunc("/{tier}", s.getTierHandler).Methods("GET")
+	tiers.HandleFunc("/{tier}", s.updateTierHandler).Methods("PUT")
+	tiers.HandleFunc("/{tier}", s.deleteTierHandler).Methods("DELETE")
+
+	// Called by the other services
+	internal := router.PathPrefix("/internal").Subrouter()
+	internal.Use(auth.InternalMiddleware)
+
+	internal.HandleFunc("/users/{userId}", s.getUserHandler).Methods("GET")
+	internal.HandleFunc("/users/{userId}/membership", s.getMembershipHandler).Methods("GET")
+
+	return router
+}
@@ -0,0 +1,62 @@
+// Shared helpers for calling authenticated API endpoints
+
+function saveTokens(data) {
+    localStorage.setItem("accessToken", data.access_token);
+    localStorage.setItem("refreshToken", data.refresh_token);
+}
+
+function clearSession() {
+    localStorage.removeItem("accessToken");
+    localStorage.removeItem("refreshToken");
+    localStorage.removeItem("userId");
+    localStorage.removeItem("userName");
+    localStorage.removeItem("userEmail");
+    localStorage.removeItem("userPhone");
+}
+
+// Exchange the refresh token for a new token pair
+async function refreshTokens() {
+    const refreshToken = localStorage.getItem("refreshToken");
+    if (!refreshToken) {
+        return false;
+    }
+
+    const response = await fetch("/api/v1/user/token/refresh", {
+        method: "POST",
+        headers: {
+            "Content-Type": "application/json",
+        },
+        body: JSON.stringify({ refresh_token: refreshToken }),
+    });
+
+    if (!response.ok) {
+        return false;
+    }
+
+    saveTokens(await response.json());
+    return true;
+}
+
+// fetch() wrapper that sends the access token and retries once after refreshing it
+async function authFetch(url, options = {}) {
+    const withToken = () => ({
+        ...options,
+        headers: {
+            ...(options.headers || {}),
+            "Authorization": `Bearer ${localStorage.getItem("accessToken")}`,
+        },
+    });
+
+    let response = await fetch(url, withToken());
+    if (response.status === 401 && await refreshTokens()) {
+        response = await fetch(url, withToken());
+    }
+
+    if (response.status === 401) {
+        clearSession();
+        alert("Your session has expired. Please log in again.");
+        window.location.href = "../login";
+    }
+
+    return response;
+}
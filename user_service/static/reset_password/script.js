@@ -0,0 +1,59 @@
+document.addEventListener("DOMContentLoaded", () => {
+    const forgotForm = document.getElementById("forgotForm");
+    const resetForm = document.getElementById("resetForm");
+    const token = new URLSearchParams(window.location.search).get("token");
+
+    if (token) {
+        forgotForm.hidden = true;
+        resetForm.hidden = false;
+    }
+
+    forgotForm.addEventListener("submit", async (event) => {
+        event.preventDefault();
+
+        try {
+            const response = await fetch("/api/v1/user/password/forgot", {
+                method: "POST",
+                headers: {
+                    "Content-Type": "application/json",
+                },
+                body: JSON.stringify({ email: new FormData(forgotForm).get("email") }),
+            });
+
+            if (response.ok) {
+                const result = await response.json();
+                alert(result.message);
+            } else {
+                alert("Request failed: " + (await response.text()));
+            }
+        } catch (error) {
+            console.error("Error:", error);
+            alert("An error occurred while requesting the reset link.");
+        }
+    });
+
+    resetForm.addEventListener("submit", async (event) => {
+        event.preventDefault();
+
+        try {
+            const response = await fetch("/api/v1/user/password/reset", {
+                method: "POST",
+                headers: {
+                    "Content-Type": "application/json",
+                },
+                body: JSON.stringify({ token: token, password: new FormData(resetForm).get("password") }),
+            });
+
+            if (response.ok) {
+                const result = await response.json();
+                alert(result.message);
+                window.location.href = "../login";
+            } else {
+                alert("Reset failed: " + (await response.text()));
+            }
+        } catch (error) {
+            console.error("Error:", error);
+            alert("An error occurred while resetting the password.");
+        }
+    });
+});
@@ -0,0 +1,41 @@
+document.addEventListener("DOMContentLoaded", async () => {
+    const message = document.getElementById("verifyMessage");
+    const resendButton = document.getElementById("resendButton");
+    const token = new URLSearchParams(window.location.search).get("token");
+
+    resendButton.addEventListener("click", async () => {
+        try {
+            const response = await authFetch("/api/v1/user/verify/resend", { method: "POST" });
+            message.textContent = response.ok ? (await response.json()).message : await response.text();
+        } catch (error) {
+            console.error("Error:", error);
+            message.textContent = "An error occurred while sending the link.";
+        }
+    });
+
+    if (!token) {
+        message.textContent = "Your email address is not verified yet.";
+        resendButton.hidden = !localStorage.getItem("accessToken");
+        return;
+    }
+
+    try {
+        const response = await fetch("/api/v1/user/verify", {
+            method: "POST",
+            headers: {
+                "Content-Type": "application/json",
+            },
+            body: JSON.stringify({ token: token }),
+        });
+
+        if (response.ok) {
+            message.textContent = (await response.json()).message + ". You can now book vehicles.";
+        } else {
+            message.textContent = "Verification failed: " + (await response.text());
+            resendButton.hidden = !localStorage.getItem("accessToken");
+        }
+    } catch (error) {
+        console.error("Error:", error);
+        message.textContent = "An error occurred during verification.";
+    }
+});
@@ -0,0 +1,79 @@
+package userservice
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+var (
+	errUserNotFound         = errors.New("user not found")
+	errTierNotFound         = errors.New("membership tier not found")
+	errTierExists           = errors.New("membership tier already exists")
+	errTierInUse            = errors.New("membership tier still has members")
+	errTierChanged          = errors.New("user's membership tier has changed")
+	errRefreshTokenNotFound = errors.New("refresh token not found")
+	errResetTokenInvalid    = errors.New("password reset token is invalid or expired")
+	errVerificationInvalid  = errors.New("email verification token is invalid or expired")
+	errPhoneCodeInvalid     = errors.New("phone verification code is wrong or expired")
+)
+
+// UserStore reads and writes accounts, membership tiers and refresh tokens
+type UserStore interface {
+	// Create adds a user whose Password is already hashed and returns the new ID
+	Create(ctx context.Context, user User) (int, error)
+	// Get and GetByEmail return the user including the password hash
+	Get(ctx context.Context, userID int) (*User, error)
+	GetByEmail(ctx context.Context, email string) (*User, error)
+	// UpdateProfile changes the user's details. An empty passwordHash keeps the current password.
+	// A new email address or phone number is unverified.
+	UpdateProfile(ctx context.Context, userID int, name, email, phone, passwordHash string) error
+	Benefits(ctx context.Context, tier string) (*MembershipBenefits, error)
+	// Tiers returns every membership tier, lowest rank first
+	Tiers(ctx context.Context) ([]MembershipBenefits, error)
+	// CreateTier returns errTierExists if the name is taken
+	CreateTier(ctx context.Context, tier MembershipBenefits) error
+	UpdateTier(ctx context.Context, tier MembershipBenefits) error
+	// DeleteTier returns errTierInUse while users are on the tier
+	DeleteTier(ctx context.Context, tier string) error
+	// ChangeTier moves the user from one tier to another and records why. It returns
+	// errTierChanged if the user is no longer on from.
+	ChangeTier(ctx context.Context, userID int, from, to, reason string) error
+	// TierHistory returns the user's tier changes, newest first
+	TierHistory(ctx context.Context, userID int) ([]TierChange, error)
+	// List returns users in ID order, only those with the role unless it is empty
+	List(ctx context.Context, role string) ([]User, error)
+	SetRole(ctx context.Context, userID int, role string) error
+
+	CreateRefreshToken(ctx context.Context, userID int, tokenHash string, expiresAt time.Time) error
+	// UserForRefreshToken returns the owner of an unexpired, unrevoked token
+	UserForRefreshToken(ctx context.Context, tokenHash string) (*User, error)
+	// RevokeRefreshToken revokes an unrevoked token, only if it belongs to userID when userID isn't 0.
+	// It returns errRefreshTokenNotFound if there was nothing to revoke.
+	RevokeRefreshToken(ctx context.Context, tokenHash string, userID int) error
+
+	CreatePasswordReset(ctx context.Context, userID int, tokenHash string, expiresAt time.Time) error
+	// PasswordResetSentWithin reports whether a reset token was created for the user in the last interval
+	PasswordResetSentWithin(ctx context.Context, userID int, interval time.Duration) (bool, error)
+	// ResetPassword sets a new password using an unexpired, unused reset token. It uses up every
+	// outstanding reset token of the user and revokes their refresh tokens, so other sessions end.
+	// It returns errResetTokenInvalid if the token can't be used.
+	ResetPassword(ctx context.Context, tokenHash, passwordHash string) (userID int, err error)
+
+	// CreateEmailVerification stores a token that verifies email for the user
+	CreateEmailVerification(ctx context.Context, userID int, email, tokenHash string, expiresAt time.Time) error
+	// EmailVerificationSentWithin reports whether a verification token was created for the user in the last interval
+	EmailVerificationSentWithin(ctx context.Context, userID int, interval time.Duration) (bool, error)
+	// VerifyEmail marks the user's email verified using an unexpired, unused token issued for
+	// their current address. It returns errVerificationInvalid if the token can't be used.
+	VerifyEmail(ctx context.Context, tokenHash string) (userID int, err error)
+
+	// CreatePhoneVerification stores a code that verifies phone for the user
+	CreatePhoneVerification(ctx context.Context, userID int, phone, codeHash string, expiresAt time.Time) error
+	// PhoneVerificationSentWithin reports whether a code was created for the user in the last interval
+	PhoneVerificationSentWithin(ctx context.Context, userID int, interval time.Duration) (bool, error)
+	// VerifyPhone checks codeHash against the user's latest unexpired code for their current number
+	// and marks the number verified if it matches. A wrong guess counts against the code; once
+	// maxAttempts have been made the code stops working. It returns errPhoneCodeInvalid on any failure.
+	VerifyPhone(ctx context.Context, userID int, codeHash string, maxAttempts int) error
+}
@@ -0,0 +1,463 @@
+package userservice
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/yongkaiyu/CNAD_Assg1/internal/auth"
+)
+
+// MemoryStore keeps the user service's data in memory, for tests and local runs without MySQL.
+// It starts with the same membership tiers the migrations seed.
+type MemoryStore struct {
+	mu            sync.Mutex
+	users         map[int]User
+	benefits      map[string]MembershipBenefits
+	refreshTokens map[string]memoryRefreshToken
+	resetTokens   map[string]memoryResetToken
+	verifyTokens  map[string]memoryVerifyToken
+	phoneCodes    []memoryPhoneCode
+	tierChanges   []TierChange
+	nextUserID    int
+}
+
+type memoryRefreshToken struct {
+	userID    int
+	expiresAt time.Time
+	revoked   bool
+}
+
+type memoryVerifyToken struct {
+	userID    int
+	email     string
+	expiresAt time.Time
+	createdAt time.Time
+	used      bool
+}
+
+type memoryPhoneCode struct {
+	userID    int
+	phone     string
+	codeHash  string
+	attempts  int
+	expiresAt time.Time
+	createdAt time.Time
+	used      bool
+}
+
+type memoryResetToken struct {
+	userID    int
+	expiresAt time.Time
+	createdAt time.Time
+	used      bool
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		users: map[int]User{},
+		benefits: map[string]MembershipBenefits{
+			"Basic":   {Tier: "Basic", DiscountRate: 0, PriorityAccess: false, BookingLimit: 2},
+			"Premium": {Tier: "Premium", DiscountRate: 10, PriorityAccess: true, BookingLimit: 5, Rank: 1, MinRentals: 5, MinSpend: 150},
+			"VIP":     {Tier: "VIP", DiscountRate: 20, PriorityAccess: true, BookingLimit: 10, Rank: 2, MinRentals: 15, MinSpend: 500},
+		},
+		refreshTokens: map[string]memoryRefreshToken{},
+		resetTokens:   map[string]memoryResetToken{},
+		verifyTokens:  map[string]memoryVerifyToken{},
+		nextUserID:    1,
+	}
+}
+
+func (s *MemoryStore) Create(ctx context.Context, user User) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, u := range s.users {
+		if u.Email == user.Email {
+			return 0, errors.New("duplicate email")
+		}
+	}
+
+	user.UserID = s.nextUserID
+	s.nextUserID++
+	if user.Role == "" {
+		user.Role = auth.RoleCustomer
+	}
+	now := time.Now().UTC()
+	user.CreatedAt, user.UpdatedAt = now, now
+	s.users[user.UserID] = user
+	return user.UserID, nil
+}
+
+func (s *MemoryStore) Get(ctx context.Context, userID int) (*User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user, ok := s.users[userID]
+	if !ok {
+		return nil, errUserNotFound
+	}
+	return &user, nil
+}
+
+func (s *MemoryStore) GetByEmail(ctx context.Context, email string) (*User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, user := range s.users {
+		if user.Email == email {
+			return &user, nil
+		}
+	}
+	return nil, errUserNotFound
+}
+
+func (s *MemoryStore) UpdateProfile(ctx context.Context, userID int, name, email, phone, passwordHash string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user, ok := s.users[userID]
+	if !ok {
+		return nil
+	}
+	if user.Email != email {
+		user.EmailVerified = false
+	}
+	if user.Phone != phone {
+		user.PhoneVerified = false
+	}
+	user.Name, user.Email, user.Phone = name, email, phone
+	if passwordHash != "" {
+		user.Password = passwordHash
+	}
+	user.UpdatedAt = time.Now().UTC()
+	s.users[userID] = user
+	return nil
+}
+
+func (s *MemoryStore) Benefits(ctx context.Context, tier string) (*MembershipBenefits, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	benefits, ok := s.benefits[tier]
+	if !ok {
+		return nil, errTierNotFound
+	}
+	return &benefits, nil
+}
+
+func (s *MemoryStore) Tiers(ctx context.Context) ([]MembershipBenefits, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var tiers []MembershipBenefits
+	for _, tier := range s.benefits {
+		tiers = append(tiers, tier)
+	}
+	sort.Slice(tiers, func(i, j int) bool {
+		if tiers[i].Rank != tiers[j].Rank {
+			return tiers[i].Rank < tiers[j].Rank
+		}
+		return tiers[i].Tier < tiers[j].Tier
+	})
+	return tiers, nil
+}
+
+func (s *MemoryStore) CreateTier(ctx context.Context, tier MembershipBenefits) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.benefits[tier.Tier]; ok {
+		return errTierExists
+	}
+	s.benefits[tier.Tier] = tier
+	return nil
+}
+
+func (s *MemoryStore) UpdateTier(ctx context.Context, tier MembershipBenefits) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.benefits[tier.Tier]; ok {
+		s.benefits[tier.Tier] = tier
+	}
+	return nil
+}
+
+func (s *MemoryStore) DeleteTier(ctx context.Context, tier string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.benefits[tier]; !ok {
+		return errTierNotFound
+	}
+	for _, user := range s.users {
+		if user.MembershipTier == tier {
+			return errTierInUse
+		}
+	}
+	delete(s.benefits, tier)
+	return nil
+}
+
+func (s *MemoryStore) ChangeTier(ctx context.Context, userID int, from, to, reason string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user, ok := s.users[userID]
+	if !ok || user.MembershipTier != from {
+		return errTierChanged
+	}
+	user.MembershipTier = to
+	user.UpdatedAt = time.Now().UTC()
+	s.users[userID] = user
+
+	s.tierChanges = append(s.tierChanges, TierChange{
+		ChangeID:  len(s.tierChanges) + 1,
+		UserID:    userID,
+		FromTier:  from,
+		ToTier:    to,
+		Reason:    reason,
+		CreatedAt: time.Now().UTC().Truncate(time.Second),
+	})
+	return nil
+}
+
+func (s *MemoryStore) TierHistory(ctx context.Context, userID int) ([]TierChange, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var changes []TierChange
+	for i := len(s.tierChanges) - 1; i >= 0; i-- {
+		if s.tierChanges[i].UserID == userID {
+			changes = append(changes, s.tierChanges[i])
+		}
+	}
+	return changes, nil
+}
+
+func (s *MemoryStore) List(ctx context.Context, role string) ([]User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var users []User
+	for _, user := range s.users {
+		if role == "" || user.Role == role {
+			users = append(users, user)
+		}
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].UserID < users[j].UserID })
+	return users, nil
+}
+
+func (s *MemoryStore) SetRole(ctx context.Context, userID int, role string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user, ok := s.users[userID]
+	if !ok {
+		return errUserNotFound
+	}
+	user.Role = role
+	user.UpdatedAt = time.Now().UTC()
+	s.users[userID] = user
+	return nil
+}
+
+func (s *MemoryStore) CreateRefreshToken(ctx context.Context, userID int, tokenHash string, expiresAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.refreshTokens[tokenHash] = memoryRefreshToken{userID: userID, expiresAt: expiresAt}
+	return nil
+}
+
+func (s *MemoryStore) UserForRefreshToken(ctx context.Context, tokenHash string) (*User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	token, ok := s.refreshTokens[tokenHash]
+	if !ok || token.revoked || !time.Now().Before(token.expiresAt) {
+		return nil, errUserNotFound
+	}
+	user, ok := s.users[token.userID]
+	if !ok {
+		return nil, errUserNotFound
+	}
+	return &user, nil
+}
+
+func (s *MemoryStore) RevokeRefreshToken(ctx context.Context, tokenHash string, userID int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	token, ok := s.refreshTokens[tokenHash]
+	if !ok || token.revoked || (userID != 0 && token.userID != userID) {
+		return errRefreshTokenNotFound
+	}
+	token.revoked = true
+	s.refreshTokens[tokenHash] = token
+	return nil
+}
+
+func (s *MemoryStore) CreatePasswordReset(ctx context.Context, userID int, tokenHash string, expiresAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.resetTokens[tokenHash] = memoryResetToken{userID: userID, expiresAt: expiresAt, createdAt: time.Now().UTC()}
+	return nil
+}
+
+func (s *MemoryStore) PasswordResetSentWithin(ctx context.Context, userID int, interval time.Duration) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	cutoff := time.Now().UTC().Add(-interval)
+	for _, t := range s.resetTokens {
+		if t.userID == userID && t.createdAt.After(cutoff) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (s *MemoryStore) ResetPassword(ctx context.Context, tokenHash, passwordHash string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	token, ok := s.resetTokens[tokenHash]
+	if !ok || token.used || !time.Now().Before(token.expiresAt) {
+		return 0, errResetTokenInvalid
+	}
+	user, ok := s.users[token.userID]
+	if !ok {
+		return 0, errResetTokenInvalid
+	}
+
+	user.Password = passwordHash
+	user.UpdatedAt = time.Now().UTC()
+	s.users[user.UserID] = user
+
+	for hash, t := range s.resetTokens {
+		if t.userID == user.UserID {
+			t.used = true
+			s.resetTokens[hash] = t
+		}
+	}
+	for hash, t := range s.refreshTokens {
+		if t.userID == user.UserID {
+			t.revoked = true
+			s.refreshTokens[hash] = t
+		}
+	}
+	return user.UserID, nil
+}
+
+func (s *MemoryStore) CreateEmailVerification(ctx context.Context, userID int, email, tokenHash string, expiresAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.verifyTokens[tokenHash] = memoryVerifyToken{userID: userID, email: email, expiresAt: expiresAt, createdAt: time.Now().UTC()}
+	return nil
+}
+
+func (s *MemoryStore) EmailVerificationSentWithin(ctx context.Context, userID int, interval time.Duration) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	cutoff := time.Now().UTC().Add(-interval)
+	for _, t := range s.verifyTokens {
+		if t.userID == userID && t.createdAt.After(cutoff) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (s *MemoryStore) VerifyEmail(ctx context.Context, tokenHash string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	token, ok := s.verifyTokens[tokenHash]
+	if !ok || token.used || !time.Now().Before(token.expiresAt) {
+		return 0, errVerificationInvalid
+	}
+	user, ok := s.users[token.userID]
+	if !ok || user.Email != token.email {
+		return 0, errVerificationInvalid
+	}
+
+	user.EmailVerified = true
+	s.users[user.UserID] = user
+
+	for hash, t := range s.verifyTokens {
+		if t.userID == user.UserID {
+			t.used = true
+			s.verifyTokens[hash] = t
+		}
+	}
+	return user.UserID, nil
+}
+
+func (s *MemoryStore) CreatePhoneVerification(ctx context.Context, userID int, phone, codeHash string, expiresAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.phoneCodes = append(s.phoneCodes, memoryPhoneCode{
+		userID:    userID,
+		phone:     phone,
+		codeHash:  codeHash,
+		expiresAt: expiresAt,
+		createdAt: time.Now().UTC(),
+	})
+	return nil
+}
+
+func (s *MemoryStore) PhoneVerificationSentWithin(ctx context.Context, userID int, interval time.Duration) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	cutoff := time.Now().UTC().Add(-interval)
+	for _, c := range s.phoneCodes {
+		if c.userID == userID && c.createdAt.After(cutoff) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (s *MemoryStore) VerifyPhone(ctx context.Context, userID int, codeHash string, maxAttempts int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user, ok := s.users[userID]
+	if !ok {
+		return errPhoneCodeInvalid
+	}
+
+	// Latest usable code for the current number
+	latest := -1
+	for i, c := range s.phoneCodes {
+		if c.userID == userID && c.phone == user.Phone && !c.used && time.Now().Before(c.expiresAt) {
+			latest = i
+		}
+	}
+	if latest < 0 || s.phoneCodes[latest].attempts >= maxAttempts {
+		return errPhoneCodeInvalid
+	}
+	if s.phoneCodes[latest].codeHash != codeHash {
+		s.phoneCodes[latest].attempts++
+		return errPhoneCodeInvalid
+	}
+
+	user.PhoneVerified = true
+	s.users[userID] = user
+	for i := range s.phoneCodes {
+		if s.phoneCodes[i].userID == userID {
+			s.phoneCodes[i].used = true
+		}
+	}
+	return nil
+}
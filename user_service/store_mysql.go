@@ -0,0 +1,430 @@
+package userservice
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/yongkaiyu/CNAD_Assg1/internal/database"
+)
+
+type mysqlUsers struct {
+	db *sql.DB
+}
+
+// NewMySQLStore keeps the user service's data in MySQL
+func NewMySQLStore(db *sql.DB) UserStore {
+	return mysqlUsers{db: db}
+}
+
+const userColumns = `user_id, name, email, phone, password, membership_tier, role,
+	email_verified_at IS NOT NULL, phone_verified_at IS NOT NULL, created_at, updated_at`
+
+func scanUser(row database.Scanner) (*User, error) {
+	var user User
+	var createdAt, updatedAt string
+	err := row.Scan(&user.UserID, &user.Name, &user.Email, &user.Phone, &user.Password,
+		&user.MembershipTier, &user.Role, &user.EmailVerified, &user.PhoneVerified, &createdAt, &updatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, errUserNotFound
+		}
+		return nil, err
+	}
+	user.CreatedAt, _ = time.Parse("2006-01-02 15:04:05", createdAt)
+	user.UpdatedAt, _ = time.Parse("2006-01-02 15:04:05", updatedAt)
+	return &user, nil
+}
+
+func (m mysqlUsers) Create(ctx context.Context, user User) (int, error) {
+	result, err := m.db.ExecContext(ctx,
+		"INSERT INTO users (name, email, phone, password, membership_tier, role) VALUES (?, ?, ?, ?, ?, ?)",
+		user.Name, user.Email, user.Phone, user.Password, user.MembershipTier, user.Role)
+	if err != nil {
+		return 0, err
+	}
+	userID, err := result.LastInsertId()
+	return int(userID), err
+}
+
+func (m mysqlUsers) Get(ctx context.Context, userID int) (*User, error) {
+	return scanUser(m.db.QueryRowContext(ctx, "SELECT "+userColumns+" FROM users WHERE user_id = ?", userID))
+}
+
+func (m mysqlUsers) GetByEmail(ctx context.Context, email string) (*User, error) {
+	return scanUser(m.db.QueryRowContext(ctx, "SELECT "+userColumns+" FROM users WHERE email = ?", email))
+}
+
+func (m mysqlUsers) UpdateProfile(ctx context.Context, userID int, name, email, phone, passwordHash string) error {
+	// MySQL applies assignments left to right, so the verified columns still see the old values
+	query := `UPDATE users SET
+		email_verified_at = IF(email = ?, email_verified_at, NULL),
+		phone_verified_at = IF(phone = ?, phone_verified_at, NULL),
+		name = ?, email = ?, phone = ?`
+	args := []interface{}{email, phone, name, email, phone}
+	if passwordHash != "" {
+		query += ", password = ?"
+		args = append(args, passwordHash)
+	}
+	query += " WHERE user_id = ?"
+	args = append(args, userID)
+
+	_, err := m.db.ExecContext(ctx, query, args...)
+	return err
+}
+
+const tierColumns = `tier, discount_rate, priority_access, booking_limit, tier_rank, min_rentals, min_spend`
+
+func scanTier(row database.Scanner) (*MembershipBenefits, error) {
+	var benefits MembershipBenefits
+	err := row.Scan(&benefits.Tier, &benefits.DiscountRate, &benefits.PriorityAccess, &benefits.BookingLimit,
+		&benefits.Rank, &benefits.MinRentals, &benefits.MinSpend)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, errTierNotFound
+		}
+		return nil, err
+	}
+	return &benefits, nil
+}
+
+func (m mysqlUsers) Benefits(ctx context.Context, tier string) (*MembershipBenefits, error) {
+	return scanTier(m.db.QueryRowContext(ctx, "SELECT "+tierColumns+" FROM membershipbenefits WHERE tier = ?", tier))
+}
+
+func (m mysqlUsers) Tiers(ctx context.Context) ([]MembershipBenefits, error) {
+	rows, err := m.db.QueryContext(ctx, "SELECT "+tierColumns+" FROM membershipbenefits ORDER BY tier_rank, tier")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tiers []MembershipBenefits
+	for rows.Next() {
+		tier, err := scanTier(rows)
+		if err != nil {
+			return nil, err
+		}
+		tiers = append(tiers, *tier)
+	}
+	return tiers, rows.Err()
+}
+
+func (m mysqlUsers) CreateTier(ctx context.Context, tier MembershipBenefits) error {
+	_, err := m.db.ExecContext(ctx, `
+		INSERT INTO membershipbenefits (`+tierColumns+`)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		tier.Tier, tier.DiscountRate, tier.PriorityAccess, tier.BookingLimit, tier.Rank, tier.MinRentals, tier.MinSpend)
+	if database.IsDuplicate(err) {
+		return errTierExists
+	}
+	return err
+}
+
+func (m mysqlUsers) UpdateTier(ctx context.Context, tier MembershipBenefits) error {
+	_, err := m.db.ExecContext(ctx, `
+		UPDATE membershipbenefits
+		SET discount_rate = ?, priority_access = ?, booking_limit = ?, tier_rank = ?, min_rentals = ?, min_spend = ?
+		WHERE tier = ?`,
+		tier.DiscountRate, tier.PriorityAccess, tier.BookingLimit, tier.Rank, tier.MinRentals, tier.MinSpend, tier.Tier)
+	return err
+}
+
+func (m mysqlUsers) DeleteTier(ctx context.Context, tier string) error {
+	return database.InTx(ctx, m.db, func(tx *sql.Tx) error {
+		// Lock the tier so nobody is moved onto it while it is deleted
+		var exists bool
+		err := tx.QueryRowContext(ctx, `SELECT TRUE FROM membershipbenefits WHERE tier = ? FOR UPDATE`, tier).Scan(&exists)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				return errTierNotFound
+			}
+			return err
+		}
+
+		var members int
+		if err := tx.QueryRowContext(ctx, `SELECT COUNT(*) FROM users WHERE membership_tier = ?`, tier).Scan(&members); err != nil {
+			return err
+		}
+		if members > 0 {
+			return errTierInUse
+		}
+
+		_, err = tx.ExecContext(ctx, `DELETE FROM membershipbenefits WHERE tier = ?`, tier)
+		return err
+	})
+}
+
+func (m mysqlUsers) ChangeTier(ctx context.Context, userID int, from, to, reason string) error {
+	return database.InTx(ctx, m.db, func(tx *sql.Tx) error {
+		result, err := tx.ExecContext(ctx, `
+			UPDATE users SET membership_tier = ? WHERE user_id = ? AND membership_tier = ?`,
+			to, userID, from)
+		if err != nil {
+			return err
+		}
+		if err := database.RequireRow(result, errTierChanged); err != nil {
+			return err
+		}
+
+		_, err = tx.ExecContext(ctx, `
+			INSERT INTO tier_changes (user_id, from_tier, to_tier, reason)
+			VALUES (?, ?, ?, ?)`,
+			userID, from, to, reason)
+		return err
+	})
+}
+
+func (m mysqlUsers) TierHistory(ctx context.Context, userID int) ([]TierChange, error) {
+	rows, err := m.db.QueryContext(ctx, `
+		SELECT change_id, user_id, from_tier, to_tier, reason, created_at
+		FROM tier_changes
+		WHERE user_id = ?
+		ORDER BY change_id DESC`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var changes []TierChange
+	for rows.Next() {
+		var change TierChange
+		var createdAt string
+		if err := rows.Scan(&change.ChangeID, &change.UserID, &change.FromTier, &change.ToTier, &change.Reason, &createdAt); err != nil {
+			return nil, err
+		}
+		change.CreatedAt, _ = time.Parse("2006-01-02 15:04:05", createdAt)
+		changes = append(changes, change)
+	}
+	return changes, rows.Err()
+}
+
+func (m mysqlUsers) List(ctx context.Context, role string) ([]User, error) {
+	query := "SELECT " + userColumns + " FROM users"
+	var args []interface{}
+	if role != "" {
+		query += " WHERE role = ?"
+		args = append(args, role)
+	}
+	query += " ORDER BY user_id"
+
+	rows, err := m.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var users []User
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, *user)
+	}
+	return users, rows.Err()
+}
+
+func (m mysqlUsers) SetRole(ctx context.Context, userID int, role string) error {
+	result, err := m.db.ExecContext(ctx, "UPDATE users SET role = ? WHERE user_id = ?", role, userID)
+	if err != nil {
+		return err
+	}
+	return database.RequireRow(result, errUserNotFound)
+}
+
+func (m mysqlUsers) CreateRefreshToken(ctx context.Context, userID int, tokenHash string, expiresAt time.Time) error {
+	_, err := m.db.ExecContext(ctx, `
+		INSERT INTO refresh_tokens (user_id, token_hash, expires_at)
+		VALUES (?, ?, ?)`,
+		userID, tokenHash, expiresAt.UTC().Format("2006-01-02 15:04:05"))
+	return err
+}
+
+func (m mysqlUsers) UserForRefreshToken(ctx context.Context, tokenHash string) (*User, error) {
+	return scanUser(m.db.QueryRowContext(ctx, `
+		SELECT u.user_id, u.name, u.email, u.phone, u.password, u.membership_tier, u.role,
+			u.email_verified_at IS NOT NULL, u.phone_verified_at IS NOT NULL, u.created_at, u.updated_at
+		FROM refresh_tokens rt
+		INNER JOIN users u ON rt.user_id = u.user_id
+		WHERE rt.token_hash = ? AND rt.revoked_at IS NULL AND rt.expires_at > UTC_TIMESTAMP()`,
+		tokenHash))
+}
+
+func (m mysqlUsers) RevokeRefreshToken(ctx context.Context, tokenHash string, userID int) error {
+	query := `UPDATE refresh_tokens SET revoked_at = UTC_TIMESTAMP() WHERE token_hash = ? AND revoked_at IS NULL`
+	args := []interface{}{tokenHash}
+	if userID != 0 {
+		query += ` AND user_id = ?`
+		args = append(args, userID)
+	}
+
+	result, err := m.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	return database.RequireRow(result, errRefreshTokenNotFound)
+}
+
+func (m mysqlUsers) CreatePasswordReset(ctx context.Context, userID int, tokenHash string, expiresAt time.Time) error {
+	_, err := m.db.ExecContext(ctx, `
+		INSERT INTO password_reset_tokens (user_id, token_hash, expires_at)
+		VALUES (?, ?, ?)`,
+		userID, tokenHash, expiresAt.UTC().Format("2006-01-02 15:04:05"))
+	return err
+}
+
+func (m mysqlUsers) PasswordResetSentWithin(ctx context.Context, userID int, interval time.Duration) (bool, error) {
+	// Compared in the database because created_at is in the session time zone
+	var sent bool
+	err := m.db.QueryRowContext(ctx, `
+		SELECT EXISTS(
+			SELECT 1 FROM password_reset_tokens
+			WHERE user_id = ? AND created_at > NOW() - INTERVAL ? SECOND
+		)`, userID, int(interval.Seconds())).Scan(&sent)
+	return sent, err
+}
+
+func (m mysqlUsers) ResetPassword(ctx context.Context, tokenHash, passwordHash string) (int, error) {
+	var userID int
+	err := database.InTx(ctx, m.db, func(tx *sql.Tx) error {
+		// Lock the token so it can only be used once
+		err := tx.QueryRowContext(ctx, `
+			SELECT user_id FROM password_reset_tokens
+			WHERE token_hash = ? AND used_at IS NULL AND expires_at > UTC_TIMESTAMP()
+			FOR UPDATE`, tokenHash).Scan(&userID)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				return errResetTokenInvalid
+			}
+			return err
+		}
+
+		if _, err := tx.ExecContext(ctx, `UPDATE users SET password = ? WHERE user_id = ?`, passwordHash, userID); err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, `
+			UPDATE password_reset_tokens SET used_at = UTC_TIMESTAMP()
+			WHERE user_id = ? AND used_at IS NULL`, userID); err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx, `
+			UPDATE refresh_tokens SET revoked_at = UTC_TIMESTAMP()
+			WHERE user_id = ? AND revoked_at IS NULL`, userID)
+		return err
+	})
+	return userID, err
+}
+
+func (m mysqlUsers) CreateEmailVerification(ctx context.Context, userID int, email, tokenHash string, expiresAt time.Time) error {
+	_, err := m.db.ExecContext(ctx, `
+		INSERT INTO email_verification_tokens (user_id, email, token_hash, expires_at)
+		VALUES (?, ?, ?, ?)`,
+		userID, email, tokenHash, expiresAt.UTC().Format("2006-01-02 15:04:05"))
+	return err
+}
+
+func (m mysqlUsers) EmailVerificationSentWithin(ctx context.Context, userID int, interval time.Duration) (bool, error) {
+	// Compared in the database because created_at is in the session time zone
+	var sent bool
+	err := m.db.QueryRowContext(ctx, `
+		SELECT EXISTS(
+			SELECT 1 FROM email_verification_tokens
+			WHERE user_id = ? AND created_at > NOW() - INTERVAL ? SECOND
+		)`, userID, int(interval.Seconds())).Scan(&sent)
+	return sent, err
+}
+
+func (m mysqlUsers) VerifyEmail(ctx context.Context, tokenHash string) (int, error) {
+	var userID int
+	err := database.InTx(ctx, m.db, func(tx *sql.Tx) error {
+		// The token only counts for the address it was sent to
+		err := tx.QueryRowContext(ctx, `
+			SELECT t.user_id
+			FROM email_verification_tokens t
+			INNER JOIN users u ON t.user_id = u.user_id AND t.email = u.email
+			WHERE t.token_hash = ? AND t.used_at IS NULL AND t.expires_at > UTC_TIMESTAMP()
+			FOR UPDATE`, tokenHash).Scan(&userID)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				return errVerificationInvalid
+			}
+			return err
+		}
+
+		if _, err := tx.ExecContext(ctx, `
+			UPDATE users SET email_verified_at = UTC_TIMESTAMP()
+			WHERE user_id = ? AND email_verified_at IS NULL`, userID); err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx, `
+			UPDATE email_verification_tokens SET used_at = UTC_TIMESTAMP()
+			WHERE user_id = ? AND used_at IS NULL`, userID)
+		return err
+	})
+	return userID, err
+}
+
+func (m mysqlUsers) CreatePhoneVerification(ctx context.Context, userID int, phone, codeHash string, expiresAt time.Time) error {
+	_, err := m.db.ExecContext(ctx, `
+		INSERT INTO phone_verification_codes (user_id, phone, code_hash, expires_at)
+		VALUES (?, ?, ?, ?)`,
+		userID, phone, codeHash, expiresAt.UTC().Format("2006-01-02 15:04:05"))
+	return err
+}
+
+func (m mysqlUsers) PhoneVerificationSentWithin(ctx context.Context, userID int, interval time.Duration) (bool, error) {
+	var sent bool
+	err := m.db.QueryRowContext(ctx, `
+		SELECT EXISTS(
+			SELECT 1 FROM phone_verification_codes
+			WHERE user_id = ? AND created_at > NOW() - INTERVAL ? SECOND
+		)`, userID, int(interval.Seconds())).Scan(&sent)
+	return sent, err
+}
+
+func (m mysqlUsers) VerifyPhone(ctx context.Context, userID int, codeHash string, maxAttempts int) error {
+	// A wrong guess must still be counted, so it is reported after the transaction commits
+	verified := false
+	err := database.InTx(ctx, m.db, func(tx *sql.Tx) error {
+		var codeID, attempts int
+		var storedHash string
+		err := tx.QueryRowContext(ctx, `
+			SELECT c.code_id, c.code_hash, c.attempts
+			FROM phone_verification_codes c
+			INNER JOIN users u ON c.user_id = u.user_id AND c.phone = u.phone
+			WHERE c.user_id = ? AND c.used_at IS NULL AND c.expires_at > UTC_TIMESTAMP()
+			ORDER BY c.code_id DESC
+			LIMIT 1
+			FOR UPDATE`, userID).Scan(&codeID, &storedHash, &attempts)
+		if err == sql.ErrNoRows || (err == nil && attempts >= maxAttempts) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if storedHash != codeHash {
+			_, err := tx.ExecContext(ctx, `UPDATE phone_verification_codes SET attempts = attempts + 1 WHERE code_id = ?`, codeID)
+			return err
+		}
+
+		if _, err := tx.ExecContext(ctx, `UPDATE users SET phone_verified_at = UTC_TIMESTAMP() WHERE user_id = ?`, userID); err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, `
+			UPDATE phone_verification_codes SET used_at = UTC_TIMESTAMP()
+			WHERE user_id = ? AND used_at IS NULL`, userID); err != nil {
+			return err
+		}
+		verified = true
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if !verified {
+		return errPhoneCodeInvalid
+	}
+	return nil
+}
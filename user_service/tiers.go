@@ -0,0 +1,387 @@
+package userservice
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/yongkaiyu/CNAD_Assg1/internal/auth"
+	"github.com/yongkaiyu/CNAD_Assg1/internal/clients"
+	"github.com/yongkaiyu/CNAD_Assg1/internal/mail"
+)
+
+// The highest ranked tier whose thresholds summary meets, or the lowest tier if none.
+// tiers must be lowest rank first.
+func qualifyingTier(tiers []MembershipBenefits, summary clients.RentalSummary) MembershipBenefits {
+	best := tiers[0]
+	for _, tier := range tiers[1:] {
+		if summary.Rentals >= tier.MinRentals && summary.Spend >= tier.MinSpend {
+			best = tier
+		}
+	}
+	return best
+}
+
+// How the tier period reads in a sentence, e.g. "90 days"
+func describePeriod(period time.Duration) string {
+	if period%(24*time.Hour) == 0 {
+		return fmt.Sprintf("%d days", int(period/(24*time.Hour)))
+	}
+	return period.String()
+}
+
+// Move every user to the tier their rentals over the tier period qualify for, upgrading or
+// downgrading as needed. Returns how many users changed tier.
+func (s *Server) evaluateTiers(ctx context.Context) (int, error) {
+	tiers, err := s.store.Tiers(ctx)
+	if err != nil {
+		return 0, err
+	}
+	if len(tiers) == 0 {
+		return 0, errors.New("there are no membership tiers")
+	}
+
+	summaries, err := s.vehicles.RentalSummaries(ctx, s.cfg.TierPeriod)
+	if err != nil {
+		return 0, fmt.Errorf("fetching rental summaries: %w", err)
+	}
+	byUser := map[int]clients.RentalSummary{}
+	for _, summary := range summaries {
+		byUser[summary.UserID] = summary
+	}
+
+	ranks := map[string]int{}
+	for _, tier := range tiers {
+		ranks[tier.Tier] = tier.Rank
+	}
+
+	users, err := s.store.List(ctx, "")
+	if err != nil {
+		return 0, err
+	}
+
+	changed := 0
+	for _, user := range users {
+		summary := byUser[user.UserID]
+		target := qualifyingTier(tiers, summary)
+		if target.Tier == user.MembershipTier {
+			continue
+		}
+
+		reason := fmt.Sprintf("%d completed rental(s) and $%.2f spent in the last %s",
+			summary.Rentals, summary.Spend, describePeriod(s.cfg.TierPeriod))
+		err := s.store.ChangeTier(ctx, user.UserID, user.MembershipTier, target.Tier, reason)
+		if errors.Is(err, errTierChanged) {
+			// Changed since it was listed, the next run will look again
+			continue
+		}
+		if err != nil {
+			return changed, fmt.Errorf("changing tier of user %d: %w", user.UserID, err)
+		}
+		changed++
+		log.Printf("Moved user %d from %s to %s: %s", user.UserID, user.MembershipTier, target.Tier, reason)
+
+		if err := s.sendTierChange(ctx, user, target, target.Rank > ranks[user.MembershipTier], reason); err != nil {
+			log.Printf("Error emailing user %d about their tier change: %v", user.UserID, err)
+		}
+	}
+	return changed, nil
+}
+
+// Tell the user they have a new tier and what it gives them
+func (s *Server) sendTierChange(ctx context.Context, user User, tier MembershipBenefits, upgraded bool, reason string) error {
+	subject := "Your membership is now " + tier.Tier
+	intro := "Congratulations, you've been upgraded to"
+	if !upgraded {
+		intro = "Your membership has changed to"
+	}
+
+	priority := "no"
+	if tier.PriorityAccess {
+		priority = "yes"
+	}
+	return s.mailer.Send(ctx, mail.Message{
+		To:      user.Email,
+		Subject: subject,
+		Body: fmt.Sprintf("Hi %s,\n\n%s %s, based on %s.\n\nYour benefits:\n"+
+			"- %g%% off every booking\n- Up to %d active bookings\n- Priority access: %s\n",
+			user.Name, intro, tier.Tier, reason, tier.DiscountRate, tier.BookingLimit, priority),
+	})
+}
+
+// Name of the MySQL advisory lock that makes sure only one instance evaluates tiers at a time
+const tierLockName = "electric_car_sharing_tier_evaluation"
+
+// TierScheduler re-evaluates every user's membership tier in the background.
+// It needs MySQL directly for the advisory lock.
+type TierScheduler struct {
+	db     *sql.DB
+	server *Server
+}
+
+func NewTierScheduler(db *sql.DB, server *Server) *TierScheduler {
+	return &TierScheduler{db: db, server: server}
+}
+
+// Run evaluates tiers every interval until ctx is cancelled
+func (t *TierScheduler) Run(ctx context.Context, interval time.Duration) {
+	log.Printf("Starting tier evaluation (every %s)", interval)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		t.runOnce(ctx)
+
+		select {
+		case <-ctx.Done():
+			log.Println("Tier evaluation stopped")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Evaluate tiers once, provided no other instance is already doing so
+func (t *TierScheduler) runOnce(ctx context.Context) {
+	// Advisory locks belong to a connection, so hold one for the whole run
+	conn, err := t.db.Conn(ctx)
+	if err != nil {
+		log.Printf("Tier evaluation: error getting connection: %v", err)
+		return
+	}
+	defer conn.Close()
+
+	var acquired sql.NullInt64
+	if err := conn.QueryRowContext(ctx, `SELECT GET_LOCK(?, 0)`, tierLockName).Scan(&acquired); err != nil {
+		log.Printf("Tier evaluation: error acquiring lock: %v", err)
+		return
+	}
+	if acquired.Int64 != 1 {
+		// Another instance is evaluating
+		return
+	}
+	defer conn.ExecContext(context.Background(), `SELECT RELEASE_LOCK(?)`, tierLockName)
+
+	changed, err := t.server.evaluateTiers(ctx)
+	if err != nil {
+		log.Printf("Tier evaluation failed: %v", err)
+	}
+	if changed > 0 {
+		log.Printf("Tier evaluation: %d user(s) changed tier", changed)
+	}
+}
+
+// The user's tier changes, newest first
+func (s *Server) tierHistoryHandler(w http.ResponseWriter, r *http.Request) {
+	userID := auth.UserID(r)
+
+	changes, err := s.store.TierHistory(r.Context(), userID)
+	if err != nil {
+		log.Printf("Error fetching tier history for user %d: %v", userID, err)
+		http.Error(w, "Error fetching tier history", http.StatusInternalServerError)
+		return
+	}
+	if changes == nil {
+		changes = []TierChange{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(changes)
+}
+
+/* Admin endpoints for managing tiers */
+
+// Tier names are referred to by promotions' comma separated eligible_tiers, so no commas
+var tierNamePattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,20}$`)
+
+// Fields accepted when creating or updating a tier. Omitted fields keep their current value on update.
+type tierInput struct {
+	Tier           *string  `json:"tier"`
+	DiscountRate   *float64 `json:"discount_rate"`
+	PriorityAccess *bool    `json:"priority_access"`
+	BookingLimit   *int     `json:"booking_limit"`
+	Rank           *int     `json:"rank"`
+	MinRentals     *int     `json:"min_rentals"`
+	MinSpend       *float64 `json:"min_spend"`
+}
+
+// Copy the given fields onto tier and check the result. The name can only be set on create.
+func (in tierInput) apply(tier *MembershipBenefits) error {
+	if in.DiscountRate != nil {
+		tier.DiscountRate = *in.DiscountRate
+	}
+	if in.PriorityAccess != nil {
+		tier.PriorityAccess = *in.PriorityAccess
+	}
+	if in.BookingLimit != nil {
+		tier.BookingLimit = *in.BookingLimit
+	}
+	if in.Rank != nil {
+		tier.Rank = *in.Rank
+	}
+	if in.MinRentals != nil {
+		tier.MinRentals = *in.MinRentals
+	}
+	if in.MinSpend != nil {
+		tier.MinSpend = *in.MinSpend
+	}
+
+	switch {
+	case !tierNamePattern.MatchString(tier.Tier):
+		return errors.New("tier must be 1 to 20 letters, digits, dashes or underscores")
+	case tier.DiscountRate < 0 || tier.DiscountRate > 100:
+		return errors.New("discount_rate must be between 0 and 100")
+	case tier.BookingLimit < 1:
+		return errors.New("booking_limit must be at least 1")
+	case tier.Rank < 0:
+		return errors.New("rank can't be negative")
+	case tier.MinRentals < 0 || tier.MinSpend < 0:
+		return errors.New("min_rentals and min_spend can't be negative")
+	}
+	return nil
+}
+
+func writeTier(w http.ResponseWriter, status int, tier *MembershipBenefits) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(tier)
+}
+
+// Every tier, lowest rank first
+func (s *Server) listTiersHandler(w http.ResponseWriter, r *http.Request) {
+	tiers, err := s.store.Tiers(r.Context())
+	if err != nil {
+		log.Printf("Error listing tiers: %v", err)
+		http.Error(w, "Error fetching tiers", http.StatusInternalServerError)
+		return
+	}
+	if tiers == nil {
+		tiers = []MembershipBenefits{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(tiers)
+}
+
+func (s *Server) getTierHandler(w http.ResponseWriter, r *http.Request) {
+	tier, err := s.store.Benefits(r.Context(), mux.Vars(r)["tier"])
+	if err != nil {
+		writeTierError(w, err)
+		return
+	}
+	writeTier(w, http.StatusOK, tier)
+}
+
+func (s *Server) createTierHandler(w http.ResponseWriter, r *http.Request) {
+	var input tierInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil || input.Tier == nil {
+		http.Error(w, "Invalid input, tier is required", http.StatusBadRequest)
+		return
+	}
+
+	tier := MembershipBenefits{Tier: *input.Tier, BookingLimit: 1}
+	if err := input.apply(&tier); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := s.store.CreateTier(r.Context(), tier); err != nil {
+		writeTierError(w, err)
+		return
+	}
+
+	log.Printf("Admin %d created tier %s", auth.UserID(r), tier.Tier)
+	writeTier(w, http.StatusCreated, &tier)
+}
+
+// Changes apply to members right away; thresholds apply at the next evaluation
+func (s *Server) updateTierHandler(w http.ResponseWriter, r *http.Request) {
+	var input tierInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		http.Error(w, "Invalid input", http.StatusBadRequest)
+		return
+	}
+
+	tier, err := s.store.Benefits(r.Context(), mux.Vars(r)["tier"])
+	if err != nil {
+		writeTierError(w, err)
+		return
+	}
+	if input.Tier != nil && *input.Tier != tier.Tier {
+		http.Error(w, "Tiers can't be renamed", http.StatusBadRequest)
+		return
+	}
+	if err := input.apply(tier); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := s.store.UpdateTier(r.Context(), *tier); err != nil {
+		writeTierError(w, err)
+		return
+	}
+
+	log.Printf("Admin %d updated tier %s", auth.UserID(r), tier.Tier)
+	writeTier(w, http.StatusOK, tier)
+}
+
+// Only tiers nobody is on can be deleted, and there must always be one left for new users
+func (s *Server) deleteTierHandler(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["tier"]
+
+	tiers, err := s.store.Tiers(r.Context())
+	if err != nil {
+		writeTierError(w, err)
+		return
+	}
+	if len(tiers) == 1 && tiers[0].Tier == name {
+		http.Error(w, "The last tier can't be deleted", http.StatusConflict)
+		return
+	}
+
+	if err := s.store.DeleteTier(r.Context(), name); err != nil {
+		writeTierError(w, err)
+		return
+	}
+
+	log.Printf("Admin %d deleted tier %s", auth.UserID(r), name)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Run the tier evaluation now instead of waiting for the schedule
+func (s *Server) evaluateTiersHandler(w http.ResponseWriter, r *http.Request) {
+	changed, err := s.evaluateTiers(r.Context())
+	if err != nil {
+		log.Printf("Error evaluating tiers: %v", err)
+		http.Error(w, "Error evaluating tiers", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("Admin %d ran the tier evaluation, %d user(s) changed tier", auth.UserID(r), changed)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]int{"changed": changed})
+}
+
+// Map tier admin errors to HTTP responses
+func writeTierError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, errTierNotFound):
+		http.Error(w, "Membership tier not found", http.StatusNotFound)
+	case errors.Is(err, errTierExists):
+		http.Error(w, "A tier with that name already exists", http.StatusConflict)
+	case errors.Is(err, errTierInUse):
+		http.Error(w, "Users are still on this tier", http.StatusConflict)
+	default:
+		log.Printf("Error updating tier: %v", err)
+		http.Error(w, "Error updating tier", http.StatusInternalServerError)
+	}
+}
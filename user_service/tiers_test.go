@@ -0,0 +1,138 @@
+package userservice
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/yongkaiyu/CNAD_Assg1/internal/auth"
+	"github.com/yongkaiyu/CNAD_Assg1/internal/clients"
+	"github.com/yongkaiyu/CNAD_Assg1/internal/config"
+)
+
+// fakeVehicles reports the given rental summaries, and no bookings
+type fakeVehicles []clients.RentalSummary
+
+func (f fakeVehicles) ListBookings(ctx context.Context, userID int, status string) ([]clients.BookingInfo, error) {
+	return nil, nil
+}
+
+func (f fakeVehicles) RentalSummaries(ctx context.Context, period time.Duration) ([]clients.RentalSummary, error) {
+	return f, nil
+}
+
+func TestQualifyingTier(t *testing.T) {
+	// Premium needs 5 rentals and $150, VIP 15 rentals and $500
+	tiers, err := NewMemoryStore().Tiers(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		rentals int
+		spend   float64
+		want    string
+	}{
+		{0, 0, "Basic"},
+		{5, 149.99, "Basic"},
+		{4, 1000, "Basic"},
+		{5, 150, "Premium"},
+		{14, 10000, "Premium"},
+		{100, 499.99, "Premium"},
+		{15, 500, "VIP"},
+	}
+	for _, tt := range tests {
+		summary := clients.RentalSummary{Rentals: tt.rentals, Spend: tt.spend}
+		if got := qualifyingTier(tiers, summary); got.Tier != tt.want {
+			t.Errorf("%d rental(s) and $%.2f: tier = %s, want %s", tt.rentals, tt.spend, got.Tier, tt.want)
+		}
+	}
+}
+
+func TestEvaluateTiers(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+	users := []struct {
+		name    string
+		tier    string
+		rentals int
+		spend   float64
+		want    string
+	}{
+		{"Alice", "Basic", 5, 150, "Premium"},
+		{"Bob", "VIP", 6, 200, "Premium"},
+		{"Carol", "Premium", 0, 0, "Basic"},
+		{"Dan", "Premium", 10, 300, "Premium"},
+	}
+	var summaries fakeVehicles
+	ids := make([]int, len(users))
+	for i, u := range users {
+		ids[i] = addUser(t, store, User{Name: u.name, Email: strings.ToLower(u.name) + "@example.com", MembershipTier: u.tier})
+		summaries = append(summaries, clients.RentalSummary{UserID: ids[i], Rentals: u.rentals, Spend: u.spend})
+	}
+	mailer := make(chanMailer, 10)
+	cfg := config.Default().Users
+	cfg.TierPeriod = 90 * 24 * time.Hour
+	server := NewServer(store, summaries, nil, mailer, nil, cfg)
+
+	evaluate := func() int {
+		t.Helper()
+		rec := do(t, server, http.MethodPost, "/api/v1/admin/tiers/evaluate", 99, auth.RoleAdmin, nil)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("evaluating: status = %d: %s", rec.Code, rec.Body)
+		}
+		var response struct {
+			Changed int `json:"changed"`
+		}
+		if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+			t.Fatal(err)
+		}
+		return response.Changed
+	}
+
+	if changed := evaluate(); changed != 3 {
+		t.Errorf("%d user(s) changed tier, want 3", changed)
+	}
+	for i, u := range users {
+		user, err := store.Get(ctx, ids[i])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if user.MembershipTier != u.want {
+			t.Errorf("%s is %s, want %s", u.name, user.MembershipTier, u.want)
+		}
+		history, err := store.TierHistory(ctx, ids[i])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if u.tier == u.want {
+			if len(history) != 0 {
+				t.Errorf("%s's tier history = %+v, want none", u.name, history)
+			}
+			continue
+		}
+		if len(history) != 1 || history[0].FromTier != u.tier || history[0].ToTier != u.want ||
+			!strings.Contains(history[0].Reason, "in the last 90 days") {
+			t.Errorf("%s's tier history = %+v, want %s to %s", u.name, history, u.tier, u.want)
+		}
+	}
+
+	// Upgrades and downgrades are told apart in the email
+	emails := map[string]string{}
+	for len(mailer) > 0 {
+		msg := <-mailer
+		emails[msg.To] = msg.Body
+	}
+	if len(emails) != 3 || !strings.Contains(emails["alice@example.com"], "upgraded to Premium") ||
+		!strings.Contains(emails["bob@example.com"], "changed to Premium") {
+		t.Errorf("emails = %v, want an upgrade for Alice and a change for Bob and Carol", emails)
+	}
+
+	// Nobody moves again until their rentals change
+	if changed := evaluate(); changed != 0 {
+		t.Errorf("evaluating again: %d user(s) changed tier, want 0", changed)
+	}
+}
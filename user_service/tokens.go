@@ -0,0 +1,151 @@
+package userservice
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/yongkaiyu/CNAD_Assg1/internal/auth"
+)
+
+const refreshTokenTTL = 7 * 24 * time.Hour
+
+type authResponse struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int    `json:"expires_in"`
+	User         User   `json:"user"`
+}
+
+// Refresh and reset tokens are opaque random strings, only their hash is stored
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// Opaque random token, used for refresh and password reset tokens
+func generateToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// Create and persist a new refresh token for the user
+func (s *Server) issueRefreshToken(ctx context.Context, userID int) (string, error) {
+	token, err := generateToken()
+	if err != nil {
+		return "", err
+	}
+
+	if err := s.store.CreateRefreshToken(ctx, userID, hashToken(token), time.Now().UTC().Add(refreshTokenTTL)); err != nil {
+		return "", err
+	}
+
+	return token, nil
+}
+
+// Issue an access/refresh token pair and write it to the response
+func (s *Server) writeAuthResponse(w http.ResponseWriter, r *http.Request, user User) {
+	// Never send the password hash back
+	user.Password = ""
+
+	accessToken, err := auth.IssueAccessToken(user.UserID, user.Role)
+	if err != nil {
+		log.Printf("Error issuing access token: %v", err)
+		http.Error(w, "Failed to issue token", http.StatusInternalServerError)
+		return
+	}
+
+	refreshToken, err := s.issueRefreshToken(r.Context(), user.UserID)
+	if err != nil {
+		log.Printf("Error issuing refresh token: %v", err)
+		http.Error(w, "Failed to issue token", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(authResponse{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int(auth.AccessTokenTTL.Seconds()),
+		User:         user,
+	})
+}
+
+// Exchange a refresh token for a new token pair. The old refresh token is revoked.
+func (s *Server) refreshTokenHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var input struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil || input.RefreshToken == "" {
+		http.Error(w, "refresh_token is required", http.StatusBadRequest)
+		return
+	}
+
+	tokenHash := hashToken(input.RefreshToken)
+
+	user, err := s.store.UserForRefreshToken(r.Context(), tokenHash)
+	if err != nil {
+		if !errors.Is(err, errUserNotFound) {
+			log.Printf("Error looking up refresh token: %v", err)
+		}
+		http.Error(w, "Invalid refresh token", http.StatusUnauthorized)
+		return
+	}
+
+	// Revoke the token being used. If another request got there first, reject this one.
+	if err := s.store.RevokeRefreshToken(r.Context(), tokenHash, 0); err != nil {
+		if errors.Is(err, errRefreshTokenNotFound) {
+			http.Error(w, "Invalid refresh token", http.StatusUnauthorized)
+			return
+		}
+		log.Printf("Error revoking refresh token: %v", err)
+		http.Error(w, "Failed to refresh token", http.StatusInternalServerError)
+		return
+	}
+
+	s.writeAuthResponse(w, r, *user)
+}
+
+// Revoke the given refresh token
+func (s *Server) logoutHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var input struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil || input.RefreshToken == "" {
+		http.Error(w, "refresh_token is required", http.StatusBadRequest)
+		return
+	}
+
+	// Logging out with an already revoked token is fine
+	err := s.store.RevokeRefreshToken(r.Context(), hashToken(input.RefreshToken), auth.UserID(r))
+	if err != nil && !errors.Is(err, errRefreshTokenNotFound) {
+		log.Printf("Error revoking refresh token: %v", err)
+		http.Error(w, "Failed to log out", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Logged out successfully"})
+}
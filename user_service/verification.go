@@ -0,0 +1,113 @@
+package userservice
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/yongkaiyu/CNAD_Assg1/internal/auth"
+	"github.com/yongkaiyu/CNAD_Assg1/internal/mail"
+)
+
+// Email the user a link that verifies their current address
+func (s *Server) sendEmailVerification(ctx context.Context, user User) error {
+	token, err := generateToken()
+	if err != nil {
+		return err
+	}
+	expiresAt := time.Now().UTC().Add(s.cfg.EmailVerificationTTL)
+	if err := s.store.CreateEmailVerification(ctx, user.UserID, user.Email, hashToken(token), expiresAt); err != nil {
+		return err
+	}
+
+	link := s.cfg.PublicURL + "/static/verify_email/?token=" + url.QueryEscape(token)
+	return s.mailer.Send(ctx, mail.Message{
+		To:      user.Email,
+		Subject: "Verify your email address",
+		Body: fmt.Sprintf("Hi %s,\n\nPlease confirm this is your email address by opening this link within %s:\n\n%s\n\n"+
+			"You can't book vehicles until your email address is verified.\n",
+			user.Name, s.cfg.EmailVerificationTTL, link),
+	})
+}
+
+// Confirm an email address with the token from the verification email
+func (s *Server) verifyEmailHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var input struct {
+		Token string `json:"token"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil || input.Token == "" {
+		http.Error(w, "Token is required", http.StatusBadRequest)
+		return
+	}
+
+	userID, err := s.store.VerifyEmail(r.Context(), hashToken(input.Token))
+	if err != nil {
+		if errors.Is(err, errVerificationInvalid) {
+			http.Error(w, "Invalid or expired verification token", http.StatusBadRequest)
+			return
+		}
+		log.Printf("Error verifying email: %v", err)
+		http.Error(w, "Failed to verify email", http.StatusInternalServerError)
+		return
+	}
+	log.Printf("Email verified for user %d", userID)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Email verified successfully"})
+}
+
+// Send the logged in user a new verification link, at most once per VerificationResendInterval
+func (s *Server) resendVerificationHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	user, err := s.store.Get(r.Context(), auth.UserID(r))
+	if err != nil {
+		if errors.Is(err, errUserNotFound) {
+			http.Error(w, "User not found", http.StatusNotFound)
+			return
+		}
+		log.Printf("Error fetching user %d: %v", auth.UserID(r), err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	if user.EmailVerified {
+		http.Error(w, "Email is already verified", http.StatusConflict)
+		return
+	}
+
+	recent, err := s.store.EmailVerificationSentWithin(r.Context(), user.UserID, s.cfg.VerificationResendInterval)
+	if err != nil {
+		log.Printf("Error checking verification emails for user %d: %v", user.UserID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if recent {
+		w.Header().Set("Retry-After", strconv.Itoa(int(s.cfg.VerificationResendInterval.Seconds())))
+		http.Error(w, "A verification email was sent recently, please wait before asking again", http.StatusTooManyRequests)
+		return
+	}
+
+	if err := s.sendEmailVerification(r.Context(), *user); err != nil {
+		log.Printf("Error sending verification email to user %d: %v", user.UserID, err)
+		http.Error(w, "Failed to send verification email", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Verification email sent"})
+}
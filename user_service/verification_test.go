@@ -0,0 +1,154 @@
+package userservice
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/yongkaiyu/CNAD_Assg1/internal/auth"
+	"github.com/yongkaiyu/CNAD_Assg1/internal/config"
+)
+
+func TestMain(m *testing.M) {
+	auth.Init("test-secret", "test-internal-key")
+	os.Exit(m.Run())
+}
+
+// Send a request as the given user and role, or anonymously for user 0
+func do(t *testing.T, server *Server, method, path string, userID int, role string, body interface{}) *httptest.ResponseRecorder {
+	t.Helper()
+	var buf bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&buf).Encode(body); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	req := httptest.NewRequest(method, path, &buf)
+	if userID != 0 {
+		token, err := auth.IssueAccessToken(userID, role)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rec := httptest.NewRecorder()
+	server.Routes().ServeHTTP(rec, req)
+	return rec
+}
+
+func addUser(t *testing.T, store *MemoryStore, user User) int {
+	t.Helper()
+	userID, err := store.Create(context.Background(), user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return userID
+}
+
+// The token in the link of a verification email
+func verificationToken(t *testing.T, body string) string {
+	t.Helper()
+	start := strings.Index(body, "?token=")
+	if start < 0 {
+		t.Fatalf("no verification link in %q", body)
+	}
+	token, err := url.QueryUnescape(strings.Fields(body[start+len("?token="):])[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+func TestVerifyEmail(t *testing.T) {
+	tests := []struct {
+		name string
+		ttl  time.Duration
+		// Changes the address after the email is sent
+		changeEmail bool
+		want        int
+	}{
+		{name: "valid link", ttl: time.Hour, want: http.StatusOK},
+		{name: "expired link", ttl: -time.Minute, want: http.StatusBadRequest},
+		{name: "address changed since", ttl: time.Hour, changeEmail: true, want: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := NewMemoryStore()
+			userID := addUser(t, store, User{Name: "Alice", Email: "alice@example.com"})
+			mailer := make(chanMailer, 10)
+			cfg := config.Default().Users
+			cfg.EmailVerificationTTL = tt.ttl
+			server := NewServer(store, nil, nil, mailer, nil, cfg)
+
+			if rec := do(t, server, http.MethodPost, "/api/v1/user/verify/resend", userID, auth.RoleCustomer, nil); rec.Code != http.StatusOK {
+				t.Fatalf("sending: status = %d: %s", rec.Code, rec.Body)
+			}
+			msg := <-mailer
+			if msg.To != "alice@example.com" {
+				t.Errorf("email sent to %s, want alice@example.com", msg.To)
+			}
+			if tt.changeEmail {
+				if err := store.UpdateProfile(context.Background(), userID, "Alice", "alice@example.org", "", ""); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			body := map[string]string{"token": verificationToken(t, msg.Body)}
+			if rec := do(t, server, http.MethodPost, "/api/v1/user/verify", 0, "", body); rec.Code != tt.want {
+				t.Fatalf("verifying: status = %d, want %d: %s", rec.Code, tt.want, rec.Body)
+			}
+			user, err := store.Get(context.Background(), userID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if user.EmailVerified != (tt.want == http.StatusOK) {
+				t.Errorf("email verified = %t", user.EmailVerified)
+			}
+
+			// Links work once
+			if tt.want == http.StatusOK {
+				if rec := do(t, server, http.MethodPost, "/api/v1/user/verify", 0, "", body); rec.Code != http.StatusBadRequest {
+					t.Errorf("verifying again: status = %d, want %d", rec.Code, http.StatusBadRequest)
+				}
+			}
+		})
+	}
+}
+
+func TestResendVerificationThrottled(t *testing.T) {
+	store := NewMemoryStore()
+	userID := addUser(t, store, User{Name: "Alice", Email: "alice@example.com"})
+	verified := addUser(t, store, User{Name: "Bob", Email: "bob@example.com", EmailVerified: true})
+	cfg := config.Default().Users
+	cfg.VerificationResendInterval = time.Hour
+	server := NewServer(store, nil, nil, make(chanMailer, 10), nil, cfg)
+
+	tests := []struct {
+		name   string
+		userID int
+		want   int
+	}{
+		{"first email", userID, http.StatusOK},
+		{"again straight away", userID, http.StatusTooManyRequests},
+		{"already verified", verified, http.StatusConflict},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := do(t, server, http.MethodPost, "/api/v1/user/verify/resend", tt.userID, auth.RoleCustomer, nil)
+			if rec.Code != tt.want {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.want, rec.Body)
+			}
+			if tt.want == http.StatusTooManyRequests && rec.Header().Get("Retry-After") != "3600" {
+				t.Errorf("Retry-After = %q, want 3600", rec.Header().Get("Retry-After"))
+			}
+		})
+	}
+}
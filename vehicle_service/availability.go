@@ -0,0 +1,201 @@
+package vehicleservice
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Slot is a period in which a vehicle has no bookings
+type Slot struct {
+	StartTime string `json:"start_time"`
+	EndTime   string `json:"end_time"`
+}
+
+// Filters for the available vehicles search
+type vehicleSearch struct {
+	// Set when the caller gave their position
+	near     bool
+	lat, lng float64
+	// Kilometres from the caller, 0 for no limit
+	radius      float64
+	minCharge   int
+	cleanliness []string
+	// The window the vehicle must be free for, zero for right now
+	start, end time.Time
+	// The day to list free slots for, zero for none
+	day time.Time
+}
+
+// Whether the search is about a future window or day rather than right now
+func (search vehicleSearch) scheduled() bool {
+	return !search.start.IsZero() || !search.day.IsZero()
+}
+
+// Booking times are RFC 3339 or "YYYY-MM-DD HH:MM:SS"
+func parseBookingTime(value string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	return time.Parse(timeLayout, value)
+}
+
+// Read ?lat=&lng=&radius=&min_charge=&cleanliness=&start_time=&end_time=&date= from the query
+func parseVehicleSearch(query url.Values) (vehicleSearch, error) {
+	var search vehicleSearch
+
+	lat, lng, err := parseCoordinates(query.Get("lat"), query.Get("lng"))
+	if err != nil {
+		return search, fmt.Errorf("invalid lat/lng: %w", err)
+	}
+	if lat != nil {
+		search.near, search.lat, search.lng = true, *lat, *lng
+	}
+
+	if radius := query.Get("radius"); radius != "" {
+		search.radius, err = strconv.ParseFloat(radius, 64)
+		switch {
+		case err != nil || search.radius <= 0:
+			return search, errors.New("radius must be a positive number of kilometres")
+		case !search.near:
+			return search, errors.New("radius needs lat and lng")
+		}
+	}
+
+	if minCharge := query.Get("min_charge"); minCharge != "" {
+		search.minCharge, err = strconv.Atoi(minCharge)
+		if err != nil || search.minCharge < 0 || search.minCharge > 100 {
+			return search, errors.New("min_charge must be between 0 and 100")
+		}
+	}
+
+	if cleanliness := query.Get("cleanliness"); cleanliness != "" {
+		for _, value := range strings.Split(cleanliness, ",") {
+			value = strings.TrimSpace(value)
+			if !validCleanliness[value] {
+				return search, fmt.Errorf("cleanliness must be %s, %s or %s", CleanlinessClean, CleanlinessModerate, CleanlinessDirty)
+			}
+			search.cleanliness = append(search.cleanliness, value)
+		}
+	}
+
+	startTime, endTime := query.Get("start_time"), query.Get("end_time")
+	if (startTime == "") != (endTime == "") {
+		return search, errors.New("start_time and end_time must be given together")
+	}
+	if startTime != "" {
+		if search.start, err = parseBookingTime(startTime); err != nil {
+			return search, errors.New("invalid start_time")
+		}
+		if search.end, err = parseBookingTime(endTime); err != nil {
+			return search, errors.New("invalid end_time")
+		}
+		if !search.end.After(search.start) {
+			return search, errors.New("end_time must be after start_time")
+		}
+		// Free slots default to the day the window starts on
+		search.day = time.Date(search.start.Year(), search.start.Month(), search.start.Day(), 0, 0, 0, 0, search.start.Location())
+	}
+
+	if date := query.Get("date"); date != "" {
+		if search.day, err = time.Parse("2006-01-02", date); err != nil {
+			return search, errors.New("date must be YYYY-MM-DD")
+		}
+	}
+	return search, nil
+}
+
+// Vehicles that can be booked for the search window, and every vehicle's free slots on the
+// search day. Vehicles in maintenance are left out, as are those with no free time on the day
+// when there is no window.
+func (s *Server) scheduledVehicles(ctx context.Context, search vehicleSearch, minChargeLevel int) ([]Vehicle, map[int][]Slot, error) {
+	fleet, err := s.store.Vehicles().List(ctx, VehicleFilter{})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// One query covers both the window and the day
+	dayStart, dayEnd := search.day, search.day.AddDate(0, 0, 1)
+	from, to := dayStart, dayEnd
+	if !search.start.IsZero() {
+		from, to = search.start, search.end
+		if !search.day.IsZero() {
+			from, to = minTime(from, dayStart), maxTime(to, dayEnd)
+		}
+	}
+	bookings, err := s.store.Bookings().ListOverlapping(ctx, from, to)
+	if err != nil {
+		return nil, nil, err
+	}
+	byVehicle := map[int][]Booking{}
+	for _, b := range bookings {
+		byVehicle[b.VehicleID] = append(byVehicle[b.VehicleID], b)
+	}
+
+	var vehicles []Vehicle
+	slots := map[int][]Slot{}
+	for _, v := range fleet {
+		if v.Status == StatusMaintenance || v.ChargeLevel < minChargeLevel {
+			continue
+		}
+		if !search.start.IsZero() && overlapsAny(byVehicle[v.VehicleID], search.start, search.end) {
+			continue
+		}
+		if !search.day.IsZero() {
+			slots[v.VehicleID] = freeSlots(byVehicle[v.VehicleID], dayStart, dayEnd, time.Now().UTC().Truncate(time.Minute))
+			if search.start.IsZero() && len(slots[v.VehicleID]) == 0 {
+				continue
+			}
+		}
+		vehicles = append(vehicles, v)
+	}
+	return vehicles, slots, nil
+}
+
+func overlapsAny(bookings []Booking, start, end time.Time) bool {
+	for _, b := range bookings {
+		if b.StartTime.Before(end) && b.EndTime.After(start) {
+			return true
+		}
+	}
+	return false
+}
+
+// The gaps between bookings from dayStart to dayEnd, leaving out anything before notBefore.
+// bookings must be in start time order.
+func freeSlots(bookings []Booking, dayStart, dayEnd, notBefore time.Time) []Slot {
+	slots := []Slot{}
+	add := func(start, end time.Time) {
+		if end.After(start) {
+			slots = append(slots, Slot{StartTime: start.Format(timeLayout), EndTime: end.Format(timeLayout)})
+		}
+	}
+
+	cursor := maxTime(dayStart, notBefore)
+	for _, b := range bookings {
+		if b.StartTime.After(cursor) {
+			add(cursor, minTime(b.StartTime, dayEnd))
+		}
+		cursor = maxTime(cursor, b.EndTime)
+	}
+	add(cursor, dayEnd)
+	return slots
+}
+
+func minTime(a, b time.Time) time.Time {
+	if a.Before(b) {
+		return a
+	}
+	return b
+}
+
+func maxTime(a, b time.Time) time.Time {
+	if a.After(b) {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,119 @@
+package vehicleservice
+
+import (
+	"encoding/json"
+	"net/http"
+	"slices"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestFreeSlots(t *testing.T) {
+	day := time.Date(2030, 1, 10, 0, 0, 0, 0, time.UTC)
+	at := func(hours float64) time.Time { return day.Add(time.Duration(hours * float64(time.Hour))) }
+	booking := func(start, end float64) Booking { return Booking{StartTime: at(start), EndTime: at(end)} }
+	slot := func(start, end float64) Slot {
+		return Slot{StartTime: at(start).Format(timeLayout), EndTime: at(end).Format(timeLayout)}
+	}
+
+	tests := []struct {
+		name      string
+		bookings  []Booking
+		notBefore float64
+		want      []Slot
+	}{
+		{"no bookings", nil, -24, []Slot{slot(0, 24)}},
+		{"a booking in the middle", []Booking{booking(10, 12)}, -24, []Slot{slot(0, 10), slot(12, 24)}},
+		{"from the day before", []Booking{booking(-3, 2)}, -24, []Slot{slot(2, 24)}},
+		{"into the next day", []Booking{booking(22, 26)}, -24, []Slot{slot(0, 22)}},
+		{"back to back", []Booking{booking(10, 11), booking(11, 12)}, -24, []Slot{slot(0, 10), slot(12, 24)}},
+		{"one inside another", []Booking{booking(9, 15), booking(10, 11)}, -24, []Slot{slot(0, 9), slot(15, 24)}},
+		{"the whole day", []Booking{booking(-1, 25)}, -24, []Slot{}},
+		{"nothing before now", []Booking{booking(10, 12)}, 13.5, []Slot{slot(13.5, 24)}},
+		{"now inside a booking", []Booking{booking(10, 12)}, 11, []Slot{slot(12, 24)}},
+		{"the day is over", nil, 30, []Slot{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := freeSlots(tt.bookings, day, day.AddDate(0, 0, 1), at(tt.notBefore))
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("free slots = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestScheduledVehicles(t *testing.T) {
+	ts := newTestServer(t)
+	// A day after tomorrow, so none of it has passed
+	day := time.Now().UTC().AddDate(0, 0, 2).Truncate(24 * time.Hour)
+	at := func(hours int) time.Time { return day.Add(time.Duration(hours) * time.Hour) }
+	busy := ts.store.AddVehicle(Vehicle{LicensePlate: "SBA1237D", ChargeLevel: 100})
+	ts.addBooking(t, 2, busy, at(10), at(12))
+	// Booked all day
+	full := ts.store.AddVehicle(Vehicle{LicensePlate: "SBA1238E", ChargeLevel: 100})
+	ts.addBooking(t, 2, full, at(-1), at(25))
+
+	search := func(query string) map[int][]Slot {
+		t.Helper()
+		rec := ts.do(t, http.MethodGet, "/api/v1/booking/vehicles?"+query, testUserID, nil)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("status = %d: %s", rec.Code, rec.Body)
+		}
+		var vehicles []struct {
+			VehicleID string `json:"vehicle_id"`
+			FreeSlots []Slot `json:"free_slots"`
+		}
+		if err := json.NewDecoder(rec.Body).Decode(&vehicles); err != nil {
+			t.Fatal(err)
+		}
+		slots := map[int][]Slot{}
+		for _, v := range vehicles {
+			id, err := strconv.Atoi(v.VehicleID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			slots[id] = v.FreeSlots
+		}
+		return slots
+	}
+	format := func(hours int) string { return at(hours).Format(timeLayout) }
+
+	// A day lists every vehicle with time free, and when. Maintenance and retired vehicles are left out.
+	slots := search("date=" + day.Format("2006-01-02"))
+	if len(slots) != 2 {
+		t.Errorf("vehicles free on the day = %v, want %d and %d", slots, ts.available, busy)
+	}
+	if want := []Slot{{format(0), format(24)}}; !slices.Equal(slots[ts.available], want) {
+		t.Errorf("free slots of the unbooked vehicle = %v, want %v", slots[ts.available], want)
+	}
+	if want := []Slot{{format(0), format(10)}, {format(12), format(24)}}; !slices.Equal(slots[busy], want) {
+		t.Errorf("free slots of the booked vehicle = %v, want %v", slots[busy], want)
+	}
+
+	// A window leaves out vehicles booked for any of it, but back to back is fine
+	tests := []struct {
+		name       string
+		start, end int
+		wantBusy   bool
+	}{
+		{"overlapping the booking", 11, 13, false},
+		{"ending as the booking starts", 8, 10, true},
+		{"starting as the booking ends", 12, 14, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			slots := search("start_time=" + at(tt.start).Format(time.RFC3339) + "&end_time=" + at(tt.end).Format(time.RFC3339))
+			if _, ok := slots[ts.available]; !ok {
+				t.Errorf("the unbooked vehicle isn't offered")
+			}
+			if _, ok := slots[busy]; ok != tt.wantBusy {
+				t.Errorf("the booked vehicle offered = %t, want %t", ok, tt.wantBusy)
+			}
+			if _, ok := slots[full]; ok {
+				t.Errorf("the vehicle booked all day is offered")
+			}
+		})
+	}
+}
@@ -0,0 +1,67 @@
+package vehicleservice
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+)
+
+// VehicleCommander sends remote commands to a vehicle's in-car unit
+type VehicleCommander interface {
+	// Unlock opens the doors and enables the vehicle for driving
+	Unlock(ctx context.Context, vehicleID int) error
+	// Lock locks the doors and immobilises the vehicle
+	Lock(ctx context.Context, vehicleID int) error
+}
+
+// NewCommander returns the commander named by name
+func NewCommander(name string) (VehicleCommander, error) {
+	switch name {
+	case "fake":
+		return &FakeCommander{}, nil
+	default:
+		return nil, fmt.Errorf("unknown vehicle commander: %s", name)
+	}
+}
+
+// Command is a command the FakeCommander was asked to send
+type Command struct {
+	VehicleID int
+	Action    string
+}
+
+// FakeCommander is for development and tests: it logs each command and keeps it in Sent.
+// Vehicles in Fail get an error instead, as if they couldn't be reached.
+type FakeCommander struct {
+	mu   sync.Mutex
+	sent []Command
+	Fail map[int]bool
+}
+
+func (f *FakeCommander) Unlock(ctx context.Context, vehicleID int) error {
+	return f.send(vehicleID, "unlock")
+}
+
+func (f *FakeCommander) Lock(ctx context.Context, vehicleID int) error {
+	return f.send(vehicleID, "lock")
+}
+
+func (f *FakeCommander) send(vehicleID int, action string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.Fail[vehicleID] {
+		return fmt.Errorf("vehicle %d did not respond to %s", vehicleID, action)
+	}
+	log.Printf("Vehicle %d: %s", vehicleID, action)
+	f.sent = append(f.sent, Command{VehicleID: vehicleID, Action: action})
+	return nil
+}
+
+// Sent returns every command sent so far
+func (f *FakeCommander) Sent() []Command {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]Command(nil), f.sent...)
+}
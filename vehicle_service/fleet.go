@@ -0,0 +1,635 @@
+package vehicleservice
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/yongkaiyu/CNAD_Assg1/internal/auth"
+)
+
+/* Fleet admin endpoints, for fleet operators. Every change needs a reason, which is kept in vehicle_changes. */
+
+const (
+	maxReasonLength = 500
+	maxImportBytes  = 1 << 20
+	maxImportRows   = 1000
+)
+
+// Statuses an operator may move a vehicle to from each status. Vehicles become
+// Booked when they are booked; an operator only sets it when ending maintenance
+// during a booking.
+var statusTransitions = map[string][]string{
+	StatusAvailable:   {StatusMaintenance},
+	StatusBooked:      {StatusAvailable, StatusMaintenance},
+	StatusMaintenance: {StatusAvailable, StatusBooked},
+}
+
+var validCleanliness = map[string]bool{CleanlinessClean: true, CleanlinessModerate: true, CleanlinessDirty: true}
+
+// Fields accepted when creating or updating a vehicle. Omitted fields keep their current
+// value on update, or get the defaults on create.
+type vehicleInput struct {
+	LicensePlate string   `json:"license_plate"`
+	Location     string   `json:"location"`
+	ChargeLevel  *int     `json:"charge_level"`
+	Cleanliness  string   `json:"cleanliness"`
+	VehicleClass string   `json:"vehicle_class"`
+	Latitude     *float64 `json:"latitude"`
+	Longitude    *float64 `json:"longitude"`
+	Status       string   `json:"status"`
+	Reason       string   `json:"reason"`
+}
+
+// Copy the given fields onto vehicle
+func (in vehicleInput) apply(vehicle *Vehicle) {
+	if in.LicensePlate != "" {
+		vehicle.LicensePlate = strings.ToUpper(strings.TrimSpace(in.LicensePlate))
+	}
+	if in.Location != "" {
+		vehicle.Location = strings.TrimSpace(in.Location)
+	}
+	if in.ChargeLevel != nil {
+		vehicle.ChargeLevel = *in.ChargeLevel
+	}
+	if in.Cleanliness != "" {
+		vehicle.Cleanliness = in.Cleanliness
+	}
+	if in.VehicleClass != "" {
+		vehicle.VehicleClass = strings.TrimSpace(in.VehicleClass)
+	}
+	if in.Latitude != nil || in.Longitude != nil {
+		vehicle.Latitude, vehicle.Longitude = in.Latitude, in.Longitude
+	}
+}
+
+// New vehicles are fully charged, clean and Standard class unless told otherwise
+func newVehicle(in vehicleInput) (Vehicle, error) {
+	vehicle := Vehicle{
+		ChargeLevel:  100,
+		Cleanliness:  CleanlinessClean,
+		VehicleClass: "Standard",
+		Status:       StatusAvailable,
+	}
+	in.apply(&vehicle)
+	if in.Status != "" {
+		if in.Status != StatusAvailable && in.Status != StatusMaintenance {
+			return vehicle, fmt.Errorf("new vehicles must be %s or %s", StatusAvailable, StatusMaintenance)
+		}
+		vehicle.Status = in.Status
+	}
+	return vehicle, validateVehicle(vehicle)
+}
+
+func validateVehicle(v Vehicle) error {
+	switch {
+	case v.LicensePlate == "" || len(v.LicensePlate) > 20:
+		return errors.New("license_plate is required and at most 20 characters")
+	case v.Location == "" || len(v.Location) > 255:
+		return errors.New("location is required and at most 255 characters")
+	case v.ChargeLevel < 0 || v.ChargeLevel > 100:
+		return errors.New("charge_level must be between 0 and 100")
+	case !validCleanliness[v.Cleanliness]:
+		return fmt.Errorf("cleanliness must be %s, %s or %s", CleanlinessClean, CleanlinessModerate, CleanlinessDirty)
+	case v.VehicleClass == "" || len(v.VehicleClass) > 50:
+		return errors.New("vehicle_class is required and at most 50 characters")
+	}
+	return validateCoordinates(v.Latitude, v.Longitude)
+}
+
+func validateReason(reason string) (string, error) {
+	reason = strings.TrimSpace(reason)
+	if reason == "" || len(reason) > maxReasonLength {
+		return "", fmt.Errorf("a reason of at most %d characters is required", maxReasonLength)
+	}
+	return reason, nil
+}
+
+// Describe what an update changed, for the audit trail
+func describeChanges(before, after Vehicle) string {
+	var changes []string
+	add := func(field string, from, to interface{}) {
+		if from != to {
+			changes = append(changes, fmt.Sprintf("%s: %v -> %v", field, from, to))
+		}
+	}
+	add("license_plate", before.LicensePlate, after.LicensePlate)
+	add("location", before.Location, after.Location)
+	add("charge_level", before.ChargeLevel, after.ChargeLevel)
+	add("cleanliness", before.Cleanliness, after.Cleanliness)
+	add("vehicle_class", before.VehicleClass, after.VehicleClass)
+	add("coordinates", formatCoordinates(before), formatCoordinates(after))
+	return strings.Join(changes, "; ")
+}
+
+// Map fleet admin errors to HTTP responses
+func writeFleetError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, errVehicleNotFound):
+		http.Error(w, "Vehicle not found", http.StatusNotFound)
+	case errors.Is(err, errLicensePlateTaken):
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		log.Printf("Error updating fleet: %v", err)
+		http.Error(w, "Error updating fleet", http.StatusInternalServerError)
+	}
+}
+
+// List the fleet, optionally by ?status= and with ?include_retired=true
+func (s *Server) listFleetHandler(w http.ResponseWriter, r *http.Request) {
+	filter := VehicleFilter{
+		Status:         r.URL.Query().Get("status"),
+		IncludeRetired: r.URL.Query().Get("include_retired") == "true",
+	}
+	if _, ok := statusTransitions[filter.Status]; filter.Status != "" && !ok {
+		http.Error(w, "Invalid status", http.StatusBadRequest)
+		return
+	}
+
+	vehicles, err := s.store.Vehicles().List(r.Context(), filter)
+	if err != nil {
+		log.Printf("Error listing vehicles: %v", err)
+		http.Error(w, "Error fetching vehicles", http.StatusInternalServerError)
+		return
+	}
+	if vehicles == nil {
+		vehicles = []Vehicle{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(vehicles)
+}
+
+func (s *Server) getFleetVehicleHandler(w http.ResponseWriter, r *http.Request) {
+	vehicleID, _ := strconv.Atoi(mux.Vars(r)["vehicleId"])
+
+	vehicle, err := s.store.Vehicles().Get(r.Context(), vehicleID)
+	if err != nil {
+		writeFleetError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(vehicle)
+}
+
+func (s *Server) createVehicleHandler(w http.ResponseWriter, r *http.Request) {
+	var input vehicleInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		http.Error(w, "Invalid input", http.StatusBadRequest)
+		return
+	}
+	reason, err := validateReason(input.Reason)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	v, err := newVehicle(input)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var vehicle *Vehicle
+	err = s.store.InTx(r.Context(), func(vehicles VehicleStore, bookings BookingStore) error {
+		vehicleID, err := vehicles.Create(r.Context(), v)
+		if err != nil {
+			return err
+		}
+		if err := vehicles.RecordChange(r.Context(), VehicleChange{
+			VehicleID: vehicleID,
+			ChangedBy: auth.UserID(r),
+			Action:    ActionCreate,
+			ToStatus:  v.Status,
+			Reason:    reason,
+		}); err != nil {
+			return err
+		}
+		vehicle, err = vehicles.Get(r.Context(), vehicleID)
+		return err
+	})
+	if err != nil {
+		writeFleetError(w, err)
+		return
+	}
+
+	log.Printf("User %d added vehicle %d (%s)", auth.UserID(r), vehicle.VehicleID, vehicle.LicensePlate)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(vehicle)
+}
+
+// Change a vehicle's details. Status has its own endpoint so transitions are checked.
+func (s *Server) updateVehicleHandler(w http.ResponseWriter, r *http.Request) {
+	vehicleID, _ := strconv.Atoi(mux.Vars(r)["vehicleId"])
+
+	var input vehicleInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		http.Error(w, "Invalid input", http.StatusBadRequest)
+		return
+	}
+	reason, err := validateReason(input.Reason)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var vehicle *Vehicle
+	var invalid error
+	err = s.store.InTx(r.Context(), func(vehicles VehicleStore, bookings BookingStore) error {
+		current, err := vehicles.Lock(r.Context(), vehicleID)
+		if err != nil {
+			return err
+		}
+		switch {
+		case current.RetiredAt != nil:
+			invalid = errors.New("retired vehicles can't be changed")
+			return invalid
+		case input.Status != "" && input.Status != current.Status:
+			invalid = errors.New("change the status with POST /api/v1/admin/vehicles/{id}/status")
+			return invalid
+		}
+
+		updated := *current
+		input.apply(&updated)
+		if invalid = validateVehicle(updated); invalid != nil {
+			return invalid
+		}
+		details := describeChanges(*current, updated)
+		if details == "" {
+			vehicle = current
+			return nil
+		}
+
+		if err := vehicles.Update(r.Context(), updated); err != nil {
+			return err
+		}
+		if s.chargedUp(*current, updated) {
+			if err := vehicles.Release(r.Context(), vehicleID); err != nil {
+				return err
+			}
+		}
+		if err := vehicles.RecordChange(r.Context(), VehicleChange{
+			VehicleID: vehicleID,
+			ChangedBy: auth.UserID(r),
+			Action:    ActionUpdate,
+			Details:   details,
+			Reason:    reason,
+		}); err != nil {
+			return err
+		}
+		vehicle, err = vehicles.Get(r.Context(), vehicleID)
+		return err
+	})
+	if invalid != nil {
+		http.Error(w, invalid.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		writeFleetError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(vehicle)
+}
+
+// Move a vehicle between Available, Booked and Maintenance
+func (s *Server) changeVehicleStatusHandler(w http.ResponseWriter, r *http.Request) {
+	vehicleID, _ := strconv.Atoi(mux.Vars(r)["vehicleId"])
+
+	var input struct {
+		Status string `json:"status"`
+		Reason string `json:"reason"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		http.Error(w, "Invalid input", http.StatusBadRequest)
+		return
+	}
+	reason, err := validateReason(input.Reason)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if _, ok := statusTransitions[input.Status]; !ok {
+		http.Error(w, "status must be Available, Booked or Maintenance", http.StatusBadRequest)
+		return
+	}
+
+	var response struct {
+		Vehicle *Vehicle `json:"vehicle"`
+		// Bookings still to run on a vehicle sent to maintenance, which the operator has to sort out
+		AffectedBookings []int `json:"affected_bookings,omitempty"`
+	}
+	var conflict error
+	err = s.store.InTx(r.Context(), func(vehicles VehicleStore, bookings BookingStore) error {
+		current, err := vehicles.Lock(r.Context(), vehicleID)
+		if err != nil {
+			return err
+		}
+		if current.RetiredAt != nil {
+			conflict = errors.New("retired vehicles can't be changed")
+			return conflict
+		}
+
+		allowed := false
+		for _, status := range statusTransitions[current.Status] {
+			allowed = allowed || status == input.Status
+		}
+		if !allowed {
+			conflict = fmt.Errorf("a vehicle can't go from %s to %s", current.Status, input.Status)
+			return conflict
+		}
+
+		active, err := bookings.ActiveForVehicle(r.Context(), vehicleID)
+		if err != nil {
+			return err
+		}
+		inProgress := len(active) > 0 && !active[0].StartTime.After(time.Now())
+		switch {
+		case input.Status == StatusAvailable && inProgress:
+			conflict = fmt.Errorf("booking %d is in progress on this vehicle", active[0].BookingID)
+			return conflict
+		case input.Status == StatusBooked && len(active) == 0:
+			conflict = errors.New("the vehicle has no active bookings")
+			return conflict
+		case input.Status == StatusMaintenance:
+			for _, b := range active {
+				response.AffectedBookings = append(response.AffectedBookings, b.BookingID)
+			}
+		}
+
+		if err := vehicles.ChangeStatus(r.Context(), vehicleID, input.Status); err != nil {
+			return err
+		}
+		// Back from maintenance counts as a release, for priority access
+		if current.Status == StatusMaintenance && input.Status == StatusAvailable {
+			if err := vehicles.Release(r.Context(), vehicleID); err != nil {
+				return err
+			}
+		}
+		if err := vehicles.RecordChange(r.Context(), VehicleChange{
+			VehicleID:  vehicleID,
+			ChangedBy:  auth.UserID(r),
+			Action:     ActionStatus,
+			FromStatus: current.Status,
+			ToStatus:   input.Status,
+			Reason:     reason,
+		}); err != nil {
+			return err
+		}
+		response.Vehicle, err = vehicles.Get(r.Context(), vehicleID)
+		return err
+	})
+	if conflict != nil {
+		http.Error(w, conflict.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		writeFleetError(w, err)
+		return
+	}
+
+	log.Printf("User %d moved vehicle %d to %s: %s", auth.UserID(r), vehicleID, input.Status, reason)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// Take a vehicle out of the fleet. It must not have bookings still to run.
+func (s *Server) retireVehicleHandler(w http.ResponseWriter, r *http.Request) {
+	vehicleID, _ := strconv.Atoi(mux.Vars(r)["vehicleId"])
+
+	var input struct {
+		Reason string `json:"reason"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		http.Error(w, "Invalid input", http.StatusBadRequest)
+		return
+	}
+	reason, err := validateReason(input.Reason)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var conflict error
+	err = s.store.InTx(r.Context(), func(vehicles VehicleStore, bookings BookingStore) error {
+		current, err := vehicles.Lock(r.Context(), vehicleID)
+		if err != nil {
+			return err
+		}
+		if current.RetiredAt != nil {
+			conflict = errors.New("the vehicle is already retired")
+			return conflict
+		}
+
+		active, err := bookings.ActiveForVehicle(r.Context(), vehicleID)
+		if err != nil {
+			return err
+		}
+		if len(active) > 0 {
+			conflict = fmt.Errorf("the vehicle has %d active booking(s), cancel or move them first", len(active))
+			return conflict
+		}
+
+		if err := vehicles.Retire(r.Context(), vehicleID); err != nil {
+			return err
+		}
+		return vehicles.RecordChange(r.Context(), VehicleChange{
+			VehicleID:  vehicleID,
+			ChangedBy:  auth.UserID(r),
+			Action:     ActionRetire,
+			FromStatus: current.Status,
+			Reason:     reason,
+		})
+	})
+	if conflict != nil {
+		http.Error(w, conflict.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		writeFleetError(w, err)
+		return
+	}
+
+	log.Printf("User %d retired vehicle %d: %s", auth.UserID(r), vehicleID, reason)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Vehicle retired"})
+}
+
+// The vehicle's audit trail, newest first
+func (s *Server) vehicleChangesHandler(w http.ResponseWriter, r *http.Request) {
+	vehicleID, _ := strconv.Atoi(mux.Vars(r)["vehicleId"])
+
+	if _, err := s.store.Vehicles().Get(r.Context(), vehicleID); err != nil {
+		writeFleetError(w, err)
+		return
+	}
+	changes, err := s.store.Vehicles().Changes(r.Context(), vehicleID)
+	if err != nil {
+		log.Printf("Error fetching changes of vehicle %d: %v", vehicleID, err)
+		http.Error(w, "Error fetching vehicle history", http.StatusInternalServerError)
+		return
+	}
+	if changes == nil {
+		changes = []VehicleChange{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(changes)
+}
+
+type importError struct {
+	Line  int    `json:"line"`
+	Error string `json:"error"`
+}
+
+// Add vehicles from a CSV body with a header row. license_plate and location are required;
+// charge_level, cleanliness, vehicle_class, status, latitude and longitude are optional columns. The reason comes
+// from ?reason=. Either every row is imported or none is.
+func (s *Server) importVehiclesHandler(w http.ResponseWriter, r *http.Request) {
+	reason, err := validateReason(r.URL.Query().Get("reason"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	reader := csv.NewReader(http.MaxBytesReader(w, r.Body, maxImportBytes))
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		http.Error(w, "The CSV needs a header row", http.StatusBadRequest)
+		return
+	}
+	columns := map[string]int{}
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	for _, required := range []string{"license_plate", "location"} {
+		if _, ok := columns[required]; !ok {
+			http.Error(w, "The CSV is missing the "+required+" column", http.StatusBadRequest)
+			return
+		}
+	}
+	field := func(record []string, name string) string {
+		if i, ok := columns[name]; ok && i < len(record) {
+			return strings.TrimSpace(record[i])
+		}
+		return ""
+	}
+
+	// Check every row before importing any
+	var rows []Vehicle
+	var lines []int
+	var problems []importError
+	plates := map[string]int{}
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Invalid CSV: %v", err), http.StatusBadRequest)
+			return
+		}
+		line, _ := reader.FieldPos(0)
+		if len(rows)+len(problems) >= maxImportRows {
+			http.Error(w, fmt.Sprintf("At most %d vehicles can be imported at once", maxImportRows), http.StatusBadRequest)
+			return
+		}
+
+		input := vehicleInput{
+			LicensePlate: field(record, "license_plate"),
+			Location:     field(record, "location"),
+			Cleanliness:  field(record, "cleanliness"),
+			VehicleClass: field(record, "vehicle_class"),
+			Status:       field(record, "status"),
+		}
+		if charge := field(record, "charge_level"); charge != "" {
+			n, err := strconv.Atoi(charge)
+			if err != nil {
+				problems = append(problems, importError{line, "charge_level must be a number"})
+				continue
+			}
+			input.ChargeLevel = &n
+		}
+		if input.Latitude, input.Longitude, err = parseCoordinates(field(record, "latitude"), field(record, "longitude")); err != nil {
+			problems = append(problems, importError{line, err.Error()})
+			continue
+		}
+
+		vehicle, err := newVehicle(input)
+		if err != nil {
+			problems = append(problems, importError{line, err.Error()})
+			continue
+		}
+		if first, ok := plates[vehicle.LicensePlate]; ok {
+			problems = append(problems, importError{line, fmt.Sprintf("license plate repeats line %d", first)})
+			continue
+		}
+		plates[vehicle.LicensePlate] = line
+		rows = append(rows, vehicle)
+		lines = append(lines, line)
+	}
+	if len(rows) == 0 && len(problems) == 0 {
+		http.Error(w, "The CSV has no vehicles", http.StatusBadRequest)
+		return
+	}
+
+	var vehicleIDs []int
+	if len(problems) == 0 {
+		err = s.store.InTx(r.Context(), func(vehicles VehicleStore, bookings BookingStore) error {
+			for i, vehicle := range rows {
+				vehicleID, err := vehicles.Create(r.Context(), vehicle)
+				if errors.Is(err, errLicensePlateTaken) {
+					problems = append(problems, importError{lines[i], err.Error()})
+					continue
+				}
+				if err != nil {
+					return err
+				}
+				if err := vehicles.RecordChange(r.Context(), VehicleChange{
+					VehicleID: vehicleID,
+					ChangedBy: auth.UserID(r),
+					Action:    ActionCreate,
+					ToStatus:  vehicle.Status,
+					Details:   "CSV import",
+					Reason:    reason,
+				}); err != nil {
+					return err
+				}
+				vehicleIDs = append(vehicleIDs, vehicleID)
+			}
+			if len(problems) > 0 {
+				return errLicensePlateTaken
+			}
+			return nil
+		})
+		if err != nil && len(problems) == 0 {
+			log.Printf("Error importing vehicles: %v", err)
+			http.Error(w, "Error importing vehicles", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if len(problems) > 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]interface{}{"imported": 0, "errors": problems})
+		return
+	}
+
+	log.Printf("User %d imported %d vehicle(s)", auth.UserID(r), len(vehicleIDs))
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{"imported": len(vehicleIDs), "vehicle_ids": vehicleIDs})
+}
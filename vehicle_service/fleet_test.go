@@ -0,0 +1,181 @@
+package vehicleservice
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"testing"
+
+	"github.com/yongkaiyu/CNAD_Assg1/internal/auth"
+)
+
+const operatorID = 2
+
+func TestChangeVehicleStatus(t *testing.T) {
+	tests := []struct {
+		name    string
+		vehicle func(ts *testServer) int
+		status  string
+		reason  string
+		want    int
+	}{
+		{"available to maintenance", func(ts *testServer) int { return ts.available }, StatusMaintenance, "Flat tyre", http.StatusOK},
+		{"maintenance to available", func(ts *testServer) int { return ts.maintenance }, StatusAvailable, "Tyre replaced", http.StatusOK},
+		{"available to booked", func(ts *testServer) int { return ts.available }, StatusBooked, "Booked by phone", http.StatusConflict},
+		{"maintenance to booked without bookings", func(ts *testServer) int { return ts.maintenance }, StatusBooked, "Tyre replaced", http.StatusConflict},
+		{"maintenance to booked for an upcoming booking", func(ts *testServer) int {
+			ts.addBooking(t, testUserID, ts.maintenance, inHours(1), inHours(2))
+			return ts.maintenance
+		}, StatusBooked, "Tyre replaced", http.StatusOK},
+		{"booked to available during a booking", func(ts *testServer) int {
+			ts.addBooking(t, testUserID, ts.available, inHours(-1), inHours(1))
+			if err := ts.store.Vehicles().ChangeStatus(context.Background(), ts.available, StatusBooked); err != nil {
+				t.Fatal(err)
+			}
+			return ts.available
+		}, StatusAvailable, "Returned early", http.StatusConflict},
+		{"retired vehicle", func(ts *testServer) int { return ts.retired }, StatusMaintenance, "Flat tyre", http.StatusConflict},
+		{"unknown status", func(ts *testServer) int { return ts.available }, "Broken", "Flat tyre", http.StatusBadRequest},
+		{"no reason", func(ts *testServer) int { return ts.available }, StatusMaintenance, " ", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts := newTestServer(t)
+			vehicleID := tt.vehicle(ts)
+			before, err := ts.store.Vehicles().Get(context.Background(), vehicleID)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			path := "/api/v1/admin/vehicles/" + strconv.Itoa(vehicleID) + "/status"
+			rec := ts.doAs(t, http.MethodPost, path, operatorID, auth.RoleFleetOperator, map[string]string{"status": tt.status, "reason": tt.reason})
+			if rec.Code != tt.want {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.want, rec.Body)
+			}
+
+			vehicle, err := ts.store.Vehicles().Get(context.Background(), vehicleID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			changes, err := ts.store.Vehicles().Changes(context.Background(), vehicleID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.want != http.StatusOK {
+				if vehicle.Status != before.Status || len(changes) != 0 {
+					t.Errorf("vehicle went to %s with %d change(s) recorded, want it left %s", vehicle.Status, len(changes), before.Status)
+				}
+				return
+			}
+			if vehicle.Status != tt.status {
+				t.Errorf("vehicle status = %s, want %s", vehicle.Status, tt.status)
+			}
+			if len(changes) != 1 || changes[0].FromStatus != before.Status || changes[0].ToStatus != tt.status ||
+				changes[0].ChangedBy != operatorID || changes[0].Reason != tt.reason {
+				t.Errorf("changes = %+v, want one from %s to %s", changes, before.Status, tt.status)
+			}
+		})
+	}
+}
+
+func TestFleetRoutesRequireOperator(t *testing.T) {
+	ts := newTestServer(t)
+	path := "/api/v1/admin/vehicles/" + strconv.Itoa(ts.available) + "/status"
+	body := map[string]string{"status": StatusMaintenance, "reason": "Flat tyre"}
+
+	if rec := ts.doAs(t, http.MethodPost, path, testUserID, auth.RoleCustomer, body); rec.Code != http.StatusForbidden {
+		t.Errorf("as a customer: status = %d, want %d", rec.Code, http.StatusForbidden)
+	}
+	if rec := ts.doAs(t, http.MethodPost, path, operatorID, auth.RoleAdmin, body); rec.Code != http.StatusOK {
+		t.Errorf("as an admin: status = %d, want %d", rec.Code, http.StatusOK)
+	}
+}
+
+func TestImportVehicles(t *testing.T) {
+	tests := []struct {
+		name string
+		csv  string
+		want int
+		// Lines reported as errors, when the import is rejected row by row
+		wantLines []int
+		wantAdded int
+	}{
+		{
+			name:      "valid rows",
+			csv:       "license_plate,location,charge_level,status\nsbc100a,Tampines,80,\nSBC101B,Jurong,,Maintenance\n",
+			want:      http.StatusCreated,
+			wantAdded: 2,
+		},
+		{
+			name:      "bad rows",
+			csv:       "license_plate,location,charge_level,cleanliness,status\nSBC100A,Tampines,full,,\nSBC101B,,50,,\nSBC102C,Jurong,50,Muddy,\nSBC103D,Jurong,50,,Booked\nSBC104E,Jurong,50,,\n",
+			want:      http.StatusBadRequest,
+			wantLines: []int{2, 3, 4, 5},
+		},
+		{
+			name:      "plate repeated in the file",
+			csv:       "license_plate,location\nSBC100A,Tampines\nsbc100a,Jurong\n",
+			want:      http.StatusBadRequest,
+			wantLines: []int{3},
+		},
+		{
+			name:      "plate already in the fleet",
+			csv:       "license_plate,location\nSBC100A,Tampines\nSBA1234A,Jurong\n",
+			want:      http.StatusBadRequest,
+			wantLines: []int{3},
+		},
+		{
+			name:      "coordinates out of range",
+			csv:       "license_plate,location,latitude,longitude\nSBC100A,Tampines,91,103.9\n",
+			want:      http.StatusBadRequest,
+			wantLines: []int{2},
+		},
+		{name: "missing location column", csv: "license_plate\nSBC100A\n", want: http.StatusBadRequest},
+		{name: "header only", csv: "license_plate,location\n", want: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts := newTestServer(t)
+			before, err := ts.store.Vehicles().List(context.Background(), VehicleFilter{IncludeRetired: true})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			rec := ts.doAs(t, http.MethodPost, "/api/v1/admin/vehicles/import?reason=New+depot", operatorID, auth.RoleFleetOperator, tt.csv)
+			if rec.Code != tt.want {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.want, rec.Body)
+			}
+			if tt.wantLines != nil {
+				var response struct {
+					Errors []importError `json:"errors"`
+				}
+				if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+					t.Fatal(err)
+				}
+				var lines []int
+				for _, problem := range response.Errors {
+					lines = append(lines, problem.Line)
+				}
+				if len(lines) != len(tt.wantLines) {
+					t.Fatalf("errors = %+v, want lines %v", response.Errors, tt.wantLines)
+				}
+				for i := range lines {
+					if lines[i] != tt.wantLines[i] {
+						t.Errorf("errors = %+v, want lines %v", response.Errors, tt.wantLines)
+						break
+					}
+				}
+			}
+
+			// Either every row is imported or none is
+			after, err := ts.store.Vehicles().List(context.Background(), VehicleFilter{IncludeRetired: true})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if added := len(after) - len(before); added != tt.wantAdded {
+				t.Errorf("%d vehicle(s) added, want %d", added, tt.wantAdded)
+			}
+		})
+	}
+}
@@ -0,0 +1,70 @@
+package vehicleservice
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+)
+
+const (
+	earthRadiusKm = 6371.0
+	// Average walking pace, and how much longer a walk on streets is than the straight line
+	walkingSpeedKmh = 5.0
+	walkingDetour   = 1.3
+)
+
+// Coordinates must be given together and be on the map
+func validateCoordinates(latitude, longitude *float64) error {
+	switch {
+	case (latitude == nil) != (longitude == nil):
+		return errors.New("latitude and longitude must be given together")
+	case latitude == nil:
+		return nil
+	case *latitude < -90 || *latitude > 90:
+		return errors.New("latitude must be between -90 and 90")
+	case *longitude < -180 || *longitude > 180:
+		return errors.New("longitude must be between -180 and 180")
+	}
+	return nil
+}
+
+// Parse coordinates from text, such as CSV fields. Both empty means none.
+func parseCoordinates(latitude, longitude string) (*float64, *float64, error) {
+	if latitude == "" && longitude == "" {
+		return nil, nil, nil
+	}
+	lat, err := strconv.ParseFloat(latitude, 64)
+	if err != nil {
+		return nil, nil, errors.New("latitude must be a number")
+	}
+	lng, err := strconv.ParseFloat(longitude, 64)
+	if err != nil {
+		return nil, nil, errors.New("longitude must be a number")
+	}
+	return &lat, &lng, validateCoordinates(&lat, &lng)
+}
+
+// How a vehicle's coordinates read in the audit trail
+func formatCoordinates(v Vehicle) string {
+	if v.Latitude == nil || v.Longitude == nil {
+		return "none"
+	}
+	return fmt.Sprintf("%.6f,%.6f", *v.Latitude, *v.Longitude)
+}
+
+// Great circle distance between two points, in kilometres
+func distanceKm(lat1, lng1, lat2, lng2 float64) float64 {
+	toRadians := func(degrees float64) float64 { return degrees * math.Pi / 180 }
+	dLat := toRadians(lat2 - lat1)
+	dLng := toRadians(lng2 - lng1)
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(toRadians(lat1))*math.Cos(toRadians(lat2))*math.Sin(dLng/2)*math.Sin(dLng/2)
+	return 2 * earthRadiusKm * math.Asin(math.Sqrt(a))
+}
+
+// Rough walking time for a straight line distance, in whole minutes
+func walkingMinutes(km float64) int {
+	minutes := int(math.Ceil(km * walkingDetour / walkingSpeedKmh * 60))
+	return max(minutes, 1)
+}
@@ -0,0 +1,96 @@
+package vehicleservice
+
+import (
+	"math"
+	"net/http"
+	"slices"
+	"testing"
+)
+
+func TestDistanceKm(t *testing.T) {
+	tests := []struct {
+		name                   string
+		lat1, lng1, lat2, lng2 float64
+		want                   float64
+	}{
+		{"same point", 1.3, 103.8, 1.3, 103.8, 0},
+		{"a degree of latitude", 0, 103.8, 1, 103.8, 111.19},
+		{"a degree of longitude at the equator", 0, 103, 0, 104, 111.19},
+		{"across the date line", 0, 179.5, 0, -179.5, 111.19},
+		{"Singapore to Kuala Lumpur", 1.3521, 103.8198, 3.1390, 101.6869, 309.2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := distanceKm(tt.lat1, tt.lng1, tt.lat2, tt.lng2); math.Abs(got-tt.want) > 0.5 {
+				t.Errorf("distance = %.2f km, want %.2f km", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWalkingMinutes(t *testing.T) {
+	tests := []struct {
+		km   float64
+		want int
+	}{
+		{0, 1},
+		{0.05, 1},
+		{1, 16},
+		{5, 78},
+	}
+	for _, tt := range tests {
+		if got := walkingMinutes(tt.km); got != tt.want {
+			t.Errorf("walkingMinutes(%g) = %d, want %d", tt.km, got, tt.want)
+		}
+	}
+}
+
+func TestNearestVehicles(t *testing.T) {
+	ts := newTestServer(t)
+	located := func(plate string, lat float64, cleanliness string, charge int) int {
+		lng := 103.8
+		return ts.store.AddVehicle(Vehicle{LicensePlate: plate, Latitude: &lat, Longitude: &lng, Cleanliness: cleanliness, ChargeLevel: charge})
+	}
+	// About 0.6, 1.7 and 4.5 km north of 1.3,103.8. ts.available has no coordinates.
+	near := located("SBA2001A", 1.305, CleanlinessClean, 90)
+	mid := located("SBA2002B", 1.315, CleanlinessDirty, 100)
+	far := located("SBA2003C", 1.340, CleanlinessClean, 60)
+
+	tests := []struct {
+		name  string
+		query string
+		want  []int
+	}{
+		{"without a position", "", []int{ts.available, near, mid, far}},
+		{"nearest first, unlocated last", "lat=1.3&lng=103.8", []int{near, mid, far, ts.available}},
+		{"from the other end", "lat=1.35&lng=103.8", []int{far, mid, near, ts.available}},
+		{"within a radius", "lat=1.3&lng=103.8&radius=2", []int{near, mid}},
+		{"clean only", "lat=1.3&lng=103.8&cleanliness=Clean", []int{near, far}},
+		{"clean or dirty within a radius", "lat=1.3&lng=103.8&radius=5&cleanliness=Clean,Dirty", []int{near, mid, far}},
+		{"enough charge", "lat=1.3&lng=103.8&min_charge=80", []int{near, mid, ts.available}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ts.vehicleIDs(t, testUserID, tt.query); !slices.Equal(got, tt.want) {
+				t.Errorf("vehicles = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNearestVehiclesInvalidSearch(t *testing.T) {
+	ts := newTestServer(t)
+	for _, query := range []string{
+		"radius=2",
+		"lat=1.3",
+		"lat=91&lng=103.8",
+		"lat=1.3&lng=103.8&radius=-1",
+		"min_charge=101",
+		"cleanliness=Spotless",
+	} {
+		rec := ts.do(t, http.MethodGet, "/api/v1/booking/vehicles?"+query, testUserID, nil)
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("?%s: status = %d, want %d", query, rec.Code, http.StatusBadRequest)
+		}
+	}
+}
@@ -0,0 +1,700 @@
+package vehicleservice
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/yongkaiyu/CNAD_Assg1/internal/auth"
+	"github.com/yongkaiyu/CNAD_Assg1/internal/clients"
+)
+
+var errBookingLimitExceeded = errors.New("booking limit exceeded")
+
+// Vehicles the caller can book. Those released within the priority window are only
+// listed for tiers with priority access. ?min_charge= and ?cleanliness= (comma separated)
+// narrow the list. Given ?lat=&lng= the nearest come first, with their distance and walking
+// time, and ?radius= in kilometres leaves out those further away.
+//
+// By default the list is what can be booked right now. Given ?start_time=&end_time= it is
+// what is free for that window instead, and each vehicle comes with its free slots on the
+// day the window starts, or on ?date=YYYY-MM-DD.
+func (s *Server) availableVehiclesHandler(w http.ResponseWriter, r *http.Request) {
+	search, err := parseVehicleSearch(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	minChargeLevel := max(s.cfg.MinChargeLevel, search.minCharge)
+	var available []Vehicle
+	var slots map[int][]Slot
+	if search.scheduled() {
+		available, slots, err = s.scheduledVehicles(r.Context(), search, minChargeLevel)
+	} else {
+		available, err = s.store.Vehicles().ListAvailable(r.Context(), minChargeLevel)
+	}
+	if err != nil {
+		log.Printf("Error fetching vehicles: %v", err)
+		http.Error(w, "Error fetching vehicles", http.StatusInternalServerError)
+		return
+	}
+	priority := s.hasPriorityAccess(r, auth.UserID(r))
+
+	// Distance from the caller of each vehicle with coordinates
+	distances := map[int]float64{}
+	var matching []Vehicle
+	for _, v := range available {
+		if len(search.cleanliness) > 0 && !slices.Contains(search.cleanliness, v.Cleanliness) {
+			continue
+		}
+		if search.near && v.Latitude != nil && v.Longitude != nil {
+			distances[v.VehicleID] = distanceKm(search.lat, search.lng, *v.Latitude, *v.Longitude)
+		}
+		if distance, located := distances[v.VehicleID]; search.radius > 0 && (!located || distance > search.radius) {
+			continue
+		}
+		matching = append(matching, v)
+	}
+	// Vehicles without coordinates go last
+	if search.near {
+		sort.SliceStable(matching, func(i, j int) bool {
+			di, iLocated := distances[matching[i].VehicleID]
+			dj, jLocated := distances[matching[j].VehicleID]
+			if iLocated != jLocated {
+				return iLocated
+			}
+			return di < dj
+		})
+	}
+
+	var vehicles []map[string]interface{}
+	for _, v := range matching {
+		earlyAccessUntil := s.earlyAccessUntil(v)
+		if !earlyAccessUntil.IsZero() && !priority {
+			continue
+		}
+
+		formattedCreatedAt := v.CreatedAt.Format(timeLayout)
+		formattedUpdatedAt := v.UpdatedAt.Format(timeLayout)
+
+		// Log the vehicle details
+		log.Printf("Vehicle ID: %d, License Plate: %s, Location: %s, Charge Level: %d, Status: %s, Cleanliness: %s, Created At: %s, Updated At: %s",
+			v.VehicleID, v.LicensePlate, v.Location, v.ChargeLevel, v.Status, v.Cleanliness, formattedCreatedAt, formattedUpdatedAt)
+
+		vehicle := map[string]interface{}{
+			"vehicle_id":    strconv.Itoa(v.VehicleID),
+			"license_plate": v.LicensePlate,
+			"location":      v.Location,
+			"charge_level":  v.ChargeLevel,
+			"status":        v.Status,
+			"cleanliness":   v.Cleanliness,
+			"created_at":    formattedCreatedAt,
+			"updated_at":    formattedUpdatedAt,
+		}
+		if !earlyAccessUntil.IsZero() {
+			vehicle["early_access_until"] = earlyAccessUntil.Format(time.RFC3339)
+		}
+		if v.Latitude != nil && v.Longitude != nil {
+			vehicle["latitude"], vehicle["longitude"] = *v.Latitude, *v.Longitude
+		}
+		if distance, ok := distances[v.VehicleID]; ok {
+			vehicle["distance_km"] = math.Round(distance*100) / 100
+			vehicle["walking_minutes"] = walkingMinutes(distance)
+		}
+		if free, ok := slots[v.VehicleID]; ok {
+			vehicle["free_slots"] = free
+		}
+
+		vehicles = append(vehicles, vehicle)
+	}
+
+	if len(vehicles) == 0 {
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode([]map[string]interface{}{})
+		return
+	}
+
+	// Set content-type to application/json
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(vehicles)
+}
+
+func (s *Server) getBookedVehiclesHandler(w http.ResponseWriter, r *http.Request) {
+	userIDInt := auth.UserID(r)
+
+	// Expired bookings are completed by the background scheduler
+
+	bookedVehicles, err := s.store.Bookings().ListBookedVehicles(r.Context(), userIDInt)
+	if err != nil {
+		log.Printf("Error fetching booked vehicles for user %d: %v", userIDInt, err)
+		http.Error(w, "Error fetching booked vehicles", http.StatusInternalServerError)
+		return
+	}
+
+	// Convert results to JSON and send the response
+	w.Header().Set("Content-Type", "application/json")
+
+	// Check if booked vehicles is empty
+	if len(bookedVehicles) == 0 {
+		response := map[string]string{
+			"message": "No booked vehicles found",
+		}
+		if err := json.NewEncoder(w).Encode(response); err != nil {
+			http.Error(w, "Error encoding response", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	if err := json.NewEncoder(w).Encode(bookedVehicles); err != nil {
+		http.Error(w, "Error encoding response", http.StatusInternalServerError)
+	}
+}
+
+// Map booking errors to HTTP responses
+func writeBookingError(w http.ResponseWriter, err error) {
+	var serviceErr *clients.Error
+	var earlyAccessErr *earlyAccessError
+	switch {
+	case errors.Is(err, errVehicleNotFound):
+		http.Error(w, "Vehicle not found", http.StatusNotFound)
+	case errors.Is(err, errVehicleUnavailable), errors.Is(err, errBookingConflict):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case errors.As(err, &earlyAccessErr):
+		http.Error(w, err.Error(), http.StatusForbidden)
+	case errors.Is(err, errBookingLimitExceeded):
+		http.Error(w, "Booking limit exceeded. Upgrade your membership to increase the limit.", http.StatusForbidden)
+	case errors.As(err, &serviceErr):
+		log.Printf("Error from billing service: %v", err)
+		writeBillingError(w, err)
+	default:
+		log.Printf("Error booking vehicle: %v", err)
+		http.Error(w, "Error booking vehicle", http.StatusInternalServerError)
+	}
+}
+
+// Pass on client errors from the billing service, anything else is a bad gateway
+func writeBillingError(w http.ResponseWriter, err error) {
+	var serviceErr *clients.Error
+	if errors.As(err, &serviceErr) && serviceErr.StatusCode >= 400 && serviceErr.StatusCode < 500 {
+		http.Error(w, serviceErr.Message, serviceErr.StatusCode)
+		return
+	}
+	http.Error(w, "Error updating billing entry", http.StatusBadGateway)
+}
+
+// Cancel a new booking that couldn't be billed and free its vehicle, then remove any bill
+// that was created after all. The booking keeps BillPending until the bill is gone, so the
+// scheduler finishes the job if the billing service can't be reached.
+func cancelUnbilledBooking(ctx context.Context, store Store, billing Billing, booking Booking) error {
+	err := store.InTx(ctx, func(vehicles VehicleStore, bookings BookingStore) error {
+		// One the scheduler already moved on has given up its vehicle
+		err := bookings.SetStatus(ctx, booking.BookingID, StatusCancelled)
+		if errors.Is(err, errBookingNotActive) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		return vehicles.SetStatus(ctx, booking.VehicleID, StatusAvailable)
+	})
+	if err != nil {
+		return err
+	}
+	if err := billing.DeleteBill(ctx, booking.BookingID); err != nil {
+		return err
+	}
+	return store.Bookings().SetBilled(ctx, booking.BookingID, 0)
+}
+
+// Price the bill of a booking whose change was rolled back after the bill was repriced for
+// its window again
+func (s *Server) restoreBill(booking Booking) {
+	_, err := s.billing.UpdateBill(context.Background(), clients.BillRequest{
+		BookingID: booking.BookingID,
+		UserID:    booking.UserID,
+		VehicleID: booking.VehicleID,
+		StartTime: booking.StartTime,
+		EndTime:   booking.EndTime,
+	})
+	if err != nil {
+		log.Printf("Error restoring bill for rolled back change to booking %d: %v", booking.BookingID, err)
+	}
+}
+
+func (s *Server) vehicleBookingHandler(w http.ResponseWriter, r *http.Request) {
+	userId := auth.UserID(r)
+
+	var booking Booking
+
+	// Log raw request body for debugging
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		log.Printf("Error reading request body: %v", err)
+		http.Error(w, "Invalid input", http.StatusBadRequest)
+		return
+	}
+	log.Printf("Raw request body: %s", string(body))
+
+	// Decode the JSON request into booking
+	if err := json.Unmarshal(body, &booking); err != nil {
+		log.Printf("Error decoding JSON: %v", err)
+		http.Error(w, "Invalid input", http.StatusBadRequest)
+		return
+	}
+
+	// Log the decoded booking for debugging
+	log.Printf("Decoded booking: %+v", booking)
+
+	// An optional promo code, passed on to the billing service
+	var extras struct {
+		PromoCode string `json:"promo_code"`
+	}
+	json.Unmarshal(body, &extras)
+
+	if !booking.EndTime.After(booking.StartTime) {
+		http.Error(w, "End time must be after start time", http.StatusBadRequest)
+		return
+	}
+
+	// Only users who have verified their email may book
+	user, err := s.users.GetUser(r.Context(), userId)
+	if err != nil {
+		if clients.IsNotFound(err) {
+			http.Error(w, "User not found", http.StatusNotFound)
+			return
+		}
+		log.Printf("Error fetching user: %v", err)
+		http.Error(w, "Error fetching user", http.StatusInternalServerError)
+		return
+	}
+	if !user.EmailVerified {
+		http.Error(w, "Verify your email address before booking", http.StatusForbidden)
+		return
+	}
+
+	// Fetch the booking limit for the user's membership tier
+	membership, err := s.users.GetMembership(r.Context(), userId)
+	if err != nil {
+		if clients.IsNotFound(err) {
+			log.Printf("User not found: %v", userId)
+			http.Error(w, "User not found", http.StatusNotFound)
+			return
+		}
+		log.Printf("Error fetching membership: %v", err)
+		http.Error(w, "Error fetching membership benefits", http.StatusInternalServerError)
+		return
+	}
+
+	// Log the decoded booking
+	log.Printf("Received booking: %+v", booking)
+
+	billRequest := clients.BillRequest{
+		UserID:    userId,
+		VehicleID: booking.VehicleID,
+		StartTime: booking.StartTime,
+		EndTime:   booking.EndTime,
+		PromoCode: extras.PromoCode,
+	}
+	// Priced up front so a bad promo code is turned away before anything is booked, and the
+	// billing service is never called with the vehicle locked
+	if _, err := s.billing.Quote(r.Context(), billRequest); err != nil {
+		writeBookingError(w, err)
+		return
+	}
+
+	// The booking runs in one transaction so a failure leaves no partial booking
+	var bookingID int
+	err = s.store.InTx(r.Context(), func(vehicles VehicleStore, bookings BookingStore) error {
+		// Count the number of existing bookings for the user, locking them so
+		// concurrent requests from the same user can't both pass the limit check
+		existingBookings, err := bookings.CountActive(r.Context(), userId)
+		if err != nil {
+			return fmt.Errorf("counting user bookings: %w", err)
+		}
+
+		// The limit is how many active bookings a user may hold, this one included
+		if existingBookings >= membership.BookingLimit {
+			return errBookingLimitExceeded
+		}
+
+		// Reject the booking if the vehicle is taken for any part of the requested window
+		if err := vehicles.LockForWindow(r.Context(), booking.VehicleID, booking.StartTime, booking.EndTime, 0); err != nil {
+			return err
+		}
+
+		// Just released vehicles are for priority tiers only at first
+		vehicle, err := vehicles.Get(r.Context(), booking.VehicleID)
+		if err != nil {
+			return err
+		}
+		if until := s.earlyAccessUntil(*vehicle); !until.IsZero() && !membership.PriorityAccess {
+			return &earlyAccessError{until}
+		}
+
+		// Pending its bill until the billing service has it
+		bookingID, err = bookings.Create(r.Context(), Booking{
+			UserID:      userId,
+			VehicleID:   booking.VehicleID,
+			StartTime:   booking.StartTime,
+			EndTime:     booking.EndTime,
+			BillPending: true,
+		})
+		if err != nil {
+			return fmt.Errorf("inserting booking: %w", err)
+		}
+
+		if err := vehicles.SetStatus(r.Context(), booking.VehicleID, StatusBooked); err != nil {
+			return fmt.Errorf("updating vehicle status: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		writeBookingError(w, err)
+		return
+	}
+
+	// Billed once the booking is saved. A booking that can't be billed is cancelled again.
+	billRequest.BookingID = bookingID
+	bill, err := s.billing.CreateBill(r.Context(), billRequest)
+	if err == nil {
+		err = s.store.Bookings().SetBilled(r.Context(), bookingID, bill.Bill.Cost())
+	}
+	if err != nil {
+		unbilled := Booking{BookingID: bookingID, VehicleID: booking.VehicleID}
+		if cancelErr := cancelUnbilledBooking(context.Background(), s.store, s.billing, unbilled); cancelErr != nil {
+			log.Printf("Error cancelling unbilled booking %d, the scheduler will retry: %v", bookingID, cancelErr)
+		}
+		writeBookingError(w, err)
+		return
+	}
+
+	// The user has what they were waiting for
+	if err := s.store.Waitlist().Leave(r.Context(), booking.VehicleID, userId); err != nil && !errors.Is(err, errNotOnWaitlist) {
+		log.Printf("Error removing user %d from the waitlist for vehicle %d: %v", userId, booking.VehicleID, err)
+	}
+
+	s.notifyAsync(userId, "Booking confirmed", fmt.Sprintf("Your booking %d for vehicle %d from %s to %s is confirmed.",
+		bookingID, booking.VehicleID, booking.StartTime.Format(timeLayout), booking.EndTime.Format(timeLayout)))
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{"message": "Vehicle booked successfully", "booking_id": bookingID, "quote": bill.Quote})
+}
+
+func (s *Server) modifyBookingHandler(w http.ResponseWriter, r *http.Request) {
+	userId := auth.UserID(r)
+
+	vars := mux.Vars(r) // Extract path variables
+	bookingID := vars["bookingId"]
+
+	if bookingID == "" {
+		http.Error(w, "Booking ID is required", http.StatusBadRequest)
+		return
+	}
+
+	bookingIDInt, err := strconv.Atoi(bookingID)
+	if err != nil {
+		http.Error(w, "Invalid booking ID format", http.StatusBadRequest)
+		return
+	}
+
+	// Parse and decode the request body
+	var input struct {
+		StartTime string `json:"startTime"`
+		EndTime   string `json:"endTime"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		http.Error(w, "Invalid input", http.StatusBadRequest)
+		log.Printf("Error decoding input: %v", err)
+		return
+	}
+
+	// Fetch current booking details
+	current, err := s.store.Bookings().Get(r.Context(), bookingIDInt)
+	if err == nil && current.UserID != userId {
+		err = errBookingNotFound
+	}
+	if err != nil {
+		if err == errBookingNotFound {
+			http.Error(w, "Booking not found or unauthorized", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Error fetching current booking details", http.StatusInternalServerError)
+		log.Printf("Error fetching booking details: %v", err)
+		return
+	}
+
+	// Once the vehicle is picked up the trip can only be ended
+	if current.Status != StatusActive || current.PickedUpAt != nil {
+		http.Error(w, "Only active bookings that haven't been picked up can be modified", http.StatusConflict)
+		return
+	}
+
+	startTime := current.StartTime
+	endTime := current.EndTime
+	currentStartTime := startTime.Format(timeLayout)
+	currentEndTime := endTime.Format(timeLayout)
+
+	log.Printf("Current values - Start Time: %s, End Time: %s", currentStartTime, currentEndTime)
+
+	// Check if values are the same
+	if input.StartTime == currentStartTime && input.EndTime == currentEndTime {
+		http.Error(w, "No changes detected in booking details", http.StatusBadRequest)
+		return
+	}
+
+	log.Printf("Updating booking - Booking ID: %s, User ID: %d, Start Time: %s, End Time: %s",
+		bookingID, userId, input.StartTime, input.EndTime)
+
+	// Get the current time
+	currentTime := time.Now()
+
+	var newStartTime, newEndTime time.Time
+
+	// If the current time is before start time, allow modification of both start_time and end_time
+	if currentTime.Before(startTime) {
+		log.Println("Allowing modifications to start time and end time before the booking start time")
+
+		newStartTime, err = time.Parse(timeLayout, input.StartTime)
+		if err != nil {
+			http.Error(w, "Invalid start time format", http.StatusBadRequest)
+			log.Printf("Error parsing new start time: %v", err)
+			return
+		}
+
+		newEndTime, err = time.Parse(timeLayout, input.EndTime)
+		if err != nil {
+			http.Error(w, "Invalid end time format", http.StatusBadRequest)
+			log.Printf("Error parsing new end time: %v", err)
+			return
+		}
+
+		// Ensure the new end time is after the new start time
+		if newEndTime.Before(newStartTime) {
+			http.Error(w, "End time must be after start time", http.StatusBadRequest)
+			return
+		}
+	} else if currentTime.Before(endTime) {
+		// If current time is within the booking period, only allow modifications to end_time
+		log.Println("Allowing modifications to end time during the booking period")
+
+		// Ensure new end time is valid (after current time and start time)
+		newStartTime = startTime
+		newEndTime, err = time.Parse(timeLayout, input.EndTime)
+		if err != nil {
+			http.Error(w, "Invalid end time format", http.StatusBadRequest)
+			log.Printf("Error parsing new end time: %v", err)
+			return
+		}
+
+		if newEndTime.Before(currentTime) || newEndTime.Before(startTime) {
+			http.Error(w, "End time must be after the current time and start time", http.StatusBadRequest)
+			return
+		}
+	} else {
+		http.Error(w, "Modifications are not allowed outside the booking period", http.StatusBadRequest)
+		log.Printf("Modification attempt outside booking period: bookingID=%s, userID=%d", bookingID, userId)
+		return
+	}
+
+	// Apply the change in a transaction so the booking and billing stay in step
+	var repriced bool
+	err = s.store.InTx(r.Context(), func(vehicles VehicleStore, bookings BookingStore) error {
+		// Make sure the new window doesn't overlap another booking of the vehicle
+		if err := vehicles.LockForWindow(r.Context(), current.VehicleID, newStartTime, newEndTime, bookingIDInt); err != nil {
+			return err
+		}
+
+		if err := bookings.UpdateWindow(r.Context(), bookingIDInt, userId, newStartTime, newEndTime); err != nil {
+			return err
+		}
+
+		// Reprice the booking; the billing service updates the bill
+		bill, err := s.billing.UpdateBill(r.Context(), clients.BillRequest{
+			BookingID: bookingIDInt,
+			UserID:    userId,
+			VehicleID: current.VehicleID,
+			StartTime: newStartTime,
+			EndTime:   newEndTime,
+		})
+		if err != nil {
+			return err
+		}
+		repriced = true
+
+		return bookings.SetTotalCost(r.Context(), bookingIDInt, bill.Bill.Cost())
+	})
+	if err != nil {
+		// The bill lives in another service, so it isn't rolled back with the booking
+		if repriced {
+			s.restoreBill(*current)
+		}
+		if errors.Is(err, errBookingNotActive) {
+			http.Error(w, "Only active bookings that haven't been picked up can be modified", http.StatusConflict)
+			return
+		}
+		if err == errBookingNotFound {
+			http.Error(w, "No changes made to the booking. Check input values.", http.StatusBadRequest)
+			log.Printf("No rows updated for booking_id: %s, user_id: %d", bookingID, userId)
+			return
+		}
+		writeBookingError(w, err)
+		return
+	}
+
+	// Send response
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{"message": "Booking modified successfully"})
+}
+
+func (s *Server) cancelBookingHandler(w http.ResponseWriter, r *http.Request) {
+	userId := auth.UserID(r)
+	vars := mux.Vars(r) // Extract path variables
+	bookingID := vars["bookingId"]
+
+	log.Printf("userID is %d", userId)
+
+	if bookingID == "" {
+		http.Error(w, "Booking ID is required", http.StatusBadRequest)
+		return
+	}
+
+	bookingIDInt, err := strconv.Atoi(bookingID)
+	if err != nil {
+		http.Error(w, "Invalid booking ID format", http.StatusBadRequest)
+		return
+	}
+
+	// Check if the booking is already within its start and end date
+	booking, err := s.store.Bookings().Get(r.Context(), bookingIDInt)
+	if err == nil && booking.UserID != userId {
+		err = errBookingNotFound
+	}
+	if err != nil {
+		if err == errBookingNotFound {
+			http.Error(w, "Booking not found or unauthorized", http.StatusNotFound)
+			log.Printf("Booking not found: %v", err)
+			return
+		}
+		http.Error(w, "Error fetching booking details", http.StatusInternalServerError)
+		log.Printf("Error fetching booking details: %v", err)
+		return
+	}
+
+	if booking.Status != StatusActive {
+		http.Error(w, "This booking is no longer active", http.StatusConflict)
+		return
+	}
+
+	// Once the booking has started it can only be ended, not cancelled
+	if booking.PickedUpAt != nil || !time.Now().Before(booking.StartTime) {
+		http.Error(w, "Booking cannot be canceled as it is currently active", http.StatusBadRequest)
+		log.Printf("Attempted to cancel an active booking: bookingID=%s, userID=%d", bookingID, userId)
+		return
+	}
+
+	// Cancel atomically so the booking, vehicle and billing never disagree
+	var refund *clients.CancelResult
+	err = s.store.InTx(r.Context(), func(vehicles VehicleStore, bookings BookingStore) error {
+		// First, and only while still active, so a concurrent cancel waits and then stops here
+		// rather than cancelling the bill again
+		if err := bookings.SetStatus(r.Context(), bookingIDInt, StatusCancelled); err != nil {
+			return err
+		}
+
+		if err := vehicles.SetStatus(r.Context(), booking.VehicleID, StatusAvailable); err != nil {
+			return err
+		}
+
+		// The billing service refunds the bill as the user's cancellation policy allows.
+		// Done last so a failed refund rolls the cancellation back.
+		var err error
+		refund, err = s.billing.CancelBill(r.Context(), bookingIDInt, clients.CancelRequest{StartTime: booking.StartTime})
+		if err != nil {
+			log.Printf("Error cancelling bill for booking %s: %v", bookingID, err)
+			return err
+		}
+		return nil
+	})
+	if err != nil {
+		var serviceErr *clients.Error
+		if errors.As(err, &serviceErr) {
+			writeBillingError(w, err)
+			return
+		}
+		if errors.Is(err, errBookingNotActive) {
+			http.Error(w, "This booking is no longer active", http.StatusConflict)
+			return
+		}
+		http.Error(w, "Error canceling booking", http.StatusInternalServerError)
+		log.Printf("Error cancelling booking %s: %v", bookingID, err)
+		return
+	}
+
+	message := fmt.Sprintf("Your booking %d starting %s has been cancelled. You are refunded $%.2f (%g%%).",
+		bookingIDInt, booking.StartTime.Format(timeLayout), refund.RefundAmount, refund.RefundPercentage)
+	if refund.AmountDue > 0 {
+		message += fmt.Sprintf(" $%.2f is still due.", refund.AmountDue)
+	}
+	s.notifyAsync(userId, "Booking cancelled", message)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message":           "Booking cancelled successfully",
+		"refund_percentage": refund.RefundPercentage,
+		"refund_amount":     refund.RefundAmount,
+		"amount_due":        refund.AmountDue,
+	})
+}
+
+func (s *Server) updateVehicleStatusHandler(w http.ResponseWriter, r *http.Request) {
+	var vehicle Vehicle
+	if err := json.NewDecoder(r.Body).Decode(&vehicle); err != nil {
+		http.Error(w, "Invalid input", http.StatusBadRequest)
+		return
+	}
+	if err := validateCoordinates(vehicle.Latitude, vehicle.Longitude); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err := s.store.InTx(r.Context(), func(vehicles VehicleStore, bookings BookingStore) error {
+		current, err := vehicles.Lock(r.Context(), vehicle.VehicleID)
+		if err != nil {
+			return err
+		}
+		if err := vehicles.UpdateCondition(r.Context(), vehicle); err != nil {
+			return err
+		}
+		if s.chargedUp(*current, vehicle) {
+			return vehicles.Release(r.Context(), vehicle.VehicleID)
+		}
+		return nil
+	})
+	if errors.Is(err, errVehicleNotFound) {
+		http.Error(w, "Vehicle not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("Error updating vehicle %d: %v", vehicle.VehicleID, err)
+		http.Error(w, "Error updating vehicle status", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{"message": "Vehicle status updated successfully"})
+}
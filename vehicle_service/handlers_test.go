@@ -0,0 +1,570 @@
+package vehicleservice
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"slices"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/yongkaiyu/CNAD_Assg1/internal/auth"
+	"github.com/yongkaiyu/CNAD_Assg1/internal/clients"
+	"github.com/yongkaiyu/CNAD_Assg1/internal/config"
+)
+
+func TestMain(m *testing.M) {
+	auth.Init("test-secret", "test-internal-key")
+	os.Exit(m.Run())
+}
+
+// fakeUsers gives every user the same membership, with priority access for the users in
+// priority, and a verified email unless unverified
+type fakeUsers struct {
+	bookingLimit int
+	priority     []int
+	unverified   bool
+}
+
+func (f fakeUsers) GetUser(ctx context.Context, userID int) (*clients.UserInfo, error) {
+	return &clients.UserInfo{UserID: userID, EmailVerified: !f.unverified}, nil
+}
+
+func (f fakeUsers) GetMembership(ctx context.Context, userID int) (*clients.Membership, error) {
+	return &clients.Membership{UserID: userID, Tier: "Basic", BookingLimit: f.bookingLimit, PriorityAccess: slices.Contains(f.priority, userID)}, nil
+}
+
+// fakeBilling prices every booking at 10 and records the bills it cancels and deletes
+type fakeBilling struct {
+	mu        sync.Mutex
+	cancelled []int
+	deleted   []int
+	createErr error
+	cancelErr error
+	updateErr error
+	deleteErr error
+}
+
+func (f *fakeBilling) Quote(ctx context.Context, req clients.BillRequest) (json.RawMessage, error) {
+	return json.RawMessage(`{"total": 10}`), nil
+}
+
+func (f *fakeBilling) CreateBill(ctx context.Context, req clients.BillRequest) (*clients.BillResponse, error) {
+	if f.createErr != nil {
+		return nil, f.createErr
+	}
+	return &clients.BillResponse{Bill: clients.BillInfo{BookingID: req.BookingID, UserID: req.UserID, TotalAmount: 10}}, nil
+}
+
+func (f *fakeBilling) UpdateBill(ctx context.Context, req clients.BillRequest) (*clients.BillResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.updateErr != nil {
+		return nil, f.updateErr
+	}
+	return f.CreateBill(ctx, req)
+}
+
+func (f *fakeBilling) CancelBill(ctx context.Context, bookingID int, req clients.CancelRequest) (*clients.CancelResult, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.cancelErr != nil {
+		return nil, f.cancelErr
+	}
+	f.cancelled = append(f.cancelled, bookingID)
+	return &clients.CancelResult{RefundPercentage: 100, RefundAmount: 10}, nil
+}
+
+func (f *fakeBilling) DeleteBill(ctx context.Context, bookingID int) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.deleteErr != nil {
+		return f.deleteErr
+	}
+	f.deleted = append(f.deleted, bookingID)
+	return nil
+}
+
+type nopNotifier struct{}
+
+func (nopNotifier) Notify(ctx context.Context, userID int, subject, message string) error {
+	return nil
+}
+
+const testUserID = 1
+
+type testServer struct {
+	*Server
+	store   *MemoryStore
+	billing *fakeBilling
+	// Vehicles added by newTestServer
+	available, maintenance, retired int
+}
+
+func newTestServer(t *testing.T) *testServer {
+	t.Helper()
+	store := NewMemoryStore()
+	billing := &fakeBilling{}
+	retiredAt := time.Now().UTC().Add(-time.Hour)
+	ts := &testServer{
+		Server:      NewServer(store, fakeUsers{bookingLimit: 1}, billing, nopNotifier{}, &FakeCommander{}, config.Vehicles{}),
+		store:       store,
+		billing:     billing,
+		available:   store.AddVehicle(Vehicle{LicensePlate: "SBA1234A", ChargeLevel: 100}),
+		maintenance: store.AddVehicle(Vehicle{LicensePlate: "SBA1235B", ChargeLevel: 100, Status: StatusMaintenance}),
+		retired:     store.AddVehicle(Vehicle{LicensePlate: "SBA1236C", ChargeLevel: 100, RetiredAt: &retiredAt}),
+	}
+	return ts
+}
+
+// Store a booking directly, bypassing the handlers
+func (ts *testServer) addBooking(t *testing.T, userID, vehicleID int, start, end time.Time) int {
+	t.Helper()
+	bookingID, err := ts.store.Bookings().Create(context.Background(), Booking{
+		UserID: userID, VehicleID: vehicleID, StartTime: start, EndTime: end,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return bookingID
+}
+
+func (ts *testServer) booking(t *testing.T, bookingID int) *Booking {
+	t.Helper()
+	booking, err := ts.store.Bookings().Get(context.Background(), bookingID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return booking
+}
+
+// Send a request as the given customer
+func (ts *testServer) do(t *testing.T, method, path string, userID int, body interface{}) *httptest.ResponseRecorder {
+	t.Helper()
+	return ts.doAs(t, method, path, userID, auth.RoleCustomer, body)
+}
+
+// Send a request as the given user and role. A string body is sent as it is, anything else as JSON.
+func (ts *testServer) doAs(t *testing.T, method, path string, userID int, role string, body interface{}) *httptest.ResponseRecorder {
+	t.Helper()
+	var buf bytes.Buffer
+	if raw, ok := body.(string); ok {
+		buf.WriteString(raw)
+	} else if body != nil {
+		if err := json.NewEncoder(&buf).Encode(body); err != nil {
+			t.Fatal(err)
+		}
+	}
+	token, err := auth.IssueAccessToken(userID, role)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest(method, path, &buf)
+	req.Header.Set("Authorization", "Bearer "+token)
+	rec := httptest.NewRecorder()
+	ts.Routes().ServeHTTP(rec, req)
+	return rec
+}
+
+// The IDs of the vehicles the user is offered for the search query, in the order listed
+func (ts *testServer) vehicleIDs(t *testing.T, userID int, query string) []int {
+	t.Helper()
+	rec := ts.do(t, http.MethodGet, "/api/v1/booking/vehicles?"+query, userID, nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("listing vehicles: status = %d: %s", rec.Code, rec.Body)
+	}
+	var vehicles []struct {
+		VehicleID string `json:"vehicle_id"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&vehicles); err != nil {
+		t.Fatal(err)
+	}
+	ids := []int{}
+	for _, v := range vehicles {
+		id, err := strconv.Atoi(v.VehicleID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// A time in the future, to the second as bookings are stored
+func inHours(hours float64) time.Time {
+	return time.Now().UTC().Add(time.Duration(hours * float64(time.Hour))).Truncate(time.Second)
+}
+
+func TestBookVehicle(t *testing.T) {
+	tests := []struct {
+		name    string
+		setup   func(t *testing.T, ts *testServer)
+		vehicle func(ts *testServer) int
+		start   time.Time
+		end     time.Time
+		want    int
+	}{
+		{
+			name:    "available",
+			vehicle: func(ts *testServer) int { return ts.available },
+			start:   inHours(2), end: inHours(4),
+			want: http.StatusCreated,
+		},
+		{
+			name: "overlapping booking",
+			setup: func(t *testing.T, ts *testServer) {
+				ts.addBooking(t, 2, ts.available, inHours(3), inHours(5))
+			},
+			vehicle: func(ts *testServer) int { return ts.available },
+			start:   inHours(2), end: inHours(4),
+			want: http.StatusConflict,
+		},
+		{
+			name: "booking inside another",
+			setup: func(t *testing.T, ts *testServer) {
+				ts.addBooking(t, 2, ts.available, inHours(1), inHours(6))
+			},
+			vehicle: func(ts *testServer) int { return ts.available },
+			start:   inHours(2), end: inHours(4),
+			want: http.StatusConflict,
+		},
+		{
+			name: "back to back with another booking",
+			setup: func(t *testing.T, ts *testServer) {
+				ts.addBooking(t, 2, ts.available, inHours(4), inHours(6))
+			},
+			vehicle: func(ts *testServer) int { return ts.available },
+			start:   inHours(2), end: inHours(4),
+			want: http.StatusCreated,
+		},
+		{
+			name: "overlapping a cancelled booking",
+			setup: func(t *testing.T, ts *testServer) {
+				bookingID := ts.addBooking(t, 2, ts.available, inHours(3), inHours(5))
+				ts.store.Bookings().SetStatus(context.Background(), bookingID, StatusCancelled)
+			},
+			vehicle: func(ts *testServer) int { return ts.available },
+			start:   inHours(2), end: inHours(4),
+			want: http.StatusCreated,
+		},
+		{
+			name: "booking limit reached",
+			setup: func(t *testing.T, ts *testServer) {
+				other := ts.store.AddVehicle(Vehicle{LicensePlate: "SBA1237D", ChargeLevel: 100})
+				ts.addBooking(t, testUserID, other, inHours(2), inHours(4))
+			},
+			vehicle: func(ts *testServer) int { return ts.available },
+			start:   inHours(2), end: inHours(4),
+			want: http.StatusForbidden,
+		},
+		{
+			name: "limit only counts active bookings",
+			setup: func(t *testing.T, ts *testServer) {
+				other := ts.store.AddVehicle(Vehicle{LicensePlate: "SBA1237D", ChargeLevel: 100})
+				bookingID := ts.addBooking(t, testUserID, other, inHours(2), inHours(4))
+				ts.store.Bookings().SetStatus(context.Background(), bookingID, StatusCompleted)
+			},
+			vehicle: func(ts *testServer) int { return ts.available },
+			start:   inHours(2), end: inHours(4),
+			want: http.StatusCreated,
+		},
+		{
+			name:    "vehicle in maintenance",
+			vehicle: func(ts *testServer) int { return ts.maintenance },
+			start:   inHours(2), end: inHours(4),
+			want: http.StatusConflict,
+		},
+		{
+			name:    "retired vehicle",
+			vehicle: func(ts *testServer) int { return ts.retired },
+			start:   inHours(2), end: inHours(4),
+			want: http.StatusConflict,
+		},
+		{
+			name:    "unknown vehicle",
+			vehicle: func(ts *testServer) int { return 99 },
+			start:   inHours(2), end: inHours(4),
+			want: http.StatusNotFound,
+		},
+		{
+			name:    "end before start",
+			vehicle: func(ts *testServer) int { return ts.available },
+			start:   inHours(4), end: inHours(2),
+			want: http.StatusBadRequest,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts := newTestServer(t)
+			if tt.setup != nil {
+				tt.setup(t, ts)
+			}
+			before, _ := ts.store.Bookings().CountActive(context.Background(), testUserID)
+
+			rec := ts.do(t, http.MethodPost, "/api/v1/booking/booking", testUserID, map[string]interface{}{
+				"vehicle_id": tt.vehicle(ts), "start_time": tt.start, "end_time": tt.end,
+			})
+			if rec.Code != tt.want {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.want, rec.Body)
+			}
+
+			after, _ := ts.store.Bookings().CountActive(context.Background(), testUserID)
+			if created := after - before; (tt.want == http.StatusCreated) != (created == 1) {
+				t.Errorf("%d bookings were created", created)
+			}
+		})
+	}
+}
+
+func TestBookVehicleUnverifiedEmail(t *testing.T) {
+	ts := newTestServer(t)
+	ts.Server.users = fakeUsers{bookingLimit: 1, unverified: true}
+
+	rec := ts.do(t, http.MethodPost, "/api/v1/booking/booking", testUserID, map[string]interface{}{
+		"vehicle_id": ts.available, "start_time": inHours(2), "end_time": inHours(4),
+	})
+	if rec.Code != http.StatusForbidden {
+		t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusForbidden, rec.Body)
+	}
+	if count, _ := ts.store.Bookings().CountActive(context.Background(), testUserID); count != 0 {
+		t.Errorf("%d bookings were created", count)
+	}
+}
+
+func TestBookVehicleBillingFails(t *testing.T) {
+	errBilling := &clients.Error{StatusCode: http.StatusServiceUnavailable, Message: "unavailable"}
+	tests := []struct {
+		name      string
+		deleteErr error
+		// Left for the scheduler to remove the bill
+		wantPending bool
+	}{
+		{name: "bill removed"},
+		{name: "billing unreachable", deleteErr: errors.New("connection refused"), wantPending: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts := newTestServer(t)
+			ts.billing.createErr, ts.billing.deleteErr = errBilling, tt.deleteErr
+
+			rec := ts.do(t, http.MethodPost, "/api/v1/booking/booking", testUserID, map[string]interface{}{
+				"vehicle_id": ts.available, "start_time": inHours(2), "end_time": inHours(4),
+			})
+			if rec.Code != http.StatusBadGateway {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusBadGateway, rec.Body)
+			}
+
+			// The booking is cancelled again and its vehicle freed
+			booking := ts.booking(t, 1)
+			if booking.Status != StatusCancelled || booking.BillPending != tt.wantPending {
+				t.Errorf("booking = %s with bill pending %t, want %s with %t", booking.Status, booking.BillPending, StatusCancelled, tt.wantPending)
+			}
+			vehicle, err := ts.store.Vehicles().Get(context.Background(), ts.available)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if vehicle.Status != StatusAvailable {
+				t.Errorf("vehicle status = %s, want %s", vehicle.Status, StatusAvailable)
+			}
+		})
+	}
+}
+
+func TestModifyBooking(t *testing.T) {
+	tests := []struct {
+		name string
+		// The booking being modified, in hours from now
+		start, end float64
+		setup      func(t *testing.T, ts *testServer)
+		// Status of the booking before it is modified, Active by default
+		status   string
+		pickedUp bool
+		userID   int
+		// The requested window, in hours from now
+		newStart, newEnd float64
+		want             int
+		// The window the booking should have afterwards
+		wantStart, wantEnd float64
+	}{
+		{
+			name: "before the start", start: 2, end: 4,
+			newStart: 3, newEnd: 6,
+			want: http.StatusOK, wantStart: 3, wantEnd: 6,
+		},
+		{
+			name: "onto another booking", start: 2, end: 4,
+			setup: func(t *testing.T, ts *testServer) {
+				ts.addBooking(t, 2, ts.available, inHours(5), inHours(7))
+			},
+			newStart: 3, newEnd: 6,
+			want: http.StatusConflict, wantStart: 2, wantEnd: 4,
+		},
+		{
+			name: "end before the new start", start: 2, end: 4,
+			newStart: 5, newEnd: 3,
+			want: http.StatusBadRequest, wantStart: 2, wantEnd: 4,
+		},
+		{
+			name: "during the booking only the end moves", start: -1, end: 2,
+			newStart: 1, newEnd: 3,
+			want: http.StatusOK, wantStart: -1, wantEnd: 3,
+		},
+		{
+			name: "during the booking to an end already past", start: -2, end: 2,
+			newStart: -2, newEnd: -1,
+			want: http.StatusBadRequest, wantStart: -2, wantEnd: 2,
+		},
+		{
+			name: "after the booking", start: -4, end: -2,
+			newStart: 1, newEnd: 3,
+			want: http.StatusBadRequest, wantStart: -4, wantEnd: -2,
+		},
+		{
+			name: "another user's booking", start: 2, end: 4, userID: 2,
+			newStart: 3, newEnd: 6,
+			want: http.StatusNotFound, wantStart: 2, wantEnd: 4,
+		},
+		{
+			name: "picked up early", start: 1, end: 2, pickedUp: true,
+			newStart: 1, newEnd: 3,
+			want: http.StatusConflict, wantStart: 1, wantEnd: 2,
+		},
+		{
+			name: "completed", start: -1, end: 2, status: StatusCompleted,
+			newStart: -1, newEnd: 3,
+			want: http.StatusConflict, wantStart: -1, wantEnd: 2,
+		},
+		{
+			name: "cancelled", start: 2, end: 4, status: StatusCancelled,
+			newStart: 3, newEnd: 6,
+			want: http.StatusConflict, wantStart: 2, wantEnd: 4,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts := newTestServer(t)
+			if tt.setup != nil {
+				tt.setup(t, ts)
+			}
+			bookingID := ts.addBooking(t, testUserID, ts.available, inHours(tt.start), inHours(tt.end))
+			if tt.pickedUp {
+				if err := ts.store.Bookings().StartTrip(context.Background(), bookingID, TripReading{At: time.Now(), ChargeLevel: 100}); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if tt.status != "" {
+				if err := ts.store.Bookings().SetStatus(context.Background(), bookingID, tt.status); err != nil {
+					t.Fatal(err)
+				}
+			}
+			userID := tt.userID
+			if userID == 0 {
+				userID = testUserID
+			}
+
+			rec := ts.do(t, http.MethodPut, "/api/v1/booking/modify/"+strconv.Itoa(bookingID), userID, map[string]string{
+				"startTime": inHours(tt.newStart).Format(timeLayout),
+				"endTime":   inHours(tt.newEnd).Format(timeLayout),
+			})
+			if rec.Code != tt.want {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.want, rec.Body)
+			}
+
+			// Allow for the clock ticking over a second between the calls to inHours
+			booking := ts.booking(t, bookingID)
+			if d := booking.StartTime.Sub(inHours(tt.wantStart)); d < -time.Second || d > time.Second {
+				t.Errorf("start time = %s, want %s", booking.StartTime, inHours(tt.wantStart))
+			}
+			if d := booking.EndTime.Sub(inHours(tt.wantEnd)); d < -time.Second || d > time.Second {
+				t.Errorf("end time = %s, want %s", booking.EndTime, inHours(tt.wantEnd))
+			}
+		})
+	}
+}
+
+func TestCancelBooking(t *testing.T) {
+	errBilling := &clients.Error{StatusCode: http.StatusBadGateway, Message: "refund failed"}
+	tests := []struct {
+		name       string
+		start, end float64
+		status     string
+		pickedUp   bool
+		userID     int
+		cancelErr  error
+		want       int
+		wantStatus string
+	}{
+		{name: "before the start", start: 2, end: 4, want: http.StatusOK, wantStatus: StatusCancelled},
+		{name: "after the start", start: -1, end: 2, want: http.StatusBadRequest, wantStatus: StatusActive},
+		{name: "picked up early", start: 1, end: 2, pickedUp: true, want: http.StatusBadRequest, wantStatus: StatusActive},
+		{name: "already cancelled", start: 2, end: 4, status: StatusCancelled, want: http.StatusConflict, wantStatus: StatusCancelled},
+		{name: "completed", start: -4, end: -2, status: StatusCompleted, want: http.StatusConflict, wantStatus: StatusCompleted},
+		{name: "another user's booking", start: 2, end: 4, userID: 2, want: http.StatusNotFound, wantStatus: StatusActive},
+		{name: "refund fails", start: 2, end: 4, cancelErr: errBilling, want: http.StatusBadGateway, wantStatus: StatusActive},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			ts := newTestServer(t)
+			ts.billing.cancelErr = tt.cancelErr
+			bookingID := ts.addBooking(t, testUserID, ts.available, inHours(tt.start), inHours(tt.end))
+			ts.store.Vehicles().SetStatus(ctx, ts.available, StatusBooked)
+			if tt.status != "" {
+				ts.store.Bookings().SetStatus(ctx, bookingID, tt.status)
+			}
+			if tt.pickedUp {
+				ts.store.Bookings().StartTrip(ctx, bookingID, TripReading{At: time.Now(), ChargeLevel: 100})
+			}
+			userID := tt.userID
+			if userID == 0 {
+				userID = testUserID
+			}
+
+			rec := ts.do(t, http.MethodDelete, "/api/v1/booking/cancel/"+strconv.Itoa(bookingID), userID, nil)
+			if rec.Code != tt.want {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.want, rec.Body)
+			}
+
+			if status := ts.booking(t, bookingID).Status; status != tt.wantStatus {
+				t.Errorf("booking status = %s, want %s", status, tt.wantStatus)
+			}
+			// The vehicle is only freed, and the bill only cancelled, with the booking
+			cancelled := tt.want == http.StatusOK
+			vehicle, err := ts.store.Vehicles().Get(ctx, ts.available)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if (vehicle.Status == StatusAvailable) != cancelled {
+				t.Errorf("vehicle status = %s", vehicle.Status)
+			}
+			if (len(ts.billing.cancelled) == 1) != cancelled {
+				t.Errorf("bills cancelled: %v", ts.billing.cancelled)
+			}
+		})
+	}
+}
+
+func TestCancelBookingTwice(t *testing.T) {
+	ts := newTestServer(t)
+	bookingID := ts.addBooking(t, testUserID, ts.available, inHours(2), inHours(4))
+
+	if rec := ts.do(t, http.MethodDelete, "/api/v1/booking/cancel/"+strconv.Itoa(bookingID), testUserID, nil); rec.Code != http.StatusOK {
+		t.Fatalf("first cancel: status = %d: %s", rec.Code, rec.Body)
+	}
+	if rec := ts.do(t, http.MethodDelete, "/api/v1/booking/cancel/"+strconv.Itoa(bookingID), testUserID, nil); rec.Code != http.StatusConflict {
+		t.Fatalf("second cancel: status = %d, want %d", rec.Code, http.StatusConflict)
+	}
+	if len(ts.billing.cancelled) != 1 {
+		t.Errorf("bill cancelled %d times, want once", len(ts.billing.cancelled))
+	}
+}
@@ -0,0 +1,137 @@
+package vehicleservice
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/yongkaiyu/CNAD_Assg1/internal/clients"
+)
+
+/* Internal endpoints called by the user and billing services */
+
+func (s *Server) getVehicleHandler(w http.ResponseWriter, r *http.Request) {
+	vehicleID, err := strconv.Atoi(mux.Vars(r)["vehicleId"])
+	if err != nil {
+		http.Error(w, "Invalid vehicle ID", http.StatusBadRequest)
+		return
+	}
+
+	vehicle, err := s.store.Vehicles().Get(r.Context(), vehicleID)
+	if err != nil {
+		if err == errVehicleNotFound {
+			http.Error(w, "Vehicle not found", http.StatusNotFound)
+			return
+		}
+		log.Printf("Error fetching vehicle %d: %v", vehicleID, err)
+		http.Error(w, "Error fetching vehicle", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(clients.VehicleInfo{
+		VehicleID:    vehicle.VehicleID,
+		LicensePlate: vehicle.LicensePlate,
+		Location:     vehicle.Location,
+		ChargeLevel:  vehicle.ChargeLevel,
+		Status:       vehicle.Status,
+		Cleanliness:  vehicle.Cleanliness,
+		VehicleClass: vehicle.VehicleClass,
+	})
+}
+
+func bookingInfo(booking Booking) clients.BookingInfo {
+	info := clients.BookingInfo{
+		BookingID:   booking.BookingID,
+		UserID:      booking.UserID,
+		VehicleID:   booking.VehicleID,
+		StartTime:   booking.StartTime.Format(timeLayout),
+		EndTime:     booking.EndTime.Format(timeLayout),
+		Status:      booking.Status,
+		CreatedAt:   booking.CreatedAt.Format(timeLayout),
+		UpdatedAt:   booking.UpdatedAt.Format(timeLayout),
+		BillPending: booking.BillPending,
+	}
+	if booking.TotalCost != nil {
+		info.TotalCost = *booking.TotalCost
+	}
+	return info
+}
+
+func (s *Server) getBookingHandler(w http.ResponseWriter, r *http.Request) {
+	bookingID, err := strconv.Atoi(mux.Vars(r)["bookingId"])
+	if err != nil {
+		http.Error(w, "Invalid booking ID", http.StatusBadRequest)
+		return
+	}
+
+	booking, err := s.store.Bookings().Get(r.Context(), bookingID)
+	if err != nil {
+		if err == errBookingNotFound {
+			http.Error(w, "Booking not found", http.StatusNotFound)
+			return
+		}
+		log.Printf("Error fetching booking %d: %v", bookingID, err)
+		http.Error(w, "Error fetching booking", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(bookingInfo(*booking))
+}
+
+// Bookings of one user, optionally filtered by status, most recently updated first
+func (s *Server) listBookingsHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.Atoi(r.URL.Query().Get("user_id"))
+	if err != nil {
+		http.Error(w, "user_id parameter is required", http.StatusBadRequest)
+		return
+	}
+
+	found, err := s.store.Bookings().ListByUser(r.Context(), userID, r.URL.Query().Get("status"))
+	if err != nil {
+		log.Printf("Error fetching bookings for user %d: %v", userID, err)
+		http.Error(w, "Error fetching bookings", http.StatusInternalServerError)
+		return
+	}
+
+	bookings := []clients.BookingInfo{}
+	for _, booking := range found {
+		bookings = append(bookings, bookingInfo(booking))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(bookings)
+}
+
+// Completed rentals and spend per user over the last ?period_seconds=, for membership tiers
+func (s *Server) rentalSummaryHandler(w http.ResponseWriter, r *http.Request) {
+	seconds, err := strconv.Atoi(r.URL.Query().Get("period_seconds"))
+	if err != nil || seconds <= 0 {
+		http.Error(w, "period_seconds parameter must be a positive number", http.StatusBadRequest)
+		return
+	}
+
+	found, err := s.store.Bookings().RentalSummaries(r.Context(), time.Duration(seconds)*time.Second)
+	if err != nil {
+		log.Printf("Error summarising rentals: %v", err)
+		http.Error(w, "Error summarising rentals", http.StatusInternalServerError)
+		return
+	}
+
+	summaries := []clients.RentalSummary{}
+	for _, summary := range found {
+		summaries = append(summaries, clients.RentalSummary{
+			UserID:  summary.UserID,
+			Rentals: summary.Rentals,
+			Spend:   summary.Spend,
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(summaries)
+}
@@ -0,0 +1,62 @@
+package vehicleservice
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/yongkaiyu/CNAD_Assg1/internal/sms"
+)
+
+// Notifier delivers messages about a user's bookings
+type Notifier interface {
+	Notify(ctx context.Context, userID int, subject, message string) error
+}
+
+// NewNotifier logs every notification and, when sender isn't nil, also texts it
+// to the user if they have verified their phone number
+func NewNotifier(users Users, sender sms.SMSSender) Notifier {
+	if sender == nil {
+		return logNotifier{}
+	}
+	return smsNotifier{users: users, sender: sender}
+}
+
+// logNotifier just writes notifications to the log
+type logNotifier struct{}
+
+func (logNotifier) Notify(ctx context.Context, userID int, subject, message string) error {
+	log.Printf("Notification for user %d: %s - %s", userID, subject, message)
+	return nil
+}
+
+type smsNotifier struct {
+	users  Users
+	sender sms.SMSSender
+}
+
+func (n smsNotifier) Notify(ctx context.Context, userID int, subject, message string) error {
+	logNotifier{}.Notify(ctx, userID, subject, message)
+
+	user, err := n.users.GetUser(ctx, userID)
+	if err != nil {
+		return err
+	}
+	// Unverified numbers may not belong to the user
+	if !user.PhoneVerified {
+		return nil
+	}
+	return n.sender.Send(ctx, user.Phone, subject+": "+message)
+}
+
+// Send a notification without holding up the request that caused it
+func (s *Server) notifyAsync(userID int, subject, message string) {
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+
+		if err := s.notifier.Notify(ctx, userID, subject, message); err != nil {
+			log.Printf("Error notifying user %d: %v", userID, err)
+		}
+	}()
+}
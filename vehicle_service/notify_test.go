@@ -0,0 +1,36 @@
+package vehicleservice
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/yongkaiyu/CNAD_Assg1/internal/clients"
+	"github.com/yongkaiyu/CNAD_Assg1/internal/sms"
+)
+
+// phoneUsers gives user 1 a verified phone number and user 2 an unverified one
+type phoneUsers struct {
+	fakeUsers
+}
+
+func (phoneUsers) GetUser(ctx context.Context, userID int) (*clients.UserInfo, error) {
+	return &clients.UserInfo{UserID: userID, Phone: fmt.Sprintf("+65912345%02d", userID), PhoneVerified: userID == 1}, nil
+}
+
+func TestSMSNotifier(t *testing.T) {
+	sender := &sms.FakeSender{}
+	notifier := NewNotifier(phoneUsers{}, sender)
+
+	for _, userID := range []int{1, 2} {
+		if err := notifier.Notify(context.Background(), userID, "Booking confirmed", "See you soon."); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Only the verified number is texted
+	sent := sender.Sent()
+	if len(sent) != 1 || sent[0].To != "+6591234501" || sent[0].Body != "Booking confirmed: See you soon." {
+		t.Errorf("texts sent = %+v, want one to +6591234561", sent)
+	}
+}
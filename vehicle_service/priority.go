@@ -0,0 +1,149 @@
+package vehicleservice
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/yongkaiyu/CNAD_Assg1/internal/auth"
+	"github.com/yongkaiyu/CNAD_Assg1/internal/clients"
+)
+
+// earlyAccessError is returned when a user without priority access tries to book a vehicle
+// that is still reserved for priority tiers
+type earlyAccessError struct {
+	until time.Time
+}
+
+func (e *earlyAccessError) Error() string {
+	minutes := int(math.Ceil(time.Until(e.until).Minutes()))
+	return fmt.Sprintf("This vehicle was just released and is reserved for priority members for another %d minute(s)", max(minutes, 1))
+}
+
+// When the vehicle opens up to every tier, or the zero time if it already has
+func (s *Server) earlyAccessUntil(v Vehicle) time.Time {
+	if v.ReleasedAt == nil || s.cfg.PriorityWindow <= 0 {
+		return time.Time{}
+	}
+	until := v.ReleasedAt.Add(s.cfg.PriorityWindow)
+	if !until.After(time.Now()) {
+		return time.Time{}
+	}
+	return until
+}
+
+// A vehicle charged back up past the minimum is offered again, which counts as a release
+func (s *Server) chargedUp(before, after Vehicle) bool {
+	return before.ChargeLevel < s.cfg.MinChargeLevel && after.ChargeLevel >= s.cfg.MinChargeLevel
+}
+
+// Whether the user's tier has priority access. Errors count as no priority access,
+// so vehicles in early access stay hidden if the user service can't be reached.
+func (s *Server) hasPriorityAccess(r *http.Request, userID int) bool {
+	membership, err := s.users.GetMembership(r.Context(), userID)
+	if err != nil {
+		log.Printf("Error fetching membership for user %d: %v", userID, err)
+		return false
+	}
+	return membership.PriorityAccess
+}
+
+/* Waitlists: users queue for a vehicle they can't book yet and are told when it is available.
+   Priority members go ahead of everyone else and are told first, see notifyWaitlists. */
+
+// The vehicles the user is waiting for and their place in each queue
+func (s *Server) listWaitlistHandler(w http.ResponseWriter, r *http.Request) {
+	userID := auth.UserID(r)
+
+	entries, err := s.store.Waitlist().ListByUser(r.Context(), userID)
+	if err != nil {
+		log.Printf("Error fetching waitlist for user %d: %v", userID, err)
+		http.Error(w, "Error fetching waitlist", http.StatusInternalServerError)
+		return
+	}
+	if entries == nil {
+		entries = []WaitlistEntry{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(entries)
+}
+
+// Join the queue for a vehicle the user can't book right now
+func (s *Server) joinWaitlistHandler(w http.ResponseWriter, r *http.Request) {
+	userID := auth.UserID(r)
+
+	var input struct {
+		VehicleID int `json:"vehicle_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil || input.VehicleID <= 0 {
+		http.Error(w, "vehicle_id is required", http.StatusBadRequest)
+		return
+	}
+
+	vehicle, err := s.store.Vehicles().Get(r.Context(), input.VehicleID)
+	if err != nil || vehicle.RetiredAt != nil {
+		if err == nil || errors.Is(err, errVehicleNotFound) {
+			http.Error(w, "Vehicle not found", http.StatusNotFound)
+			return
+		}
+		log.Printf("Error fetching vehicle %d: %v", input.VehicleID, err)
+		http.Error(w, "Error joining waitlist", http.StatusInternalServerError)
+		return
+	}
+
+	membership, err := s.users.GetMembership(r.Context(), userID)
+	if err != nil {
+		if clients.IsNotFound(err) {
+			http.Error(w, "User not found", http.StatusNotFound)
+			return
+		}
+		log.Printf("Error fetching membership for user %d: %v", userID, err)
+		http.Error(w, "Error fetching membership benefits", http.StatusInternalServerError)
+		return
+	}
+
+	available := vehicle.Status == StatusAvailable && vehicle.ChargeLevel >= s.cfg.MinChargeLevel
+	if available && (membership.PriorityAccess || s.earlyAccessUntil(*vehicle).IsZero()) {
+		http.Error(w, "This vehicle is available, book it instead", http.StatusConflict)
+		return
+	}
+
+	if err := s.store.Waitlist().Join(r.Context(), input.VehicleID, userID, membership.PriorityAccess); err != nil {
+		log.Printf("Error adding user %d to the waitlist for vehicle %d: %v", userID, input.VehicleID, err)
+		http.Error(w, "Error joining waitlist", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]string{"message": "You'll be notified when the vehicle is available"})
+}
+
+func (s *Server) leaveWaitlistHandler(w http.ResponseWriter, r *http.Request) {
+	userID := auth.UserID(r)
+	vehicleID, err := strconv.Atoi(mux.Vars(r)["vehicleId"])
+	if err != nil {
+		http.Error(w, "Invalid vehicle ID", http.StatusBadRequest)
+		return
+	}
+
+	if err := s.store.Waitlist().Leave(r.Context(), vehicleID, userID); err != nil {
+		if errors.Is(err, errNotOnWaitlist) {
+			http.Error(w, "You aren't on the waitlist for this vehicle", http.StatusNotFound)
+			return
+		}
+		log.Printf("Error removing user %d from the waitlist for vehicle %d: %v", userID, vehicleID, err)
+		http.Error(w, "Error leaving waitlist", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
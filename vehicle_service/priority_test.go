@@ -0,0 +1,99 @@
+package vehicleservice
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"slices"
+	"strconv"
+	"testing"
+	"time"
+)
+
+const priorityUserID = 3
+
+func TestPriorityEarlyAccess(t *testing.T) {
+	tests := []struct {
+		name string
+		// How long ago the vehicle was released
+		releasedAgo time.Duration
+		userID      int
+		wantListed  bool
+		wantBook    int
+		wantJoin    int
+	}{
+		{"priority member inside the window", 5 * time.Minute, priorityUserID, true, http.StatusCreated, http.StatusConflict},
+		{"regular member inside the window", 5 * time.Minute, testUserID, false, http.StatusForbidden, http.StatusCreated},
+		{"regular member after the window", 20 * time.Minute, testUserID, true, http.StatusCreated, http.StatusConflict},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts := newTestServer(t)
+			ts.users = fakeUsers{bookingLimit: 1, priority: []int{priorityUserID}}
+			ts.cfg.PriorityWindow = 15 * time.Minute
+			releasedAt := time.Now().UTC().Add(-tt.releasedAgo)
+			vehicleID := ts.store.AddVehicle(Vehicle{LicensePlate: "SBA1237D", ChargeLevel: 100, ReleasedAt: &releasedAt})
+
+			if listed := slices.Contains(ts.vehicleIDs(t, tt.userID, ""), vehicleID); listed != tt.wantListed {
+				t.Errorf("vehicle listed = %t, want %t", listed, tt.wantListed)
+			}
+			rec := ts.do(t, http.MethodPost, "/api/v1/booking/waitlist", tt.userID, map[string]int{"vehicle_id": vehicleID})
+			if rec.Code != tt.wantJoin {
+				t.Errorf("joining the waitlist: status = %d, want %d: %s", rec.Code, tt.wantJoin, rec.Body)
+			}
+			rec = ts.do(t, http.MethodPost, "/api/v1/booking/booking", tt.userID, map[string]interface{}{
+				"vehicle_id": vehicleID, "start_time": inHours(0.1), "end_time": inHours(1),
+			})
+			if rec.Code != tt.wantBook {
+				t.Errorf("booking: status = %d, want %d: %s", rec.Code, tt.wantBook, rec.Body)
+			}
+		})
+	}
+}
+
+func TestWaitlistPositions(t *testing.T) {
+	ts := newTestServer(t)
+	ts.users = fakeUsers{bookingLimit: 1, priority: []int{3, 4}}
+
+	// Users 1 and 2 join before priority members 3 and 4, then user 1 joins again
+	for _, userID := range []int{1, 2, 3, 4, 1} {
+		rec := ts.do(t, http.MethodPost, "/api/v1/booking/waitlist", userID, map[string]int{"vehicle_id": ts.maintenance})
+		if rec.Code != http.StatusCreated {
+			t.Fatalf("user %d joining: status = %d: %s", userID, rec.Code, rec.Body)
+		}
+	}
+	// A notified entry no longer holds a place
+	if err := ts.store.Waitlist().Join(context.Background(), ts.maintenance, 5, true); err != nil {
+		t.Fatal(err)
+	}
+	ts.store.mu.Lock()
+	notifiedAt := time.Now().UTC()
+	ts.store.data.waitlist[len(ts.store.data.waitlist)-1].NotifiedAt = &notifiedAt
+	ts.store.mu.Unlock()
+
+	// Priority members go first, then first come first served
+	want := map[int]int{3: 1, 4: 2, 2: 3, 1: 4}
+	for userID, position := range want {
+		rec := ts.do(t, http.MethodGet, "/api/v1/booking/waitlist", userID, nil)
+		var entries []WaitlistEntry
+		if err := json.NewDecoder(rec.Body).Decode(&entries); err != nil {
+			t.Fatal(err)
+		}
+		if len(entries) != 1 || entries[0].Position != position {
+			t.Errorf("user %d's waitlist = %+v, want position %d", userID, entries, position)
+		}
+	}
+
+	rec := ts.do(t, http.MethodDelete, "/api/v1/booking/waitlist/"+strconv.Itoa(ts.maintenance), 3, nil)
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("leaving: status = %d: %s", rec.Code, rec.Body)
+	}
+	rec = ts.do(t, http.MethodGet, "/api/v1/booking/waitlist", 2, nil)
+	var entries []WaitlistEntry
+	if err := json.NewDecoder(rec.Body).Decode(&entries); err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Position != 2 {
+		t.Errorf("after a priority member left, user 2's waitlist = %+v, want position 2", entries)
+	}
+}
@@ -0,0 +1,508 @@
+package vehicleservice
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/yongkaiyu/CNAD_Assg1/internal/config"
+	"github.com/yongkaiyu/CNAD_Assg1/internal/database"
+)
+
+// Name of the MySQL advisory lock that makes sure only one instance runs the jobs at a time
+const schedulerLockName = "electric_car_sharing_scheduler"
+
+// Scheduler moves bookings through their lifecycle in the background.
+// It works on MySQL directly since it relies on an advisory lock. Booking times are stored
+// in UTC, so the jobs compare them with UTC_TIMESTAMP() rather than the session time zone.
+type Scheduler struct {
+	db       *sql.DB
+	billing  Billing
+	notifier Notifier
+	vehicles config.Vehicles
+}
+
+func NewScheduler(db *sql.DB, billing Billing, notifier Notifier, vehicles config.Vehicles) *Scheduler {
+	return &Scheduler{db: db, billing: billing, notifier: notifier, vehicles: vehicles}
+}
+
+// Run runs the booking lifecycle jobs until ctx is cancelled
+func (s *Scheduler) Run(ctx context.Context, cfg config.Scheduler) {
+	log.Printf("Starting booking scheduler (every %s)", cfg.Interval)
+
+	ticker := time.NewTicker(cfg.Interval)
+	defer ticker.Stop()
+
+	for {
+		s.runSchedulerOnce(ctx, cfg)
+
+		select {
+		case <-ctx.Done():
+			log.Println("Booking scheduler stopped")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Run every job once, provided no other instance is already doing so
+func (s *Scheduler) runSchedulerOnce(ctx context.Context, cfg config.Scheduler) {
+	// Advisory locks belong to a connection, so hold one for the whole run
+	conn, err := s.db.Conn(ctx)
+	if err != nil {
+		log.Printf("Scheduler: error getting connection: %v", err)
+		return
+	}
+	defer conn.Close()
+
+	var acquired sql.NullInt64
+	if err := conn.QueryRowContext(ctx, `SELECT GET_LOCK(?, 0)`, schedulerLockName).Scan(&acquired); err != nil {
+		log.Printf("Scheduler: error acquiring lock: %v", err)
+		return
+	}
+	if acquired.Int64 != 1 {
+		// Another instance is running the jobs
+		return
+	}
+	defer conn.ExecContext(context.Background(), `SELECT RELEASE_LOCK(?)`, schedulerLockName)
+
+	jobs := []struct {
+		name string
+		run  func(context.Context, config.Scheduler) (int, error)
+	}{
+		{"complete expired bookings", s.completeExpiredBookings},
+		{"flag no-shows", s.flagNoShows},
+		{"send start reminders", s.sendStartReminders},
+		{"notify waitlists", s.notifyWaitlists},
+		{"notify late returns", s.notifyLateReturns},
+		{"bill ended trips", s.billEndedTrips},
+		{"cancel unbilled bookings", s.cancelUnbilledBookings},
+	}
+
+	for _, job := range jobs {
+		count, err := job.run(ctx, cfg)
+		if err != nil {
+			log.Printf("Scheduler: %s failed: %v", job.name, err)
+			continue
+		}
+		if count > 0 {
+			log.Printf("Scheduler: %s: %d booking(s)", job.name, count)
+		}
+	}
+}
+
+// Complete active bookings whose end time has passed and release their vehicles. Trips in
+// progress are left for the customer to end.
+func (s *Scheduler) completeExpiredBookings(ctx context.Context, cfg config.Scheduler) (int, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, `
+		SELECT booking_id, vehicle_id
+		FROM bookings
+		WHERE status = 'Active' AND end_time < UTC_TIMESTAMP() AND picked_up_at IS NULL
+		FOR UPDATE`)
+	if err != nil {
+		return 0, err
+	}
+
+	var bookingIDs []interface{}
+	var vehicleIDs []interface{}
+	for rows.Next() {
+		var bookingID, vehicleID int
+		if err := rows.Scan(&bookingID, &vehicleID); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		bookingIDs = append(bookingIDs, bookingID)
+		vehicleIDs = append(vehicleIDs, vehicleID)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+	if len(bookingIDs) == 0 {
+		return 0, nil
+	}
+
+	_, err = tx.ExecContext(ctx, fmt.Sprintf(`
+		UPDATE bookings SET status = 'Completed'
+		WHERE status = 'Active' AND booking_id IN (%s)`, database.Placeholders(len(bookingIDs))),
+		bookingIDs...)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := releaseVehicles(ctx, tx, vehicleIDs); err != nil {
+		return 0, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return len(bookingIDs), nil
+}
+
+// Make the vehicles of bookings that just ended Available again, leaving those that are in
+// the middle of another booking. notifyWaitlists then tells whoever is waiting for them.
+func releaseVehicles(ctx context.Context, tx *sql.Tx, vehicleIDs []interface{}) error {
+	_, err := tx.ExecContext(ctx, fmt.Sprintf(`
+		UPDATE vehicles v SET v.status = 'Available'
+		WHERE v.status = 'Booked' AND v.vehicle_id IN (%s)
+		AND NOT EXISTS (
+			SELECT 1 FROM bookings b
+			WHERE b.vehicle_id = v.vehicle_id AND b.status = 'Active'
+			AND b.start_time <= UTC_TIMESTAMP() AND b.end_time > UTC_TIMESTAMP()
+		)`, database.Placeholders(len(vehicleIDs))),
+		vehicleIDs...)
+	return err
+}
+
+// Mark bookings that were never picked up within the grace period as no-shows and release
+// their vehicles
+func (s *Scheduler) flagNoShows(ctx context.Context, cfg config.Scheduler) (int, error) {
+	if cfg.NoShowGrace <= 0 {
+		return 0, nil
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, `
+		SELECT booking_id, vehicle_id
+		FROM bookings
+		WHERE status = 'Active' AND picked_up_at IS NULL
+		AND start_time < UTC_TIMESTAMP() - INTERVAL ? SECOND
+		FOR UPDATE`,
+		int(cfg.NoShowGrace.Seconds()))
+	if err != nil {
+		return 0, err
+	}
+
+	var bookingIDs []interface{}
+	var vehicleIDs []interface{}
+	for rows.Next() {
+		var bookingID, vehicleID int
+		if err := rows.Scan(&bookingID, &vehicleID); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		bookingIDs = append(bookingIDs, bookingID)
+		vehicleIDs = append(vehicleIDs, vehicleID)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+	if len(bookingIDs) == 0 {
+		return 0, nil
+	}
+
+	_, err = tx.ExecContext(ctx, fmt.Sprintf(`
+		UPDATE bookings SET status = ?
+		WHERE status = 'Active' AND booking_id IN (%s)`, database.Placeholders(len(bookingIDs))),
+		append([]interface{}{StatusNoShow}, bookingIDs...)...)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := releaseVehicles(ctx, tx, vehicleIDs); err != nil {
+		return 0, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return len(bookingIDs), nil
+}
+
+// Remind users shortly before their booking starts. Each booking is claimed
+// before sending so a reminder only goes out once.
+func (s *Scheduler) sendStartReminders(ctx context.Context, cfg config.Scheduler) (int, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT b.booking_id, b.user_id, b.start_time, v.license_plate, v.location
+		FROM bookings b
+		INNER JOIN vehicles v ON b.vehicle_id = v.vehicle_id
+		WHERE b.status = 'Active' AND b.reminder_sent_at IS NULL
+		AND b.start_time > UTC_TIMESTAMP() AND b.start_time <= UTC_TIMESTAMP() + INTERVAL ? SECOND`,
+		int(cfg.ReminderLead.Seconds()))
+	if err != nil {
+		return 0, err
+	}
+
+	type reminder struct {
+		bookingID, userID                 int
+		startTime, licensePlate, location string
+	}
+	var reminders []reminder
+	for rows.Next() {
+		var rem reminder
+		if err := rows.Scan(&rem.bookingID, &rem.userID, &rem.startTime, &rem.licensePlate, &rem.location); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		reminders = append(reminders, rem)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	sent := 0
+	for _, rem := range reminders {
+		result, err := s.db.ExecContext(ctx, `
+			UPDATE bookings SET reminder_sent_at = UTC_TIMESTAMP()
+			WHERE booking_id = ? AND reminder_sent_at IS NULL`, rem.bookingID)
+		if err != nil {
+			return sent, err
+		}
+		if claimed, err := result.RowsAffected(); err != nil || claimed == 0 {
+			continue
+		}
+
+		message := fmt.Sprintf("Your booking %d for %s at %s starts at %s.",
+			rem.bookingID, rem.licensePlate, rem.location, rem.startTime)
+		if err := s.notifier.Notify(ctx, rem.userID, "Your booking starts soon", message); err != nil {
+			log.Printf("Scheduler: error sending reminder for booking %d: %v", rem.bookingID, err)
+			continue
+		}
+		sent++
+	}
+
+	return sent, nil
+}
+
+// Tell waiting users that their vehicle can be booked. Priority members are told as soon as
+// it is available. Everyone else waits until the vehicle is out of its priority window and
+// priority members have had the window to book it. Each entry is claimed before sending so
+// it is only notified once.
+func (s *Scheduler) notifyWaitlists(ctx context.Context, cfg config.Scheduler) (int, error) {
+	window := int(s.vehicles.PriorityWindow.Seconds())
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT w.entry_id, w.user_id, v.vehicle_id, v.license_plate, v.location
+		FROM waitlist_entries w
+		INNER JOIN vehicles v ON w.vehicle_id = v.vehicle_id
+		WHERE w.notified_at IS NULL
+		AND v.status = 'Available' AND v.retired_at IS NULL AND v.charge_level >= ?
+		AND (w.priority OR (
+			(v.released_at IS NULL OR v.released_at <= UTC_TIMESTAMP() - INTERVAL ? SECOND)
+			AND NOT EXISTS (
+				SELECT 1 FROM waitlist_entries p
+				WHERE p.vehicle_id = w.vehicle_id AND p.priority
+				AND (p.notified_at IS NULL OR p.notified_at > UTC_TIMESTAMP() - INTERVAL ? SECOND)
+			)
+		))
+		ORDER BY w.priority DESC, w.entry_id`,
+		s.vehicles.MinChargeLevel, window, window)
+	if err != nil {
+		return 0, err
+	}
+
+	type waiting struct {
+		entryID, userID, vehicleID int
+		licensePlate, location     string
+	}
+	var entries []waiting
+	for rows.Next() {
+		var entry waiting
+		if err := rows.Scan(&entry.entryID, &entry.userID, &entry.vehicleID, &entry.licensePlate, &entry.location); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		entries = append(entries, entry)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	sent := 0
+	for _, entry := range entries {
+		result, err := s.db.ExecContext(ctx, `
+			UPDATE waitlist_entries SET notified_at = UTC_TIMESTAMP()
+			WHERE entry_id = ? AND notified_at IS NULL`, entry.entryID)
+		if err != nil {
+			return sent, err
+		}
+		if claimed, err := result.RowsAffected(); err != nil || claimed == 0 {
+			continue
+		}
+
+		message := fmt.Sprintf("Vehicle %s at %s that you were waiting for is available to book.",
+			entry.licensePlate, entry.location)
+		if err := s.notifier.Notify(ctx, entry.userID, "Your vehicle is available", message); err != nil {
+			log.Printf("Scheduler: error notifying user %d about vehicle %d: %v", entry.userID, entry.vehicleID, err)
+			continue
+		}
+		sent++
+	}
+
+	return sent, nil
+}
+
+// Tell customers whose trip has run past its end and the return grace that late fees now
+// apply, and warn whoever has booked the vehicle next that it may not be back in time. Each
+// trip is claimed before sending so the notices only go out once.
+func (s *Scheduler) notifyLateReturns(ctx context.Context, cfg config.Scheduler) (int, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT b.booking_id, b.user_id, b.vehicle_id, b.end_time, v.license_plate
+		FROM bookings b
+		INNER JOIN vehicles v ON b.vehicle_id = v.vehicle_id
+		WHERE b.status = 'Active' AND b.picked_up_at IS NOT NULL AND b.returned_at IS NULL
+		AND b.late_notice_sent_at IS NULL AND b.end_time < UTC_TIMESTAMP() - INTERVAL ? SECOND`,
+		int(s.vehicles.LateReturnGrace.Seconds()))
+	if err != nil {
+		return 0, err
+	}
+
+	type lateTrip struct {
+		bookingID, userID, vehicleID int
+		endTime, licensePlate        string
+	}
+	var trips []lateTrip
+	for rows.Next() {
+		var trip lateTrip
+		if err := rows.Scan(&trip.bookingID, &trip.userID, &trip.vehicleID, &trip.endTime, &trip.licensePlate); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		trips = append(trips, trip)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	sent := 0
+	for _, trip := range trips {
+		result, err := s.db.ExecContext(ctx, `
+			UPDATE bookings SET late_notice_sent_at = UTC_TIMESTAMP()
+			WHERE booking_id = ? AND late_notice_sent_at IS NULL`, trip.bookingID)
+		if err != nil {
+			return sent, err
+		}
+		if claimed, err := result.RowsAffected(); err != nil || claimed == 0 {
+			continue
+		}
+
+		message := fmt.Sprintf("Your booking %d with %s ended at %s. Late fees apply until you end the trip, please return the vehicle as soon as you can.",
+			trip.bookingID, trip.licensePlate, trip.endTime)
+		if err := s.notifier.Notify(ctx, trip.userID, "Your trip is overdue", message); err != nil {
+			log.Printf("Scheduler: error sending late notice for booking %d: %v", trip.bookingID, err)
+		}
+
+		// The next customer is the one waiting on this vehicle
+		var nextBookingID, nextUserID int
+		var nextStart string
+		err = s.db.QueryRowContext(ctx, `
+			SELECT booking_id, user_id, start_time
+			FROM bookings
+			WHERE vehicle_id = ? AND status = 'Active' AND picked_up_at IS NULL AND booking_id <> ?
+			AND end_time > UTC_TIMESTAMP()
+			ORDER BY start_time
+			LIMIT 1`, trip.vehicleID, trip.bookingID).Scan(&nextBookingID, &nextUserID, &nextStart)
+		switch {
+		case err == sql.ErrNoRows:
+		case err != nil:
+			log.Printf("Scheduler: error finding the booking after %d: %v", trip.bookingID, err)
+		default:
+			message := fmt.Sprintf("Vehicle %s for your booking %d starting at %s hasn't been returned by the previous customer yet. We'll let you know when it is back.",
+				trip.licensePlate, nextBookingID, nextStart)
+			if err := s.notifier.Notify(ctx, nextUserID, "Your vehicle is running late", message); err != nil {
+				log.Printf("Scheduler: error warning user %d about late vehicle %d: %v", nextUserID, trip.vehicleID, err)
+			}
+		}
+		sent++
+	}
+
+	return sent, nil
+}
+
+// Reprice the bills of trips that ended while the billing service couldn't be reached. Trips
+// get a minute first so this doesn't race the request that ended them.
+func (s *Scheduler) billEndedTrips(ctx context.Context, cfg config.Scheduler) (int, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT `+bookingColumns+`
+		FROM bookings
+		WHERE bill_pending AND returned_at < UTC_TIMESTAMP() - INTERVAL 1 MINUTE`)
+	if err != nil {
+		return 0, err
+	}
+
+	var trips []Booking
+	for rows.Next() {
+		booking, err := scanBooking(rows)
+		if err != nil {
+			rows.Close()
+			return 0, err
+		}
+		trips = append(trips, booking)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	billed := 0
+	for _, trip := range trips {
+		bill, err := billTrip(ctx, s.billing, mysqlBookings{s.db}, trip, s.vehicles.LateReturnGrace)
+		if err != nil {
+			log.Printf("Scheduler: error billing the trip of booking %d: %v", trip.BookingID, err)
+			continue
+		}
+
+		message := fmt.Sprintf("The bill for your trip with vehicle %d is ready. %s", trip.VehicleID, tripBillNotice(bill.Bill))
+		if err := s.notifier.Notify(ctx, trip.UserID, "Your trip has been billed", message); err != nil {
+			log.Printf("Scheduler: error sending the bill of booking %d: %v", trip.BookingID, err)
+		}
+		billed++
+	}
+
+	return billed, nil
+}
+
+// Finish cancelling new bookings that couldn't be billed: those the booking request gave up
+// on, and any it never got to bill, well after the billing service would have answered
+func (s *Scheduler) cancelUnbilledBookings(ctx context.Context, cfg config.Scheduler) (int, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT `+bookingColumns+`
+		FROM bookings
+		WHERE bill_pending AND returned_at IS NULL
+		AND (status <> 'Active' OR created_at < NOW() - INTERVAL 5 MINUTE)`)
+	if err != nil {
+		return 0, err
+	}
+
+	var unbilled []Booking
+	for rows.Next() {
+		booking, err := scanBooking(rows)
+		if err != nil {
+			rows.Close()
+			return 0, err
+		}
+		unbilled = append(unbilled, booking)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	cancelled := 0
+	for _, booking := range unbilled {
+		if err := cancelUnbilledBooking(ctx, NewMySQLStore(s.db), s.billing, booking); err != nil {
+			log.Printf("Scheduler: error cancelling unbilled booking %d: %v", booking.BookingID, err)
+			continue
+		}
+		cancelled++
+	}
+
+	return cancelled, nil
+}
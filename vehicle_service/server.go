@@ -0,0 +1,235 @@
+// Package vehicleservice owns the fleet and bookings.
+// It owns the vehicles, bookings, waitlist_entries and telemetry_readings tables.
+package vehicleservice
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/yongkaiyu/CNAD_Assg1/internal/auth"
+	"github.com/yongkaiyu/CNAD_Assg1/internal/clients"
+	"github.com/yongkaiyu/CNAD_Assg1/internal/config"
+	"github.com/yongkaiyu/CNAD_Assg1/internal/static"
+)
+
+type Vehicle struct {
+	VehicleID    int        `json:"vehicle_id"`
+	LicensePlate string     `json:"license_plate"`
+	Location     string     `json:"location"`
+	ChargeLevel  int        `json:"charge_level"`
+	Status       string     `json:"status"`
+	Cleanliness  string     `json:"cleanliness"`
+	VehicleClass string     `json:"vehicle_class"`
+	Latitude     *float64   `json:"latitude,omitempty"`
+	Longitude    *float64   `json:"longitude,omitempty"`
+	OdometerKm   *float64   `json:"odometer_km,omitempty"`
+	DoorsLocked  *bool      `json:"doors_locked,omitempty"`
+	Faults       []string   `json:"faults,omitempty"`
+	TelemetryAt  *time.Time `json:"telemetry_at,omitempty"`
+	RetiredAt    *time.Time `json:"retired_at,omitempty"`
+	ReleasedAt   *time.Time `json:"released_at,omitempty"`
+	CreatedAt    time.Time  `json:"created_at"`
+	UpdatedAt    time.Time  `json:"updated_at"`
+}
+
+const (
+	StatusAvailable   = "Available"
+	StatusBooked      = "Booked"
+	StatusMaintenance = "Maintenance"
+)
+
+// VehicleChange is one entry in a vehicle's audit trail, written by the fleet admin API
+type VehicleChange struct {
+	ChangeID   int       `json:"change_id"`
+	VehicleID  int       `json:"vehicle_id"`
+	ChangedBy  int       `json:"changed_by"`
+	Action     string    `json:"action"`
+	FromStatus string    `json:"from_status,omitempty"`
+	ToStatus   string    `json:"to_status,omitempty"`
+	Details    string    `json:"details,omitempty"`
+	Reason     string    `json:"reason"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+const (
+	ActionCreate = "create"
+	ActionUpdate = "update"
+	ActionStatus = "status"
+	ActionRetire = "retire"
+)
+
+const (
+	CleanlinessClean    = "Clean"
+	CleanlinessModerate = "Moderate"
+	CleanlinessDirty    = "Dirty"
+)
+
+type BookedVehicle struct {
+	BookingID    int     `json:"bookingId"`
+	VehicleID    int     `json:"vehicleId"`
+	LicensePlate string  `json:"licensePlate"`
+	Location     string  `json:"location"`
+	ChargeLevel  int     `json:"chargeLevel"`
+	Status       string  `json:"status"`
+	StartTime    string  `json:"startTime"`
+	EndTime      string  `json:"endTime"`
+	TotalAmount  float64 `json:"totalAmount"`
+	// Set once the trip has started
+	PickedUpAt string `json:"pickedUpAt,omitempty"`
+}
+
+// WaitlistEntry is a user waiting for a vehicle to become available. Position is their
+// place in the queue, counting from 1, until they are notified.
+type WaitlistEntry struct {
+	EntryID    int        `json:"entry_id"`
+	VehicleID  int        `json:"vehicle_id"`
+	UserID     int        `json:"user_id"`
+	Priority   bool       `json:"priority"`
+	Position   int        `json:"position,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	NotifiedAt *time.Time `json:"notified_at,omitempty"`
+}
+
+// TelemetryReading is what an in-car unit reports. Fields the unit didn't report are nil.
+// Faults lists the fault codes active at the time, empty when there are none.
+type TelemetryReading struct {
+	ReadingID   int64     `json:"reading_id,omitempty"`
+	VehicleID   int       `json:"vehicle_id"`
+	RecordedAt  time.Time `json:"recorded_at"`
+	ChargeLevel *int      `json:"charge_level,omitempty"`
+	OdometerKm  *float64  `json:"odometer_km,omitempty"`
+	Latitude    *float64  `json:"latitude,omitempty"`
+	Longitude   *float64  `json:"longitude,omitempty"`
+	DoorsLocked *bool     `json:"doors_locked,omitempty"`
+	Faults      []string  `json:"faults,omitempty"`
+}
+
+// RentalSummary is how much one user rented over a period
+type RentalSummary struct {
+	UserID  int
+	Rentals int
+	Spend   float64
+}
+
+type Booking struct {
+	BookingID int       `json:"booking_id"`
+	UserID    int       `json:"user_id"`
+	VehicleID int       `json:"vehicle_id"`
+	StartTime time.Time `json:"start_time"`
+	EndTime   time.Time `json:"end_time"`
+	Status    string    `json:"status"`
+	TotalCost *float64  `json:"total_cost,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	// When the customer actually picked the vehicle up and returned it, and its odometer
+	// and charge level at each end
+	PickedUpAt       *time.Time `json:"picked_up_at,omitempty"`
+	ReturnedAt       *time.Time `json:"returned_at,omitempty"`
+	StartOdometerKm  *float64   `json:"start_odometer_km,omitempty"`
+	EndOdometerKm    *float64   `json:"end_odometer_km,omitempty"`
+	StartChargeLevel *int       `json:"start_charge_level,omitempty"`
+	EndChargeLevel   *int       `json:"end_charge_level,omitempty"`
+	// Set from the end of the trip until its bill has been repriced for the trip as taken
+	BillPending bool `json:"bill_pending,omitempty"`
+}
+
+// TripReading is the vehicle's state at the start or end of a trip
+type TripReading struct {
+	At          time.Time
+	OdometerKm  *float64
+	ChargeLevel int
+}
+
+const (
+	StatusActive    = "Active"
+	StatusCompleted = "Completed"
+	StatusCancelled = "Cancelled"
+	StatusNoShow    = "NoShow"
+)
+
+// Pages of the vehicle service, served by the gateway
+var Pages = static.Dir("./vehicle_service/static", "vehicles_available", "vehicle_booking", "bookings_home", "modify_booking")
+
+// Users is the part of the user service the vehicle service calls
+type Users interface {
+	GetUser(ctx context.Context, userID int) (*clients.UserInfo, error)
+	GetMembership(ctx context.Context, userID int) (*clients.Membership, error)
+}
+
+// Billing is the part of the billing service the vehicle service calls
+type Billing interface {
+	Quote(ctx context.Context, req clients.BillRequest) (json.RawMessage, error)
+	CreateBill(ctx context.Context, req clients.BillRequest) (*clients.BillResponse, error)
+	UpdateBill(ctx context.Context, req clients.BillRequest) (*clients.BillResponse, error)
+	CancelBill(ctx context.Context, bookingID int, req clients.CancelRequest) (*clients.CancelResult, error)
+	DeleteBill(ctx context.Context, bookingID int) error
+}
+
+type Server struct {
+	store     Store
+	users     Users
+	billing   Billing
+	notifier  Notifier
+	commander VehicleCommander
+	cfg       config.Vehicles
+}
+
+func NewServer(store Store, users Users, billing Billing, notifier Notifier, commander VehicleCommander, cfg config.Vehicles) *Server {
+	return &Server{store: store, users: users, billing: billing, notifier: notifier, commander: commander, cfg: cfg}
+}
+
+func (s *Server) Routes() *mux.Router {
+	router := mux.NewRouter()
+
+	api := router.PathPrefix("/api/v1/booking").Subrouter()
+	api.Use(auth.Middleware)
+
+	api.HandleFunc("/vehicles", s.availableVehiclesHandler)
+	api.HandleFunc("/bookings", s.getBookedVehiclesHandler)
+	api.HandleFunc("/booking", s.vehicleBookingHandler)
+	api.HandleFunc("/modify/{bookingId}", s.modifyBookingHandler).Methods("PUT")
+	api.HandleFunc("/cancel/{bookingId}", s.cancelBookingHandler).Methods("DELETE")
+	api.HandleFunc("/{bookingId:[0-9]+}/start", s.startTripHandler).Methods("POST")
+	api.HandleFunc("/{bookingId:[0-9]+}/end", s.endTripHandler).Methods("POST")
+	api.HandleFunc("/waitlist", s.listWaitlistHandler).Methods("GET")
+	api.HandleFunc("/waitlist", s.joinWaitlistHandler).Methods("POST")
+	api.HandleFunc("/waitlist/{vehicleId}", s.leaveWaitlistHandler).Methods("DELETE")
+	// Reporting a vehicle's condition is for fleet operators
+	api.Handle("/status", auth.RequireRole(auth.RoleFleetOperator)(http.HandlerFunc(s.updateVehicleStatusHandler)))
+
+	// Fleet administration, for fleet operators
+	admin := router.PathPrefix("/api/v1/admin/vehicles").Subrouter()
+	admin.Use(auth.Middleware, auth.RequireRole(auth.RoleFleetOperator))
+
+	admin.HandleFunc("", s.listFleetHandler).Methods("GET")
+	admin.HandleFunc("", s.createVehicleHandler).Methods("POST")
+	admin.HandleFunc("/import", s.importVehiclesHandler).Methods("POST")
+	admin.HandleFunc("/{vehicleId:[0-9]+}", s.getFleetVehicleHandler).Methods("GET")
+	admin.HandleFunc("/{vehicleId:[0-9]+}", s.updateVehicleHandler).Methods("PUT")
+	admin.HandleFunc("/{vehicleId:[0-9]+}", s.retireVehicleHandler).Methods("DELETE")
+	admin.HandleFunc("/{vehicleId:[0-9]+}/status", s.changeVehicleStatusHandler).Methods("POST")
+	admin.HandleFunc("/{vehicleId:[0-9]+}/changes", s.vehicleChangesHandler).Methods("GET")
+	admin.HandleFunc("/{vehicleId:[0-9]+}/telemetry", s.vehicleTelemetryHandler).Methods("GET")
+
+	// Reported by in-car units, which authenticate with the telemetry key instead of a user
+	telemetry := router.PathPrefix("/api/v1/telemetry").Subrouter()
+	telemetry.Use(s.requireTelemetryKey)
+
+	telemetry.HandleFunc("", s.telemetryBatchHandler).Methods("POST")
+	telemetry.HandleFunc("/stream", s.telemetryStreamHandler).Methods("GET")
+
+	// Called by the other services
+	internal := router.PathPrefix("/internal").Subrouter()
+	internal.Use(auth.InternalMiddleware)
+
+	internal.HandleFunc("/vehicles/{vehicleId}", s.getVehicleHandler).Methods("GET")
+	internal.HandleFunc("/bookings", s.listBookingsHandler).Methods("GET")
+	internal.HandleFunc("/bookings/{bookingId}", s.getBookingHandler).Methods("GET")
+	internal.HandleFunc("/rentals/summary", s.rentalSummaryHandler).Methods("GET")
+
+	return router
+}
@@ -0,0 +1,121 @@
+package vehicleservice
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+var (
+	errVehicleNotFound    = errors.New("vehicle not found")
+	errVehicleUnavailable = errors.New("vehicle is not available for booking")
+	errBookingConflict    = errors.New("vehicle is already booked for the requested time")
+	errBookingNotFound    = errors.New("booking not found")
+	errLicensePlateTaken  = errors.New("license plate is already registered")
+	errNotOnWaitlist      = errors.New("not on the waitlist for this vehicle")
+	errTripChanged        = errors.New("the trip was started or ended at the same time")
+	errBookingNotActive   = errors.New("this booking is no longer active")
+)
+
+// Layout MySQL returns DATETIME columns in, and the one the pages send back
+const timeLayout = "2006-01-02 15:04:05"
+
+// VehicleFilter narrows List. An empty Status matches any.
+type VehicleFilter struct {
+	Status         string
+	IncludeRetired bool
+}
+
+// VehicleStore reads and writes the fleet
+type VehicleStore interface {
+	// ListAvailable returns vehicles that can be booked and have at least minChargeLevel charge, in ID order
+	ListAvailable(ctx context.Context, minChargeLevel int) ([]Vehicle, error)
+	// List returns the fleet in ID order
+	List(ctx context.Context, filter VehicleFilter) ([]Vehicle, error)
+	// Get and Lock also return retired vehicles. Lock holds the vehicle until the transaction ends.
+	Get(ctx context.Context, vehicleID int) (*Vehicle, error)
+	Lock(ctx context.Context, vehicleID int) (*Vehicle, error)
+	// Create adds a vehicle and returns its ID, or errLicensePlateTaken.
+	// A vehicle added as Available is released right away.
+	Create(ctx context.Context, vehicle Vehicle) (int, error)
+	// Update saves the vehicle's license plate, location, coordinates, charge level, cleanliness and class
+	Update(ctx context.Context, vehicle Vehicle) error
+	// Retire takes the vehicle out of the fleet for good. Its bookings and history are kept.
+	Retire(ctx context.Context, vehicleID int) error
+	// LockForWindow locks the vehicle until the transaction ends and checks that no other
+	// active booking overlaps the window. excludeBookingID lets a booking being modified ignore itself.
+	LockForWindow(ctx context.Context, vehicleID int, startTime, endTime time.Time, excludeBookingID int) error
+	// SetStatus is used by bookings and leaves vehicles in maintenance alone,
+	// only fleet operators take them out with ChangeStatus
+	SetStatus(ctx context.Context, vehicleID int, status string) error
+	ChangeStatus(ctx context.Context, vehicleID int, status string) error
+	// UpdateCondition saves the vehicle's location, charge level and cleanliness, and its
+	// coordinates when they are given
+	UpdateCondition(ctx context.Context, vehicle Vehicle) error
+	// Release records that the vehicle has just been released to customers
+	Release(ctx context.Context, vehicleID int) error
+
+	// RecordTelemetry adds a reading to the vehicle's time series
+	RecordTelemetry(ctx context.Context, reading TelemetryReading) error
+	// ApplyTelemetry copies the values a reading has onto the vehicle, unless the vehicle
+	// already has a later reading
+	ApplyTelemetry(ctx context.Context, reading TelemetryReading) error
+	// Telemetry returns the vehicle's readings recorded in [from, to), latest first, at most limit
+	Telemetry(ctx context.Context, vehicleID int, from, to time.Time, limit int) ([]TelemetryReading, error)
+
+	RecordChange(ctx context.Context, change VehicleChange) error
+	// Changes returns the vehicle's audit trail, newest first
+	Changes(ctx context.Context, vehicleID int) ([]VehicleChange, error)
+}
+
+// BookingStore reads and writes bookings
+type BookingStore interface {
+	Get(ctx context.Context, bookingID int) (*Booking, error)
+	// ListByUser returns the user's bookings, most recently updated first. An empty status matches any.
+	ListByUser(ctx context.Context, userID int, status string) ([]Booking, error)
+	// ListBookedVehicles returns the user's active bookings with their vehicles, earliest first
+	ListBookedVehicles(ctx context.Context, userID int) ([]BookedVehicle, error)
+	// CountActive counts the user's active bookings, locking them until the transaction ends
+	CountActive(ctx context.Context, userID int) (int, error)
+	// ActiveForVehicle returns the vehicle's active bookings that haven't ended, earliest first
+	ActiveForVehicle(ctx context.Context, vehicleID int) ([]Booking, error)
+	// ListOverlapping returns every active booking that overlaps the window, by vehicle then start time
+	ListOverlapping(ctx context.Context, startTime, endTime time.Time) ([]Booking, error)
+	// RentalSummaries counts the completed bookings and their cost per user, for bookings that
+	// ended in the last period. Users without any are left out.
+	RentalSummaries(ctx context.Context, period time.Duration) ([]RentalSummary, error)
+	Create(ctx context.Context, booking Booking) (int, error)
+	// UpdateWindow moves one of the user's bookings to a new window, or returns errBookingNotActive
+	// if it is no longer active or has been picked up
+	UpdateWindow(ctx context.Context, bookingID, userID int, startTime, endTime time.Time) error
+	SetTotalCost(ctx context.Context, bookingID int, totalCost float64) error
+	// SetBilled records what a booking or its trip was billed and clears its BillPending
+	SetBilled(ctx context.Context, bookingID int, totalCost float64) error
+	// SetStatus moves an active booking on, or returns errBookingNotActive if it already was
+	SetStatus(ctx context.Context, bookingID int, status string) error
+	// StartTrip records the pickup of an active booking, or returns errTripChanged if it was already picked up
+	StartTrip(ctx context.Context, bookingID int, reading TripReading) error
+	// EndTrip records the return of a trip in progress and completes the booking with its
+	// bill pending, or returns errTripChanged if the trip isn't in progress
+	EndTrip(ctx context.Context, bookingID int, reading TripReading) error
+}
+
+// WaitlistStore reads and writes the queues of users waiting for vehicles
+type WaitlistStore interface {
+	// Join puts the user at the back of the vehicle's queue, even if they were already on it
+	Join(ctx context.Context, vehicleID, userID int, priority bool) error
+	// Leave returns errNotOnWaitlist if the user isn't waiting for the vehicle
+	Leave(ctx context.Context, vehicleID, userID int) error
+	// ListByUser returns the vehicles the user is waiting for, most recently joined first
+	ListByUser(ctx context.Context, userID int) ([]WaitlistEntry, error)
+}
+
+// Store gives the vehicle service its data
+type Store interface {
+	Vehicles() VehicleStore
+	Bookings() BookingStore
+	Waitlist() WaitlistStore
+	// InTx runs fn in a transaction. If fn returns an error nothing it did through
+	// the given stores is kept.
+	InTx(ctx context.Context, fn func(vehicles VehicleStore, bookings BookingStore) error) error
+}
@@ -0,0 +1,658 @@
+package vehicleservice
+
+import (
+	"context"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+)
+
+// MemoryStore keeps the vehicle service's data in memory, for tests and local runs without MySQL.
+// Transactions hold a single lock, so they never interleave.
+type MemoryStore struct {
+	mu   sync.Mutex
+	data *memoryData
+}
+
+type memoryData struct {
+	vehicles      map[int]Vehicle
+	bookings      map[int]Booking
+	changes       []VehicleChange
+	waitlist      []WaitlistEntry
+	telemetry     []TelemetryReading
+	nextVehicleID int
+	nextBookingID int
+	nextChangeID  int
+	nextEntryID   int
+	nextReadingID int64
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{data: &memoryData{
+		vehicles:      map[int]Vehicle{},
+		bookings:      map[int]Booking{},
+		nextVehicleID: 1,
+		nextBookingID: 1,
+		nextChangeID:  1,
+		nextEntryID:   1,
+		nextReadingID: 1,
+	}}
+}
+
+// AddVehicle stores a vehicle and returns its ID
+func (s *MemoryStore) AddVehicle(vehicle Vehicle) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.data.addVehicle(vehicle)
+}
+
+func (d *memoryData) addVehicle(vehicle Vehicle) int {
+	vehicle.VehicleID = d.nextVehicleID
+	d.nextVehicleID++
+	if vehicle.Status == "" {
+		vehicle.Status = StatusAvailable
+	}
+	now := time.Now().UTC()
+	vehicle.CreatedAt, vehicle.UpdatedAt = now, now
+	d.vehicles[vehicle.VehicleID] = vehicle
+	return vehicle.VehicleID
+}
+
+func (s *MemoryStore) Vehicles() VehicleStore  { return memoryVehicles{s, false} }
+func (s *MemoryStore) Bookings() BookingStore  { return memoryBookings{s, false} }
+func (s *MemoryStore) Waitlist() WaitlistStore { return memoryWaitlist{s} }
+
+func (s *MemoryStore) InTx(ctx context.Context, fn func(vehicles VehicleStore, bookings BookingStore) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	snapshot := s.data.clone()
+	if err := fn(memoryVehicles{s, true}, memoryBookings{s, true}); err != nil {
+		s.data = snapshot
+		return err
+	}
+	return nil
+}
+
+// Stores handed to InTx already hold the lock
+func (s *MemoryStore) lock(inTx bool) func() {
+	if inTx {
+		return func() {}
+	}
+	s.mu.Lock()
+	return s.mu.Unlock
+}
+
+func (d *memoryData) clone() *memoryData {
+	c := *d
+	c.vehicles = make(map[int]Vehicle, len(d.vehicles))
+	for id, v := range d.vehicles {
+		c.vehicles[id] = v
+	}
+	c.bookings = make(map[int]Booking, len(d.bookings))
+	for id, b := range d.bookings {
+		c.bookings[id] = b
+	}
+	c.changes = append([]VehicleChange(nil), d.changes...)
+	c.waitlist = append([]WaitlistEntry(nil), d.waitlist...)
+	c.telemetry = append([]TelemetryReading(nil), d.telemetry...)
+	return &c
+}
+
+type memoryVehicles struct {
+	s    *MemoryStore
+	inTx bool
+}
+
+func (m memoryVehicles) ListAvailable(ctx context.Context, minChargeLevel int) ([]Vehicle, error) {
+	defer m.s.lock(m.inTx)()
+
+	var vehicles []Vehicle
+	for _, v := range m.s.data.vehicles {
+		if v.Status == StatusAvailable && v.RetiredAt == nil && v.ChargeLevel >= minChargeLevel {
+			vehicles = append(vehicles, v)
+		}
+	}
+	sort.Slice(vehicles, func(i, j int) bool { return vehicles[i].VehicleID < vehicles[j].VehicleID })
+	return vehicles, nil
+}
+
+func (m memoryVehicles) List(ctx context.Context, filter VehicleFilter) ([]Vehicle, error) {
+	defer m.s.lock(m.inTx)()
+
+	var vehicles []Vehicle
+	for _, v := range m.s.data.vehicles {
+		if (filter.Status == "" || v.Status == filter.Status) && (filter.IncludeRetired || v.RetiredAt == nil) {
+			vehicles = append(vehicles, v)
+		}
+	}
+	sort.Slice(vehicles, func(i, j int) bool { return vehicles[i].VehicleID < vehicles[j].VehicleID })
+	return vehicles, nil
+}
+
+func (m memoryVehicles) Get(ctx context.Context, vehicleID int) (*Vehicle, error) {
+	defer m.s.lock(m.inTx)()
+
+	v, ok := m.s.data.vehicles[vehicleID]
+	if !ok {
+		return nil, errVehicleNotFound
+	}
+	return &v, nil
+}
+
+// Transactions already hold the store's lock, so this is the same as Get
+func (m memoryVehicles) Lock(ctx context.Context, vehicleID int) (*Vehicle, error) {
+	return m.Get(ctx, vehicleID)
+}
+
+func (m memoryVehicles) Create(ctx context.Context, vehicle Vehicle) (int, error) {
+	defer m.s.lock(m.inTx)()
+
+	for _, v := range m.s.data.vehicles {
+		if v.LicensePlate == vehicle.LicensePlate {
+			return 0, errLicensePlateTaken
+		}
+	}
+	if vehicle.Status == "" || vehicle.Status == StatusAvailable {
+		now := time.Now().UTC().Truncate(time.Second)
+		vehicle.ReleasedAt = &now
+	}
+	return m.s.data.addVehicle(vehicle), nil
+}
+
+func (m memoryVehicles) Update(ctx context.Context, vehicle Vehicle) error {
+	defer m.s.lock(m.inTx)()
+
+	for _, v := range m.s.data.vehicles {
+		if v.LicensePlate == vehicle.LicensePlate && v.VehicleID != vehicle.VehicleID {
+			return errLicensePlateTaken
+		}
+	}
+	if v, ok := m.s.data.vehicles[vehicle.VehicleID]; ok {
+		v.LicensePlate = vehicle.LicensePlate
+		v.Location = vehicle.Location
+		v.ChargeLevel = vehicle.ChargeLevel
+		v.Cleanliness = vehicle.Cleanliness
+		v.VehicleClass = vehicle.VehicleClass
+		v.Latitude, v.Longitude = vehicle.Latitude, vehicle.Longitude
+		v.UpdatedAt = time.Now().UTC()
+		m.s.data.vehicles[vehicle.VehicleID] = v
+	}
+	return nil
+}
+
+func (m memoryVehicles) Retire(ctx context.Context, vehicleID int) error {
+	defer m.s.lock(m.inTx)()
+
+	v, ok := m.s.data.vehicles[vehicleID]
+	if !ok || v.RetiredAt != nil {
+		return errVehicleNotFound
+	}
+	now := time.Now().UTC().Truncate(time.Second)
+	v.RetiredAt = &now
+	v.UpdatedAt = now
+	m.s.data.vehicles[vehicleID] = v
+	return nil
+}
+
+func (m memoryVehicles) LockForWindow(ctx context.Context, vehicleID int, startTime, endTime time.Time, excludeBookingID int) error {
+	defer m.s.lock(m.inTx)()
+
+	v, ok := m.s.data.vehicles[vehicleID]
+	if !ok {
+		return errVehicleNotFound
+	}
+	if v.Status == StatusMaintenance || v.RetiredAt != nil {
+		return errVehicleUnavailable
+	}
+
+	for _, b := range m.s.data.bookings {
+		if b.VehicleID == vehicleID && b.Status == StatusActive && b.BookingID != excludeBookingID &&
+			b.StartTime.Before(endTime) && b.EndTime.After(startTime) {
+			return errBookingConflict
+		}
+	}
+	return nil
+}
+
+func (m memoryVehicles) SetStatus(ctx context.Context, vehicleID int, status string) error {
+	defer m.s.lock(m.inTx)()
+
+	if v, ok := m.s.data.vehicles[vehicleID]; ok && v.Status != StatusMaintenance {
+		v.Status = status
+		v.UpdatedAt = time.Now().UTC()
+		m.s.data.vehicles[vehicleID] = v
+	}
+	return nil
+}
+
+func (m memoryVehicles) ChangeStatus(ctx context.Context, vehicleID int, status string) error {
+	defer m.s.lock(m.inTx)()
+
+	if v, ok := m.s.data.vehicles[vehicleID]; ok {
+		v.Status = status
+		v.UpdatedAt = time.Now().UTC()
+		m.s.data.vehicles[vehicleID] = v
+	}
+	return nil
+}
+
+func (m memoryVehicles) UpdateCondition(ctx context.Context, vehicle Vehicle) error {
+	defer m.s.lock(m.inTx)()
+
+	if v, ok := m.s.data.vehicles[vehicle.VehicleID]; ok {
+		v.Location = vehicle.Location
+		v.ChargeLevel = vehicle.ChargeLevel
+		v.Cleanliness = vehicle.Cleanliness
+		if vehicle.Latitude != nil && vehicle.Longitude != nil {
+			v.Latitude, v.Longitude = vehicle.Latitude, vehicle.Longitude
+		}
+		v.UpdatedAt = time.Now().UTC()
+		m.s.data.vehicles[vehicle.VehicleID] = v
+	}
+	return nil
+}
+
+func (m memoryVehicles) Release(ctx context.Context, vehicleID int) error {
+	defer m.s.lock(m.inTx)()
+
+	if v, ok := m.s.data.vehicles[vehicleID]; ok {
+		now := time.Now().UTC().Truncate(time.Second)
+		v.ReleasedAt = &now
+		m.s.data.vehicles[vehicleID] = v
+	}
+	return nil
+}
+
+func (m memoryVehicles) RecordTelemetry(ctx context.Context, reading TelemetryReading) error {
+	defer m.s.lock(m.inTx)()
+
+	reading.ReadingID = m.s.data.nextReadingID
+	m.s.data.nextReadingID++
+	m.s.data.telemetry = append(m.s.data.telemetry, reading)
+	return nil
+}
+
+func (m memoryVehicles) ApplyTelemetry(ctx context.Context, reading TelemetryReading) error {
+	defer m.s.lock(m.inTx)()
+
+	v, ok := m.s.data.vehicles[reading.VehicleID]
+	if !ok || (v.TelemetryAt != nil && v.TelemetryAt.After(reading.RecordedAt)) {
+		return nil
+	}
+	if reading.ChargeLevel != nil {
+		v.ChargeLevel = *reading.ChargeLevel
+	}
+	if reading.OdometerKm != nil {
+		v.OdometerKm = reading.OdometerKm
+	}
+	if reading.Latitude != nil && reading.Longitude != nil {
+		v.Latitude, v.Longitude = reading.Latitude, reading.Longitude
+	}
+	if reading.DoorsLocked != nil {
+		v.DoorsLocked = reading.DoorsLocked
+	}
+	if reading.Faults != nil {
+		v.Faults = append([]string(nil), reading.Faults...)
+	}
+	recordedAt := reading.RecordedAt
+	v.TelemetryAt = &recordedAt
+	v.UpdatedAt = time.Now().UTC()
+	m.s.data.vehicles[reading.VehicleID] = v
+	return nil
+}
+
+func (m memoryVehicles) Telemetry(ctx context.Context, vehicleID int, from, to time.Time, limit int) ([]TelemetryReading, error) {
+	defer m.s.lock(m.inTx)()
+
+	var readings []TelemetryReading
+	for _, reading := range m.s.data.telemetry {
+		if reading.VehicleID == vehicleID && !reading.RecordedAt.Before(from) && reading.RecordedAt.Before(to) {
+			readings = append(readings, reading)
+		}
+	}
+	sort.Slice(readings, func(i, j int) bool {
+		if !readings[i].RecordedAt.Equal(readings[j].RecordedAt) {
+			return readings[i].RecordedAt.After(readings[j].RecordedAt)
+		}
+		return readings[i].ReadingID > readings[j].ReadingID
+	})
+	if len(readings) > limit {
+		readings = readings[:limit]
+	}
+	return readings, nil
+}
+
+func (m memoryVehicles) RecordChange(ctx context.Context, change VehicleChange) error {
+	defer m.s.lock(m.inTx)()
+
+	change.ChangeID = m.s.data.nextChangeID
+	m.s.data.nextChangeID++
+	change.CreatedAt = time.Now().UTC()
+	m.s.data.changes = append(m.s.data.changes, change)
+	return nil
+}
+
+func (m memoryVehicles) Changes(ctx context.Context, vehicleID int) ([]VehicleChange, error) {
+	defer m.s.lock(m.inTx)()
+
+	var changes []VehicleChange
+	for i := len(m.s.data.changes) - 1; i >= 0; i-- {
+		if m.s.data.changes[i].VehicleID == vehicleID {
+			changes = append(changes, m.s.data.changes[i])
+		}
+	}
+	return changes, nil
+}
+
+type memoryBookings struct {
+	s    *MemoryStore
+	inTx bool
+}
+
+func (m memoryBookings) Get(ctx context.Context, bookingID int) (*Booking, error) {
+	defer m.s.lock(m.inTx)()
+
+	b, ok := m.s.data.bookings[bookingID]
+	if !ok {
+		return nil, errBookingNotFound
+	}
+	return &b, nil
+}
+
+func (m memoryBookings) ListByUser(ctx context.Context, userID int, status string) ([]Booking, error) {
+	defer m.s.lock(m.inTx)()
+
+	var bookings []Booking
+	for _, b := range m.s.data.bookings {
+		if b.UserID == userID && (status == "" || b.Status == status) {
+			bookings = append(bookings, b)
+		}
+	}
+	sort.Slice(bookings, func(i, j int) bool {
+		if !bookings[i].UpdatedAt.Equal(bookings[j].UpdatedAt) {
+			return bookings[i].UpdatedAt.After(bookings[j].UpdatedAt)
+		}
+		return bookings[i].BookingID > bookings[j].BookingID
+	})
+	return bookings, nil
+}
+
+func (m memoryBookings) ListBookedVehicles(ctx context.Context, userID int) ([]BookedVehicle, error) {
+	defer m.s.lock(m.inTx)()
+
+	var active []Booking
+	for _, b := range m.s.data.bookings {
+		if b.UserID == userID && b.Status == StatusActive {
+			active = append(active, b)
+		}
+	}
+	sort.Slice(active, func(i, j int) bool { return active[i].StartTime.Before(active[j].StartTime) })
+
+	var bookedVehicles []BookedVehicle
+	for _, b := range active {
+		v, ok := m.s.data.vehicles[b.VehicleID]
+		if !ok {
+			continue
+		}
+		bookedVehicle := BookedVehicle{
+			BookingID:    b.BookingID,
+			VehicleID:    v.VehicleID,
+			LicensePlate: v.LicensePlate,
+			Location:     v.Location,
+			ChargeLevel:  v.ChargeLevel,
+			Status:       v.Status,
+			StartTime:    b.StartTime.Format(timeLayout),
+			EndTime:      b.EndTime.Format(timeLayout),
+		}
+		if b.TotalCost != nil {
+			bookedVehicle.TotalAmount = *b.TotalCost
+		}
+		if b.PickedUpAt != nil {
+			bookedVehicle.PickedUpAt = b.PickedUpAt.Format(timeLayout)
+		}
+		bookedVehicles = append(bookedVehicles, bookedVehicle)
+	}
+	return bookedVehicles, nil
+}
+
+func (m memoryBookings) CountActive(ctx context.Context, userID int) (int, error) {
+	defer m.s.lock(m.inTx)()
+
+	count := 0
+	for _, b := range m.s.data.bookings {
+		if b.UserID == userID && b.Status == StatusActive {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (m memoryBookings) ActiveForVehicle(ctx context.Context, vehicleID int) ([]Booking, error) {
+	defer m.s.lock(m.inTx)()
+
+	now := time.Now()
+	var bookings []Booking
+	for _, b := range m.s.data.bookings {
+		if b.VehicleID == vehicleID && b.Status == StatusActive && b.EndTime.After(now) {
+			bookings = append(bookings, b)
+		}
+	}
+	sort.Slice(bookings, func(i, j int) bool { return bookings[i].StartTime.Before(bookings[j].StartTime) })
+	return bookings, nil
+}
+
+func (m memoryBookings) ListOverlapping(ctx context.Context, startTime, endTime time.Time) ([]Booking, error) {
+	defer m.s.lock(m.inTx)()
+
+	var bookings []Booking
+	for _, b := range m.s.data.bookings {
+		if b.Status == StatusActive && b.StartTime.Before(endTime) && b.EndTime.After(startTime) {
+			bookings = append(bookings, b)
+		}
+	}
+	sort.Slice(bookings, func(i, j int) bool {
+		if bookings[i].VehicleID != bookings[j].VehicleID {
+			return bookings[i].VehicleID < bookings[j].VehicleID
+		}
+		return bookings[i].StartTime.Before(bookings[j].StartTime)
+	})
+	return bookings, nil
+}
+
+func (m memoryBookings) RentalSummaries(ctx context.Context, period time.Duration) ([]RentalSummary, error) {
+	defer m.s.lock(m.inTx)()
+
+	since := time.Now().Add(-period)
+	byUser := map[int]*RentalSummary{}
+	for _, b := range m.s.data.bookings {
+		if b.Status != StatusCompleted || !b.EndTime.After(since) {
+			continue
+		}
+		summary, ok := byUser[b.UserID]
+		if !ok {
+			summary = &RentalSummary{UserID: b.UserID}
+			byUser[b.UserID] = summary
+		}
+		summary.Rentals++
+		if b.TotalCost != nil {
+			summary.Spend += *b.TotalCost
+		}
+	}
+
+	var summaries []RentalSummary
+	for _, summary := range byUser {
+		summaries = append(summaries, *summary)
+	}
+	sort.Slice(summaries, func(i, j int) bool { return summaries[i].UserID < summaries[j].UserID })
+	return summaries, nil
+}
+
+func (m memoryBookings) Create(ctx context.Context, booking Booking) (int, error) {
+	defer m.s.lock(m.inTx)()
+
+	booking.BookingID = m.s.data.nextBookingID
+	m.s.data.nextBookingID++
+	if booking.Status == "" {
+		booking.Status = StatusActive
+	}
+	if booking.TotalCost == nil {
+		zero := 0.0
+		booking.TotalCost = &zero
+	}
+	// Stored like a DATETIME column: UTC to the second
+	booking.StartTime = booking.StartTime.UTC().Truncate(time.Second)
+	booking.EndTime = booking.EndTime.UTC().Truncate(time.Second)
+	now := time.Now().UTC()
+	booking.CreatedAt, booking.UpdatedAt = now, now
+
+	m.s.data.bookings[booking.BookingID] = booking
+	return booking.BookingID, nil
+}
+
+func (m memoryBookings) UpdateWindow(ctx context.Context, bookingID, userID int, startTime, endTime time.Time) error {
+	defer m.s.lock(m.inTx)()
+
+	b, ok := m.s.data.bookings[bookingID]
+	if !ok || b.UserID != userID {
+		return errBookingNotFound
+	}
+	if b.Status != StatusActive || b.PickedUpAt != nil {
+		return errBookingNotActive
+	}
+	b.StartTime = startTime.UTC().Truncate(time.Second)
+	b.EndTime = endTime.UTC().Truncate(time.Second)
+	b.UpdatedAt = time.Now().UTC()
+	m.s.data.bookings[bookingID] = b
+	return nil
+}
+
+func (m memoryBookings) SetTotalCost(ctx context.Context, bookingID int, totalCost float64) error {
+	defer m.s.lock(m.inTx)()
+
+	if b, ok := m.s.data.bookings[bookingID]; ok {
+		b.TotalCost = &totalCost
+		b.UpdatedAt = time.Now().UTC()
+		m.s.data.bookings[bookingID] = b
+	}
+	return nil
+}
+
+func (m memoryBookings) SetBilled(ctx context.Context, bookingID int, totalCost float64) error {
+	defer m.s.lock(m.inTx)()
+
+	if b, ok := m.s.data.bookings[bookingID]; ok {
+		b.TotalCost, b.BillPending = &totalCost, false
+		b.UpdatedAt = time.Now().UTC()
+		m.s.data.bookings[bookingID] = b
+	}
+	return nil
+}
+
+func (m memoryBookings) SetStatus(ctx context.Context, bookingID int, status string) error {
+	defer m.s.lock(m.inTx)()
+
+	b, ok := m.s.data.bookings[bookingID]
+	if !ok || b.Status != StatusActive {
+		return errBookingNotActive
+	}
+	b.Status = status
+	b.UpdatedAt = time.Now().UTC()
+	m.s.data.bookings[bookingID] = b
+	return nil
+}
+
+func (m memoryBookings) StartTrip(ctx context.Context, bookingID int, reading TripReading) error {
+	defer m.s.lock(m.inTx)()
+
+	b, ok := m.s.data.bookings[bookingID]
+	if !ok || b.Status != StatusActive || b.PickedUpAt != nil {
+		return errTripChanged
+	}
+	at := reading.At.UTC().Truncate(time.Second)
+	charge := reading.ChargeLevel
+	b.PickedUpAt, b.StartOdometerKm, b.StartChargeLevel = &at, reading.OdometerKm, &charge
+	b.UpdatedAt = time.Now().UTC()
+	m.s.data.bookings[bookingID] = b
+	return nil
+}
+
+func (m memoryBookings) EndTrip(ctx context.Context, bookingID int, reading TripReading) error {
+	defer m.s.lock(m.inTx)()
+
+	b, ok := m.s.data.bookings[bookingID]
+	if !ok || b.Status != StatusActive || b.PickedUpAt == nil || b.ReturnedAt != nil {
+		return errTripChanged
+	}
+	at := reading.At.UTC().Truncate(time.Second)
+	charge := reading.ChargeLevel
+	b.Status = StatusCompleted
+	b.ReturnedAt, b.EndOdometerKm, b.EndChargeLevel = &at, reading.OdometerKm, &charge
+	b.BillPending = true
+	b.UpdatedAt = time.Now().UTC()
+	m.s.data.bookings[bookingID] = b
+	return nil
+}
+
+// The waitlist is never used inside transactions
+type memoryWaitlist struct {
+	s *MemoryStore
+}
+
+func (m memoryWaitlist) Join(ctx context.Context, vehicleID, userID int, priority bool) error {
+	m.s.mu.Lock()
+	defer m.s.mu.Unlock()
+
+	m.s.data.waitlist = slices.DeleteFunc(m.s.data.waitlist, func(e WaitlistEntry) bool {
+		return e.VehicleID == vehicleID && e.UserID == userID
+	})
+	m.s.data.waitlist = append(m.s.data.waitlist, WaitlistEntry{
+		EntryID:   m.s.data.nextEntryID,
+		VehicleID: vehicleID,
+		UserID:    userID,
+		Priority:  priority,
+		CreatedAt: time.Now().UTC().Truncate(time.Second),
+	})
+	m.s.data.nextEntryID++
+	return nil
+}
+
+func (m memoryWaitlist) Leave(ctx context.Context, vehicleID, userID int) error {
+	m.s.mu.Lock()
+	defer m.s.mu.Unlock()
+
+	before := len(m.s.data.waitlist)
+	m.s.data.waitlist = slices.DeleteFunc(m.s.data.waitlist, func(e WaitlistEntry) bool {
+		return e.VehicleID == vehicleID && e.UserID == userID
+	})
+	if len(m.s.data.waitlist) == before {
+		return errNotOnWaitlist
+	}
+	return nil
+}
+
+func (m memoryWaitlist) ListByUser(ctx context.Context, userID int) ([]WaitlistEntry, error) {
+	m.s.mu.Lock()
+	defer m.s.mu.Unlock()
+
+	var entries []WaitlistEntry
+	for i := len(m.s.data.waitlist) - 1; i >= 0; i-- {
+		entry := m.s.data.waitlist[i]
+		if entry.UserID != userID {
+			continue
+		}
+		if entry.NotifiedAt == nil {
+			// Priority members are ahead of everyone else, then it's first come first served
+			for _, other := range m.s.data.waitlist {
+				if other.VehicleID == entry.VehicleID && other.NotifiedAt == nil &&
+					((other.Priority && !entry.Priority) || (other.Priority == entry.Priority && other.EntryID <= entry.EntryID)) {
+					entry.Position++
+				}
+			}
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
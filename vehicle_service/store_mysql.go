@@ -0,0 +1,666 @@
+package vehicleservice
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+
+	"github.com/yongkaiyu/CNAD_Assg1/internal/database"
+)
+
+type mysqlStore struct {
+	db *sql.DB
+}
+
+// NewMySQLStore keeps the vehicle service's data in MySQL
+func NewMySQLStore(db *sql.DB) Store {
+	return &mysqlStore{db: db}
+}
+
+func (s *mysqlStore) Vehicles() VehicleStore  { return mysqlVehicles{s.db} }
+func (s *mysqlStore) Bookings() BookingStore  { return mysqlBookings{s.db} }
+func (s *mysqlStore) Waitlist() WaitlistStore { return mysqlWaitlist{s.db} }
+
+func (s *mysqlStore) InTx(ctx context.Context, fn func(vehicles VehicleStore, bookings BookingStore) error) error {
+	return database.InTx(ctx, s.db, func(tx *sql.Tx) error {
+		return fn(mysqlVehicles{tx}, mysqlBookings{tx})
+	})
+}
+
+type mysqlVehicles struct {
+	q database.Queryer
+}
+
+const vehicleColumns = `vehicle_id, license_plate, location, charge_level, status, cleanliness, vehicle_class,
+	latitude, longitude, odometer_km, doors_locked, faults, telemetry_at, retired_at, released_at, created_at, updated_at`
+
+// Parse a nullable DATETIME column
+func parseNullTime(value sql.NullString) *time.Time {
+	if !value.Valid {
+		return nil
+	}
+	t, _ := time.Parse(timeLayout, value.String)
+	return &t
+}
+
+func scanVehicle(row database.Scanner) (Vehicle, error) {
+	var vehicle Vehicle
+	var latitude, longitude, odometer sql.NullFloat64
+	var doorsLocked sql.NullBool
+	var faults, telemetryAt, retiredAt, releasedAt sql.NullString
+	var createdAt, updatedAt string
+	err := row.Scan(&vehicle.VehicleID, &vehicle.LicensePlate, &vehicle.Location, &vehicle.ChargeLevel,
+		&vehicle.Status, &vehicle.Cleanliness, &vehicle.VehicleClass, &latitude, &longitude,
+		&odometer, &doorsLocked, &faults, &telemetryAt, &retiredAt, &releasedAt, &createdAt, &updatedAt)
+	if err != nil {
+		return vehicle, err
+	}
+	if latitude.Valid && longitude.Valid {
+		vehicle.Latitude, vehicle.Longitude = &latitude.Float64, &longitude.Float64
+	}
+	if odometer.Valid {
+		vehicle.OdometerKm = &odometer.Float64
+	}
+	if doorsLocked.Valid {
+		vehicle.DoorsLocked = &doorsLocked.Bool
+	}
+	vehicle.Faults = splitFaults(faults)
+	vehicle.TelemetryAt = parseNullTime(telemetryAt)
+	vehicle.RetiredAt = parseNullTime(retiredAt)
+	vehicle.ReleasedAt = parseNullTime(releasedAt)
+	vehicle.CreatedAt, _ = time.Parse(timeLayout, createdAt)
+	vehicle.UpdatedAt, _ = time.Parse(timeLayout, updatedAt)
+	return vehicle, nil
+}
+
+func scanVehicles(rows *sql.Rows) ([]Vehicle, error) {
+	defer rows.Close()
+
+	var vehicles []Vehicle
+	for rows.Next() {
+		vehicle, err := scanVehicle(rows)
+		if err != nil {
+			return nil, err
+		}
+		vehicles = append(vehicles, vehicle)
+	}
+	return vehicles, rows.Err()
+}
+
+func (m mysqlVehicles) ListAvailable(ctx context.Context, minChargeLevel int) ([]Vehicle, error) {
+	rows, err := m.q.QueryContext(ctx, `
+		SELECT `+vehicleColumns+`
+		FROM vehicles
+		WHERE status = 'Available' AND retired_at IS NULL AND charge_level >= ?
+		ORDER BY vehicle_id`, minChargeLevel)
+	if err != nil {
+		return nil, err
+	}
+	return scanVehicles(rows)
+}
+
+func (m mysqlVehicles) List(ctx context.Context, filter VehicleFilter) ([]Vehicle, error) {
+	query := `SELECT ` + vehicleColumns + ` FROM vehicles WHERE 1 = 1`
+	var args []interface{}
+	if filter.Status != "" {
+		query += ` AND status = ?`
+		args = append(args, filter.Status)
+	}
+	if !filter.IncludeRetired {
+		query += ` AND retired_at IS NULL`
+	}
+	query += ` ORDER BY vehicle_id`
+
+	rows, err := m.q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	return scanVehicles(rows)
+}
+
+func (m mysqlVehicles) Get(ctx context.Context, vehicleID int) (*Vehicle, error) {
+	return m.get(ctx, `SELECT `+vehicleColumns+` FROM vehicles WHERE vehicle_id = ?`, vehicleID)
+}
+
+func (m mysqlVehicles) Lock(ctx context.Context, vehicleID int) (*Vehicle, error) {
+	return m.get(ctx, `SELECT `+vehicleColumns+` FROM vehicles WHERE vehicle_id = ? FOR UPDATE`, vehicleID)
+}
+
+func (m mysqlVehicles) get(ctx context.Context, query string, vehicleID int) (*Vehicle, error) {
+	vehicle, err := scanVehicle(m.q.QueryRowContext(ctx, query, vehicleID))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, errVehicleNotFound
+		}
+		return nil, err
+	}
+	return &vehicle, nil
+}
+
+func (m mysqlVehicles) Create(ctx context.Context, vehicle Vehicle) (int, error) {
+	result, err := m.q.ExecContext(ctx, `
+		INSERT INTO vehicles (license_plate, location, charge_level, status, cleanliness, vehicle_class,
+			latitude, longitude, released_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, IF(? = 'Available', UTC_TIMESTAMP(), NULL))`,
+		vehicle.LicensePlate, vehicle.Location, vehicle.ChargeLevel, vehicle.Status, vehicle.Cleanliness, vehicle.VehicleClass,
+		vehicle.Latitude, vehicle.Longitude, vehicle.Status)
+	if err != nil {
+		if database.IsDuplicate(err) {
+			return 0, errLicensePlateTaken
+		}
+		return 0, err
+	}
+	vehicleID, err := result.LastInsertId()
+	return int(vehicleID), err
+}
+
+func (m mysqlVehicles) Update(ctx context.Context, vehicle Vehicle) error {
+	_, err := m.q.ExecContext(ctx, `
+		UPDATE vehicles
+		SET license_plate = ?, location = ?, charge_level = ?, cleanliness = ?, vehicle_class = ?,
+			latitude = ?, longitude = ?
+		WHERE vehicle_id = ?`,
+		vehicle.LicensePlate, vehicle.Location, vehicle.ChargeLevel, vehicle.Cleanliness, vehicle.VehicleClass,
+		vehicle.Latitude, vehicle.Longitude, vehicle.VehicleID)
+	if database.IsDuplicate(err) {
+		return errLicensePlateTaken
+	}
+	return err
+}
+
+func (m mysqlVehicles) Retire(ctx context.Context, vehicleID int) error {
+	result, err := m.q.ExecContext(ctx, `UPDATE vehicles SET retired_at = UTC_TIMESTAMP() WHERE vehicle_id = ? AND retired_at IS NULL`, vehicleID)
+	if err != nil {
+		return err
+	}
+	return database.RequireRow(result, errVehicleNotFound)
+}
+
+func (m mysqlVehicles) LockForWindow(ctx context.Context, vehicleID int, startTime, endTime time.Time, excludeBookingID int) error {
+	var status string
+	var retired bool
+	err := m.q.QueryRowContext(ctx, `SELECT status, retired_at IS NOT NULL FROM vehicles WHERE vehicle_id = ? FOR UPDATE`, vehicleID).Scan(&status, &retired)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return errVehicleNotFound
+		}
+		return err
+	}
+	if status == StatusMaintenance || retired {
+		return errVehicleUnavailable
+	}
+
+	var overlapping int
+	err = m.q.QueryRowContext(ctx, `
+		SELECT COUNT(*)
+		FROM bookings
+		WHERE vehicle_id = ? AND status = 'Active' AND booking_id <> ?
+		AND start_time < ? AND end_time > ?`,
+		vehicleID, excludeBookingID, endTime, startTime).Scan(&overlapping)
+	if err != nil {
+		return err
+	}
+	if overlapping > 0 {
+		return errBookingConflict
+	}
+
+	return nil
+}
+
+func (m mysqlVehicles) SetStatus(ctx context.Context, vehicleID int, status string) error {
+	_, err := m.q.ExecContext(ctx, `UPDATE vehicles SET status = ? WHERE vehicle_id = ? AND status <> 'Maintenance'`, status, vehicleID)
+	return err
+}
+
+func (m mysqlVehicles) ChangeStatus(ctx context.Context, vehicleID int, status string) error {
+	_, err := m.q.ExecContext(ctx, `UPDATE vehicles SET status = ? WHERE vehicle_id = ?`, status, vehicleID)
+	return err
+}
+
+func (m mysqlVehicles) UpdateCondition(ctx context.Context, vehicle Vehicle) error {
+	_, err := m.q.ExecContext(ctx, `
+		UPDATE vehicles
+		SET location = ?, charge_level = ?, cleanliness = ?,
+			latitude = COALESCE(?, latitude), longitude = COALESCE(?, longitude)
+		WHERE vehicle_id = ?`,
+		vehicle.Location, vehicle.ChargeLevel, vehicle.Cleanliness, vehicle.Latitude, vehicle.Longitude, vehicle.VehicleID)
+	return err
+}
+
+func (m mysqlVehicles) Release(ctx context.Context, vehicleID int) error {
+	_, err := m.q.ExecContext(ctx, `UPDATE vehicles SET released_at = UTC_TIMESTAMP() WHERE vehicle_id = ?`, vehicleID)
+	return err
+}
+
+// Fault codes are stored comma separated. NULL means not reported, an empty string no faults.
+func joinFaults(faults []string) sql.NullString {
+	return sql.NullString{String: strings.Join(faults, ","), Valid: faults != nil}
+}
+
+func splitFaults(faults sql.NullString) []string {
+	if !faults.Valid || faults.String == "" {
+		return nil
+	}
+	return strings.Split(faults.String, ",")
+}
+
+func (m mysqlVehicles) RecordTelemetry(ctx context.Context, reading TelemetryReading) error {
+	_, err := m.q.ExecContext(ctx, `
+		INSERT INTO telemetry_readings (vehicle_id, recorded_at, charge_level, odometer_km, latitude, longitude,
+			doors_locked, faults)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		reading.VehicleID, reading.RecordedAt, reading.ChargeLevel, reading.OdometerKm, reading.Latitude, reading.Longitude,
+		reading.DoorsLocked, joinFaults(reading.Faults))
+	return err
+}
+
+func (m mysqlVehicles) ApplyTelemetry(ctx context.Context, reading TelemetryReading) error {
+	_, err := m.q.ExecContext(ctx, `
+		UPDATE vehicles
+		SET charge_level = COALESCE(?, charge_level), odometer_km = COALESCE(?, odometer_km),
+			latitude = COALESCE(?, latitude), longitude = COALESCE(?, longitude),
+			doors_locked = COALESCE(?, doors_locked), faults = COALESCE(?, faults), telemetry_at = ?
+		WHERE vehicle_id = ? AND (telemetry_at IS NULL OR telemetry_at <= ?)`,
+		reading.ChargeLevel, reading.OdometerKm, reading.Latitude, reading.Longitude,
+		reading.DoorsLocked, joinFaults(reading.Faults), reading.RecordedAt,
+		reading.VehicleID, reading.RecordedAt)
+	return err
+}
+
+func (m mysqlVehicles) Telemetry(ctx context.Context, vehicleID int, from, to time.Time, limit int) ([]TelemetryReading, error) {
+	rows, err := m.q.QueryContext(ctx, `
+		SELECT reading_id, vehicle_id, recorded_at, charge_level, odometer_km, latitude, longitude, doors_locked, faults
+		FROM telemetry_readings
+		WHERE vehicle_id = ? AND recorded_at >= ? AND recorded_at < ?
+		ORDER BY recorded_at DESC, reading_id DESC
+		LIMIT ?`, vehicleID, from, to, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var readings []TelemetryReading
+	for rows.Next() {
+		var reading TelemetryReading
+		var recordedAt string
+		var chargeLevel sql.NullInt64
+		var odometer, latitude, longitude sql.NullFloat64
+		var doorsLocked sql.NullBool
+		var faults sql.NullString
+		err := rows.Scan(&reading.ReadingID, &reading.VehicleID, &recordedAt, &chargeLevel, &odometer,
+			&latitude, &longitude, &doorsLocked, &faults)
+		if err != nil {
+			return nil, err
+		}
+		reading.RecordedAt, _ = time.Parse(timeLayout, recordedAt)
+		if chargeLevel.Valid {
+			level := int(chargeLevel.Int64)
+			reading.ChargeLevel = &level
+		}
+		if odometer.Valid {
+			reading.OdometerKm = &odometer.Float64
+		}
+		if latitude.Valid && longitude.Valid {
+			reading.Latitude, reading.Longitude = &latitude.Float64, &longitude.Float64
+		}
+		if doorsLocked.Valid {
+			reading.DoorsLocked = &doorsLocked.Bool
+		}
+		reading.Faults = splitFaults(faults)
+		readings = append(readings, reading)
+	}
+	return readings, rows.Err()
+}
+
+func (m mysqlVehicles) RecordChange(ctx context.Context, change VehicleChange) error {
+	_, err := m.q.ExecContext(ctx, `
+		INSERT INTO vehicle_changes (vehicle_id, changed_by, action, from_status, to_status, details, reason)
+		VALUES (?, ?, ?, NULLIF(?, ''), NULLIF(?, ''), ?, ?)`,
+		change.VehicleID, change.ChangedBy, change.Action, change.FromStatus, change.ToStatus, change.Details, change.Reason)
+	return err
+}
+
+func (m mysqlVehicles) Changes(ctx context.Context, vehicleID int) ([]VehicleChange, error) {
+	rows, err := m.q.QueryContext(ctx, `
+		SELECT change_id, vehicle_id, changed_by, action, COALESCE(from_status, ''), COALESCE(to_status, ''),
+			details, reason, created_at
+		FROM vehicle_changes
+		WHERE vehicle_id = ?
+		ORDER BY change_id DESC`, vehicleID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var changes []VehicleChange
+	for rows.Next() {
+		var change VehicleChange
+		var createdAt string
+		if err := rows.Scan(&change.ChangeID, &change.VehicleID, &change.ChangedBy, &change.Action, &change.FromStatus,
+			&change.ToStatus, &change.Details, &change.Reason, &createdAt); err != nil {
+			return nil, err
+		}
+		change.CreatedAt, _ = time.Parse(timeLayout, createdAt)
+		changes = append(changes, change)
+	}
+	return changes, rows.Err()
+}
+
+type mysqlBookings struct {
+	q database.Queryer
+}
+
+const bookingColumns = `booking_id, user_id, vehicle_id, start_time, end_time, status, total_cost, created_at, updated_at,
+	picked_up_at, returned_at, start_odometer_km, end_odometer_km, start_charge_level, end_charge_level, bill_pending`
+
+func scanBooking(row database.Scanner) (Booking, error) {
+	var booking Booking
+	var startTime, endTime, createdAt, updatedAt string
+	var totalCost, startOdometer, endOdometer sql.NullFloat64
+	var pickedUpAt, returnedAt sql.NullString
+	var startCharge, endCharge sql.NullInt64
+	err := row.Scan(&booking.BookingID, &booking.UserID, &booking.VehicleID, &startTime, &endTime,
+		&booking.Status, &totalCost, &createdAt, &updatedAt,
+		&pickedUpAt, &returnedAt, &startOdometer, &endOdometer, &startCharge, &endCharge, &booking.BillPending)
+	if err != nil {
+		return booking, err
+	}
+	booking.PickedUpAt = parseNullTime(pickedUpAt)
+	booking.ReturnedAt = parseNullTime(returnedAt)
+	if startOdometer.Valid {
+		booking.StartOdometerKm = &startOdometer.Float64
+	}
+	if endOdometer.Valid {
+		booking.EndOdometerKm = &endOdometer.Float64
+	}
+	if startCharge.Valid {
+		level := int(startCharge.Int64)
+		booking.StartChargeLevel = &level
+	}
+	if endCharge.Valid {
+		level := int(endCharge.Int64)
+		booking.EndChargeLevel = &level
+	}
+	booking.StartTime, _ = time.Parse(timeLayout, startTime)
+	booking.EndTime, _ = time.Parse(timeLayout, endTime)
+	booking.CreatedAt, _ = time.Parse(timeLayout, createdAt)
+	booking.UpdatedAt, _ = time.Parse(timeLayout, updatedAt)
+	if totalCost.Valid {
+		booking.TotalCost = &totalCost.Float64
+	}
+	return booking, nil
+}
+
+func (m mysqlBookings) Get(ctx context.Context, bookingID int) (*Booking, error) {
+	booking, err := scanBooking(m.q.QueryRowContext(ctx, `SELECT `+bookingColumns+` FROM bookings WHERE booking_id = ?`, bookingID))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, errBookingNotFound
+		}
+		return nil, err
+	}
+	return &booking, nil
+}
+
+func (m mysqlBookings) ListByUser(ctx context.Context, userID int, status string) ([]Booking, error) {
+	query := `SELECT ` + bookingColumns + ` FROM bookings WHERE user_id = ?`
+	args := []interface{}{userID}
+	if status != "" {
+		query += ` AND status = ?`
+		args = append(args, status)
+	}
+	query += ` ORDER BY updated_at DESC`
+
+	rows, err := m.q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var bookings []Booking
+	for rows.Next() {
+		booking, err := scanBooking(rows)
+		if err != nil {
+			return nil, err
+		}
+		bookings = append(bookings, booking)
+	}
+	return bookings, rows.Err()
+}
+
+func (m mysqlBookings) ListBookedVehicles(ctx context.Context, userID int) ([]BookedVehicle, error) {
+	rows, err := m.q.QueryContext(ctx, `
+		SELECT
+			b.booking_id, v.vehicle_id, v.license_plate, v.location, v.charge_level, v.status,
+			b.start_time, b.end_time, b.total_cost, COALESCE(b.picked_up_at, '')
+		FROM
+			bookings b
+		INNER JOIN
+			vehicles v ON b.vehicle_id = v.vehicle_id
+		WHERE
+			b.user_id = ? AND b.status = 'Active'
+		ORDER BY
+			b.start_time ASC`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var bookedVehicles []BookedVehicle
+	for rows.Next() {
+		var vehicle BookedVehicle
+		var totalAmount sql.NullFloat64
+		if err := rows.Scan(&vehicle.BookingID, &vehicle.VehicleID, &vehicle.LicensePlate, &vehicle.Location, &vehicle.ChargeLevel,
+			&vehicle.Status, &vehicle.StartTime, &vehicle.EndTime, &totalAmount, &vehicle.PickedUpAt); err != nil {
+			return nil, err
+		}
+		vehicle.TotalAmount = totalAmount.Float64
+		bookedVehicles = append(bookedVehicles, vehicle)
+	}
+	return bookedVehicles, rows.Err()
+}
+
+func (m mysqlBookings) CountActive(ctx context.Context, userID int) (int, error) {
+	var count int
+	err := m.q.QueryRowContext(ctx, `
+		SELECT COUNT(*)
+		FROM bookings
+		WHERE user_id = ? AND status = 'Active'
+		FOR UPDATE`, userID).Scan(&count)
+	return count, err
+}
+
+func (m mysqlBookings) ActiveForVehicle(ctx context.Context, vehicleID int) ([]Booking, error) {
+	rows, err := m.q.QueryContext(ctx, `
+		SELECT `+bookingColumns+`
+		FROM bookings
+		WHERE vehicle_id = ? AND status = 'Active' AND end_time > UTC_TIMESTAMP()
+		ORDER BY start_time`, vehicleID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var bookings []Booking
+	for rows.Next() {
+		booking, err := scanBooking(rows)
+		if err != nil {
+			return nil, err
+		}
+		bookings = append(bookings, booking)
+	}
+	return bookings, rows.Err()
+}
+
+func (m mysqlBookings) ListOverlapping(ctx context.Context, startTime, endTime time.Time) ([]Booking, error) {
+	rows, err := m.q.QueryContext(ctx, `
+		SELECT `+bookingColumns+`
+		FROM bookings
+		WHERE status = 'Active' AND start_time < ? AND end_time > ?
+		ORDER BY vehicle_id, start_time`, endTime, startTime)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var bookings []Booking
+	for rows.Next() {
+		booking, err := scanBooking(rows)
+		if err != nil {
+			return nil, err
+		}
+		bookings = append(bookings, booking)
+	}
+	return bookings, rows.Err()
+}
+
+func (m mysqlBookings) RentalSummaries(ctx context.Context, period time.Duration) ([]RentalSummary, error) {
+	rows, err := m.q.QueryContext(ctx, `
+		SELECT user_id, COUNT(*), COALESCE(SUM(total_cost), 0)
+		FROM bookings
+		WHERE status = 'Completed' AND end_time > UTC_TIMESTAMP() - INTERVAL ? SECOND
+		GROUP BY user_id
+		ORDER BY user_id`, int(period.Seconds()))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var summaries []RentalSummary
+	for rows.Next() {
+		var summary RentalSummary
+		if err := rows.Scan(&summary.UserID, &summary.Rentals, &summary.Spend); err != nil {
+			return nil, err
+		}
+		summaries = append(summaries, summary)
+	}
+	return summaries, rows.Err()
+}
+
+func (m mysqlBookings) Create(ctx context.Context, booking Booking) (int, error) {
+	var totalCost float64
+	if booking.TotalCost != nil {
+		totalCost = *booking.TotalCost
+	}
+
+	result, err := m.q.ExecContext(ctx, `
+		INSERT INTO bookings (user_id, vehicle_id, start_time, end_time, total_cost, bill_pending)
+		VALUES (?, ?, ?, ?, ?, ?)`,
+		booking.UserID, booking.VehicleID, booking.StartTime, booking.EndTime, totalCost, booking.BillPending)
+	if err != nil {
+		return 0, err
+	}
+
+	bookingID, err := result.LastInsertId()
+	return int(bookingID), err
+}
+
+func (m mysqlBookings) UpdateWindow(ctx context.Context, bookingID, userID int, startTime, endTime time.Time) error {
+	result, err := m.q.ExecContext(ctx, `
+		UPDATE bookings
+		SET start_time = ?, end_time = ?
+		WHERE booking_id = ? AND user_id = ? AND status = 'Active' AND picked_up_at IS NULL`,
+		startTime, endTime, bookingID, userID)
+	if err != nil {
+		return err
+	}
+	return database.RequireRow(result, errBookingNotActive)
+}
+
+func (m mysqlBookings) SetTotalCost(ctx context.Context, bookingID int, totalCost float64) error {
+	_, err := m.q.ExecContext(ctx, `UPDATE bookings SET total_cost = ? WHERE booking_id = ?`, totalCost, bookingID)
+	return err
+}
+
+func (m mysqlBookings) SetBilled(ctx context.Context, bookingID int, totalCost float64) error {
+	_, err := m.q.ExecContext(ctx, `UPDATE bookings SET total_cost = ?, bill_pending = FALSE WHERE booking_id = ?`, totalCost, bookingID)
+	return err
+}
+
+func (m mysqlBookings) SetStatus(ctx context.Context, bookingID int, status string) error {
+	result, err := m.q.ExecContext(ctx, `UPDATE bookings SET status = ? WHERE booking_id = ? AND status = ?`,
+		status, bookingID, StatusActive)
+	if err != nil {
+		return err
+	}
+	return database.RequireRow(result, errBookingNotActive)
+}
+
+func (m mysqlBookings) StartTrip(ctx context.Context, bookingID int, reading TripReading) error {
+	result, err := m.q.ExecContext(ctx, `
+		UPDATE bookings
+		SET picked_up_at = ?, start_odometer_km = ?, start_charge_level = ?
+		WHERE booking_id = ? AND status = 'Active' AND picked_up_at IS NULL`,
+		reading.At, reading.OdometerKm, reading.ChargeLevel, bookingID)
+	if err != nil {
+		return err
+	}
+	return database.RequireRow(result, errTripChanged)
+}
+
+func (m mysqlBookings) EndTrip(ctx context.Context, bookingID int, reading TripReading) error {
+	result, err := m.q.ExecContext(ctx, `
+		UPDATE bookings
+		SET status = 'Completed', returned_at = ?, end_odometer_km = ?, end_charge_level = ?, bill_pending = TRUE
+		WHERE booking_id = ? AND status = 'Active' AND picked_up_at IS NOT NULL AND returned_at IS NULL`,
+		reading.At, reading.OdometerKm, reading.ChargeLevel, bookingID)
+	if err != nil {
+		return err
+	}
+	return database.RequireRow(result, errTripChanged)
+}
+
+type mysqlWaitlist struct {
+	q database.Queryer
+}
+
+func (m mysqlWaitlist) Join(ctx context.Context, vehicleID, userID int, priority bool) error {
+	// REPLACE gives an existing entry a new ID, which sends it to the back of the queue
+	_, err := m.q.ExecContext(ctx, `
+		REPLACE INTO waitlist_entries (vehicle_id, user_id, priority)
+		VALUES (?, ?, ?)`,
+		vehicleID, userID, priority)
+	return err
+}
+
+func (m mysqlWaitlist) Leave(ctx context.Context, vehicleID, userID int) error {
+	result, err := m.q.ExecContext(ctx, `DELETE FROM waitlist_entries WHERE vehicle_id = ? AND user_id = ?`, vehicleID, userID)
+	if err != nil {
+		return err
+	}
+	return database.RequireRow(result, errNotOnWaitlist)
+}
+
+func (m mysqlWaitlist) ListByUser(ctx context.Context, userID int) ([]WaitlistEntry, error) {
+	// Priority members are ahead of everyone else, then it's first come first served
+	rows, err := m.q.QueryContext(ctx, `
+		SELECT w.entry_id, w.vehicle_id, w.user_id, w.priority, w.created_at, w.notified_at,
+			IF(w.notified_at IS NULL, (
+				SELECT COUNT(*) FROM waitlist_entries o
+				WHERE o.vehicle_id = w.vehicle_id AND o.notified_at IS NULL
+				AND (o.priority > w.priority OR (o.priority = w.priority AND o.entry_id <= w.entry_id))
+			), 0)
+		FROM waitlist_entries w
+		WHERE w.user_id = ?
+		ORDER BY w.entry_id DESC`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []WaitlistEntry
+	for rows.Next() {
+		var entry WaitlistEntry
+		var createdAt string
+		var notifiedAt sql.NullString
+		if err := rows.Scan(&entry.EntryID, &entry.VehicleID, &entry.UserID, &entry.Priority,
+			&createdAt, &notifiedAt, &entry.Position); err != nil {
+			return nil, err
+		}
+		entry.CreatedAt, _ = time.Parse(timeLayout, createdAt)
+		entry.NotifiedAt = parseNullTime(notifiedAt)
+		entries = append(entries, entry)
+	}
+	return entries, rows.Err()
+}
@@ -0,0 +1,282 @@
+package vehicleservice
+
+import (
+	"context"
+	"crypto/hmac"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/gorilla/websocket"
+)
+
+/* Telemetry: in-car units report battery, odometer, GPS, door locks and faults, either in
+   batches over HTTP or one reading per message over a WebSocket. Every reading is kept, and
+   the latest values are copied onto the vehicle. */
+
+const (
+	maxTelemetryBytes = 1 << 20
+	maxTelemetryBatch = 500
+	// Fault codes are stored comma separated, so the list has to fit in faults VARCHAR(500)
+	maxFaults = 15
+	// How far ahead of our clock a unit's clock may be
+	maxClockSkew = 5 * time.Minute
+	// A stream with nothing to say for this long is closed
+	telemetryIdleTimeout = 2 * time.Minute
+
+	defaultTelemetryLimit = 100
+	maxTelemetryLimit     = 1000
+)
+
+var faultCode = regexp.MustCompile(`^[A-Za-z0-9_-]{1,32}$`)
+
+var upgrader = websocket.Upgrader{
+	// In-car units aren't browsers, they prove who they are with the telemetry key
+	CheckOrigin: func(r *http.Request) bool { return true },
+}
+
+// unknownVehicleError is returned when telemetry arrives for a vehicle that isn't in the fleet
+type unknownVehicleError struct {
+	vehicleID int
+}
+
+func (e *unknownVehicleError) Error() string {
+	return fmt.Sprintf("Vehicle %d is not in the fleet", e.vehicleID)
+}
+
+// Only let through in-car units that send the telemetry key. Without a key nothing gets through.
+func (s *Server) requireTelemetryKey(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := s.cfg.TelemetryKey
+		if key == "" || !hmac.Equal([]byte(r.Header.Get("X-Telemetry-Key")), []byte(key)) {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func validateReading(reading *TelemetryReading) error {
+	switch {
+	case reading.VehicleID <= 0:
+		return errors.New("vehicle_id is required")
+	case reading.RecordedAt.IsZero():
+		return errors.New("recorded_at is required")
+	case reading.RecordedAt.After(time.Now().Add(maxClockSkew)):
+		return errors.New("recorded_at is in the future")
+	case reading.ChargeLevel != nil && (*reading.ChargeLevel < 0 || *reading.ChargeLevel > 100):
+		return errors.New("charge_level must be between 0 and 100")
+	case reading.OdometerKm != nil && *reading.OdometerKm < 0:
+		return errors.New("odometer_km must not be negative")
+	case len(reading.Faults) > maxFaults:
+		return fmt.Errorf("at most %d faults can be reported at once", maxFaults)
+	}
+	if err := validateCoordinates(reading.Latitude, reading.Longitude); err != nil {
+		return err
+	}
+	for _, fault := range reading.Faults {
+		if !faultCode.MatchString(fault) {
+			return fmt.Errorf("invalid fault code %q", fault)
+		}
+	}
+
+	// Stored to the second, like every other time
+	reading.RecordedAt = reading.RecordedAt.UTC().Truncate(time.Second)
+	return nil
+}
+
+// Store valid readings and bring their vehicles up to date. Either every reading is
+// stored or none is.
+func (s *Server) ingestTelemetry(ctx context.Context, readings []TelemetryReading) error {
+	// Lock vehicles in ID order so two batches can't deadlock, and apply oldest first
+	sort.SliceStable(readings, func(i, j int) bool {
+		if readings[i].VehicleID != readings[j].VehicleID {
+			return readings[i].VehicleID < readings[j].VehicleID
+		}
+		return readings[i].RecordedAt.Before(readings[j].RecordedAt)
+	})
+
+	return s.store.InTx(ctx, func(vehicles VehicleStore, bookings BookingStore) error {
+		for start := 0; start < len(readings); {
+			vehicleID := readings[start].VehicleID
+			end := start
+			for end < len(readings) && readings[end].VehicleID == vehicleID {
+				end++
+			}
+
+			before, err := vehicles.Lock(ctx, vehicleID)
+			if errors.Is(err, errVehicleNotFound) || (err == nil && before.RetiredAt != nil) {
+				return &unknownVehicleError{vehicleID}
+			}
+			if err != nil {
+				return err
+			}
+			for _, reading := range readings[start:end] {
+				if err := vehicles.RecordTelemetry(ctx, reading); err != nil {
+					return err
+				}
+				if err := vehicles.ApplyTelemetry(ctx, reading); err != nil {
+					return err
+				}
+			}
+
+			after, err := vehicles.Get(ctx, vehicleID)
+			if err != nil {
+				return err
+			}
+			if s.chargedUp(*before, *after) {
+				if err := vehicles.Release(ctx, vehicleID); err != nil {
+					return err
+				}
+			}
+			start = end
+		}
+		return nil
+	})
+}
+
+// A batch of readings as a JSON array, from one or more vehicles
+func (s *Server) telemetryBatchHandler(w http.ResponseWriter, r *http.Request) {
+	var readings []TelemetryReading
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxTelemetryBytes)).Decode(&readings); err != nil {
+		http.Error(w, "Invalid input", http.StatusBadRequest)
+		return
+	}
+	if len(readings) == 0 || len(readings) > maxTelemetryBatch {
+		http.Error(w, fmt.Sprintf("Send between 1 and %d readings at once", maxTelemetryBatch), http.StatusBadRequest)
+		return
+	}
+	for i := range readings {
+		if err := validateReading(&readings[i]); err != nil {
+			http.Error(w, fmt.Sprintf("Reading %d: %v", i+1, err), http.StatusBadRequest)
+			return
+		}
+	}
+
+	if err := s.ingestTelemetry(r.Context(), readings); err != nil {
+		var unknown *unknownVehicleError
+		if errors.As(err, &unknown) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		log.Printf("Error storing %d telemetry reading(s): %v", len(readings), err)
+		http.Error(w, "Error storing telemetry", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]int{"accepted": len(readings)})
+}
+
+// What the server answers each streamed reading with
+type telemetryAck struct {
+	Accepted int    `json:"accepted"`
+	Error    string `json:"error,omitempty"`
+}
+
+// A WebSocket over which a unit sends one reading per message. Each is answered with an
+// ack, and a bad reading doesn't close the stream.
+func (s *Server) telemetryStreamHandler(w http.ResponseWriter, r *http.Request) {
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// The upgrader has already answered the request
+		log.Printf("Error opening telemetry stream: %v", err)
+		return
+	}
+	defer conn.Close()
+	conn.SetReadLimit(maxTelemetryBytes)
+
+	for {
+		conn.SetReadDeadline(time.Now().Add(telemetryIdleTimeout))
+		_, message, err := conn.ReadMessage()
+		if err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+				log.Printf("Telemetry stream from %s closed: %v", r.RemoteAddr, err)
+			}
+			return
+		}
+		if err := conn.WriteJSON(s.streamedReading(r.Context(), message)); err != nil {
+			return
+		}
+	}
+}
+
+func (s *Server) streamedReading(ctx context.Context, message []byte) telemetryAck {
+	var reading TelemetryReading
+	if err := json.Unmarshal(message, &reading); err != nil {
+		return telemetryAck{Error: "Invalid input"}
+	}
+	if err := validateReading(&reading); err != nil {
+		return telemetryAck{Error: err.Error()}
+	}
+
+	err := s.ingestTelemetry(ctx, []TelemetryReading{reading})
+	var unknown *unknownVehicleError
+	switch {
+	case errors.As(err, &unknown):
+		return telemetryAck{Error: err.Error()}
+	case err != nil:
+		log.Printf("Error storing telemetry for vehicle %d: %v", reading.VehicleID, err)
+		return telemetryAck{Error: "Error storing telemetry"}
+	}
+	return telemetryAck{Accepted: 1}
+}
+
+// A vehicle's readings, latest first. ?from= and ?to= bound the time (the last day by
+// default) and ?limit= the number of readings.
+func (s *Server) vehicleTelemetryHandler(w http.ResponseWriter, r *http.Request) {
+	vehicleID, _ := strconv.Atoi(mux.Vars(r)["vehicleId"])
+	query := r.URL.Query()
+
+	to := time.Now().UTC()
+	if value := query.Get("to"); value != "" {
+		t, err := parseBookingTime(value)
+		if err != nil {
+			http.Error(w, "Invalid to", http.StatusBadRequest)
+			return
+		}
+		to = t
+	}
+	from := to.Add(-24 * time.Hour)
+	if value := query.Get("from"); value != "" {
+		t, err := parseBookingTime(value)
+		if err != nil || !t.Before(to) {
+			http.Error(w, "from must be a time before to", http.StatusBadRequest)
+			return
+		}
+		from = t
+	}
+	limit := defaultTelemetryLimit
+	if value := query.Get("limit"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 || n > maxTelemetryLimit {
+			http.Error(w, fmt.Sprintf("limit must be between 1 and %d", maxTelemetryLimit), http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+
+	if _, err := s.store.Vehicles().Get(r.Context(), vehicleID); err != nil {
+		writeFleetError(w, err)
+		return
+	}
+	readings, err := s.store.Vehicles().Telemetry(r.Context(), vehicleID, from, to, limit)
+	if err != nil {
+		log.Printf("Error fetching telemetry of vehicle %d: %v", vehicleID, err)
+		http.Error(w, "Error fetching telemetry", http.StatusInternalServerError)
+		return
+	}
+	if readings == nil {
+		readings = []TelemetryReading{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(readings)
+}
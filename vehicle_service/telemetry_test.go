@@ -0,0 +1,42 @@
+package vehicleservice
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/yongkaiyu/CNAD_Assg1/internal/config"
+)
+
+func TestRequireTelemetryKey(t *testing.T) {
+	tests := []struct {
+		name       string
+		configured string
+		sent       string
+		want       int
+	}{
+		{"right key", "unit-key", "unit-key", http.StatusNoContent},
+		{"wrong key", "unit-key", "guess", http.StatusForbidden},
+		{"no key sent", "unit-key", "", http.StatusForbidden},
+		{"no key configured", "", "", http.StatusForbidden},
+		{"no key configured, one sent", "", "unit-key", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := NewServer(NewMemoryStore(), nil, nil, nopNotifier{}, &FakeCommander{}, config.Vehicles{TelemetryKey: tt.configured})
+			handler := server.requireTelemetryKey(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusNoContent)
+			}))
+
+			req := httptest.NewRequest(http.MethodPost, "/api/v1/telemetry", nil)
+			if tt.sent != "" {
+				req.Header.Set("X-Telemetry-Key", tt.sent)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			if rec.Code != tt.want {
+				t.Errorf("status = %d, want %d", rec.Code, tt.want)
+			}
+		})
+	}
+}
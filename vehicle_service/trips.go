@@ -0,0 +1,253 @@
+package vehicleservice
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/yongkaiyu/CNAD_Assg1/internal/auth"
+	"github.com/yongkaiyu/CNAD_Assg1/internal/clients"
+)
+
+/* Trips: the customer starts a trip when they pick the vehicle up, which unlocks it, and ends
+   it when they return it, which locks it again. The bill is then based on the trip rather
+   than the booked window. */
+
+// How long before the booked start a vehicle can be picked up
+const pickupEarly = 15 * time.Minute
+
+// The caller's booking from the path, or an error response
+func (s *Server) tripBooking(w http.ResponseWriter, r *http.Request) (*Booking, bool) {
+	bookingID, err := strconv.Atoi(mux.Vars(r)["bookingId"])
+	if err != nil {
+		http.Error(w, "Invalid booking ID", http.StatusBadRequest)
+		return nil, false
+	}
+
+	booking, err := s.store.Bookings().Get(r.Context(), bookingID)
+	if err == nil && booking.UserID != auth.UserID(r) {
+		err = errBookingNotFound
+	}
+	if err != nil {
+		if errors.Is(err, errBookingNotFound) {
+			http.Error(w, "Booking not found or unauthorized", http.StatusNotFound)
+			return nil, false
+		}
+		log.Printf("Error fetching booking %d: %v", bookingID, err)
+		http.Error(w, "Error fetching booking details", http.StatusInternalServerError)
+		return nil, false
+	}
+	if booking.Status != StatusActive {
+		http.Error(w, "This booking is no longer active", http.StatusConflict)
+		return nil, false
+	}
+	return booking, true
+}
+
+// Relock a vehicle unlocked for a trip that then couldn't be recorded
+func (s *Server) relock(vehicleID int) {
+	if err := s.commander.Lock(context.Background(), vehicleID); err != nil {
+		log.Printf("Error relocking vehicle %d: %v", vehicleID, err)
+	}
+}
+
+// Pick up the booked vehicle: unlock it and record when, and its odometer and charge
+func (s *Server) startTripHandler(w http.ResponseWriter, r *http.Request) {
+	booking, ok := s.tripBooking(w, r)
+	if !ok {
+		return
+	}
+
+	now := time.Now().UTC().Truncate(time.Second)
+	switch {
+	case booking.PickedUpAt != nil:
+		http.Error(w, "The trip has already started", http.StatusConflict)
+		return
+	case now.Before(booking.StartTime.Add(-pickupEarly)):
+		http.Error(w, fmt.Sprintf("The vehicle can be picked up from %s", booking.StartTime.Add(-pickupEarly).Format(timeLayout)), http.StatusConflict)
+		return
+	case !now.Before(booking.EndTime):
+		http.Error(w, "The booking has ended", http.StatusConflict)
+		return
+	}
+
+	vehicle, err := s.store.Vehicles().Get(r.Context(), booking.VehicleID)
+	if err != nil {
+		log.Printf("Error fetching vehicle %d: %v", booking.VehicleID, err)
+		http.Error(w, "Error fetching vehicle", http.StatusInternalServerError)
+		return
+	}
+	if vehicle.Status == StatusMaintenance || vehicle.RetiredAt != nil {
+		http.Error(w, "The vehicle is out of service, please contact support", http.StatusConflict)
+		return
+	}
+
+	if err := s.commander.Unlock(r.Context(), booking.VehicleID); err != nil {
+		log.Printf("Error unlocking vehicle %d for booking %d: %v", booking.VehicleID, booking.BookingID, err)
+		http.Error(w, "Couldn't unlock the vehicle, please try again", http.StatusBadGateway)
+		return
+	}
+
+	err = s.store.InTx(r.Context(), func(vehicles VehicleStore, bookings BookingStore) error {
+		if err := bookings.StartTrip(r.Context(), booking.BookingID, TripReading{
+			At:          now,
+			OdometerKm:  vehicle.OdometerKm,
+			ChargeLevel: vehicle.ChargeLevel,
+		}); err != nil {
+			return err
+		}
+		return vehicles.SetStatus(r.Context(), booking.VehicleID, StatusBooked)
+	})
+	if err != nil {
+		s.relock(booking.VehicleID)
+		if errors.Is(err, errTripChanged) {
+			http.Error(w, "The trip has already started", http.StatusConflict)
+			return
+		}
+		log.Printf("Error starting trip for booking %d: %v", booking.BookingID, err)
+		http.Error(w, "Error starting trip", http.StatusInternalServerError)
+		return
+	}
+
+	started, err := s.store.Bookings().Get(r.Context(), booking.BookingID)
+	if err != nil {
+		log.Printf("Error fetching booking %d: %v", booking.BookingID, err)
+		started = booking
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"message": "Trip started, the vehicle is unlocked", "booking": started})
+}
+
+// Return the vehicle: lock it, record when, and its odometer and charge, then bill the trip
+// for the time actually used
+func (s *Server) endTripHandler(w http.ResponseWriter, r *http.Request) {
+	booking, ok := s.tripBooking(w, r)
+	if !ok {
+		return
+	}
+	if booking.PickedUpAt == nil {
+		http.Error(w, "The trip hasn't started", http.StatusConflict)
+		return
+	}
+
+	// Lock first: a trip only ends once the vehicle is secured
+	if err := s.commander.Lock(r.Context(), booking.VehicleID); err != nil {
+		log.Printf("Error locking vehicle %d for booking %d: %v", booking.VehicleID, booking.BookingID, err)
+		http.Error(w, "Couldn't lock the vehicle, make sure the doors are closed and try again", http.StatusBadGateway)
+		return
+	}
+
+	now := time.Now().UTC().Truncate(time.Second)
+	// The customer's booking after this one, if any, told when a late vehicle is back
+	var next *Booking
+	err := s.store.InTx(r.Context(), func(vehicles VehicleStore, bookings BookingStore) error {
+		// Locked so the readings are the latest telemetry
+		vehicle, err := vehicles.Lock(r.Context(), booking.VehicleID)
+		if err != nil {
+			return err
+		}
+		if err := bookings.EndTrip(r.Context(), booking.BookingID, TripReading{
+			At:          now,
+			OdometerKm:  vehicle.OdometerKm,
+			ChargeLevel: vehicle.ChargeLevel,
+		}); err != nil {
+			return err
+		}
+
+		// The vehicle is free again unless another booking has already begun
+		upcoming, err := bookings.ActiveForVehicle(r.Context(), booking.VehicleID)
+		if err != nil {
+			return err
+		}
+		if len(upcoming) == 0 || upcoming[0].StartTime.After(now) {
+			if err := vehicles.SetStatus(r.Context(), booking.VehicleID, StatusAvailable); err != nil {
+				return err
+			}
+		}
+		if len(upcoming) > 0 {
+			next = &upcoming[0]
+		}
+		return nil
+	})
+	if err != nil {
+		if errors.Is(err, errTripChanged) {
+			http.Error(w, "The trip has already ended", http.StatusConflict)
+			return
+		}
+		writeBookingError(w, err)
+		return
+	}
+
+	ended, err := s.store.Bookings().Get(r.Context(), booking.BookingID)
+	if err != nil {
+		log.Printf("Error fetching booking %d: %v", booking.BookingID, err)
+		returned := *booking
+		returned.Status, returned.ReturnedAt, returned.BillPending = StatusCompleted, &now, true
+		ended = &returned
+	}
+
+	// Billed once the trip is recorded, so the bill is never repriced for a trip that didn't
+	// end. If the billing service can't be reached the scheduler tries again.
+	message := "Trip ended, the vehicle is locked"
+	notice := fmt.Sprintf("Your trip with vehicle %d ended at %s.", booking.VehicleID, now.Format(timeLayout))
+	var quote json.RawMessage
+	bill, err := billTrip(r.Context(), s.billing, s.store.Bookings(), *ended, s.cfg.LateReturnGrace)
+	if err != nil {
+		log.Printf("Error billing the trip of booking %d, the scheduler will retry: %v", booking.BookingID, err)
+		message += ". Your bill will be updated shortly"
+	} else {
+		cost := bill.Bill.Cost()
+		ended.TotalCost, ended.BillPending, quote = &cost, false, bill.Quote
+		notice += " " + tripBillNotice(bill.Bill)
+	}
+
+	s.notifyAsync(booking.UserID, "Trip ended", notice)
+	if next != nil && now.After(booking.EndTime.Add(s.cfg.LateReturnGrace)) {
+		s.notifyAsync(next.UserID, "Your vehicle is back", fmt.Sprintf("Vehicle %d for your booking %d starting at %s has been returned.",
+			booking.VehicleID, next.BookingID, next.StartTime.Format(timeLayout)))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"message": message, "booking": ended, "quote": quote})
+}
+
+// What the customer is told about their trip's bill. A bill paid up front can still owe late
+// fees or the longer trip, which they pay from their bills.
+func tripBillNotice(bill clients.BillInfo) string {
+	notice := fmt.Sprintf("The total is $%.2f.", bill.Cost())
+	if bill.AmountDue > 0 {
+		notice += fmt.Sprintf(" $%.2f of it is still to pay, please pay it from your bills.", bill.AmountDue)
+	}
+	return notice
+}
+
+// Reprice the bill of an ended trip for the trip as taken and record what it cost. Repricing
+// to the same trip changes nothing, so this is safe to retry.
+func billTrip(ctx context.Context, billing Billing, bookings BookingStore, booking Booking, grace time.Duration) (*clients.BillResponse, error) {
+	// A trip is billed for at least a second so it has a window
+	end := *booking.ReturnedAt
+	if !end.After(*booking.PickedUpAt) {
+		end = booking.PickedUpAt.Add(time.Second)
+	}
+	bill, err := billing.UpdateBill(ctx, clients.BillRequest{
+		BookingID: booking.BookingID,
+		UserID:    booking.UserID,
+		VehicleID: booking.VehicleID,
+		StartTime: *booking.PickedUpAt,
+		EndTime:   end,
+		LateAfter: booking.EndTime.Add(grace),
+		Final:     true,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return bill, bookings.SetBilled(ctx, booking.BookingID, bill.Bill.Cost())
+}
@@ -0,0 +1,60 @@
+package vehicleservice
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestEndTrip(t *testing.T) {
+	tests := []struct {
+		name      string
+		updateErr error
+		// The bill is left pending for the scheduler when billing is down
+		wantPending bool
+	}{
+		{name: "billed straight away"},
+		{name: "billing unreachable", updateErr: errors.New("connection refused"), wantPending: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			ts := newTestServer(t)
+			ts.billing.updateErr = tt.updateErr
+			start := time.Now().UTC().Add(-time.Hour).Truncate(time.Second)
+			bookingID := ts.addBooking(t, testUserID, ts.available, start, start.Add(2*time.Hour))
+			if err := ts.store.Bookings().StartTrip(ctx, bookingID, TripReading{At: start, ChargeLevel: 100}); err != nil {
+				t.Fatal(err)
+			}
+
+			rec := ts.do(t, http.MethodPost, "/api/v1/booking/"+strconv.Itoa(bookingID)+"/end", testUserID, nil)
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status = %d: %s", rec.Code, rec.Body)
+			}
+
+			// The trip ends whether or not the bill could be updated
+			booking := ts.booking(t, bookingID)
+			if booking.Status != StatusCompleted || booking.BillPending != tt.wantPending {
+				t.Fatalf("booking = %s with bill pending %t, want %s with %t", booking.Status, booking.BillPending, StatusCompleted, tt.wantPending)
+			}
+			if !tt.wantPending {
+				if booking.TotalCost == nil || *booking.TotalCost != 10 {
+					t.Errorf("total cost = %v, want 10", booking.TotalCost)
+				}
+				return
+			}
+
+			// Once billing is back, the scheduler's retry bills the trip
+			ts.billing.updateErr = nil
+			if _, err := billTrip(ctx, ts.billing, ts.store.Bookings(), *booking, ts.cfg.LateReturnGrace); err != nil {
+				t.Fatal(err)
+			}
+			if booking := ts.booking(t, bookingID); booking.BillPending || booking.TotalCost == nil || *booking.TotalCost != 10 {
+				t.Errorf("after retry: bill pending %t with total cost %v, want billed at 10", booking.BillPending, booking.TotalCost)
+			}
+		})
+	}
+}